@@ -0,0 +1,335 @@
+package mp4
+
+// aacSampleRates maps samplingFrequencyIndex values to rates in Hz.
+var aacSampleRates = [13]uint32{
+	96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350,
+}
+
+// AudioSpecificConfig holds the leading fields of an MPEG-4
+// AudioSpecificConfig (ISO/IEC 14496-3 1.6.2.1), including explicit and
+// backward-compatible SBR/PS signalling.
+type AudioSpecificConfig struct {
+	ObjectType      uint8  // core audio object type (2 for the AAC-LC core of HE-AAC)
+	SampleRateIndex uint8  // 0x0f if the rate is explicit
+	SampleRate      uint32 // core sample rate in Hz
+	ChannelConfig   uint8  // 0 if defined by a program config element
+
+	// ExtensionObjectType is AOTSBR when SBR is signalled, explicitly or via
+	// the sync extension; 0 otherwise.
+	ExtensionObjectType uint8
+	SBR                 bool
+	PS                  bool
+	ExtensionSampleRate uint32 // SBR output sample rate, 0 if not signalled
+
+	// Explicit is true for hierarchical signalling, where the config starts
+	// with the SBR or PS object type.
+	Explicit bool
+
+	// ExtensionChannelConfig is the extensionChannelConfiguration of ER
+	// BSAC with explicit SBR signalling.
+	ExtensionChannelConfig uint8
+
+	// GASpecificConfig fields of the AAC object types (1-4, 6, 7, 17 and
+	// 19-23). They are zero for other object types and for configs with a
+	// program config element, whose specific configs are not parsed.
+	FrameLengthFlag    bool   // 960 or 120 samples per frame instead of 1024 or 128
+	DependsOnCoreCoder bool   // CoreCoderDelay is present
+	CoreCoderDelay     uint16 // in samples
+	LayerNr            uint8  // AAC scalable object types 6 and 20
+	NumOfSubFrame      uint8  // ER BSAC
+	LayerLength        uint16 // ER BSAC
+
+	// ResilienceFlags holds aacSectionDataResilienceFlag,
+	// aacScalefactorDataResilienceFlag and aacSpectralDataResilienceFlag as
+	// bits 2 to 0, for object types 17, 19, 20 and 23.
+	ResilienceFlags uint8
+
+	// EPConfig is the epConfig of the error resilient object types, which
+	// follows their specific config. Values 2 and 3 are followed by an
+	// ErrorProtectionSpecificConfig, which is not parsed.
+	EPConfig uint8
+}
+
+// isGAObjectType reports whether an object type uses GASpecificConfig.
+func isGAObjectType(aot uint8) bool {
+	switch aot {
+	case 1, 2, 3, 4, 6, 7, 17, 19, 20, 21, 22, 23:
+		return true
+	}
+	return false
+}
+
+// isERObjectType reports whether an object type is error resilient, with
+// an epConfig after its specific config.
+func isERObjectType(aot uint8) bool {
+	switch aot {
+	case 17, 19, 20, 21, 22, 23, 24, 25, 26, 27, 39:
+		return true
+	}
+	return false
+}
+
+// CodecObjectType returns the object type used in RFC 6381 codec strings:
+// AOTPS for HE-AAC v2, AOTSBR for HE-AAC, and the core type otherwise.
+func (c *AudioSpecificConfig) CodecObjectType() uint8 {
+	switch {
+	case c.PS:
+		return AOTPS
+	case c.SBR:
+		return AOTSBR
+	}
+	return c.ObjectType
+}
+
+// OutputSampleRate returns the decoded sample rate, which is the SBR rate
+// for HE-AAC streams.
+func (c *AudioSpecificConfig) OutputSampleRate() uint32 {
+	if c.SBR && c.ExtensionSampleRate != 0 {
+		return c.ExtensionSampleRate
+	}
+	return c.SampleRate
+}
+
+// Channels returns the output channel count for channel configurations
+// 1-7 and 11-14, or 0 if it is defined by a program config element.
+// Parametric stereo upmixes a mono core to two channels.
+func (c *AudioSpecificConfig) Channels() uint16 {
+	if c.PS && c.ChannelConfig == 1 {
+		return 2
+	}
+	switch c.ChannelConfig {
+	case 1, 2, 3, 4, 5, 6:
+		return uint16(c.ChannelConfig)
+	case 7:
+		return 8
+	case 11:
+		return 7
+	case 12, 14:
+		return 8
+	case 13:
+		return 24
+	}
+	return 0
+}
+
+// readAudioObjectType reads GetAudioObjectType() with the escape for
+// object types 32 and above.
+func readAudioObjectType(br *BitReader) uint8 {
+	aot := uint8(br.ReadBits(5))
+	if aot == 31 {
+		aot = 32 + uint8(br.ReadBits(6))
+	}
+	return aot
+}
+
+// readSampleRate reads samplingFrequencyIndex and the optional explicit rate.
+func readSampleRate(br *BitReader) (uint8, uint32) {
+	idx := uint8(br.ReadBits(4))
+	if idx == 0x0f {
+		return idx, br.ReadBits(24)
+	}
+	if int(idx) < len(aacSampleRates) {
+		return idx, aacSampleRates[idx]
+	}
+	return idx, 0
+}
+
+// ReadAudioSpecificConfig parses an AudioSpecificConfig from the
+// DecoderSpecificInfo of an esds box.
+func ReadAudioSpecificConfig(data []byte) (AudioSpecificConfig, error) {
+	var c AudioSpecificConfig
+	if len(data) < 2 {
+		return c, ErrTruncated
+	}
+	br := NewBitReader(data)
+	c.ObjectType = readAudioObjectType(&br)
+	c.SampleRateIndex, c.SampleRate = readSampleRate(&br)
+	c.ChannelConfig = uint8(br.ReadBits(4))
+
+	if c.ObjectType == AOTSBR || c.ObjectType == AOTPS {
+		c.Explicit = true
+		c.ExtensionObjectType = AOTSBR
+		c.SBR = true
+		c.PS = c.ObjectType == AOTPS
+		_, c.ExtensionSampleRate = readSampleRate(&br)
+		c.ObjectType = readAudioObjectType(&br)
+		if c.ObjectType == 22 { // ER BSAC
+			c.ExtensionChannelConfig = uint8(br.ReadBits(4))
+		}
+	}
+	if err := br.Err(); err != nil {
+		return c, err
+	}
+
+	// epConfig and backward-compatible SBR/PS signalling follow the
+	// specific config, so they can only be found when it has been parsed.
+	if !readGASpecificConfig(&br, &c) {
+		return c, nil
+	}
+	if isERObjectType(c.ObjectType) {
+		c.EPConfig = uint8(br.ReadBits(2))
+		if br.Err() != nil {
+			c.EPConfig = 0
+			return c, nil
+		}
+		if c.EPConfig >= 2 {
+			return c, nil
+		}
+	}
+	if c.Explicit {
+		return c, nil
+	}
+	if br.BitsLeft() >= 16 && br.ReadBits(11) == 0x2b7 {
+		if readAudioObjectType(&br) == AOTSBR {
+			if br.ReadFlag() { // sbrPresentFlag
+				c.ExtensionObjectType = AOTSBR
+				c.SBR = true
+				_, c.ExtensionSampleRate = readSampleRate(&br)
+				if br.BitsLeft() >= 12 && br.ReadBits(11) == 0x548 {
+					c.PS = br.ReadFlag()
+				}
+			}
+		}
+	}
+	if br.Err() != nil {
+		// A truncated sync extension is ignored rather than failing the
+		// whole config.
+		c.SBR, c.PS, c.ExtensionObjectType, c.ExtensionSampleRate = false, false, 0, 0
+	}
+	return c, nil
+}
+
+// readGASpecificConfig reads GASpecificConfig into c for the AAC object
+// types. Returns false, leaving c unchanged, if the object type has another
+// config syntax, the config uses a program config element or is truncated,
+// or it carries a version 3 extension.
+func readGASpecificConfig(br *BitReader, c *AudioSpecificConfig) bool {
+	if !isGAObjectType(c.ObjectType) || c.ChannelConfig == 0 {
+		return false
+	}
+	g := *c
+	g.FrameLengthFlag = br.ReadFlag()
+	g.DependsOnCoreCoder = br.ReadFlag()
+	if g.DependsOnCoreCoder {
+		g.CoreCoderDelay = uint16(br.ReadBits(14))
+	}
+	extensionFlag := br.ReadFlag()
+	if g.ObjectType == 6 || g.ObjectType == 20 {
+		g.LayerNr = uint8(br.ReadBits(3))
+	}
+	if extensionFlag {
+		if g.ObjectType == 22 {
+			g.NumOfSubFrame = uint8(br.ReadBits(5))
+			g.LayerLength = uint16(br.ReadBits(11))
+		}
+		switch g.ObjectType {
+		case 17, 19, 20, 23:
+			g.ResilienceFlags = uint8(br.ReadBits(3))
+		}
+		if br.ReadFlag() { // extensionFlag3
+			return false
+		}
+	}
+	if br.Err() != nil {
+		return false
+	}
+	*c = g
+	return true
+}
+
+// Bytes encodes the config for use as DecoderSpecificInfo. SBR and PS are
+// written with explicit hierarchical signalling; without an
+// ExtensionSampleRate, the SBR output rate is written as twice the core
+// rate, as HE-AAC is normally configured. Only the AAC object types
+// with a GASpecificConfig can be encoded: Bytes returns nil for other
+// object types, for configs with a program config element (ChannelConfig
+// 0), and for an EPConfig of 2 or 3.
+func (c *AudioSpecificConfig) Bytes() []byte {
+	if !isGAObjectType(c.ObjectType) || c.ChannelConfig == 0 || c.EPConfig >= 2 {
+		return nil
+	}
+	var bw bitWriter
+	aot := c.ObjectType
+	if c.SBR {
+		aot = AOTSBR
+		if c.PS {
+			aot = AOTPS
+		}
+	}
+	putAudioObjectType(&bw, aot)
+	putSampleRate(&bw, c.SampleRateIndex, c.SampleRate)
+	bw.put(uint64(c.ChannelConfig), 4)
+	if c.SBR {
+		rate := c.ExtensionSampleRate
+		if rate == 0 {
+			rate = 2 * c.SampleRate
+			if rate == 0 && int(c.SampleRateIndex) < len(aacSampleRates) {
+				rate = 2 * aacSampleRates[c.SampleRateIndex]
+			}
+		}
+		putSampleRate(&bw, 0x0f, rate)
+		putAudioObjectType(&bw, c.ObjectType)
+		if c.ObjectType == 22 {
+			bw.put(uint64(c.ExtensionChannelConfig), 4)
+		}
+	}
+
+	bw.put(boolBit(c.FrameLengthFlag), 1)
+	bw.put(boolBit(c.DependsOnCoreCoder), 1)
+	if c.DependsOnCoreCoder {
+		bw.put(uint64(c.CoreCoderDelay), 14)
+	}
+	// extensionFlag is set for the error resilient object types only.
+	er := isERObjectType(c.ObjectType)
+	bw.put(boolBit(er), 1)
+	if c.ObjectType == 6 || c.ObjectType == 20 {
+		bw.put(uint64(c.LayerNr), 3)
+	}
+	if er {
+		if c.ObjectType == 22 {
+			bw.put(uint64(c.NumOfSubFrame), 5)
+			bw.put(uint64(c.LayerLength), 11)
+		}
+		switch c.ObjectType {
+		case 17, 19, 20, 23:
+			bw.put(uint64(c.ResilienceFlags), 3)
+		}
+		bw.put(0, 1) // extensionFlag3
+		bw.put(uint64(c.EPConfig), 2)
+	}
+	return bw.bytes()
+}
+
+func boolBit(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// putAudioObjectType writes an audio object type with the escape code.
+func putAudioObjectType(bw *bitWriter, aot uint8) {
+	if aot >= 32 {
+		bw.put(31, 5)
+		bw.put(uint64(aot-32), 6)
+		return
+	}
+	bw.put(uint64(aot), 5)
+}
+
+// putSampleRate writes a sampling frequency index, using the index for rate
+// if it is in the table and falling back to an explicit 24-bit rate.
+func putSampleRate(bw *bitWriter, idx uint8, rate uint32) {
+	if idx < 0x0f && int(idx) < len(aacSampleRates) && (rate == 0 || aacSampleRates[idx] == rate) {
+		bw.put(uint64(idx), 4)
+		return
+	}
+	for i, r := range aacSampleRates {
+		if r == rate {
+			bw.put(uint64(i), 4)
+			return
+		}
+	}
+	bw.put(0x0f, 4)
+	bw.put(uint64(rate), 24)
+}
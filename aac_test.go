@@ -0,0 +1,132 @@
+package mp4_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/tetsuo/mp4"
+)
+
+func TestAudioSpecificConfigRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want mp4.AudioSpecificConfig
+	}{
+		{
+			name: "AAC-LC",
+			data: []byte{0x12, 0x10},
+			want: mp4.AudioSpecificConfig{ObjectType: 2, SampleRateIndex: 4, SampleRate: 44100, ChannelConfig: 2},
+		},
+		{
+			name: "HE-AAC v2 explicit",
+			data: []byte{0xeb, 0x09, 0x88, 0x00},
+			want: mp4.AudioSpecificConfig{
+				ObjectType: 2, SampleRateIndex: 6, SampleRate: 24000, ChannelConfig: 1,
+				ExtensionObjectType: mp4.AOTSBR, SBR: true, PS: true, ExtensionSampleRate: 48000,
+				Explicit: true,
+			},
+		},
+		{
+			name: "ER AAC-LD",
+			data: []byte{0xb9, 0x8d, 0xe4},
+			want: mp4.AudioSpecificConfig{
+				ObjectType: 23, SampleRateIndex: 3, SampleRate: 48000, ChannelConfig: 1,
+				FrameLengthFlag: true, ResilienceFlags: 7, EPConfig: 1,
+			},
+		},
+		{
+			name: "ER BSAC",
+			data: []byte{0xb1, 0x11, 0x38, 0x01, 0x20},
+			want: mp4.AudioSpecificConfig{
+				ObjectType: 22, SampleRateIndex: 2, SampleRate: 64000, ChannelConfig: 2,
+				NumOfSubFrame: 7, LayerLength: 1, EPConfig: 1,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mp4.ReadAudioSpecificConfig(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if b := got.Bytes(); !bytes.Equal(b, tt.data) {
+				t.Errorf("Bytes = % x, want % x", b, tt.data)
+			}
+		})
+	}
+}
+
+func TestAudioSpecificConfigSyncExtension(t *testing.T) {
+	// AAC-LC at 24 kHz with backward-compatible SBR signalling of 48 kHz.
+	c, err := mp4.ReadAudioSpecificConfig([]byte{0x13, 0x10, 0x56, 0xe5, 0x98})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.SBR || c.Explicit || c.ExtensionSampleRate != 48000 {
+		t.Errorf("got %+v, want implicit SBR at 48000 Hz", c)
+	}
+	if aot := c.CodecObjectType(); aot != mp4.AOTSBR {
+		t.Errorf("codec object type = %d, want %d", aot, mp4.AOTSBR)
+	}
+}
+
+func TestAudioSpecificConfigBytesSBRRate(t *testing.T) {
+	// Without an extension rate, SBR doubles the core rate.
+	for _, c := range []mp4.AudioSpecificConfig{
+		{ObjectType: 2, SampleRateIndex: 6, SampleRate: 24000, ChannelConfig: 2, SBR: true},
+		{ObjectType: 2, SampleRateIndex: 6, ChannelConfig: 2, SBR: true},
+	} {
+		got, err := mp4.ReadAudioSpecificConfig(c.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.SBR || got.ExtensionSampleRate != 48000 || got.OutputSampleRate() != 48000 {
+			t.Errorf("got %+v, want SBR at 48000 Hz", got)
+		}
+	}
+}
+
+func TestAudioSpecificConfigBytesUnsupported(t *testing.T) {
+	for _, c := range []mp4.AudioSpecificConfig{
+		{ObjectType: 39, SampleRateIndex: 3, ChannelConfig: 2}, // ER AAC-ELD
+		{ObjectType: 2, SampleRateIndex: 3},                    // program config element
+		{ObjectType: 23, SampleRateIndex: 3, ChannelConfig: 1, EPConfig: 2},
+	} {
+		if b := c.Bytes(); b != nil {
+			t.Errorf("object type %d: Bytes = % x, want nil", c.ObjectType, b)
+		}
+	}
+}
+
+func TestEsdsRoundTrip(t *testing.T) {
+	d := mp4.ESDescriptor{
+		ESID:          2,
+		DependsOnESID: 1,
+		URL:           "http://example.com/es",
+		OCRESID:       3,
+		DecoderConfig: mp4.DecoderConfigDescriptor{
+			ObjectTypeIndication: mp4.OTIMPEG4Audio,
+			StreamType:           5,
+			BufferSizeDB:         6144,
+			MaxBitrate:           160000,
+			AvgBitrate:           128000,
+			DecoderSpecificInfo:  []byte{0xeb, 0x09, 0x88, 0x00},
+		},
+	}
+	r := writeBox(t, func(w *mp4.Writer) { w.WriteEsds(d) })
+	got, err := mp4.ReadEsds(r.Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, d) {
+		t.Errorf("got %+v, want %+v", got, d)
+	}
+	if c := got.Codec(); c != "40.29" {
+		t.Errorf("codec = %q, want 40.29 for HE-AAC v2", c)
+	}
+}
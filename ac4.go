@@ -0,0 +1,143 @@
+package mp4
+
+// AC4Presentation is one presentation of an AC-4 decoder specific info.
+// MDCompat and the channel fields are zero for presentation_config 6
+// (additional EMDF substreams only).
+type AC4Presentation struct {
+	Version  uint8 // presentation_version
+	Config   uint8 // presentation_config (5 bits)
+	MDCompat uint8 // decoder compatibility level (3 bits)
+
+	// ChannelCoded reports whether the presentation is channel based, in
+	// which case ChannelMode is its dsi_presentation_ch_mode. Only version
+	// 1 and 2 presentations signal this.
+	ChannelCoded    bool
+	ChannelMode     uint8
+	BackChannels4   bool   // pres_b_4_back_channels_present, for modes 11-14
+	TopChannelPairs uint8  // pres_top_channel_pairs, for modes 11-14
+	ChannelMask     uint32 // presentation_channel_mask_v1 (24 bits)
+}
+
+// AC4Config holds the fields of a dac4 box (ETSI TS 103 190-2 Annex E)
+// needed to describe the stream. Substream group details are not decoded.
+type AC4Config struct {
+	DSIVersion       uint8
+	BitstreamVersion uint8
+	FSIndex          uint8 // 0 for 44.1 kHz, 1 for 48 kHz
+	FrameRateIndex   uint8
+	Presentations    []AC4Presentation
+}
+
+// ReadAC4Config parses dac4 box data (ac4_dsi_v1). Presentations are read
+// up to the first one that is truncated.
+func ReadAC4Config(data []byte) (AC4Config, error) {
+	var c AC4Config
+	br := NewBitReader(data)
+	c.DSIVersion = uint8(br.ReadBits(3))
+	c.BitstreamVersion = uint8(br.ReadBits(7))
+	c.FSIndex = uint8(br.ReadBits(1))
+	c.FrameRateIndex = uint8(br.ReadBits(4))
+	n := int(br.ReadBits(9))
+	if c.BitstreamVersion > 1 && br.ReadFlag() { // b_program_id
+		br.Skip(16)        // short_program_id
+		if br.ReadFlag() { // b_uuid
+			br.Skip(128)
+		}
+	}
+	br.Skip(2 + 32 + 32) // ac4_bitrate_dsi
+	br.ByteAlign()
+	if err := br.Err(); err != nil {
+		return c, err
+	}
+
+	for range n {
+		var p AC4Presentation
+		p.Version = uint8(br.ReadBits(8))
+		size := int(br.ReadBits(8))
+		if size == 255 {
+			size += int(br.ReadBits(16))
+		}
+		end := br.Pos() + size*8
+		if err := br.Err(); err != nil || end > len(data)*8 {
+			return c, ErrTruncated
+		}
+		if p.Version <= 2 {
+			p.Config = uint8(br.ReadBits(5))
+			if p.Config != 6 {
+				p.MDCompat = uint8(br.ReadBits(3))
+				if br.ReadFlag() { // b_presentation_id
+					br.Skip(5)
+				}
+				if p.Version == 0 {
+					br.Skip(2 + 5 + 10) // frame rate multiply, EMDF version, key ID
+					p.ChannelMask = br.ReadBits(24)
+				} else {
+					br.Skip(2 + 2 + 5 + 10) // frame rate multiply and fraction, EMDF version, key ID
+					p.ChannelCoded = br.ReadFlag()
+					if p.ChannelCoded {
+						p.ChannelMode = uint8(br.ReadBits(5))
+						if p.ChannelMode >= 11 && p.ChannelMode <= 14 {
+							p.BackChannels4 = br.ReadFlag()
+							p.TopChannelPairs = uint8(br.ReadBits(2))
+						}
+						p.ChannelMask = br.ReadBits(24)
+					}
+				}
+			}
+		}
+		if err := br.Err(); err != nil || br.Pos() > end {
+			return c, ErrTruncated
+		}
+		br.Skip(end - br.Pos())
+		c.Presentations = append(c.Presentations, p)
+	}
+	return c, nil
+}
+
+// SampleRate returns the sampling frequency in Hz.
+func (c *AC4Config) SampleRate() uint32 {
+	if c.FSIndex == 0 {
+		return 44100
+	}
+	return 48000
+}
+
+// Codec returns the codec string suffix after "ac-4.", the bitstream
+// version and the first presentation's version and compatibility level as
+// two-digit hex numbers, like "02.01.03". Returns "" if the config has no
+// presentations.
+func (c *AC4Config) Codec() string {
+	if len(c.Presentations) == 0 {
+		return ""
+	}
+	p := &c.Presentations[0]
+	return string([]byte{
+		hexDigit(c.BitstreamVersion >> 4), hexDigit(c.BitstreamVersion), '.',
+		hexDigit(p.Version >> 4), hexDigit(p.Version), '.',
+		hexDigit(p.MDCompat >> 4), hexDigit(p.MDCompat),
+	})
+}
+
+// ac4ChannelModeChannels is the channel count of each
+// dsi_presentation_ch_mode, indexed by mode. Modes 11-14 are given with
+// four back channels and two top channel pairs.
+var ac4ChannelModeChannels = [...]uint8{1, 2, 3, 5, 6, 7, 8, 7, 8, 7, 8, 11, 12, 13, 14, 24}
+
+// Channels returns the number of channels of the first channel-coded
+// presentation, or 0 if there is none.
+func (c *AC4Config) Channels() int {
+	for _, p := range c.Presentations {
+		if !p.ChannelCoded || int(p.ChannelMode) >= len(ac4ChannelModeChannels) {
+			continue
+		}
+		n := int(ac4ChannelModeChannels[p.ChannelMode])
+		if p.ChannelMode >= 11 && p.ChannelMode <= 14 {
+			if !p.BackChannels4 {
+				n -= 2
+			}
+			n -= 4 - 2*int(p.TopChannelPairs)
+		}
+		return n
+	}
+	return 0
+}
@@ -0,0 +1,89 @@
+package mp4_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tetsuo/mp4"
+)
+
+// testDac4 is an ac4_dsi_v1 at 48 kHz with a 5.1 channel-coded
+// presentation and an EMDF-only one.
+var testDac4 = packBits(
+	"001 0000010 1 0001 000000010 0" + // dsi v1, bitstream version 2, 48 kHz, two presentations, no program id
+		strings.Repeat("0", 66) + "00000" + // ac4_bitrate_dsi, byte_align
+		"00000001 00001000" + // presentation_version 1, 8 bytes
+		"00000 011 0" + strings.Repeat("0", 19) + // presentation_config 0, mdcompat 3, no presentation id
+		"1 00100 000000000000000001000111 000000" + // channel coded, 5.1, channel mask, padding
+		"00000001 00000001 00110 000") // presentation_version 1, 1 byte, presentation_config 6
+
+func TestReadAC4Config(t *testing.T) {
+	c, err := mp4.ReadAC4Config(testDac4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := mp4.AC4Config{
+		DSIVersion:       1,
+		BitstreamVersion: 2,
+		FSIndex:          1,
+		FrameRateIndex:   1,
+		Presentations: []mp4.AC4Presentation{
+			{Version: 1, Config: 0, MDCompat: 3, ChannelCoded: true, ChannelMode: 4, ChannelMask: 0x47},
+			{Version: 1, Config: 6},
+		},
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("got %+v, want %+v", c, want)
+	}
+	if s := c.Codec(); s != "02.01.03" {
+		t.Errorf("codec = %q, want 02.01.03", s)
+	}
+	if c.SampleRate() != 48000 || c.Channels() != 6 {
+		t.Errorf("rate %d, channels %d, want 48000 and 6", c.SampleRate(), c.Channels())
+	}
+
+	// Presentations before a truncated one are kept.
+	c, err = mp4.ReadAC4Config(testDac4[:len(testDac4)-1])
+	if err != mp4.ErrTruncated || len(c.Presentations) != 1 {
+		t.Errorf("truncated: %d presentations, err %v", len(c.Presentations), err)
+	}
+}
+
+func TestAC4Channels(t *testing.T) {
+	tests := []struct {
+		p    mp4.AC4Presentation
+		want int
+	}{
+		{mp4.AC4Presentation{ChannelCoded: true, ChannelMode: 1}, 2},
+		{mp4.AC4Presentation{ChannelCoded: true, ChannelMode: 11, BackChannels4: true, TopChannelPairs: 2}, 11},
+		{mp4.AC4Presentation{ChannelCoded: true, ChannelMode: 11, TopChannelPairs: 1}, 7},
+		{mp4.AC4Presentation{}, 0},
+	}
+	for _, tt := range tests {
+		c := mp4.AC4Config{Presentations: []mp4.AC4Presentation{tt.p}}
+		if n := c.Channels(); n != tt.want {
+			t.Errorf("%+v: channels = %d, want %d", tt.p, n, tt.want)
+		}
+	}
+}
+
+func TestMhaCRoundTrip(t *testing.T) {
+	want := mp4.MHAConfig{
+		ConfigurationVersion:   1,
+		ProfileLevelIndication: 0x0d,
+		ReferenceChannelLayout: 6,
+		Config:                 []byte{0x01, 0x02, 0x03},
+	}
+	r := writeBox(t, func(w *mp4.Writer) { w.WriteMhaC(want) })
+	c, err := mp4.ReadMhaC(r.Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("got %+v, want %+v", c, want)
+	}
+	if c.Codec() != "0x0D" || c.Channels() != 6 {
+		t.Errorf("codec %q, channels %d, want 0x0D and 6", c.Codec(), c.Channels())
+	}
+}
@@ -0,0 +1,61 @@
+package mp4
+
+// alacConfigSize is the size of ALACSpecificConfig.
+const alacConfigSize = 24
+
+// AlacConfig holds the ALACSpecificConfig carried in the alac box nested
+// inside an alac sample entry.
+type AlacConfig struct {
+	FrameLength       uint32 // samples per frame
+	CompatibleVersion uint8
+	BitDepth          uint8
+	PB                uint8 // Rice tuning: history multiplier
+	MB                uint8 // Rice tuning: initial history
+	KB                uint8 // Rice tuning: maximum k
+	NumChannels       uint8
+	MaxRun            uint16
+	MaxFrameBytes     uint32
+	AvgBitRate        uint32
+	SampleRate        uint32 // in Hz, not limited to 16 bits
+}
+
+// ReadAlacConfig parses the data of the alac config box.
+// The alac type is shared with the sample entry, so the Reader does not
+// treat it as a full box; data must start with the 4-byte version+flags.
+func ReadAlacConfig(data []byte) (AlacConfig, error) {
+	if len(data) < 4+alacConfigSize {
+		return AlacConfig{}, ErrTruncated
+	}
+	d := data[4:]
+	return AlacConfig{
+		FrameLength:       be.Uint32(d[0:4]),
+		CompatibleVersion: d[4],
+		BitDepth:          d[5],
+		PB:                d[6],
+		MB:                d[7],
+		KB:                d[8],
+		NumChannels:       d[9],
+		MaxRun:            be.Uint16(d[10:12]),
+		MaxFrameBytes:     be.Uint32(d[12:16]),
+		AvgBitRate:        be.Uint32(d[16:20]),
+		SampleRate:        be.Uint32(d[20:24]),
+	}, nil
+}
+
+// WriteAlacConfig writes a complete alac config box (version 0).
+// The caller must start the alac sample entry and end it afterwards.
+func (w *Writer) WriteAlacConfig(c AlacConfig) {
+	w.StartFullBox(TypeAlac, 0, 0)
+	w.putUint32(c.FrameLength)
+	w.putUint8(c.CompatibleVersion)
+	w.putUint8(c.BitDepth)
+	w.putUint8(c.PB)
+	w.putUint8(c.MB)
+	w.putUint8(c.KB)
+	w.putUint8(c.NumChannels)
+	w.putUint16(c.MaxRun)
+	w.putUint32(c.MaxFrameBytes)
+	w.putUint32(c.AvgBitRate)
+	w.putUint32(c.SampleRate)
+	w.EndBox()
+}
@@ -0,0 +1,99 @@
+package mp4
+
+import "strconv"
+
+// AV1Config holds a parsed AV1CodecConfigurationRecord (av1C box data).
+type AV1Config struct {
+	SeqProfile           uint8
+	SeqLevelIdx0         uint8
+	SeqTier0             bool // true for High tier
+	HighBitdepth         bool
+	TwelveBit            bool
+	Monochrome           bool
+	ChromaSubsamplingX   bool
+	ChromaSubsamplingY   bool
+	ChromaSamplePosition uint8
+
+	// InitialPresentationDelay is initial_presentation_delay_minus_one + 1,
+	// 0 if not present.
+	InitialPresentationDelay uint8
+
+	// ConfigOBUs holds the sequence header and metadata OBUs, if any.
+	ConfigOBUs []byte
+}
+
+// ReadAV1Config parses av1C box data.
+func ReadAV1Config(data []byte) (AV1Config, error) {
+	var c AV1Config
+	if len(data) < 4 {
+		return c, ErrTruncated
+	}
+	c.SeqProfile = data[1] >> 5
+	c.SeqLevelIdx0 = data[1] & 0x1f
+	c.SeqTier0 = data[2]&0x80 != 0
+	c.HighBitdepth = data[2]&0x40 != 0
+	c.TwelveBit = data[2]&0x20 != 0
+	c.Monochrome = data[2]&0x10 != 0
+	c.ChromaSubsamplingX = data[2]&0x08 != 0
+	c.ChromaSubsamplingY = data[2]&0x04 != 0
+	c.ChromaSamplePosition = data[2] & 0x03
+	if data[3]&0x10 != 0 {
+		c.InitialPresentationDelay = data[3]&0x0f + 1
+	}
+	c.ConfigOBUs = data[4:]
+	return c, nil
+}
+
+// BitDepth returns the bit depth of each colour component: 8, 10 or 12.
+func (c *AV1Config) BitDepth() uint8 {
+	switch {
+	case c.HighBitdepth && c.TwelveBit:
+		return 12
+	case c.HighBitdepth:
+		return 10
+	}
+	return 8
+}
+
+// Codec returns the codec string suffix for av01, e.g. "0.04M.08".
+func (c *AV1Config) Codec() string {
+	buf := make([]byte, 0, 16)
+	buf = strconv.AppendUint(buf, uint64(c.SeqProfile), 10)
+	buf = append(buf, '.')
+	if c.SeqLevelIdx0 < 10 {
+		buf = append(buf, '0')
+	}
+	buf = strconv.AppendUint(buf, uint64(c.SeqLevelIdx0), 10)
+	if c.SeqTier0 {
+		buf = append(buf, 'H')
+	} else {
+		buf = append(buf, 'M')
+	}
+	buf = append(buf, '.')
+	if c.BitDepth() < 10 {
+		buf = append(buf, '0')
+	}
+	buf = strconv.AppendUint(buf, uint64(c.BitDepth()), 10)
+	return string(buf)
+}
+
+// WriteAv1C writes a complete av1C box.
+func (w *Writer) WriteAv1C(c AV1Config) {
+	w.StartBox(TypeAv1C)
+	w.putUint8(0x81) // marker, version 1
+	w.putUint8(c.SeqProfile<<5 | c.SeqLevelIdx0&0x1f)
+	b := c.ChromaSamplePosition & 0x03
+	for i, f := range [...]bool{c.SeqTier0, c.HighBitdepth, c.TwelveBit, c.Monochrome, c.ChromaSubsamplingX, c.ChromaSubsamplingY} {
+		if f {
+			b |= 0x80 >> i
+		}
+	}
+	w.putUint8(b)
+	if c.InitialPresentationDelay > 0 {
+		w.putUint8(0x10 | (c.InitialPresentationDelay-1)&0x0f)
+	} else {
+		w.putUint8(0)
+	}
+	w.putBytes(c.ConfigOBUs)
+	w.EndBox()
+}
@@ -0,0 +1,115 @@
+package mp4_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tetsuo/mp4"
+)
+
+func TestAv1CRoundTrip(t *testing.T) {
+	tests := []struct {
+		c     mp4.AV1Config
+		codec string
+		depth uint8
+	}{
+		{
+			c: mp4.AV1Config{
+				SeqLevelIdx0: 8, ChromaSubsamplingX: true, ChromaSubsamplingY: true,
+				ConfigOBUs: []byte{0x0a, 0x0b, 0x00, 0x00, 0x00, 0x42, 0xab, 0xbf, 0xc3, 0x70, 0x0b, 0xe0},
+			},
+			codec: "0.08M.08",
+			depth: 8,
+		},
+		{
+			c: mp4.AV1Config{
+				SeqProfile: 2, SeqLevelIdx0: 13, SeqTier0: true, HighBitdepth: true, TwelveBit: true,
+				Monochrome: true, ChromaSamplePosition: 2, InitialPresentationDelay: 4, ConfigOBUs: []byte{},
+			},
+			codec: "2.13H.12",
+			depth: 12,
+		},
+		{
+			c:     mp4.AV1Config{SeqProfile: 1, SeqLevelIdx0: 31, HighBitdepth: true, ConfigOBUs: []byte{}},
+			codec: "1.31M.10",
+			depth: 10,
+		},
+	}
+	for _, tt := range tests {
+		r := writeBox(t, func(w *mp4.Writer) { w.WriteAv1C(tt.c) })
+		c, err := mp4.ReadAV1Config(r.Data())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(c, tt.c) {
+			t.Errorf("got %+v, want %+v", c, tt.c)
+		}
+		if s := c.Codec(); s != tt.codec {
+			t.Errorf("codec = %q, want %q", s, tt.codec)
+		}
+		if d := c.BitDepth(); d != tt.depth {
+			t.Errorf("bit depth = %d, want %d", d, tt.depth)
+		}
+	}
+}
+
+func TestPixiRoundTrip(t *testing.T) {
+	want := mp4.PixelInformation{BitsPerChannel: []uint8{10, 10, 10}}
+	r := writeBox(t, func(w *mp4.Writer) { w.WritePixi(want) })
+	p, err := mp4.ReadPixi(r.Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("got %+v, want %+v", p, want)
+	}
+	if _, err := mp4.ReadPixi([]byte{3, 8, 8}); err != mp4.ErrTruncated {
+		t.Errorf("short pixi: err = %v, want %v", err, mp4.ErrTruncated)
+	}
+}
+
+func TestAuxCRoundTrip(t *testing.T) {
+	tests := []struct {
+		a     mp4.AuxiliaryType
+		alpha bool
+	}{
+		{mp4.AuxiliaryType{Type: mp4.AuxTypeAlpha, Subtype: []byte{}}, true},
+		{mp4.AuxiliaryType{Type: mp4.AuxTypeHEVCAlpha, Subtype: []byte{}}, true},
+		{mp4.AuxiliaryType{Type: mp4.AuxTypeDepth, Subtype: []byte{0x01, 0x02}}, false},
+	}
+	for _, tt := range tests {
+		r := writeBox(t, func(w *mp4.Writer) { w.WriteAuxC(tt.a) })
+		a, err := mp4.ReadAuxC(r.Data())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(a, tt.a) {
+			t.Errorf("got %+v, want %+v", a, tt.a)
+		}
+		if a.IsAlpha() != tt.alpha {
+			t.Errorf("%s: alpha = %v, want %v", a.Type, a.IsAlpha(), tt.alpha)
+		}
+	}
+}
+
+func TestImageGridRoundTrip(t *testing.T) {
+	for _, tt := range []struct {
+		g    mp4.ImageGrid
+		size int
+	}{
+		{mp4.ImageGrid{Rows: 2, Columns: 3, OutputWidth: 1500, OutputHeight: 1000}, 8},
+		{mp4.ImageGrid{Rows: 256, Columns: 1, OutputWidth: 512, OutputHeight: 70000}, 12},
+	} {
+		data := mp4.AppendImageGrid(nil, tt.g)
+		if len(data) != tt.size {
+			t.Errorf("%+v: %d bytes, want %d", tt.g, len(data), tt.size)
+		}
+		g, err := mp4.ReadImageGrid(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g != tt.g {
+			t.Errorf("got %+v, want %+v", g, tt.g)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package mp4
+
+import "errors"
+
+// ErrInvalidNALLength is returned when a length-prefixed sample is malformed
+// or the NAL unit length size is not 1, 2 or 4.
+var ErrInvalidNALLength = errors.New("mp4: invalid NAL unit length")
+
+// AVCConfig holds a parsed AVCDecoderConfigurationRecord (avcC box data).
+type AVCConfig struct {
+	ConfigurationVersion uint8
+	Profile              uint8 // AVCProfileIndication (profile_idc)
+	ProfileCompatibility uint8 // constraint_set flags
+	Level                uint8 // AVCLevelIndication (level_idc)
+	NALLengthSize        uint8 // bytes per NAL unit length prefix: 1, 2 or 4
+	SPS                  [][]byte
+	PPS                  [][]byte
+
+	// High profile extension, present for profile_idc 100, 110, 122 and 144.
+	HasExt         bool
+	ChromaFormat   uint8 // chroma_format_idc
+	BitDepthLuma   uint8 // bit_depth_luma_minus8 + 8
+	BitDepthChroma uint8 // bit_depth_chroma_minus8 + 8
+	SPSExt         [][]byte
+}
+
+// avcHasExt reports whether avcC records for the profile carry the
+// chroma/bit-depth extension.
+func avcHasExt(profile uint8) bool {
+	switch profile {
+	case 100, 110, 122, 144:
+		return true
+	}
+	return false
+}
+
+// ReadAVCConfig parses avcC box data. Parameter set slices point into data.
+// The high profile extension is optional in practice; it is decoded only if
+// the profile requires it and bytes remain after the PPS list.
+func ReadAVCConfig(data []byte) (AVCConfig, error) {
+	var c AVCConfig
+	if len(data) < 7 {
+		return c, ErrTruncated
+	}
+	c.ConfigurationVersion = data[0]
+	c.Profile = data[1]
+	c.ProfileCompatibility = data[2]
+	c.Level = data[3]
+	c.NALLengthSize = data[4]&0x03 + 1
+
+	ptr := 5
+	var ok bool
+	c.SPS, ptr, ok = readParameterSets(data, ptr, int(data[ptr]&0x1f))
+	if !ok || ptr >= len(data) {
+		return c, ErrTruncated
+	}
+	c.PPS, ptr, ok = readParameterSets(data, ptr, int(data[ptr]))
+	if !ok {
+		return c, ErrTruncated
+	}
+
+	if avcHasExt(c.Profile) && ptr+4 <= len(data) {
+		c.HasExt = true
+		c.ChromaFormat = data[ptr] & 0x03
+		c.BitDepthLuma = data[ptr+1]&0x07 + 8
+		c.BitDepthChroma = data[ptr+2]&0x07 + 8
+		ptr += 3
+		c.SPSExt, _, ok = readParameterSets(data, ptr, int(data[ptr]))
+		if !ok {
+			return c, ErrTruncated
+		}
+	}
+	return c, nil
+}
+
+// readParameterSets reads count 16-bit length-prefixed NAL units starting
+// after the count byte at ptr. Returns the units and the position after them.
+func readParameterSets(data []byte, ptr, count int) ([][]byte, int, bool) {
+	ptr++ // count byte
+	var sets [][]byte
+	for range count {
+		if ptr+2 > len(data) {
+			return sets, ptr, false
+		}
+		n := int(be.Uint16(data[ptr:]))
+		ptr += 2
+		if ptr+n > len(data) {
+			return sets, ptr, false
+		}
+		sets = append(sets, data[ptr:ptr+n])
+		ptr += n
+	}
+	return sets, ptr, true
+}
+
+// Codec returns the RFC 6381 profile string like "64001f".
+func (c *AVCConfig) Codec() string {
+	var buf [6]byte
+	buf[0] = hexDigit(c.Profile >> 4)
+	buf[1] = hexDigit(c.Profile & 0x0f)
+	buf[2] = hexDigit(c.ProfileCompatibility >> 4)
+	buf[3] = hexDigit(c.ProfileCompatibility & 0x0f)
+	buf[4] = hexDigit(c.Level >> 4)
+	buf[5] = hexDigit(c.Level & 0x0f)
+	return string(buf[:])
+}
+
+// AppendParameterSets appends the SPS, SPS extension and PPS NAL units to dst
+// in Annex B format, each preceded by a 4-byte start code. Decoders expect
+// them in front of the first IDR access unit of an Annex B stream.
+func (c *AVCConfig) AppendParameterSets(dst []byte) []byte {
+	for _, s := range c.SPS {
+		dst = append(dst, 0, 0, 0, 1)
+		dst = append(dst, s...)
+	}
+	for _, s := range c.SPSExt {
+		dst = append(dst, 0, 0, 0, 1)
+		dst = append(dst, s...)
+	}
+	for _, s := range c.PPS {
+		dst = append(dst, 0, 0, 0, 1)
+		dst = append(dst, s...)
+	}
+	return dst
+}
+
+// AppendAnnexB converts a sample of length-prefixed NAL units to Annex B
+// format and appends it to dst. lengthSize is the NAL length size from the
+// decoder configuration record.
+func AppendAnnexB(dst, sample []byte, lengthSize int) ([]byte, error) {
+	if lengthSize != 1 && lengthSize != 2 && lengthSize != 4 {
+		return dst, ErrInvalidNALLength
+	}
+	ptr := 0
+	for ptr < len(sample) {
+		if ptr+lengthSize > len(sample) {
+			return dst, ErrInvalidNALLength
+		}
+		var n int
+		for i := range lengthSize {
+			n = n<<8 | int(sample[ptr+i])
+		}
+		ptr += lengthSize
+		if n > len(sample)-ptr {
+			return dst, ErrInvalidNALLength
+		}
+		dst = append(dst, 0, 0, 0, 1)
+		dst = append(dst, sample[ptr:ptr+n]...)
+		ptr += n
+	}
+	return dst, nil
+}
+
+// WriteAvcC writes a complete avcC box. The extension fields are written for
+// high profiles when HasExt is set.
+func (w *Writer) WriteAvcC(c AVCConfig) {
+	w.StartBox(TypeAvcC)
+	version := c.ConfigurationVersion
+	if version == 0 {
+		version = 1
+	}
+	lengthSize := c.NALLengthSize
+	if lengthSize == 0 {
+		lengthSize = 4
+	}
+	w.putUint8(version)
+	w.putUint8(c.Profile)
+	w.putUint8(c.ProfileCompatibility)
+	w.putUint8(c.Level)
+	w.putUint8(0xfc | (lengthSize-1)&0x03)
+	w.putUint8(0xe0 | uint8(len(c.SPS))&0x1f)
+	for _, s := range c.SPS {
+		w.putUint16(uint16(len(s)))
+		w.putBytes(s)
+	}
+	w.putUint8(uint8(len(c.PPS)))
+	for _, s := range c.PPS {
+		w.putUint16(uint16(len(s)))
+		w.putBytes(s)
+	}
+	if c.HasExt && avcHasExt(c.Profile) {
+		w.putUint8(0xfc | c.ChromaFormat&0x03)
+		w.putUint8(0xf8 | (c.BitDepthLuma-8)&0x07)
+		w.putUint8(0xf8 | (c.BitDepthChroma-8)&0x07)
+		w.putUint8(uint8(len(c.SPSExt)))
+		for _, s := range c.SPSExt {
+			w.putUint16(uint16(len(s)))
+			w.putBytes(s)
+		}
+	}
+	w.EndBox()
+}
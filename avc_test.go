@@ -0,0 +1,140 @@
+package mp4_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/tetsuo/mp4"
+)
+
+// x264 1080p High profile SPS with a 1088 -> 1080 crop and VUI timing.
+var testSPS = []byte{
+	0x67, 0x64, 0x00, 0x28, 0xac, 0xd9, 0x40, 0x78, 0x02, 0x27, 0xe5, 0x84, 0x00,
+	0x00, 0x03, 0x00, 0x04, 0x00, 0x00, 0x03, 0x00, 0xf0, 0x3c, 0x60, 0xc6, 0x58,
+}
+
+func TestAvcCRoundTrip(t *testing.T) {
+	c := mp4.AVCConfig{
+		ConfigurationVersion: 1,
+		Profile:              100,
+		Level:                0x28,
+		NALLengthSize:        4,
+		SPS:                  [][]byte{testSPS},
+		PPS:                  [][]byte{{0x68, 0xeb, 0xe3, 0xcb}},
+		HasExt:               true,
+		ChromaFormat:         1,
+		BitDepthLuma:         8,
+		BitDepthChroma:       8,
+	}
+	buf := make([]byte, 256)
+	w := mp4.NewWriter(buf)
+	w.WriteAvcC(c)
+
+	r := mp4.NewReader(w.Bytes())
+	if !r.Next() || r.Type() != mp4.TypeAvcC {
+		t.Fatal("avcC box not found")
+	}
+	got, err := mp4.ReadAVCConfig(r.Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, c) {
+		t.Errorf("got %+v, want %+v", got, c)
+	}
+	if s := got.Codec(); s != "640028" {
+		t.Errorf("codec = %q, want 640028", s)
+	}
+}
+
+func TestAvcCBaseline(t *testing.T) {
+	// Baseline profile records carry no extension, even with HasExt set.
+	c := mp4.AVCConfig{
+		ConfigurationVersion: 1,
+		Profile:              66,
+		ProfileCompatibility: 0xc0,
+		Level:                0x1e,
+		NALLengthSize:        2,
+		SPS:                  [][]byte{{0x67, 0x42, 0xc0, 0x1e}},
+		PPS:                  [][]byte{{0x68, 0xce}, {0x68, 0xcf}},
+	}
+	w := mp4.NewWriter(make([]byte, 256))
+	w.WriteAvcC(mp4.AVCConfig{
+		Profile: c.Profile, ProfileCompatibility: c.ProfileCompatibility, Level: c.Level,
+		NALLengthSize: c.NALLengthSize, SPS: c.SPS, PPS: c.PPS, HasExt: true, ChromaFormat: 1,
+	})
+	r := mp4.NewReader(w.Bytes())
+	if !r.Next() {
+		t.Fatal("avcC box not found")
+	}
+	got, err := mp4.ReadAVCConfig(r.Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, c) {
+		t.Errorf("got %+v, want %+v", got, c)
+	}
+	if s := got.Codec(); s != "42c01e" {
+		t.Errorf("codec = %q, want 42c01e", s)
+	}
+	for n := range len(r.Data()) - 1 {
+		if _, err := mp4.ReadAVCConfig(r.Data()[:n]); err != mp4.ErrTruncated {
+			t.Errorf("%d bytes: err = %v, want %v", n, err, mp4.ErrTruncated)
+		}
+	}
+}
+
+func TestAppendAnnexB(t *testing.T) {
+	sample := []byte{0, 0, 0, 2, 0x09, 0xf0, 0, 0, 0, 1, 0x65}
+	got, err := mp4.AppendAnnexB(nil, sample, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0, 0, 0, 1, 0x09, 0xf0, 0, 0, 0, 1, 0x65}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got % x, want % x", got, want)
+	}
+	if _, err := mp4.AppendAnnexB(nil, sample[:8], 4); err != mp4.ErrInvalidNALLength {
+		t.Errorf("truncated sample: err = %v", err)
+	}
+}
+
+func TestReadAVCSPS(t *testing.T) {
+	s, err := mp4.ReadAVCSPS(testSPS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.CodedWidth != 1920 || s.CodedHeight != 1088 {
+		t.Errorf("coded size = %dx%d, want 1920x1088", s.CodedWidth, s.CodedHeight)
+	}
+	if s.Width() != 1920 || s.Height() != 1080 {
+		t.Errorf("cropped size = %dx%d, want 1920x1080", s.Width(), s.Height())
+	}
+	if s.FrameRate() != 30 {
+		t.Errorf("frame rate = %v, want 30", s.FrameRate())
+	}
+}
+
+func TestBitReaderExpGolomb(t *testing.T) {
+	// 1 | 010 | 011 | 0 11111111
+	br := mp4.NewBitReader([]byte{0xa6, 0xff})
+	if v := br.ReadUE(); v != 0 {
+		t.Errorf("ue = %d, want 0", v)
+	}
+	if v := br.ReadUE(); v != 1 {
+		t.Errorf("ue = %d, want 1", v)
+	}
+	if v := br.ReadSE(); v != -1 {
+		t.Errorf("se = %d, want -1", v)
+	}
+	if v := br.ReadBits(9); v != 0xff {
+		t.Errorf("bits = %#x, want 0xff", v)
+	}
+	if br.Err() != nil {
+		t.Fatal(br.Err())
+	}
+	br.ReadBit()
+	if br.Err() != mp4.ErrTruncated {
+		t.Errorf("err = %v, want ErrTruncated", br.Err())
+	}
+}
@@ -0,0 +1,282 @@
+package mp4
+
+import "errors"
+
+// ErrInvalidParameterSet is returned when a parameter set NAL unit has
+// out-of-range values.
+var ErrInvalidParameterSet = errors.New("mp4: invalid parameter set")
+
+// sarTable maps aspect_ratio_idc values 1-16 to sample aspect ratios
+// (Table E-1, shared by H.264 and H.265).
+var sarTable = [17][2]uint16{
+	{0, 0}, {1, 1}, {12, 11}, {10, 11}, {16, 11}, {40, 33}, {24, 11}, {20, 11},
+	{32, 11}, {80, 33}, {18, 11}, {15, 11}, {64, 33}, {160, 99}, {4, 3}, {3, 2}, {2, 1},
+}
+
+// aspectRatioExtendedSAR signals an explicit sar_width/sar_height pair.
+const aspectRatioExtendedSAR = 255
+
+// VUIInfo holds the video usability information fields shared by H.264 and
+// H.265 sequence parameter sets.
+type VUIInfo struct {
+	SarWidth  uint16 // sample aspect ratio, 0 if unspecified
+	SarHeight uint16
+
+	VideoFormat             uint8
+	FullRange               bool
+	ColourDescription       bool  // colour fields below are present
+	ColourPrimaries         uint8 // ISO/IEC 23091-2 code points
+	TransferCharacteristics uint8
+	MatrixCoefficients      uint8
+
+	TimingInfo     bool // timing fields below are present
+	NumUnitsInTick uint32
+	TimeScale      uint32
+	FixedFrameRate bool // H.264 only
+}
+
+// AVCSPS holds the fields of an H.264 sequence parameter set needed to
+// describe the picture format.
+type AVCSPS struct {
+	Profile         uint8 // profile_idc
+	ConstraintFlags uint8 // constraint_set0..5 flags and reserved bits
+	Level           uint8 // level_idc
+	ID              uint32
+
+	ChromaFormat       uint8 // chroma_format_idc (1 = 4:2:0 if absent)
+	SeparateColorPlane bool
+	BitDepthLuma       uint8
+	BitDepthChroma     uint8
+
+	Log2MaxFrameNum       uint8
+	PicOrderCntType       uint8
+	Log2MaxPicOrderCntLsb uint8
+	MaxNumRefFrames       uint32
+	FrameMbsOnly          bool
+
+	// Decoded picture size in luma samples before cropping.
+	CodedWidth  uint32
+	CodedHeight uint32
+
+	// Crop window offsets in luma samples.
+	CropLeft   uint32
+	CropRight  uint32
+	CropTop    uint32
+	CropBottom uint32
+
+	VUIPresent bool
+	VUI        VUIInfo
+
+	deltaPicOrderAlwaysZero bool // slice headers omit delta_pic_order_cnt
+}
+
+// Width returns the cropped picture width in luma samples.
+func (s *AVCSPS) Width() uint32 { return s.CodedWidth - s.CropLeft - s.CropRight }
+
+// Height returns the cropped picture height in luma samples.
+func (s *AVCSPS) Height() uint32 { return s.CodedHeight - s.CropTop - s.CropBottom }
+
+// FrameRate returns the frame rate from VUI timing info, or 0 if absent.
+// H.264 ticks count fields, so a frame spans two ticks.
+func (s *AVCSPS) FrameRate() float64 {
+	if !s.VUI.TimingInfo || s.VUI.NumUnitsInTick == 0 {
+		return 0
+	}
+	return float64(s.VUI.TimeScale) / float64(2*s.VUI.NumUnitsInTick)
+}
+
+// DisplaySize returns the cropped picture size with the sample aspect ratio
+// applied to the width.
+func (v *VUIInfo) DisplaySize(width, height uint32) (uint32, uint32) {
+	if v.SarWidth == 0 || v.SarHeight == 0 || v.SarWidth == v.SarHeight {
+		return width, height
+	}
+	return uint32(uint64(width) * uint64(v.SarWidth) / uint64(v.SarHeight)), height
+}
+
+// avcHighProfile reports whether the SPS for the profile carries
+// chroma format, bit depth and scaling matrix fields.
+func avcHighProfile(profile uint8) bool {
+	switch profile {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		return true
+	}
+	return false
+}
+
+// ReadAVCSPS parses an H.264 SPS NAL unit, including its one-byte NAL
+// header, as stored in avcC. Parsing stops after the VUI timing info;
+// HRD and bitstream restriction fields are not decoded.
+func ReadAVCSPS(nal []byte) (AVCSPS, error) {
+	var s AVCSPS
+	if len(nal) < 4 {
+		return s, ErrTruncated
+	}
+	rbsp := UnescapeRBSP(make([]byte, 0, len(nal)), nal[1:])
+	br := NewBitReader(rbsp)
+
+	s.Profile = uint8(br.ReadBits(8))
+	s.ConstraintFlags = uint8(br.ReadBits(8))
+	s.Level = uint8(br.ReadBits(8))
+	s.ID = br.ReadUE()
+
+	s.ChromaFormat = 1
+	s.BitDepthLuma = 8
+	s.BitDepthChroma = 8
+	if avcHighProfile(s.Profile) {
+		s.ChromaFormat = uint8(br.ReadUE())
+		if s.ChromaFormat == 3 {
+			s.SeparateColorPlane = br.ReadFlag()
+		}
+		s.BitDepthLuma = uint8(br.ReadUE()) + 8
+		s.BitDepthChroma = uint8(br.ReadUE()) + 8
+		br.Skip(1)         // qpprime_y_zero_transform_bypass_flag
+		if br.ReadFlag() { // seq_scaling_matrix_present_flag
+			n := 8
+			if s.ChromaFormat == 3 {
+				n = 12
+			}
+			for i := range n {
+				if br.ReadFlag() {
+					size := 16
+					if i >= 6 {
+						size = 64
+					}
+					skipScalingList(&br, size)
+				}
+			}
+		}
+	}
+
+	s.Log2MaxFrameNum = uint8(br.ReadUE()) + 4
+	s.PicOrderCntType = uint8(br.ReadUE())
+	switch s.PicOrderCntType {
+	case 0:
+		s.Log2MaxPicOrderCntLsb = uint8(br.ReadUE()) + 4
+	case 1:
+		s.deltaPicOrderAlwaysZero = br.ReadFlag()
+		br.ReadSE() // offset_for_non_ref_pic
+		br.ReadSE() // offset_for_top_to_bottom_field
+		n := br.ReadUE()
+		for i := uint32(0); i < n && br.Err() == nil; i++ {
+			br.ReadSE() // offset_for_ref_frame
+		}
+	}
+	s.MaxNumRefFrames = br.ReadUE()
+	br.Skip(1) // gaps_in_frame_num_value_allowed_flag
+
+	widthMbs := br.ReadUE() + 1
+	heightMapUnits := br.ReadUE() + 1
+	s.FrameMbsOnly = br.ReadFlag()
+	if !s.FrameMbsOnly {
+		br.Skip(1) // mb_adaptive_frame_field_flag
+	}
+	br.Skip(1) // direct_8x8_inference_flag
+
+	frameHeightFactor := uint32(2)
+	if s.FrameMbsOnly {
+		frameHeightFactor = 1
+	}
+	s.CodedWidth = widthMbs * 16
+	s.CodedHeight = heightMapUnits * 16 * frameHeightFactor
+
+	if br.ReadFlag() { // frame_cropping_flag
+		cropUnitX, cropUnitY := uint32(1), frameHeightFactor
+		if !s.SeparateColorPlane && s.ChromaFormat != 0 {
+			if s.ChromaFormat == 1 || s.ChromaFormat == 2 {
+				cropUnitX = 2
+			}
+			if s.ChromaFormat == 1 {
+				cropUnitY *= 2
+			}
+		}
+		s.CropLeft = br.ReadUE() * cropUnitX
+		s.CropRight = br.ReadUE() * cropUnitX
+		s.CropTop = br.ReadUE() * cropUnitY
+		s.CropBottom = br.ReadUE() * cropUnitY
+		if s.CropLeft+s.CropRight >= s.CodedWidth || s.CropTop+s.CropBottom >= s.CodedHeight {
+			return s, ErrInvalidParameterSet
+		}
+	}
+
+	if err := br.Err(); err != nil {
+		return s, err
+	}
+
+	s.VUIPresent = br.ReadFlag()
+	if s.VUIPresent {
+		// Truncated VUI is tolerated; fields past the end stay zero.
+		readVUI(&br, &s.VUI, true)
+	}
+	return s, nil
+}
+
+// skipScalingList skips a scaling_list() syntax structure.
+func skipScalingList(br *BitReader, size int) {
+	last, next := int32(8), int32(8)
+	for range size {
+		if next != 0 {
+			next = (last + br.ReadSE() + 256) % 256
+		}
+		if next != 0 {
+			last = next
+		}
+		if br.Err() != nil {
+			return
+		}
+	}
+}
+
+// readVUI reads the leading VUI fields up to and including timing info.
+// The HEVC VUI has additional flags between the signal type and timing
+// info; avc selects the H.264 layout.
+func readVUI(br *BitReader, v *VUIInfo, avc bool) {
+	if br.ReadFlag() { // aspect_ratio_info_present_flag
+		idc := br.ReadBits(8)
+		if idc == aspectRatioExtendedSAR {
+			v.SarWidth = uint16(br.ReadBits(16))
+			v.SarHeight = uint16(br.ReadBits(16))
+		} else if idc < uint32(len(sarTable)) {
+			v.SarWidth = sarTable[idc][0]
+			v.SarHeight = sarTable[idc][1]
+		}
+	}
+	if br.ReadFlag() { // overscan_info_present_flag
+		br.Skip(1) // overscan_appropriate_flag
+	}
+	v.VideoFormat = 5  // unspecified
+	if br.ReadFlag() { // video_signal_type_present_flag
+		v.VideoFormat = uint8(br.ReadBits(3))
+		v.FullRange = br.ReadFlag()
+		if br.ReadFlag() { // colour_description_present_flag
+			v.ColourDescription = true
+			v.ColourPrimaries = uint8(br.ReadBits(8))
+			v.TransferCharacteristics = uint8(br.ReadBits(8))
+			v.MatrixCoefficients = uint8(br.ReadBits(8))
+		}
+	}
+	if br.ReadFlag() { // chroma_loc_info_present_flag
+		br.ReadUE() // chroma_sample_loc_type_top_field
+		br.ReadUE() // chroma_sample_loc_type_bottom_field
+	}
+	if !avc {
+		br.Skip(3)         // neutral_chroma, field_seq, frame_field_info_present flags
+		if br.ReadFlag() { // default_display_window_flag
+			br.ReadUE()
+			br.ReadUE()
+			br.ReadUE()
+			br.ReadUE()
+		}
+	}
+	if br.Err() != nil {
+		return
+	}
+	if br.ReadFlag() { // timing_info_present_flag
+		v.NumUnitsInTick = br.ReadBits(32)
+		v.TimeScale = br.ReadBits(32)
+		if avc {
+			v.FixedFrameRate = br.ReadFlag()
+		}
+		v.TimingInfo = br.Err() == nil
+	}
+}
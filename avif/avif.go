@@ -0,0 +1,199 @@
+// Package avif reads and writes AVIF images: HEIF files whose image items
+// are coded with AV1.
+package avif
+
+import (
+	"errors"
+	"io"
+
+	"github.com/tetsuo/mp4"
+	"github.com/tetsuo/mp4/heif"
+)
+
+var (
+	ErrNotAVIF     = errors.New("avif: not an AVIF file")
+	ErrInvalidGrid = errors.New("avif: grid item does not match its inputs")
+)
+
+// Brands of AVIF files.
+var (
+	BrandAVIF = [4]byte{'a', 'v', 'i', 'f'} // still images
+	BrandAVIS = [4]byte{'a', 'v', 'i', 's'} // image sequences
+
+	brandMif1 = [4]byte{'m', 'i', 'f', '1'}
+	brandMiaf = [4]byte{'m', 'i', 'a', 'f'}
+)
+
+// File is a parsed AVIF file. Item data is read with the embedded
+// heif.File.
+type File struct {
+	*heif.File
+}
+
+// Open parses the size-byte AVIF file read from r. It returns ErrNotAVIF
+// if the file has neither the avif nor the avis brand.
+func Open(r io.ReaderAt, size int64) (*File, error) {
+	f, err := heif.Open(r, size)
+	if err != nil {
+		return nil, err
+	}
+	if !f.HasBrand(BrandAVIF) && !f.HasBrand(BrandAVIS) {
+		return nil, ErrNotAVIF
+	}
+	return &File{f}, nil
+}
+
+// Image is an image item with what is needed to decode it.
+type Image struct {
+	Item *heif.Item
+
+	// Config is the av1C of the item, or of the first tile for grids; nil
+	// if absent.
+	Config *mp4.AV1Config
+
+	// BitsPerChannel is from the pixi of the item, or of the first tile
+	// for grids; nil if absent.
+	BitsPerChannel []uint8
+
+	Grid  *mp4.ImageGrid // nil unless the item is a grid
+	Tiles []*heif.Item   // grid inputs in row-major order
+	Alpha *heif.Item     // alpha plane auxiliary item, nil if none
+}
+
+// Primary returns the primary image.
+func (f *File) Primary() (*Image, error) {
+	return f.Image(f.PrimaryID)
+}
+
+// Image returns the image item with the given ID, resolving its grid
+// layout and alpha plane.
+func (f *File) Image(id uint32) (*Image, error) {
+	it := f.Item(id)
+	if it == nil {
+		return nil, heif.ErrItemNotFound
+	}
+	img := &Image{Item: it, Alpha: f.alpha(id)}
+	src := it
+	if it.Type == mp4.ItemTypeGrid {
+		data, err := f.ItemData(id)
+		if err != nil {
+			return nil, err
+		}
+		g, err := mp4.ReadImageGrid(data)
+		if err != nil {
+			return nil, err
+		}
+		img.Grid = &g
+		for _, tid := range it.ReferencedItems(mp4.TypeDimg) {
+			t := f.Item(tid)
+			if t == nil {
+				return nil, heif.ErrItemNotFound
+			}
+			img.Tiles = append(img.Tiles, t)
+		}
+		if len(img.Tiles) != int(g.Rows)*int(g.Columns) {
+			return nil, ErrInvalidGrid
+		}
+		src = img.Tiles[0]
+	}
+
+	if p := src.Property(mp4.TypeAv1C); p != nil {
+		if c, ok := p.Value.(mp4.AV1Config); ok {
+			img.Config = &c
+		}
+	}
+	for _, item := range []*heif.Item{it, src} {
+		if p := item.Property(mp4.TypePixi); p != nil {
+			if pi, ok := p.Value.(mp4.PixelInformation); ok {
+				img.BitsPerChannel = pi.BitsPerChannel
+				break
+			}
+		}
+	}
+	return img, nil
+}
+
+// alpha returns the alpha plane of the item with the given ID: an item
+// with an alpha auxC property and an auxl reference to it.
+func (f *File) alpha(id uint32) *heif.Item {
+	for i := range f.Items {
+		it := &f.Items[i]
+		p := it.Property(mp4.TypeAuxC)
+		if p == nil {
+			continue
+		}
+		if aux, ok := p.Value.(mp4.AuxiliaryType); !ok || !aux.IsAlpha() {
+			continue
+		}
+		for _, to := range it.ReferencedItems(mp4.TypeAuxl) {
+			if to == id {
+				return it
+			}
+		}
+	}
+	return nil
+}
+
+// Write writes a minimal AVIF file with a single image item to w. obu
+// holds the OBUs of one AV1 still image, typically a sequence header and a
+// frame; config is its configuration and width and height its size.
+func Write(w io.Writer, config mp4.AV1Config, width, height uint32, obu []byte) error {
+	buf := make([]byte, 512+len(config.ConfigOBUs)+len(obu))
+	mw := mp4.NewWriter(buf)
+
+	// The item's offset depends on the size of the meta box, which does
+	// not depend on the offset value: write the header twice.
+	writeHeader(&mw, config, width, height, 0, len(obu))
+	offset := uint64(mw.Len() + 8)
+	mw.Reset()
+	writeHeader(&mw, config, width, height, offset, len(obu))
+
+	mw.StartBox(mp4.TypeMdat)
+	mw.Write(obu)
+	mw.EndBox()
+	if err := mw.Err(); err != nil {
+		return err
+	}
+	_, err := w.Write(mw.Bytes())
+	return err
+}
+
+// writeHeader writes the ftyp and meta boxes of a single-item AVIF file
+// whose item data of the given length is at offset.
+func writeHeader(mw *mp4.Writer, config mp4.AV1Config, width, height uint32, offset uint64, length int) {
+	mw.WriteFtyp(BrandAVIF, 0, [][4]byte{BrandAVIF, brandMif1, brandMiaf})
+
+	mw.StartFullBox(mp4.TypeMeta, 0, 0)
+	mw.WriteHdlr([4]byte{'p', 'i', 'c', 't'}, "")
+	mw.WritePitm(1)
+	mw.WriteIloc([]mp4.ItemLocation{{
+		ID:      1,
+		Extents: []mp4.ItemExtent{{Offset: offset, Length: uint64(length)}},
+	}})
+	mw.WriteIinf([]mp4.ItemInfo{{ID: 1, Type: mp4.TypeAv01}})
+
+	channels := 3
+	if config.Monochrome {
+		channels = 1
+	}
+	bits := make([]uint8, channels)
+	for i := range bits {
+		bits[i] = config.BitDepth()
+	}
+	mw.StartBox(mp4.TypeIprp)
+	mw.StartBox(mp4.TypeIpco)
+	mw.WriteAv1C(config)
+	mw.WriteIspe(mp4.ImageSpatialExtents{Width: width, Height: height})
+	mw.WritePixi(mp4.PixelInformation{BitsPerChannel: bits})
+	mw.EndBox()
+	mw.WriteIpma([]mp4.ItemPropertyAssociation{{
+		ItemID: 1,
+		Associations: []mp4.PropertyAssociation{
+			{Index: 1, Essential: true},
+			{Index: 2},
+			{Index: 3},
+		},
+	}})
+	mw.EndBox()
+	mw.EndBox()
+}
@@ -0,0 +1,157 @@
+package avif_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/tetsuo/mp4"
+	"github.com/tetsuo/mp4/avif"
+)
+
+var testConfig = mp4.AV1Config{
+	SeqLevelIdx0: 8, HighBitdepth: true, ChromaSubsamplingX: true, ChromaSubsamplingY: true,
+	ConfigOBUs: []byte{0x0a, 0x0b, 0x00, 0x00, 0x00, 0x42, 0xab, 0xbf, 0xc3, 0x70, 0x0b, 0xe0},
+}
+
+func open(t *testing.T, file []byte) *avif.File {
+	t.Helper()
+	f, err := avif.Open(bytes.NewReader(file), int64(len(file)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	obu := []byte{0x12, 0x00, 0x32, 0x04, 0xde, 0xad, 0xbe, 0xef}
+	var buf bytes.Buffer
+	if err := avif.Write(&buf, testConfig, 640, 480, obu); err != nil {
+		t.Fatal(err)
+	}
+	f := open(t, buf.Bytes())
+	img, err := f.Primary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Item.Type != mp4.TypeAv01 || img.Grid != nil || img.Alpha != nil {
+		t.Errorf("image = %+v", img)
+	}
+	if img.Config == nil || !reflect.DeepEqual(*img.Config, testConfig) {
+		t.Errorf("config = %+v, want %+v", img.Config, testConfig)
+	}
+	if !bytes.Equal(img.BitsPerChannel, []uint8{10, 10, 10}) {
+		t.Errorf("bits per channel = %v, want [10 10 10]", img.BitsPerChannel)
+	}
+	if w, h, ok := img.Item.Size(); !ok || w != 640 || h != 480 {
+		t.Errorf("size = %dx%d, %v", w, h, ok)
+	}
+	if p := img.Item.Property(mp4.TypeAv1C); p == nil || !p.Essential {
+		t.Errorf("av1C = %+v, want essential", p)
+	}
+	if data, err := f.ItemData(img.Item.ID); err != nil || !bytes.Equal(data, obu) {
+		t.Errorf("item data = % x, %v", data, err)
+	}
+}
+
+// buildGrid returns an AVIF file whose primary item 1 is a grid of the
+// tiles 2 to 5, stored in idat with the tile data, and item 6 is its alpha
+// plane. tiles is the number of dimg references written.
+func buildGrid(tiles int) []byte {
+	w := mp4.NewWriter(make([]byte, 4096))
+	w.WriteFtyp(avif.BrandAVIF, 0, [][4]byte{avif.BrandAVIF, {'m', 'i', 'f', '1'}})
+	w.StartFullBox(mp4.TypeMeta, 0, 0)
+	w.WriteHdlr([4]byte{'p', 'i', 'c', 't'}, "")
+	w.WritePitm(1)
+	grid := mp4.AppendImageGrid(nil, mp4.ImageGrid{Rows: 2, Columns: 2, OutputWidth: 1000, OutputHeight: 700})
+	idat := append(bytes.Clone(grid), "tile2tile3tile4tile5alpha"...)
+	locs := []mp4.ItemLocation{{ID: 1, ConstructionMethod: mp4.ConstructionIdatOffset, Extents: []mp4.ItemExtent{{Length: uint64(len(grid))}}}}
+	infos := []mp4.ItemInfo{{ID: 1, Type: mp4.ItemTypeGrid}}
+	for id := uint32(2); id <= 6; id++ {
+		off := uint64(len(grid)) + uint64(id-2)*5
+		locs = append(locs, mp4.ItemLocation{ID: id, ConstructionMethod: mp4.ConstructionIdatOffset, Extents: []mp4.ItemExtent{{Offset: off, Length: 5}}})
+		infos = append(infos, mp4.ItemInfo{ID: id, Type: mp4.TypeAv01, Hidden: true})
+	}
+	w.WriteIloc(locs)
+	w.WriteIinf(infos)
+	w.WriteIref([]mp4.ItemReference{
+		{Type: mp4.TypeDimg, FromID: 1, ToIDs: []uint32{2, 3, 4, 5}[:tiles]},
+		{Type: mp4.TypeAuxl, FromID: 6, ToIDs: []uint32{1}},
+	})
+	w.StartBox(mp4.TypeIprp)
+	w.StartBox(mp4.TypeIpco)
+	w.WriteAv1C(testConfig)
+	w.WriteIspe(mp4.ImageSpatialExtents{Width: 500, Height: 350})
+	w.WritePixi(mp4.PixelInformation{BitsPerChannel: []uint8{8, 8, 8}})
+	w.WriteIspe(mp4.ImageSpatialExtents{Width: 1000, Height: 700})
+	w.WriteAuxC(mp4.AuxiliaryType{Type: mp4.AuxTypeAlpha})
+	w.WriteAv1C(mp4.AV1Config{SeqLevelIdx0: 8, Monochrome: true})
+	w.EndBox()
+	var assoc []mp4.ItemPropertyAssociation
+	assoc = append(assoc, mp4.ItemPropertyAssociation{ItemID: 1, Associations: []mp4.PropertyAssociation{{Index: 4}, {Index: 3}}})
+	for id := uint32(2); id <= 5; id++ {
+		assoc = append(assoc, mp4.ItemPropertyAssociation{ItemID: id, Associations: []mp4.PropertyAssociation{{Index: 1, Essential: true}, {Index: 2}}})
+	}
+	assoc = append(assoc, mp4.ItemPropertyAssociation{ItemID: 6, Associations: []mp4.PropertyAssociation{{Index: 6, Essential: true}, {Index: 4}, {Index: 5, Essential: true}}})
+	w.WriteIpma(assoc)
+	w.EndBox()
+	w.StartBox(mp4.TypeIdat)
+	w.Write(idat)
+	w.EndBox()
+	w.EndBox()
+	return bytes.Clone(w.Bytes())
+}
+
+func TestGridImage(t *testing.T) {
+	f := open(t, buildGrid(4))
+	img, err := f.Primary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := mp4.ImageGrid{Rows: 2, Columns: 2, OutputWidth: 1000, OutputHeight: 700}
+	if img.Grid == nil || *img.Grid != want {
+		t.Fatalf("grid = %+v, want %+v", img.Grid, want)
+	}
+	var ids []uint32
+	for _, tile := range img.Tiles {
+		ids = append(ids, tile.ID)
+	}
+	if !reflect.DeepEqual(ids, []uint32{2, 3, 4, 5}) {
+		t.Errorf("tiles = %v, want [2 3 4 5]", ids)
+	}
+	// The config comes from the first tile and the pixi from the grid.
+	if img.Config == nil || !reflect.DeepEqual(*img.Config, testConfig) {
+		t.Errorf("config = %+v, want %+v", img.Config, testConfig)
+	}
+	if !bytes.Equal(img.BitsPerChannel, []uint8{8, 8, 8}) {
+		t.Errorf("bits per channel = %v, want [8 8 8]", img.BitsPerChannel)
+	}
+	if img.Alpha == nil || img.Alpha.ID != 6 {
+		t.Errorf("alpha = %+v, want item 6", img.Alpha)
+	}
+	if data, err := f.ItemData(4); err != nil || string(data) != "tile4" {
+		t.Errorf("tile 4 data = %q, %v", data, err)
+	}
+
+	alpha, err := f.Image(6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alpha.Config == nil || !alpha.Config.Monochrome || alpha.Alpha != nil {
+		t.Errorf("alpha image = %+v", alpha)
+	}
+
+	f = open(t, buildGrid(3))
+	if _, err := f.Primary(); err != avif.ErrInvalidGrid {
+		t.Errorf("three tiles: err = %v, want %v", err, avif.ErrInvalidGrid)
+	}
+}
+
+func TestOpenNotAVIF(t *testing.T) {
+	file := buildGrid(4)
+	copy(file[8:12], "heic")
+	copy(file[16:24], "heicmif1")
+	if _, err := avif.Open(bytes.NewReader(file), int64(len(file))); err != avif.ErrNotAVIF {
+		t.Errorf("err = %v, want %v", err, avif.ErrNotAVIF)
+	}
+}
@@ -0,0 +1,156 @@
+package mp4
+
+// BitReader reads big-endian bit fields and Exp-Golomb codes from a byte
+// slice, as used by H.264/H.265 parameter sets and MPEG-4 audio configs.
+//
+// Reads past the end of the buffer return zero and set a sticky error;
+// check [BitReader.Err] once after a sequence of reads:
+//
+//	br := mp4.NewBitReader(rbsp)
+//	profile := br.ReadBits(8)
+//	id := br.ReadUE()
+//	if err := br.Err(); err != nil { ... }
+type BitReader struct {
+	buf []byte
+	pos int // bit position
+	err error
+}
+
+// NewBitReader creates a BitReader over buf.
+func NewBitReader(buf []byte) BitReader {
+	return BitReader{buf: buf}
+}
+
+// Err returns ErrTruncated if any read went past the end of the buffer.
+func (b *BitReader) Err() error { return b.err }
+
+// Pos returns the number of bits consumed.
+func (b *BitReader) Pos() int { return b.pos }
+
+// BitsLeft returns the number of unread bits.
+func (b *BitReader) BitsLeft() int { return len(b.buf)*8 - b.pos }
+
+// ReadBit reads a single bit.
+func (b *BitReader) ReadBit() uint32 {
+	if b.pos >= len(b.buf)*8 {
+		b.err = ErrTruncated
+		return 0
+	}
+	v := uint32(b.buf[b.pos>>3]>>(7-b.pos&7)) & 1
+	b.pos++
+	return v
+}
+
+// ReadFlag reads a single bit as a boolean.
+func (b *BitReader) ReadFlag() bool {
+	return b.ReadBit() == 1
+}
+
+// ReadBits reads n bits (n <= 32) as an unsigned value.
+func (b *BitReader) ReadBits(n int) uint32 {
+	return uint32(b.ReadBits64(n))
+}
+
+// ReadBits64 reads n bits (n <= 64) as an unsigned value.
+func (b *BitReader) ReadBits64(n int) uint64 {
+	if n > b.BitsLeft() {
+		b.pos = len(b.buf) * 8
+		b.err = ErrTruncated
+		return 0
+	}
+	var v uint64
+	for n > 0 {
+		// Consume as many bits as remain in the current byte.
+		avail := 8 - b.pos&7
+		take := min(avail, n)
+		bits := uint64(b.buf[b.pos>>3]>>(avail-take)) & (1<<take - 1)
+		v = v<<take | bits
+		b.pos += take
+		n -= take
+	}
+	return v
+}
+
+// Skip advances by n bits.
+func (b *BitReader) Skip(n int) {
+	if n > b.BitsLeft() {
+		b.pos = len(b.buf) * 8
+		b.err = ErrTruncated
+		return
+	}
+	b.pos += n
+}
+
+// ByteAlign advances to the next byte boundary.
+func (b *BitReader) ByteAlign() {
+	b.pos = (b.pos + 7) &^ 7
+}
+
+// ReadUE reads an unsigned Exp-Golomb code, ue(v).
+func (b *BitReader) ReadUE() uint32 {
+	zeros := 0
+	for b.ReadBit() == 0 {
+		if b.err != nil || zeros >= 32 {
+			b.err = ErrTruncated
+			return 0
+		}
+		zeros++
+	}
+	if zeros == 0 {
+		return 0
+	}
+	return uint32((uint64(1)<<zeros - 1) + b.ReadBits64(zeros))
+}
+
+// ReadSE reads a signed Exp-Golomb code, se(v).
+func (b *BitReader) ReadSE() int32 {
+	k := b.ReadUE()
+	if k&1 == 1 {
+		return int32((k + 1) / 2)
+	}
+	return -int32(k / 2)
+}
+
+// UnescapeRBSP appends nal to dst with emulation prevention bytes
+// (0x000003 sequences) removed, yielding the raw byte sequence payload.
+func UnescapeRBSP(dst, nal []byte) []byte {
+	zeros := 0
+	for _, c := range nal {
+		if zeros >= 2 && c == 3 {
+			zeros = 0
+			continue
+		}
+		if c == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		dst = append(dst, c)
+	}
+	return dst
+}
+
+// bitWriter accumulates big-endian bit fields for encoding bit-packed
+// configuration records.
+type bitWriter struct {
+	buf []byte
+	n   int // bits written
+}
+
+// put appends the low n bits of v.
+func (w *bitWriter) put(v uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.n&7 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if v>>i&1 != 0 {
+			w.buf[len(w.buf)-1] |= 1 << (7 - w.n&7)
+		}
+		w.n++
+	}
+}
+
+// bytes returns the written bits, zero-padded to a byte boundary.
+func (w *bitWriter) bytes() []byte {
+	return w.buf
+}
@@ -21,7 +21,19 @@ var (
 	TypeTrak = BoxType{'t', 'r', 'a', 'k'} // Track container
 	TypeTkhd = BoxType{'t', 'k', 'h', 'd'} // Track header (ID, dimensions)
 	TypeTref = BoxType{'t', 'r', 'e', 'f'} // Track reference container
+	TypeChap = BoxType{'c', 'h', 'a', 'p'} // Chapter track reference (in tref)
+	TypeHint = BoxType{'h', 'i', 'n', 't'} // Hint track reference: the media tracks a hint track uses
+	TypeCdsc = BoxType{'c', 'd', 's', 'c'} // Content description reference: the track this one describes
+	TypeSync = BoxType{'s', 'y', 'n', 'c'} // Synchronisation reference: the track to sync to
+	TypeVdep = BoxType{'v', 'd', 'e', 'p'} // Auxiliary depth video reference
+	TypeSubt = BoxType{'s', 'u', 'b', 't'} // Subtitle reference: subtitles for the referenced track
+	TypeFont = BoxType{'f', 'o', 'n', 't'} // Font reference: the track carrying fonts
 	TypeTrgr = BoxType{'t', 'r', 'g', 'r'} // Track grouping indication
+	TypeMsrc = BoxType{'m', 's', 'r', 'c'} // Multi-source presentation track group (in trgr)
+	TypeSter = BoxType{'s', 't', 'e', 'r'} // Stereo video track group (in trgr)
+	TypeTsel = BoxType{'t', 's', 'e', 'l'} // Track selection (in trak/udta)
+	TypeKind = BoxType{'k', 'i', 'n', 'd'} // Track kind, a role from a scheme (in trak/udta)
+	TypeLabl = BoxType{'l', 'a', 'b', 'l'} // Label (in trak/udta)
 	TypeEdts = BoxType{'e', 'd', 't', 's'} // Edit list container
 	TypeElst = BoxType{'e', 'l', 's', 't'} // Edit list entries
 	TypeMdia = BoxType{'m', 'd', 'i', 'a'} // Media information container
@@ -76,12 +88,53 @@ var (
 	TypeTrun = BoxType{'t', 'r', 'u', 'n'} // Track run (per-sample metadata)
 	TypeSidx = BoxType{'s', 'i', 'd', 'x'} // Segment index
 	TypeEmsg = BoxType{'e', 'm', 's', 'g'} // Event message
+	TypeMfra = BoxType{'m', 'f', 'r', 'a'} // Movie fragment random access container
+)
+
+// Protection boxes (ISO/IEC 23001-7 Common Encryption).
+var (
+	TypeEncv = BoxType{'e', 'n', 'c', 'v'} // Encrypted visual sample entry
+	TypeEnca = BoxType{'e', 'n', 'c', 'a'} // Encrypted audio sample entry
+	TypeSinf = BoxType{'s', 'i', 'n', 'f'} // Protection scheme information
+	TypeFrma = BoxType{'f', 'r', 'm', 'a'} // Original format (unencrypted sample entry type)
+	TypeSchm = BoxType{'s', 'c', 'h', 'm'} // Scheme type
+	TypeSchi = BoxType{'s', 'c', 'h', 'i'} // Scheme information container
+	TypeTenc = BoxType{'t', 'e', 'n', 'c'} // Track encryption defaults
+	TypePssh = BoxType{'p', 's', 's', 'h'} // Protection system specific header
+	TypeSenc = BoxType{'s', 'e', 'n', 'c'} // Sample encryption (IVs and subsample maps)
 )
 
 // Metadata boxes.
 var (
 	TypeMeta = BoxType{'m', 'e', 't', 'a'} // Metadata container
 	TypeUdta = BoxType{'u', 'd', 't', 'a'} // User data container
+	TypeIlst = BoxType{'i', 'l', 's', 't'} // iTunes metadata item list (in meta)
+	TypeData = BoxType{'d', 'a', 't', 'a'} // iTunes metadata value (in ilst items)
+	TypeMean = BoxType{'m', 'e', 'a', 'n'} // iTunes freeform item namespace
+	TypeName = BoxType{'n', 'a', 'm', 'e'} // iTunes freeform item name
+	TypeKeys = BoxType{'k', 'e', 'y', 's'} // QuickTime metadata item keys (mdta handler)
+	TypeChpl = BoxType{'c', 'h', 'p', 'l'} // Nero chapter list (in moov/udta)
+)
+
+// Item boxes (ISO/IEC 14496-12 section 8.11, used by HEIF).
+var (
+	TypePitm = BoxType{'p', 'i', 't', 'm'} // Primary item reference
+	TypeIinf = BoxType{'i', 'i', 'n', 'f'} // Item information
+	TypeInfe = BoxType{'i', 'n', 'f', 'e'} // Item information entry
+	TypeIloc = BoxType{'i', 'l', 'o', 'c'} // Item location
+	TypeIref = BoxType{'i', 'r', 'e', 'f'} // Item reference
+	TypeIdat = BoxType{'i', 'd', 'a', 't'} // Item data
+	TypeIprp = BoxType{'i', 'p', 'r', 'p'} // Item properties container
+	TypeIpco = BoxType{'i', 'p', 'c', 'o'} // Item property container
+	TypeIpma = BoxType{'i', 'p', 'm', 'a'} // Item property association
+	TypeIspe = BoxType{'i', 's', 'p', 'e'} // Image spatial extents
+	TypeIrot = BoxType{'i', 'r', 'o', 't'} // Image rotation
+	TypeImir = BoxType{'i', 'm', 'i', 'r'} // Image mirroring
+	TypePixi = BoxType{'p', 'i', 'x', 'i'} // Pixel information (bits per channel)
+	TypeAuxC = BoxType{'a', 'u', 'x', 'C'} // Auxiliary image type
+	TypeDimg = BoxType{'d', 'i', 'm', 'g'} // Item reference: derived image to its inputs
+	TypeThmb = BoxType{'t', 'h', 'm', 'b'} // Item reference: thumbnail to its image
+	TypeAuxl = BoxType{'a', 'u', 'x', 'l'} // Item reference: auxiliary image to its master
 )
 
 // Data boxes.
@@ -95,13 +148,72 @@ var (
 var (
 	TypeAvc1 = BoxType{'a', 'v', 'c', '1'} // AVC/H.264 visual sample entry
 	TypeAvcC = BoxType{'a', 'v', 'c', 'C'} // AVC decoder configuration record
+	TypeHvc1 = BoxType{'h', 'v', 'c', '1'} // HEVC/H.265 visual sample entry (parameter sets in hvcC only)
+	TypeHev1 = BoxType{'h', 'e', 'v', '1'} // HEVC/H.265 visual sample entry (in-band parameter sets allowed)
+	TypeHvcC = BoxType{'h', 'v', 'c', 'C'} // HEVC decoder configuration record
+	TypeVvc1 = BoxType{'v', 'v', 'c', '1'} // VVC/H.266 visual sample entry (parameter sets in vvcC only)
+	TypeVvi1 = BoxType{'v', 'v', 'i', '1'} // VVC/H.266 visual sample entry (in-band parameter sets allowed)
+	TypeVvcC = BoxType{'v', 'v', 'c', 'C'} // VVC decoder configuration record
+	TypeDvh1 = BoxType{'d', 'v', 'h', '1'} // Dolby Vision HEVC entry (parameter sets in hvcC only)
+	TypeDvhe = BoxType{'d', 'v', 'h', 'e'} // Dolby Vision HEVC entry (in-band parameter sets allowed)
+	TypeDav1 = BoxType{'d', 'a', 'v', '1'} // Dolby Vision AV1 entry
+	TypeAv01 = BoxType{'a', 'v', '0', '1'} // AV1 visual sample entry and item type
+	TypeAv1C = BoxType{'a', 'v', '1', 'C'} // AV1 codec configuration record
+	TypeDvcC = BoxType{'d', 'v', 'c', 'C'} // Dolby Vision configuration, profiles 0-7
+	TypeDvvC = BoxType{'d', 'v', 'v', 'C'} // Dolby Vision configuration, profiles 8-10
+	TypeDvwC = BoxType{'d', 'v', 'w', 'C'} // Dolby Vision configuration, profiles 11 and up
 	TypeBtrt = BoxType{'b', 't', 'r', 't'} // MPEG-4 bit rate
 	TypePasp = BoxType{'p', 'a', 's', 'p'} // Pixel aspect ratio
+	TypeColr = BoxType{'c', 'o', 'l', 'r'} // Colour information (nclx or ICC)
+	TypeClap = BoxType{'c', 'l', 'a', 'p'} // Clean aperture
+	TypeMdcv = BoxType{'m', 'd', 'c', 'v'} // Mastering display colour volume
+	TypeClli = BoxType{'c', 'l', 'l', 'i'} // Content light level
 	TypeMp4a = BoxType{'m', 'p', '4', 'a'} // MPEG-4 audio sample entry
 	TypeEsds = BoxType{'e', 's', 'd', 's'} // ES descriptor
+	TypeFlac = BoxType{'f', 'L', 'a', 'C'} // FLAC audio sample entry
+	TypeDfla = BoxType{'d', 'f', 'L', 'a'} // FLAC specific box (metadata blocks)
+	TypeAlac = BoxType{'a', 'l', 'a', 'c'} // ALAC audio sample entry and its config box
+	TypeIpcm = BoxType{'i', 'p', 'c', 'm'} // Integer PCM audio sample entry (ISO/IEC 23003-5)
+	TypeFpcm = BoxType{'f', 'p', 'c', 'm'} // Floating point PCM audio sample entry (ISO/IEC 23003-5)
+	TypePcmC = BoxType{'p', 'c', 'm', 'C'} // PCM configuration
+	TypeSrat = BoxType{'s', 'r', 'a', 't'} // Sampling rate for version 1 audio sample entries
+	TypeLpcm = BoxType{'l', 'p', 'c', 'm'} // QuickTime linear PCM (version 2 sound description)
+	TypeTwos = BoxType{'t', 'w', 'o', 's'} // QuickTime big-endian signed PCM
+	TypeSowt = BoxType{'s', 'o', 'w', 't'} // QuickTime little-endian signed PCM
+	TypeIn24 = BoxType{'i', 'n', '2', '4'} // QuickTime 24-bit integer PCM
+	TypeIn32 = BoxType{'i', 'n', '3', '2'} // QuickTime 32-bit integer PCM
+	TypeFl32 = BoxType{'f', 'l', '3', '2'} // QuickTime 32-bit float PCM
+	TypeFl64 = BoxType{'f', 'l', '6', '4'} // QuickTime 64-bit float PCM
+	TypeMp3  = BoxType{'.', 'm', 'p', '3'} // QuickTime MPEG-1/2 Layer 3 audio sample entry
+	TypeMha1 = BoxType{'m', 'h', 'a', '1'} // MPEG-H 3D Audio sample entry, single stream
+	TypeMha2 = BoxType{'m', 'h', 'a', '2'} // MPEG-H 3D Audio sample entry, multi-stream
+	TypeMhm1 = BoxType{'m', 'h', 'm', '1'} // MPEG-H 3D Audio sample entry, MHAS single stream
+	TypeMhm2 = BoxType{'m', 'h', 'm', '2'} // MPEG-H 3D Audio sample entry, MHAS multi-stream
+	TypeMhaC = BoxType{'m', 'h', 'a', 'C'} // MPEG-H 3D Audio decoder configuration
+	TypeAc4  = BoxType{'a', 'c', '-', '4'} // AC-4 audio sample entry
+	TypeDac4 = BoxType{'d', 'a', 'c', '4'} // AC-4 specific box (ac4_dsi_v1)
+	TypeChnl = BoxType{'c', 'h', 'n', 'l'} // Channel layout
+	TypeChan = BoxType{'c', 'h', 'a', 'n'} // QuickTime audio channel layout
+
+	// Subtitle sample entries (ISO/IEC 14496-30) and WebVTT sample boxes.
+	TypeWvtt = BoxType{'w', 'v', 't', 't'} // WebVTT sample entry
+	TypeVttC = BoxType{'v', 't', 't', 'C'} // WebVTT configuration (file header)
+	TypeVlab = BoxType{'v', 'l', 'a', 'b'} // WebVTT source label
+	TypeVttc = BoxType{'v', 't', 't', 'c'} // WebVTT cue
+	TypeVtte = BoxType{'v', 't', 't', 'e'} // WebVTT empty sample
+	TypeVtta = BoxType{'v', 't', 't', 'a'} // WebVTT additional text (comments)
+	TypeIden = BoxType{'i', 'd', 'e', 'n'} // WebVTT cue identifier
+	TypeSttg = BoxType{'s', 't', 't', 'g'} // WebVTT cue settings
+	TypePayl = BoxType{'p', 'a', 'y', 'l'} // WebVTT cue payload
+	TypeStpp = BoxType{'s', 't', 'p', 'p'} // XML subtitle sample entry (TTML)
+	TypeTx3g = BoxType{'t', 'x', '3', 'g'} // 3GPP timed text sample entry
+	TypeFtab = BoxType{'f', 't', 'a', 'b'} // 3GPP timed text font table
+	TypeStyl = BoxType{'s', 't', 'y', 'l'} // 3GPP timed text style modifier (in samples)
 )
 
 // IsFullBox returns true if the box type has version and flags fields.
+// Reader.IsFullBox refines this for the current box, since QuickTime files
+// write meta without them.
 func IsFullBox(t BoxType) bool {
 	switch t {
 	case TypeMvhd, TypeTkhd, TypeMdhd, TypeHdlr,
@@ -111,7 +223,14 @@ func IsFullBox(t BoxType) bool {
 		TypeMeta, TypeEsds, TypeMehd, TypeTrex,
 		TypeMfhd, TypeTfhd, TypeTfdt, TypeTrun,
 		TypeSbgp, TypeSgpd, TypeSaiz, TypeSaio,
-		TypeCslg, TypeSdtp, TypeSidx, TypeEmsg:
+		TypeCslg, TypeSdtp, TypeSidx, TypeEmsg,
+		TypeDfla, TypeVvcC, TypeChpl, TypePcmC,
+		TypeSrat, TypeChnl, TypeChan, TypeMsrc,
+		TypeSter, TypeTsel, TypeKind, TypeLabl,
+		TypeKeys, TypePitm, TypeIinf, TypeInfe,
+		TypeIloc, TypeIref, TypeIpma, TypeIspe,
+		TypePixi, TypeAuxC, TypeSchm, TypeTenc,
+		TypePssh, TypeSenc:
 		return true
 	}
 	return false
@@ -123,7 +242,8 @@ func IsContainerBox(t BoxType) bool {
 	case TypeMoov, TypeTrak, TypeEdts, TypeMdia,
 		TypeMinf, TypeDinf, TypeStbl, TypeUdta,
 		TypeMeta, TypeMvex, TypeMoof, TypeTraf,
-		TypeTref, TypeTrgr:
+		TypeTref, TypeTrgr, TypeIprp, TypeIpco,
+		TypeSinf, TypeSchi, TypeMfra:
 		return true
 	}
 	return false
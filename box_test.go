@@ -0,0 +1,19 @@
+package mp4_test
+
+import (
+	"testing"
+
+	"github.com/tetsuo/mp4"
+)
+
+// writeBox writes a box with write and returns a Reader positioned on it.
+func writeBox(t *testing.T, write func(w *mp4.Writer)) mp4.Reader {
+	t.Helper()
+	w := mp4.NewWriter(make([]byte, 4096))
+	write(&w)
+	r := mp4.NewReader(w.Bytes())
+	if !r.Next() {
+		t.Fatal("box not written")
+	}
+	return r
+}
@@ -0,0 +1,515 @@
+package mp4
+
+// Common Encryption (ISO/IEC 23001-7) protection scheme types.
+var (
+	SchemeCENC = [4]byte{'c', 'e', 'n', 'c'} // AES-CTR, full sample or subsample
+	SchemeCBC1 = [4]byte{'c', 'b', 'c', '1'} // AES-CBC, full sample or subsample
+	SchemeCENS = [4]byte{'c', 'e', 'n', 's'} // AES-CTR with pattern encryption
+	SchemeCBCS = [4]byte{'c', 'b', 'c', 's'} // AES-CBC with pattern encryption and constant IV
+)
+
+// DRM system IDs of pssh boxes.
+var (
+	SystemCommon    = [16]byte{0x10, 0x77, 0xef, 0xec, 0xc0, 0xb2, 0x4d, 0x02, 0xac, 0xe3, 0x3c, 0x1e, 0x52, 0xe2, 0xfb, 0x4b} // W3C Common PSSH
+	SystemWidevine  = [16]byte{0xed, 0xef, 0x8b, 0xa9, 0x79, 0xd6, 0x4a, 0xce, 0xa3, 0xc8, 0x27, 0xdc, 0xd5, 0x1d, 0x21, 0xed}
+	SystemPlayReady = [16]byte{0x9a, 0x04, 0xf0, 0x79, 0x98, 0x40, 0x42, 0x86, 0xab, 0x92, 0xe6, 0x5b, 0xe0, 0x88, 0x5f, 0x95}
+	SystemFairPlay  = [16]byte{0x94, 0xce, 0x86, 0xfb, 0x07, 0xff, 0x4f, 0x43, 0xad, 0xb8, 0x93, 0xd2, 0xfa, 0x96, 0x8c, 0xa2}
+)
+
+// SencUseSubsamples is the senc flag signalling subsample maps.
+const SencUseSubsamples = 0x000002
+
+// ProtectionScheme holds a parsed schm box.
+type ProtectionScheme struct {
+	Type    [4]byte // e.g. SchemeCENC
+	Version uint32  // 0x00010000 for Common Encryption
+	URI     string  // "" if absent
+}
+
+// ReadSchm parses schm box data (after version+flags). The URI is present
+// if flags bit 0 is set.
+func ReadSchm(data []byte, flags uint32) (ProtectionScheme, error) {
+	var s ProtectionScheme
+	if len(data) < 8 {
+		return s, ErrTruncated
+	}
+	copy(s.Type[:], data[0:4])
+	s.Version = be.Uint32(data[4:8])
+	if flags&1 != 0 {
+		if uri, _, ok := readCString(data, 8); ok {
+			s.URI = uri
+		} else {
+			s.URI = string(data[8:])
+		}
+	}
+	return s, nil
+}
+
+// WriteSchm writes a complete schm box.
+func (w *Writer) WriteSchm(s ProtectionScheme) {
+	var flags uint32
+	if s.URI != "" {
+		flags = 1
+	}
+	w.StartFullBox(TypeSchm, 0, flags)
+	w.putBytes(s.Type[:])
+	w.putUint32(s.Version)
+	if s.URI != "" {
+		w.putBytes([]byte(s.URI))
+		w.putUint8(0)
+	}
+	w.EndBox()
+}
+
+// TrackEncryption holds a parsed tenc box, the default encryption
+// parameters of a track's samples.
+type TrackEncryption struct {
+	// Pattern encryption (cens, cbcs): encrypted and clear 16-byte blocks
+	// in each pattern, 0 for full encryption. Version 1 only.
+	DefaultCryptByteBlock uint8
+	DefaultSkipByteBlock  uint8
+
+	DefaultIsProtected     bool
+	DefaultPerSampleIVSize uint8 // 0, 8 or 16; 0 means a constant IV is used
+	DefaultKID             [16]byte
+
+	// DefaultConstantIV is the IV of every sample when
+	// DefaultPerSampleIVSize is 0, nil otherwise.
+	DefaultConstantIV []byte
+}
+
+// ReadTenc parses tenc box data (after version+flags).
+func ReadTenc(data []byte, version uint8) (TrackEncryption, error) {
+	var t TrackEncryption
+	if len(data) < 20 {
+		return t, ErrTruncated
+	}
+	if version > 0 {
+		t.DefaultCryptByteBlock = data[1] >> 4
+		t.DefaultSkipByteBlock = data[1] & 0x0f
+	}
+	t.DefaultIsProtected = data[2] != 0
+	t.DefaultPerSampleIVSize = data[3]
+	copy(t.DefaultKID[:], data[4:20])
+	if t.DefaultIsProtected && t.DefaultPerSampleIVSize == 0 {
+		if len(data) < 21 || len(data) < 21+int(data[20]) {
+			return t, ErrTruncated
+		}
+		t.DefaultConstantIV = data[21 : 21+int(data[20])]
+	}
+	return t, nil
+}
+
+// WriteTenc writes a complete tenc box, in version 1 if a pattern is set.
+func (w *Writer) WriteTenc(t TrackEncryption) {
+	pattern := t.DefaultCryptByteBlock != 0 || t.DefaultSkipByteBlock != 0
+	if pattern {
+		w.StartFullBox(TypeTenc, 1, 0)
+	} else {
+		w.StartFullBox(TypeTenc, 0, 0)
+	}
+	w.putUint8(0)
+	w.putUint8(t.DefaultCryptByteBlock<<4 | t.DefaultSkipByteBlock&0x0f)
+	if t.DefaultIsProtected {
+		w.putUint8(1)
+	} else {
+		w.putUint8(0)
+	}
+	w.putUint8(t.DefaultPerSampleIVSize)
+	w.putBytes(t.DefaultKID[:])
+	if t.DefaultIsProtected && t.DefaultPerSampleIVSize == 0 {
+		w.putUint8(uint8(len(t.DefaultConstantIV)))
+		w.putBytes(t.DefaultConstantIV)
+	}
+	w.EndBox()
+}
+
+// GroupingSeig is the grouping type of the CENC sample group, whose
+// entries override the tenc defaults of the samples mapped to them, e.g.
+// for key rotation.
+var GroupingSeig = [4]byte{'s', 'e', 'i', 'g'}
+
+// ReadSeig parses a seig sample group description entry. It has the
+// layout of version 1 tenc box data.
+func ReadSeig(data []byte) (TrackEncryption, error) {
+	return ReadTenc(data, 1)
+}
+
+// AppendSeig appends t as a seig sample group description entry to dst.
+func AppendSeig(dst []byte, t TrackEncryption) []byte {
+	var protected byte
+	if t.DefaultIsProtected {
+		protected = 1
+	}
+	dst = append(dst, 0, t.DefaultCryptByteBlock<<4|t.DefaultSkipByteBlock&0x0f, protected, t.DefaultPerSampleIVSize)
+	dst = append(dst, t.DefaultKID[:]...)
+	if t.DefaultIsProtected && t.DefaultPerSampleIVSize == 0 {
+		dst = append(dst, uint8(len(t.DefaultConstantIV)))
+		dst = append(dst, t.DefaultConstantIV...)
+	}
+	return dst
+}
+
+// ProtectionInfo holds a parsed sinf box: the format an encv or enca
+// sample entry had before encryption and how it was protected.
+type ProtectionInfo struct {
+	OriginalFormat BoxType // from frma, e.g. TypeAvc1
+	Scheme         ProtectionScheme
+	Encryption     *TrackEncryption // tenc from schi, nil if absent
+}
+
+// ReadSinf parses sinf box data.
+func ReadSinf(data []byte) (ProtectionInfo, error) {
+	var p ProtectionInfo
+	var err error
+	var haveFrma bool
+	r := NewReader(data)
+	for r.Next() && err == nil {
+		switch r.Type() {
+		case TypeFrma:
+			if len(r.Data()) < 4 {
+				return p, ErrTruncated
+			}
+			p.OriginalFormat = BoxType(r.Data()[0:4])
+			haveFrma = true
+		case TypeSchm:
+			p.Scheme, err = ReadSchm(r.Data(), r.Flags())
+		case TypeSchi:
+			r.Enter()
+			for r.Next() {
+				if r.Type() == TypeTenc {
+					var t TrackEncryption
+					if t, err = ReadTenc(r.Data(), r.Version()); err == nil {
+						p.Encryption = &t
+					}
+					break
+				}
+			}
+			r.Exit()
+		}
+	}
+	if err == nil && !haveFrma {
+		err = ErrTruncated
+	}
+	return p, err
+}
+
+// WriteSinf writes a complete sinf box with frma, schm and, if
+// p.Encryption is set, schi holding tenc.
+func (w *Writer) WriteSinf(p ProtectionInfo) {
+	w.StartBox(TypeSinf)
+	w.StartBox(TypeFrma)
+	w.putBytes(p.OriginalFormat[:])
+	w.EndBox()
+	w.WriteSchm(p.Scheme)
+	if p.Encryption != nil {
+		w.StartBox(TypeSchi)
+		w.WriteTenc(*p.Encryption)
+		w.EndBox()
+	}
+	w.EndBox()
+}
+
+// ProtectionSystemHeader holds a parsed pssh box.
+type ProtectionSystemHeader struct {
+	SystemID [16]byte
+	KeyIDs   [][16]byte // version 1 only
+	Data     []byte     // system-specific data
+}
+
+// ReadPssh parses pssh box data (after version+flags).
+func ReadPssh(data []byte, version uint8) (ProtectionSystemHeader, error) {
+	var p ProtectionSystemHeader
+	if len(data) < 20 {
+		return p, ErrTruncated
+	}
+	copy(p.SystemID[:], data[0:16])
+	ptr := 16
+	if version > 0 {
+		n := int(be.Uint32(data[16:20]))
+		ptr = 20
+		if n > (len(data)-ptr)/16 {
+			return p, ErrTruncated
+		}
+		p.KeyIDs = make([][16]byte, n)
+		for i := range p.KeyIDs {
+			copy(p.KeyIDs[i][:], data[ptr:ptr+16])
+			ptr += 16
+		}
+	}
+	if len(data) < ptr+4 {
+		return p, ErrTruncated
+	}
+	n := int(be.Uint32(data[ptr:]))
+	ptr += 4
+	if n > len(data)-ptr {
+		return p, ErrTruncated
+	}
+	p.Data = data[ptr : ptr+n]
+	return p, nil
+}
+
+// WritePssh writes a complete pssh box, in version 1 if it lists key IDs.
+func (w *Writer) WritePssh(p ProtectionSystemHeader) {
+	if len(p.KeyIDs) > 0 {
+		w.StartFullBox(TypePssh, 1, 0)
+		w.putBytes(p.SystemID[:])
+		w.putUint32(uint32(len(p.KeyIDs)))
+		for _, kid := range p.KeyIDs {
+			w.putBytes(kid[:])
+		}
+	} else {
+		w.StartFullBox(TypePssh, 0, 0)
+		w.putBytes(p.SystemID[:])
+	}
+	w.putUint32(uint32(len(p.Data)))
+	w.putBytes(p.Data)
+	w.EndBox()
+}
+
+// Subsample is one entry of a subsample map: a run of clear bytes followed
+// by a run of protected bytes.
+type Subsample struct {
+	ClearBytes     uint16
+	ProtectedBytes uint32
+}
+
+// SampleEncryption is the encryption parameters of one sample, from senc or
+// the sample auxiliary information saiz and saio point to.
+type SampleEncryption struct {
+	IV         []byte      // nil if the track uses a constant IV
+	Subsamples []Subsample // nil if the whole sample is protected
+}
+
+// ReadSenc parses senc box data (after version+flags). The per-sample IV
+// size is not signalled in the box; it comes from tenc, or from the sample
+// group description that overrides it. sampleCount is the number of samples
+// the box describes; a box claiming more entries is rejected.
+func ReadSenc(data []byte, flags uint32, ivSize, sampleCount int) ([]SampleEncryption, error) {
+	if len(data) < 4 {
+		return nil, ErrTruncated
+	}
+	n := int(be.Uint32(data))
+	subsamples := flags&SencUseSubsamples != 0
+	// Smallest size of one entry: the IV and the subsample count.
+	entrySize := ivSize
+	if subsamples {
+		entrySize += 2
+	}
+	if n > sampleCount || entrySize > 0 && n > (len(data)-4)/entrySize {
+		return nil, ErrTruncated
+	}
+	ptr := 4
+	entries := make([]SampleEncryption, 0, n)
+	for range n {
+		e, size, err := ReadSampleEncryption(data[ptr:], ivSize, subsamples)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, e)
+		ptr += size
+	}
+	return entries, nil
+}
+
+// ReadSampleEncryption parses the encryption parameters of one sample and
+// returns them with the number of bytes read.
+func ReadSampleEncryption(data []byte, ivSize int, subsamples bool) (SampleEncryption, int, error) {
+	var e SampleEncryption
+	if len(data) < ivSize {
+		return e, 0, ErrTruncated
+	}
+	if ivSize > 0 {
+		e.IV = data[:ivSize]
+	}
+	ptr := ivSize
+	if !subsamples {
+		return e, ptr, nil
+	}
+	if len(data) < ptr+2 {
+		return e, 0, ErrTruncated
+	}
+	n := int(be.Uint16(data[ptr:]))
+	ptr += 2
+	if len(data) < ptr+6*n {
+		return e, 0, ErrTruncated
+	}
+	e.Subsamples = make([]Subsample, n)
+	for i := range e.Subsamples {
+		e.Subsamples[i] = Subsample{
+			ClearBytes:     be.Uint16(data[ptr:]),
+			ProtectedBytes: be.Uint32(data[ptr+2:]),
+		}
+		ptr += 6
+	}
+	return e, ptr, nil
+}
+
+// WriteSenc writes a complete senc box. Subsample maps are written for
+// every sample if any sample has one.
+func (w *Writer) WriteSenc(entries []SampleEncryption) {
+	var flags uint32
+	for _, e := range entries {
+		if e.Subsamples != nil {
+			flags = SencUseSubsamples
+			break
+		}
+	}
+	w.StartFullBox(TypeSenc, 0, flags)
+	w.putUint32(uint32(len(entries)))
+	for _, e := range entries {
+		w.putBytes(e.IV)
+		if flags != 0 {
+			w.putUint16(uint16(len(e.Subsamples)))
+			for _, s := range e.Subsamples {
+				w.putUint16(s.ClearBytes)
+				w.putUint32(s.ProtectedBytes)
+			}
+		}
+	}
+	w.EndBox()
+}
+
+// SampleAuxInfoSizes holds a parsed saiz box.
+type SampleAuxInfoSizes struct {
+	AuxInfoType          [4]byte // zero if absent; the scheme type for CENC
+	AuxInfoTypeParameter uint32
+	DefaultSize          uint8 // size of every sample's information, or 0
+	SampleCount          uint32
+	Sizes                []uint8 // per-sample sizes when DefaultSize is 0
+}
+
+// Size returns the size of the information of sample i (0-based).
+func (s *SampleAuxInfoSizes) Size(i int) uint8 {
+	if s.DefaultSize != 0 {
+		return s.DefaultSize
+	}
+	if i < len(s.Sizes) {
+		return s.Sizes[i]
+	}
+	return 0
+}
+
+// ReadSaiz parses saiz box data (after version+flags).
+func ReadSaiz(data []byte, flags uint32) (SampleAuxInfoSizes, error) {
+	var s SampleAuxInfoSizes
+	ptr := 0
+	if flags&1 != 0 {
+		if len(data) < 8 {
+			return s, ErrTruncated
+		}
+		copy(s.AuxInfoType[:], data[0:4])
+		s.AuxInfoTypeParameter = be.Uint32(data[4:8])
+		ptr = 8
+	}
+	if len(data) < ptr+5 {
+		return s, ErrTruncated
+	}
+	s.DefaultSize = data[ptr]
+	s.SampleCount = be.Uint32(data[ptr+1:])
+	ptr += 5
+	if s.DefaultSize == 0 {
+		if uint64(len(data)-ptr) < uint64(s.SampleCount) {
+			return s, ErrTruncated
+		}
+		s.Sizes = data[ptr : ptr+int(s.SampleCount)]
+	}
+	return s, nil
+}
+
+// WriteSaiz writes a complete saiz box.
+func (w *Writer) WriteSaiz(s SampleAuxInfoSizes) {
+	var flags uint32
+	if s.AuxInfoType != [4]byte{} {
+		flags = 1
+	}
+	w.StartFullBox(TypeSaiz, 0, flags)
+	if flags != 0 {
+		w.putBytes(s.AuxInfoType[:])
+		w.putUint32(s.AuxInfoTypeParameter)
+	}
+	w.putUint8(s.DefaultSize)
+	if s.DefaultSize == 0 {
+		w.putUint32(uint32(len(s.Sizes)))
+		w.putBytes(s.Sizes)
+	} else {
+		w.putUint32(s.SampleCount)
+	}
+	w.EndBox()
+}
+
+// SampleAuxInfoOffsets holds a parsed saio box. Offsets are relative to
+// the start of the enclosing moof in fragments (with the default base), or
+// absolute file offsets otherwise.
+type SampleAuxInfoOffsets struct {
+	AuxInfoType          [4]byte // zero if absent
+	AuxInfoTypeParameter uint32
+	Offsets              []uint64 // one per chunk, or per track run in fragments
+}
+
+// ReadSaio parses saio box data (after version+flags). Offsets are 32-bit
+// in version 0 and 64-bit otherwise.
+func ReadSaio(data []byte, version uint8, flags uint32) (SampleAuxInfoOffsets, error) {
+	var s SampleAuxInfoOffsets
+	ptr := 0
+	if flags&1 != 0 {
+		if len(data) < 8 {
+			return s, ErrTruncated
+		}
+		copy(s.AuxInfoType[:], data[0:4])
+		s.AuxInfoTypeParameter = be.Uint32(data[4:8])
+		ptr = 8
+	}
+	if len(data) < ptr+4 {
+		return s, ErrTruncated
+	}
+	n := int(be.Uint32(data[ptr:]))
+	ptr += 4
+	size := 4
+	if version > 0 {
+		size = 8
+	}
+	if n > (len(data)-ptr)/size {
+		return s, ErrTruncated
+	}
+	s.Offsets = make([]uint64, n)
+	for i := range s.Offsets {
+		if size == 4 {
+			s.Offsets[i] = uint64(be.Uint32(data[ptr:]))
+		} else {
+			s.Offsets[i] = be.Uint64(data[ptr:])
+		}
+		ptr += size
+	}
+	return s, nil
+}
+
+// WriteSaio writes a complete saio box, in version 1 if any offset needs
+// 64 bits.
+func (w *Writer) WriteSaio(s SampleAuxInfoOffsets) {
+	var flags uint32
+	if s.AuxInfoType != [4]byte{} {
+		flags = 1
+	}
+	var version uint8
+	for _, off := range s.Offsets {
+		if off > uint32Max {
+			version = 1
+			break
+		}
+	}
+	w.StartFullBox(TypeSaio, version, flags)
+	if flags != 0 {
+		w.putBytes(s.AuxInfoType[:])
+		w.putUint32(s.AuxInfoTypeParameter)
+	}
+	w.putUint32(uint32(len(s.Offsets)))
+	for _, off := range s.Offsets {
+		if version == 0 {
+			w.putUint32(uint32(off))
+		} else {
+			w.putUint64(off)
+		}
+	}
+	w.EndBox()
+}
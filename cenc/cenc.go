@@ -0,0 +1,127 @@
+// Package cenc encrypts and decrypts MP4 files with Common Encryption
+// (ISO/IEC 23001-7) given their content keys.
+package cenc
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+
+	"github.com/tetsuo/mp4"
+)
+
+var (
+	ErrUnsupportedScheme = errors.New("cenc: unsupported protection scheme")
+	ErrKeyNotFound       = errors.New("cenc: no key for key ID")
+	ErrInvalidSubsamples = errors.New("cenc: subsamples exceed sample size")
+	ErrInvalidIV         = errors.New("cenc: missing or invalid IV")
+	ErrInvalidNALUnits   = errors.New("cenc: NAL unit lengths exceed sample size")
+)
+
+// Keys maps key IDs to 16-byte AES content keys.
+type Keys map[[16]byte][]byte
+
+// Decrypter decrypts the samples of one track protected with the cenc
+// (AES-CTR) or cbcs (AES-CBC with pattern) scheme.
+type Decrypter struct {
+	scheme     [4]byte
+	block      cipher.Block
+	cryptBlock int
+	skipBlock  int
+	constantIV []byte
+}
+
+// NewDecrypter returns a Decrypter for a track with the given protection
+// information, taking the key of its tenc default key ID from keys.
+func NewDecrypter(p *mp4.ProtectionInfo, keys Keys) (*Decrypter, error) {
+	if p.Encryption == nil {
+		return nil, ErrKeyNotFound
+	}
+	return newDecrypter(p.Scheme.Type, *p.Encryption, keys)
+}
+
+// newDecrypter returns a Decrypter for samples protected with scheme and
+// the parameters of t, from tenc or a seig sample group entry.
+func newDecrypter(scheme [4]byte, t mp4.TrackEncryption, keys Keys) (*Decrypter, error) {
+	if scheme != mp4.SchemeCENC && scheme != mp4.SchemeCBCS {
+		return nil, ErrUnsupportedScheme
+	}
+	key, ok := keys[t.DefaultKID]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Decrypter{
+		scheme:     scheme,
+		block:      block,
+		cryptBlock: int(t.DefaultCryptByteBlock),
+		skipBlock:  int(t.DefaultSkipByteBlock),
+		constantIV: t.DefaultConstantIV,
+	}, nil
+}
+
+// DecryptSample decrypts sample in place using its encryption parameters.
+func (d *Decrypter) DecryptSample(sample []byte, e mp4.SampleEncryption) error {
+	iv := e.IV
+	if len(iv) == 0 {
+		iv = d.constantIV
+	}
+	if len(iv) != 16 && (len(iv) != 8 || d.scheme != mp4.SchemeCENC) {
+		return ErrInvalidIV
+	}
+
+	// The protected ranges: the whole sample, or the protected part of
+	// each subsample.
+	ranges := [][]byte{sample}
+	if len(e.Subsamples) > 0 {
+		ranges = ranges[:0]
+		pos := 0
+		for _, s := range e.Subsamples {
+			pos += int(s.ClearBytes)
+			end := pos + int(s.ProtectedBytes)
+			if end > len(sample) {
+				return ErrInvalidSubsamples
+			}
+			ranges = append(ranges, sample[pos:end])
+			pos = end
+		}
+	}
+
+	if d.scheme == mp4.SchemeCENC {
+		// One key stream runs across all protected ranges; 8-byte IVs are
+		// the high half of the initial counter block.
+		var ctr [aes.BlockSize]byte
+		copy(ctr[:], iv)
+		stream := cipher.NewCTR(d.block, ctr[:])
+		for _, r := range ranges {
+			stream.XORKeyStream(r, r)
+		}
+		return nil
+	}
+
+	// cbcs restarts the CBC chain with the IV in every protected range and
+	// leaves partial trailing blocks clear.
+	for _, r := range ranges {
+		d.decryptPattern(r, iv)
+	}
+	return nil
+}
+
+// decryptPattern decrypts the encrypted blocks of one cbcs protected
+// range: cryptBlock blocks out of every cryptBlock+skipBlock, or every
+// full block if no pattern is set.
+func (d *Decrypter) decryptPattern(data, iv []byte) {
+	mode := cipher.NewCBCDecrypter(d.block, iv)
+	crypt := d.cryptBlock * aes.BlockSize
+	skip := d.skipBlock * aes.BlockSize
+	if crypt == 0 {
+		crypt, skip = len(data), 0
+	}
+	for off := 0; len(data)-off >= aes.BlockSize; off += crypt + skip {
+		n := min(crypt, len(data)-off) &^ (aes.BlockSize - 1)
+		mode.CryptBlocks(data[off:off+n], data[off:off+n])
+	}
+}
@@ -0,0 +1,222 @@
+package cenc
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+
+	"github.com/tetsuo/mp4"
+	"github.com/tetsuo/mp4/track"
+)
+
+// Key is a content key and its key ID.
+type Key struct {
+	ID  [16]byte
+	Key []byte // 16-byte AES key
+
+	// IV is the IV of the first sample for cenc, 8 or 16 bytes, and the
+	// constant IV of every sample for cbcs, 16 bytes. A random IV is used
+	// if nil.
+	IV []byte
+}
+
+// Encrypter encrypts the samples of one track with the cenc or cbcs
+// scheme.
+type Encrypter struct {
+	scheme [4]byte
+	block  cipher.Block
+	params mp4.TrackEncryption
+	iv     []byte // IV of the next sample for cenc, constant IV for cbcs
+
+	// NAL unit framing of AVC and HEVC samples; nalLengthSize is 0 for
+	// other codecs.
+	nalLengthSize int
+	hevc          bool
+	slices        *mp4.SliceHeaderParser
+}
+
+// NewEncrypter returns an Encrypter for the samples of t. Under cbcs,
+// video is encrypted with a 1:9 pattern and audio in full. AVC and HEVC
+// samples are split into subsamples that leave NAL unit lengths, slice
+// headers and non-VCL NAL units clear; slice headers are parsed with the
+// parameter sets of the decoder configuration and those found in the
+// samples.
+func NewEncrypter(t *track.Track, scheme [4]byte, key Key) (*Encrypter, error) {
+	if scheme != mp4.SchemeCENC && scheme != mp4.SchemeCBCS {
+		return nil, ErrUnsupportedScheme
+	}
+	block, err := aes.NewCipher(key.Key)
+	if err != nil {
+		return nil, err
+	}
+	e := &Encrypter{scheme: scheme, block: block, iv: key.IV}
+	switch {
+	case t.AVC != nil:
+		e.nalLengthSize = int(t.AVC.NALLengthSize)
+		e.slices = mp4.NewAVCSliceHeaderParser(t.AVC)
+	case t.HEVC != nil:
+		e.nalLengthSize = int(t.HEVC.NALLengthSize)
+		e.hevc = true
+		e.slices = mp4.NewHEVCSliceHeaderParser(t.HEVC)
+	}
+
+	e.params = mp4.TrackEncryption{DefaultIsProtected: true, DefaultKID: key.ID}
+	if scheme == mp4.SchemeCENC {
+		if e.iv == nil {
+			e.iv = make([]byte, 8)
+			rand.Read(e.iv)
+		}
+		if len(e.iv) != 8 && len(e.iv) != 16 {
+			return nil, ErrInvalidIV
+		}
+		e.iv = append([]byte(nil), e.iv...)
+		e.params.DefaultPerSampleIVSize = uint8(len(e.iv))
+		return e, nil
+	}
+	if e.iv == nil {
+		e.iv = make([]byte, 16)
+		rand.Read(e.iv)
+	}
+	if len(e.iv) != 16 {
+		return nil, ErrInvalidIV
+	}
+	if t.Kind == track.TrackVideo {
+		e.params.DefaultCryptByteBlock = 1
+		e.params.DefaultSkipByteBlock = 9
+	}
+	e.params.DefaultConstantIV = e.iv
+	return e, nil
+}
+
+// Encryption returns the parameters of the samples e encrypts, as written
+// to tenc or a seig sample group entry.
+func (e *Encrypter) Encryption() mp4.TrackEncryption { return e.params }
+
+// EncryptSample encrypts sample in place and returns its senc entry.
+func (e *Encrypter) EncryptSample(sample []byte) (mp4.SampleEncryption, error) {
+	var se mp4.SampleEncryption
+	ranges := [][]byte{sample}
+	if e.nalLengthSize > 0 {
+		var err error
+		if se.Subsamples, err = e.subsamples(sample); err != nil {
+			return se, err
+		}
+		ranges = ranges[:0]
+		pos := 0
+		for _, s := range se.Subsamples {
+			pos += int(s.ClearBytes)
+			ranges = append(ranges, sample[pos:pos+int(s.ProtectedBytes)])
+			pos += int(s.ProtectedBytes)
+		}
+	}
+
+	if e.scheme == mp4.SchemeCBCS {
+		for _, r := range ranges {
+			e.encryptPattern(r)
+		}
+		return se, nil
+	}
+
+	se.IV = append([]byte(nil), e.iv...)
+	var ctr [aes.BlockSize]byte
+	copy(ctr[:], e.iv)
+	stream := cipher.NewCTR(e.block, ctr[:])
+	var blocks uint64
+	for _, r := range ranges {
+		stream.XORKeyStream(r, r)
+		blocks += uint64(len(r))
+	}
+	// 8-byte IVs count samples; 16-byte IVs skip past the counter blocks
+	// the sample used so that no two samples share key stream.
+	if len(e.iv) == 8 {
+		binary.BigEndian.PutUint64(e.iv, binary.BigEndian.Uint64(e.iv)+1)
+	} else {
+		blocks = (blocks + aes.BlockSize - 1) / aes.BlockSize
+		lo := binary.BigEndian.Uint64(e.iv[8:])
+		if lo+blocks < lo {
+			binary.BigEndian.PutUint64(e.iv, binary.BigEndian.Uint64(e.iv)+1)
+		}
+		binary.BigEndian.PutUint64(e.iv[8:], lo+blocks)
+	}
+	return se, nil
+}
+
+// encryptPattern encrypts one cbcs protected range in place, the
+// counterpart of Decrypter.decryptPattern.
+func (e *Encrypter) encryptPattern(data []byte) {
+	mode := cipher.NewCBCEncrypter(e.block, e.iv)
+	crypt := int(e.params.DefaultCryptByteBlock) * aes.BlockSize
+	skip := int(e.params.DefaultSkipByteBlock) * aes.BlockSize
+	if crypt == 0 {
+		crypt, skip = len(data), 0
+	}
+	for off := 0; len(data)-off >= aes.BlockSize; off += crypt + skip {
+		n := min(crypt, len(data)-off) &^ (aes.BlockSize - 1)
+		mode.CryptBlocks(data[off:off+n], data[off:off+n])
+	}
+}
+
+// subsamples splits a sample of length-prefixed NAL units into subsamples.
+// Each VCL NAL unit is protected after its slice header in whole 16-byte
+// blocks, as ISO/IEC 23001-7 requires of both schemes; everything else is
+// clear.
+func (e *Encrypter) subsamples(sample []byte) ([]mp4.Subsample, error) {
+	var subs []mp4.Subsample
+	var clearBytes int
+	addClear := func(n int) {
+		clearBytes += n
+		for clearBytes > 0xffff {
+			subs = append(subs, mp4.Subsample{ClearBytes: 0xffff})
+			clearBytes -= 0xffff
+		}
+	}
+	for pos := 0; pos < len(sample); {
+		if len(sample)-pos < e.nalLengthSize {
+			return nil, ErrInvalidNALUnits
+		}
+		var n int
+		for _, b := range sample[pos : pos+e.nalLengthSize] {
+			n = n<<8 | int(b)
+		}
+		pos += e.nalLengthSize
+		if n > len(sample)-pos {
+			return nil, ErrInvalidNALUnits
+		}
+		nal := sample[pos : pos+n]
+		pos += n
+
+		protected := 0
+		if len(nal) > 0 && e.isVCL(nal[0]) {
+			headerSize, err := e.slices.HeaderSize(nal)
+			if err != nil {
+				return nil, err
+			}
+			protected = (len(nal) - headerSize) &^ (aes.BlockSize - 1)
+		} else if len(nal) > 0 {
+			// Parameter sets in the samples replace those of the decoder
+			// configuration; slices that need one that fails to parse fail
+			// themselves.
+			e.slices.AddParameterSet(nal)
+		}
+		addClear(e.nalLengthSize + len(nal) - protected)
+		if protected > 0 {
+			subs = append(subs, mp4.Subsample{ClearBytes: uint16(clearBytes), ProtectedBytes: uint32(protected)})
+			clearBytes = 0
+		}
+	}
+	if clearBytes > 0 || len(subs) == 0 {
+		subs = append(subs, mp4.Subsample{ClearBytes: uint16(clearBytes)})
+	}
+	return subs, nil
+}
+
+// isVCL reports whether a NAL unit with first header byte b holds coded
+// slice data.
+func (e *Encrypter) isVCL(b byte) bool {
+	if e.hevc {
+		return (b>>1)&0x3f < 32
+	}
+	t := b & 0x1f
+	return t >= 1 && t <= 5
+}
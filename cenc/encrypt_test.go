@@ -0,0 +1,113 @@
+package cenc_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/tetsuo/mp4"
+	"github.com/tetsuo/mp4/cenc"
+	"github.com/tetsuo/mp4/track"
+)
+
+var testKey = cenc.Key{
+	ID:  [16]byte{0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f},
+	Key: []byte{0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f},
+}
+
+// testAVC holds the parameter sets of an x264 1080p High profile stream
+// with CABAC.
+var testAVC = mp4.AVCConfig{
+	NALLengthSize: 4,
+	SPS: [][]byte{{
+		0x67, 0x64, 0x00, 0x28, 0xac, 0xd9, 0x40, 0x78, 0x02, 0x27, 0xe5, 0x84, 0x00,
+		0x00, 0x03, 0x00, 0x04, 0x00, 0x00, 0x03, 0x00, 0xf0, 0x3c, 0x60, 0xc6, 0x58,
+	}},
+	PPS: [][]byte{{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0}},
+}
+
+// testIDRSlice is an IDR slice whose 9-byte header, after the NAL unit
+// header, holds an emulation prevention byte, followed by 64 bytes of
+// slice data.
+var testIDRSlice = append([]byte{
+	0x65,                                                 // nal_ref_idc 3, IDR
+	0x88, 0x80, 0x00, 0x04, 0x00, 0x00, 0x03, 0x03, 0xff, // I slice, idr_pic_id 65535
+}, bytes.Repeat([]byte{0xa5}, 64)...)
+
+func TestEncryptSliceHeaderClear(t *testing.T) {
+	tr := &track.Track{Kind: track.TrackVideo, AVC: &testAVC}
+	aud := []byte{0x09, 0xf0}
+	sample := []byte{0, 0, 0, byte(len(aud))}
+	sample = append(sample, aud...)
+	sample = append(sample, 0, 0, 0, byte(len(testIDRSlice)))
+	sample = append(sample, testIDRSlice...)
+	// The access unit delimiter, all NAL unit lengths and the slice header
+	// stay clear.
+	clear := 4 + len(aud) + 4 + 10
+
+	for _, scheme := range [][4]byte{mp4.SchemeCENC, mp4.SchemeCBCS} {
+		t.Run(string(scheme[:]), func(t *testing.T) {
+			e, err := cenc.NewEncrypter(tr, scheme, testKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			enc := bytes.Clone(sample)
+			se, err := e.EncryptSample(enc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []mp4.Subsample{{ClearBytes: uint16(clear), ProtectedBytes: 64}}
+			if len(se.Subsamples) != 1 || se.Subsamples[0] != want[0] {
+				t.Fatalf("subsamples = %+v, want %+v", se.Subsamples, want)
+			}
+			if !bytes.Equal(enc[:clear], sample[:clear]) {
+				t.Errorf("clear bytes changed: % x", enc[:clear])
+			}
+			if bytes.Equal(enc[clear:clear+16], sample[clear:clear+16]) {
+				t.Error("slice data not encrypted")
+			}
+
+			params := e.Encryption()
+			d, err := cenc.NewDecrypter(&mp4.ProtectionInfo{
+				Scheme:     mp4.ProtectionScheme{Type: scheme},
+				Encryption: &params,
+			}, cenc.Keys{testKey.ID: testKey.Key})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := d.DecryptSample(enc, se); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(enc, sample) {
+				t.Error("decrypted sample differs from the original")
+			}
+		})
+	}
+}
+
+func TestEncryptUnknownParameterSet(t *testing.T) {
+	tr := &track.Track{Kind: track.TrackVideo, AVC: &mp4.AVCConfig{NALLengthSize: 4}}
+	e, err := cenc.NewEncrypter(tr, mp4.SchemeCENC, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sample := append([]byte{0, 0, 0, byte(len(testIDRSlice))}, testIDRSlice...)
+	if _, err := e.EncryptSample(sample); err != mp4.ErrUnknownParameterSet {
+		t.Errorf("err = %v, want %v", err, mp4.ErrUnknownParameterSet)
+	}
+
+	// Parameter sets carried in the sample are used for the slices after
+	// them.
+	var inband []byte
+	for _, nal := range [][]byte{testAVC.SPS[0], testAVC.PPS[0], testIDRSlice} {
+		inband = append(inband, 0, 0, 0, byte(len(nal)))
+		inband = append(inband, nal...)
+	}
+	se, err := e.EncryptSample(inband)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clear := len(inband) - 64
+	if len(se.Subsamples) != 1 || int(se.Subsamples[0].ClearBytes) != clear {
+		t.Errorf("subsamples = %+v, want %d clear bytes", se.Subsamples, clear)
+	}
+}
@@ -0,0 +1,507 @@
+package cenc
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"slices"
+
+	"github.com/tetsuo/mp4"
+	"github.com/tetsuo/mp4/track"
+)
+
+var ErrMissingSampleInfo = errors.New("cenc: missing sample encryption information")
+
+// trackState is what decrypting the samples of one track needs.
+type trackState struct {
+	scheme [4]byte
+	tenc   mp4.TrackEncryption
+	keys   Keys
+
+	groups []mp4.TrackEncryption // seig entries of stbl
+}
+
+// sampleKey is how one sample is decrypted; dec is nil for clear samples.
+type sampleKey struct {
+	dec    *Decrypter
+	ivSize int
+}
+
+// key returns the sampleKey of samples protected with the parameters of t.
+func (st *trackState) key(t mp4.TrackEncryption) (sampleKey, error) {
+	if !t.DefaultIsProtected {
+		return sampleKey{}, nil
+	}
+	dec, err := newDecrypter(st.scheme, t, st.keys)
+	return sampleKey{dec, int(t.DefaultPerSampleIVSize)}, err
+}
+
+// sampleKeys returns how each of n samples is decrypted: by the seig
+// sample group sbgp maps it to, or else by the track defaults. local holds
+// the seig entries of the track fragment, if any.
+func (st *trackState) sampleKeys(n int, sbgp *mp4.SampleToGroup, local []mp4.TrackEncryption) ([]sampleKey, error) {
+	def, err := st.key(st.tenc)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]sampleKey, n)
+	for i := range keys {
+		keys[i] = def
+	}
+	if sbgp == nil {
+		return keys, nil
+	}
+	byIndex := map[uint32]sampleKey{0: def}
+	i := 0
+	for _, e := range sbgp.Entries {
+		k, ok := byIndex[e.GroupDescriptionIndex]
+		if !ok {
+			var t mp4.TrackEncryption
+			switch idx := int(e.GroupDescriptionIndex); {
+			case idx > 0x10000 && idx-0x10001 < len(local):
+				t = local[idx-0x10001]
+			case idx <= 0x10000 && idx-1 < len(st.groups):
+				t = st.groups[idx-1]
+			default:
+				return nil, ErrMissingSampleInfo
+			}
+			if k, err = st.key(t); err != nil {
+				return nil, err
+			}
+			byIndex[e.GroupDescriptionIndex] = k
+		}
+		for j := uint32(0); j < e.SampleCount && i < n; j++ {
+			keys[i] = k
+			i++
+		}
+	}
+	return keys, nil
+}
+
+// DecryptFile writes a clear copy of the encrypted size-byte MP4 file read
+// from src to dst, taking content keys by key ID from keys. Progressive
+// files, with sample auxiliary information located by saiz and saio in
+// stbl, and fragmented ones, with senc or saiz and saio in each traf, are
+// supported, as are keys rotated with seig sample groups.
+//
+// Encrypted sample entries get back the type named in their frma box. The
+// sinf, pssh, senc, saiz and saio boxes and seig sample groups are
+// overwritten with free boxes of the same size, so that chunk offsets, trun
+// data offsets and sidx sizes stay valid.
+func DecryptFile(dst io.Writer, src io.ReaderAt, size int64, keys Keys) error {
+	buf := make([]byte, size)
+	if n, err := src.ReadAt(buf, 0); n < len(buf) {
+		return err
+	}
+
+	var moov []byte
+	r := mp4.NewReader(buf)
+	for r.Next() {
+		if r.Type() == mp4.TypeMoov {
+			moov = r.RawBox()
+			break
+		}
+	}
+	tracks, _, err := track.ParseTracks(moov)
+	if err != nil {
+		return err
+	}
+	states := make(map[uint32]*trackState)
+	for _, t := range tracks {
+		p := t.Protection
+		if p == nil {
+			continue
+		}
+		if p.Scheme.Type != mp4.SchemeCENC && p.Scheme.Type != mp4.SchemeCBCS {
+			return ErrUnsupportedScheme
+		}
+		if p.Encryption == nil {
+			return ErrMissingSampleInfo
+		}
+		states[t.ID] = &trackState{scheme: p.Scheme.Type, tenc: *p.Encryption, keys: keys}
+	}
+
+	if err := decryptMoov(buf, moov, tracks, states); err != nil {
+		return err
+	}
+
+	defaults := readTrex(moov)
+
+	var pos int64
+	r = mp4.NewReader(buf)
+	for r.Next() {
+		raw := r.RawBox()
+		if r.Type() == mp4.TypeMoof {
+			if err := decryptMoof(buf, raw, pos, defaults, states); err != nil {
+				return err
+			}
+		}
+		pos += int64(len(raw))
+	}
+
+	_, err = dst.Write(buf)
+	return err
+}
+
+// decryptMoov decrypts the samples of progressive encrypted tracks and
+// clears the protection boxes of the moov box.
+func decryptMoov(buf, moov []byte, tracks []*track.Track, states map[uint32]*trackState) error {
+	r := mp4.NewReader(moov)
+	r.Next()
+	r.Enter()
+	defer r.Exit()
+	for r.Next() {
+		switch r.Type() {
+		case mp4.TypePssh:
+			clearProtection(&r)
+		case mp4.TypeTrak:
+			r.Enter()
+			var id uint32
+			for r.Next() {
+				switch r.Type() {
+				case mp4.TypeTkhd:
+					id, _, _, _ = r.ReadTkhd()
+				case mp4.TypeMdia:
+					t := track.FindTrack(tracks, id)
+					if err := decryptTrak(buf, &r, t, states[id]); err != nil {
+						r.Exit()
+						return err
+					}
+				}
+			}
+			r.Exit()
+		}
+	}
+	return nil
+}
+
+// decryptTrak decrypts the samples of the track whose mdia box r is at,
+// if it is encrypted and progressive, and clears its protection boxes.
+func decryptTrak(buf []byte, r *mp4.Reader, t *track.Track, st *trackState) error {
+	var saiz, saio, stsc []byte
+	var saizFlags, saioFlags uint32
+	var saioVersion uint8
+	var sbgp *mp4.SampleToGroup
+	var groups []mp4.TrackEncryption
+	var err error
+
+	r.Enter()
+	for r.Next() {
+		if r.Type() != mp4.TypeMinf {
+			continue
+		}
+		r.Enter()
+		for r.Next() {
+			if r.Type() != mp4.TypeStbl {
+				continue
+			}
+			r.Enter()
+			for r.Next() && err == nil {
+				clearProtection(r)
+				switch r.Type() {
+				case mp4.TypeStsd:
+					clearSampleEntries(r)
+				case mp4.TypeStsc:
+					stsc = r.Data()
+				case mp4.TypeSaiz:
+					saiz, saizFlags = r.Data(), r.Flags()
+				case mp4.TypeSaio:
+					saio, saioFlags, saioVersion = r.Data(), r.Flags(), r.Version()
+				case mp4.TypeSbgp:
+					var g mp4.SampleToGroup
+					if g, err = mp4.ReadSbgp(r.Data(), r.Version()); err == nil && g.GroupingType == mp4.GroupingSeig {
+						sbgp = &g
+					}
+				case mp4.TypeSgpd:
+					groups, err = readSeigGroups(r, groups)
+				}
+			}
+			r.Exit()
+		}
+		r.Exit()
+	}
+	r.Exit()
+	if err != nil || st == nil {
+		return err
+	}
+	st.groups = groups
+
+	if t == nil || len(t.Samples) == 0 {
+		return nil
+	}
+	if saiz == nil || saio == nil {
+		return ErrMissingSampleInfo
+	}
+	sizes, err := mp4.ReadSaiz(saiz, saizFlags)
+	if err != nil {
+		return err
+	}
+	offsets, err := mp4.ReadSaio(saio, saioVersion, saioFlags)
+	if err != nil {
+		return err
+	}
+	keys, err := st.sampleKeys(len(t.Samples), sbgp, nil)
+	if err != nil {
+		return err
+	}
+	var chunks []int
+	if len(offsets.Offsets) > 1 {
+		chunks = chunkSampleCounts(stsc, len(offsets.Offsets))
+	}
+	entries, err := readAuxInfo(buf, 0, sizes, offsets, chunks, keys)
+	if err != nil {
+		return err
+	}
+	for i, s := range t.Samples {
+		if err := decryptSample(buf, s.Offset, s.Size, entries[i], keys[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clearSampleEntries gives the encv and enca entries of the stsd box r is
+// at their original type and turns their sinf boxes into free boxes.
+func clearSampleEntries(r *mp4.Reader) {
+	r.Enter()
+	defer r.Exit()
+	r.Skip(4) // entry count
+	for r.Next() {
+		var childOffset int
+		switch r.Type() {
+		case mp4.TypeEncv:
+			if len(r.Data()) < 78 {
+				continue
+			}
+			childOffset = 78
+		case mp4.TypeEnca:
+			if len(r.Data()) < 28 {
+				continue
+			}
+			childOffset = mp4.ReadAudioSampleEntry(r.Data()).ChildOffset
+		default:
+			continue
+		}
+		cr := mp4.NewReader(r.Data()[childOffset:])
+		for cr.Next() {
+			if cr.Type() != mp4.TypeSinf {
+				continue
+			}
+			if p, err := mp4.ReadSinf(cr.Data()); err == nil {
+				setType(r.RawBox(), p.OriginalFormat)
+			}
+			setType(cr.RawBox(), mp4.TypeFree)
+		}
+	}
+}
+
+// isProtectionBox reports whether the box r is at only describes
+// encryption: pssh, senc, saiz, saio or a seig sample group.
+func isProtectionBox(r *mp4.Reader) bool {
+	switch r.Type() {
+	case mp4.TypePssh, mp4.TypeSenc, mp4.TypeSaiz, mp4.TypeSaio:
+		return true
+	case mp4.TypeSbgp, mp4.TypeSgpd:
+		d := r.Data()
+		return len(d) >= 4 && [4]byte(d[0:4]) == mp4.GroupingSeig
+	}
+	return false
+}
+
+// clearProtection turns the box r is at into a free box if it only
+// describes encryption.
+func clearProtection(r *mp4.Reader) {
+	if isProtectionBox(r) {
+		setType(r.RawBox(), mp4.TypeFree)
+	}
+}
+
+// decryptMoof decrypts the samples of the encrypted track fragments of the
+// moof box raw at offset moofOffset in buf, and clears its protection
+// boxes. defaults holds the trex defaults of the movie's tracks.
+func decryptMoof(buf, raw []byte, moofOffset int64, defaults map[uint32]mp4.SampleDefaults, states map[uint32]*trackState) error {
+	frags, err := mp4.ReadTrackFragments(raw, moofOffset, defaults)
+	if err != nil {
+		return err
+	}
+	r := mp4.NewReader(raw)
+	r.Next()
+	r.Enter()
+	defer r.Exit()
+	i := 0
+	for r.Next() {
+		if r.Type() != mp4.TypeTraf {
+			clearProtection(&r)
+			continue
+		}
+		traf := r.RawBox()
+		f, err := readTrackFragment(&r, frags[i])
+		if err != nil {
+			return err
+		}
+		i++
+		st := states[f.Header.TrackID]
+		if st != nil && len(f.Samples) > 0 {
+			if err := decryptFragment(buf, &f, moofOffset, st); err != nil {
+				return err
+			}
+		}
+
+		tr := mp4.NewReader(traf)
+		tr.Next()
+		tr.Enter()
+		for tr.Next() {
+			clearProtection(&tr)
+		}
+		tr.Exit()
+	}
+	return nil
+}
+
+// decryptFragment decrypts the samples of track fragment f.
+func decryptFragment(buf []byte, f *trackFragment, moofOffset int64, st *trackState) error {
+	keys, err := st.sampleKeys(len(f.Samples), f.sbgp, f.sgpd)
+	if err != nil {
+		return err
+	}
+	// Fragments whose samples are all clear, such as those of a clear
+	// lead, need no sample encryption information.
+	if !slices.ContainsFunc(keys, func(k sampleKey) bool { return k.dec != nil }) {
+		return nil
+	}
+	var entries []mp4.SampleEncryption
+	switch {
+	case f.senc != nil:
+		entries, err = readSenc(f.senc, f.sencFlags, keys)
+	case f.saiz != nil && f.saio != nil:
+		var sizes mp4.SampleAuxInfoSizes
+		var offsets mp4.SampleAuxInfoOffsets
+		if sizes, err = mp4.ReadSaiz(f.saiz, f.saizFlags); err != nil {
+			return err
+		}
+		if offsets, err = mp4.ReadSaio(f.saio, f.saioVersion, f.saioFlags); err != nil {
+			return err
+		}
+		// saio offsets in a traf are relative to the moof unless tfhd
+		// sets a base data offset.
+		auxBase := moofOffset
+		if f.Header.Flags&mp4.TfhdBaseDataOffsetPresent != 0 {
+			auxBase = int64(f.Header.BaseDataOffset)
+		}
+		chunks := make([]int, len(f.Runs))
+		for i, run := range f.Runs {
+			chunks[i] = len(run.Entries)
+		}
+		entries, err = readAuxInfo(buf, auxBase, sizes, offsets, chunks, keys)
+	default:
+		return ErrMissingSampleInfo
+	}
+	if err != nil {
+		return err
+	}
+	for i, s := range f.Samples {
+		if err := decryptSample(buf, s.Offset, s.Size, entries[i], keys[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readSenc reads an entry of senc box data for each sample keys describes.
+func readSenc(data []byte, flags uint32, keys []sampleKey) ([]mp4.SampleEncryption, error) {
+	if len(data) < 4 {
+		return nil, mp4.ErrTruncated
+	}
+	if int(binary.BigEndian.Uint32(data)) < len(keys) {
+		return nil, ErrMissingSampleInfo
+	}
+	entries := make([]mp4.SampleEncryption, len(keys))
+	ptr := 4
+	for i, k := range keys {
+		e, n, err := mp4.ReadSampleEncryption(data[ptr:], k.ivSize, flags&mp4.SencUseSubsamples != 0)
+		if err != nil {
+			return nil, err
+		}
+		entries[i] = e
+		ptr += n
+	}
+	return entries, nil
+}
+
+// readAuxInfo reads the CENC sample auxiliary information of the samples
+// keys describes, at offsets relative to base. With one offset the entries
+// are contiguous; otherwise there is one offset per chunk, whose sample
+// counts are given by chunks.
+func readAuxInfo(buf []byte, base int64, sizes mp4.SampleAuxInfoSizes, offsets mp4.SampleAuxInfoOffsets, chunks []int, keys []sampleKey) ([]mp4.SampleEncryption, error) {
+	if len(offsets.Offsets) == 0 || int(sizes.SampleCount) < len(keys) {
+		return nil, ErrMissingSampleInfo
+	}
+	if len(offsets.Offsets) == 1 {
+		chunks = []int{len(keys)}
+	} else if len(chunks) < len(offsets.Offsets) {
+		return nil, ErrMissingSampleInfo
+	}
+	entries := make([]mp4.SampleEncryption, 0, len(keys))
+	for c, off := range offsets.Offsets {
+		pos := base + int64(off)
+		for range chunks[c] {
+			i := len(entries)
+			if i == len(keys) {
+				return entries, nil
+			}
+			n := int64(sizes.Size(i))
+			if pos < 0 || pos+n > int64(len(buf)) {
+				return nil, mp4.ErrTruncated
+			}
+			ivSize := keys[i].ivSize
+			e, _, err := mp4.ReadSampleEncryption(buf[pos:pos+n], ivSize, int(n) > ivSize)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, e)
+			pos += n
+		}
+	}
+	if len(entries) < len(keys) {
+		return nil, ErrMissingSampleInfo
+	}
+	return entries, nil
+}
+
+// chunkSampleCounts returns the number of samples in each of the first n
+// chunks described by stsc box data.
+func chunkSampleCounts(stsc []byte, n int) []int {
+	counts := make([]int, n)
+	it := mp4.NewStscIter(stsc)
+	e, ok := it.Next()
+	for ok {
+		next, more := it.Next()
+		last := n
+		if more {
+			last = min(int(next.FirstChunk)-1, n)
+		}
+		for c := max(int(e.FirstChunk)-1, 0); c < last; c++ {
+			counts[c] = int(e.SamplesPerChunk)
+		}
+		e, ok = next, more
+	}
+	return counts
+}
+
+// decryptSample decrypts the size-byte sample at offset in buf with its
+// entry, if key protects it.
+func decryptSample(buf []byte, offset int64, size uint32, e mp4.SampleEncryption, key sampleKey) error {
+	if key.dec == nil {
+		return nil
+	}
+	end := offset + int64(size)
+	if offset < 0 || end > int64(len(buf)) {
+		return mp4.ErrTruncated
+	}
+	return key.dec.DecryptSample(buf[offset:end], e)
+}
+
+// setType overwrites the type in the header of the raw box.
+func setType(raw []byte, t mp4.BoxType) {
+	copy(raw[4:8], t[:])
+}
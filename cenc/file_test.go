@@ -0,0 +1,271 @@
+package cenc_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"testing"
+
+	"github.com/tetsuo/mp4"
+	"github.com/tetsuo/mp4/cenc"
+	"github.com/tetsuo/mp4/internal/mp4test"
+	"github.com/tetsuo/mp4/track"
+)
+
+var (
+	defaultKID = [16]byte{0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f}
+	rotatedKID = [16]byte{0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f}
+
+	testKeys = cenc.Keys{
+		defaultKID: {0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f},
+		rotatedKID: {0x40, 0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49, 0x4a, 0x4b, 0x4c, 0x4d, 0x4e, 0x4f},
+	}
+)
+
+// testFragment describes a fragment of a test file by the key ID its
+// samples are encrypted with, zero for clear samples.
+type testFragment struct {
+	kid     [16]byte
+	samples int
+}
+
+// testEncryption returns the encryption parameters of scheme with kid.
+func testEncryption(scheme [4]byte, kid [16]byte) mp4.TrackEncryption {
+	if kid == [16]byte{} {
+		return mp4.TrackEncryption{}
+	}
+	if scheme == mp4.SchemeCBCS {
+		return mp4.TrackEncryption{
+			DefaultCryptByteBlock: 1,
+			DefaultSkipByteBlock:  9,
+			DefaultIsProtected:    true,
+			DefaultKID:            kid,
+			DefaultConstantIV:     bytes.Repeat([]byte{0x5a}, 16),
+		}
+	}
+	return mp4.TrackEncryption{DefaultIsProtected: true, DefaultPerSampleIVSize: 8, DefaultKID: kid}
+}
+
+// encryptSample encrypts the protected range of sample, which follows a
+// 4-byte clear header, as scheme does with the parameters of te.
+func encryptSample(t *testing.T, scheme [4]byte, te mp4.TrackEncryption, sample []byte, n int) mp4.SampleEncryption {
+	t.Helper()
+	block, err := aes.NewCipher(testKeys[te.DefaultKID])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := sample[4:]
+	e := mp4.SampleEncryption{Subsamples: []mp4.Subsample{{ClearBytes: 4, ProtectedBytes: uint32(len(data))}}}
+	if scheme == mp4.SchemeCENC {
+		e.IV = []byte{0, 0, 0, 0, 0, 0, 1, byte(n)}
+		var ctr [16]byte
+		copy(ctr[:], e.IV)
+		cipher.NewCTR(block, ctr[:]).XORKeyStream(data, data)
+		return e
+	}
+	// One block of every ten, with the chain running across them.
+	mode := cipher.NewCBCEncrypter(block, te.DefaultConstantIV)
+	for off := 0; len(data)-off >= 16; off += 160 {
+		mode.CryptBlocks(data[off:off+16], data[off:off+16])
+	}
+	return e
+}
+
+// encryptedFile returns a fragmented file with a FLAC track protected with
+// scheme and defaultKID, with one fragment per element of frags, and the
+// clear data of its samples. Fragments with other keys name theirs in a
+// seig sample group. With auxInfo, the senc boxes are made free boxes, so
+// that the sample auxiliary information is found by saiz and saio only.
+func encryptedFile(t *testing.T, scheme [4]byte, auxInfo bool, frags []testFragment) ([]byte, [][]byte) {
+	t.Helper()
+	tenc := testEncryption(scheme, defaultKID)
+	si := mp4.FlacStreamInfo{MinBlockSize: 1024, MaxBlockSize: 1024, SampleRate: 48000, Channels: 2, BitsPerSample: 16}
+	movie := mp4test.Movie{
+		TimeScale: 1000,
+		Tracks: []mp4test.Track{{
+			ID: 1, Handler: mp4test.Audio, TimeScale: 48000,
+			Entry: mp4test.AudioEntry(mp4.TypeEnca, 2, 48000, func(w *mp4.Writer) {
+				w.WriteDfla(mp4.FlacConfig{Blocks: []mp4.FlacMetadataBlock{si.Block()}})
+				w.WriteSinf(mp4.ProtectionInfo{
+					OriginalFormat: mp4.TypeFlac,
+					Scheme:         mp4.ProtectionScheme{Type: scheme, Version: 0x00010000},
+					Encryption:     &tenc,
+				})
+			}),
+		}},
+		Extra: func(w *mp4.Writer) {
+			w.StartBox(mp4.TypeMvex)
+			w.WriteTrex(1, 1, 1024, 0, 0)
+			w.EndBox()
+			w.WritePssh(mp4.ProtectionSystemHeader{SystemID: mp4.SystemCommon, KeyIDs: [][16]byte{defaultKID}})
+		},
+	}
+	file := movie.Build()
+
+	var clear [][]byte
+	for i, f := range frags {
+		te := testEncryption(scheme, f.kid)
+		var entries []mp4.SampleEncryption
+		run := mp4.TrackRun{Flags: mp4.TrunDataOffsetPresent | mp4.TrunSampleSizePresent}
+		var mdat []byte
+		for j := range f.samples {
+			// Sizes that are not a multiple of the AES block size.
+			sample := bytes.Repeat([]byte{byte(len(clear))}, 100+j)
+			clear = append(clear, bytes.Clone(sample))
+			if te.DefaultIsProtected {
+				entries = append(entries, encryptSample(t, scheme, te, sample, len(clear)))
+			}
+			run.Entries = append(run.Entries, mp4.TrunEntry{Size: uint32(len(sample))})
+			mdat = append(mdat, sample...)
+		}
+
+		// The moof is written twice: the data offset is known once its
+		// size is.
+		w := mp4.NewWriter(make([]byte, 4096))
+		var senc int
+		writeMoof := func() {
+			w.Reset()
+			w.StartBox(mp4.TypeMoof)
+			w.WriteMfhd(uint32(i + 1))
+			w.StartBox(mp4.TypeTraf)
+			w.WriteTrackFragmentHeader(mp4.TrackFragmentHeader{Flags: mp4.TfhdDefaultBaseIsMoof, TrackID: 1})
+			w.WriteTfdt(uint64(i * f.samples * 1024))
+			w.WriteTrackRun(run)
+			if f.kid != defaultKID {
+				w.WriteSbgp(mp4.SampleToGroup{
+					GroupingType: mp4.GroupingSeig,
+					Entries:      []mp4.SampleToGroupEntry{{SampleCount: uint32(f.samples), GroupDescriptionIndex: 0x10001}},
+				})
+				w.WriteSgpd(mp4.SampleGroupDescription{
+					GroupingType: mp4.GroupingSeig,
+					Entries:      [][]byte{mp4.AppendSeig(nil, te)},
+				})
+			}
+			if entries != nil {
+				senc = w.Len()
+				w.WriteSenc(entries)
+				size := uint8(len(entries[0].IV) + 2 + 6)
+				w.WriteSaiz(mp4.SampleAuxInfoSizes{DefaultSize: size, SampleCount: uint32(len(entries))})
+				w.WriteSaio(mp4.SampleAuxInfoOffsets{Offsets: []uint64{uint64(senc + 16)}})
+			}
+			w.EndBox()
+			w.EndBox()
+		}
+		writeMoof()
+		run.DataOffset = int32(w.Len() + 8)
+		writeMoof()
+		if w.Err() != nil {
+			t.Fatal(w.Err())
+		}
+		moof := w.Bytes()
+		if auxInfo && entries != nil {
+			copy(moof[senc+4:], mp4.TypeFree[:])
+		}
+		file = append(file, moof...)
+
+		w = mp4.NewWriter(make([]byte, len(mdat)+8))
+		w.StartBox(mp4.TypeMdat)
+		w.Write(mdat)
+		w.EndBox()
+		file = append(file, w.Bytes()...)
+	}
+	return file, clear
+}
+
+// decryptFile returns file decrypted with keys.
+func decryptFile(file []byte, keys cenc.Keys) ([]byte, error) {
+	var b bytes.Buffer
+	err := cenc.DecryptFile(&b, bytes.NewReader(file), int64(len(file)), keys)
+	return b.Bytes(), err
+}
+
+// hasBox reports whether a box of type typ is in data, at any depth.
+func hasBox(data []byte, typ mp4.BoxType) bool {
+	r := mp4.NewReader(data)
+	for r.Next() {
+		if r.Type() == typ {
+			return true
+		}
+		if mp4.IsContainerBox(r.Type()) && hasBox(r.Data(), typ) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDecryptFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		scheme  [4]byte
+		auxInfo bool
+		frags   []testFragment
+	}{
+		{"cenc", mp4.SchemeCENC, false, []testFragment{{defaultKID, 3}, {defaultKID, 2}}},
+		{"cbcs", mp4.SchemeCBCS, false, []testFragment{{defaultKID, 3}, {defaultKID, 2}}},
+		{"saiz", mp4.SchemeCENC, true, []testFragment{{defaultKID, 3}, {defaultKID, 2}}},
+		{"rotation", mp4.SchemeCENC, false, []testFragment{{defaultKID, 2}, {rotatedKID, 2}, {defaultKID, 2}}},
+		{"clear lead", mp4.SchemeCBCS, false, []testFragment{{[16]byte{}, 2}, {rotatedKID, 2}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc, want := encryptedFile(t, tt.scheme, tt.auxInfo, tt.frags)
+			dec, err := decryptFile(enc, testKeys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(dec) != len(enc) {
+				t.Errorf("decrypted size = %d, want %d", len(dec), len(enc))
+			}
+
+			tracks, _, err := track.ParseTracks(mp4test.Moov(dec))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tr := tracks[0]
+			if tr.Protection != nil || tr.Codec() != "flac" {
+				t.Errorf("track codec = %q, protection %+v", tr.Codec(), tr.Protection)
+			}
+
+			var samples [][]byte
+			r := mp4.NewReader(dec)
+			for r.Next() {
+				if r.Type() == mp4.TypeMdat {
+					samples = append(samples, r.Data())
+				}
+			}
+			got := bytes.Join(samples, nil)
+			if !bytes.Equal(got, bytes.Join(want, nil)) {
+				t.Errorf("sample data = % x\nwant % x", got, bytes.Join(want, nil))
+			}
+
+			for _, typ := range []mp4.BoxType{mp4.TypeSinf, mp4.TypePssh, mp4.TypeSenc, mp4.TypeSaiz, mp4.TypeSaio, mp4.TypeSbgp, mp4.TypeSgpd} {
+				if hasBox(dec, typ) {
+					t.Errorf("%s box not cleared", typ)
+				}
+			}
+		})
+	}
+}
+
+func TestDecryptFileErrors(t *testing.T) {
+	enc, _ := encryptedFile(t, mp4.SchemeCENC, false, []testFragment{{defaultKID, 2}, {rotatedKID, 2}})
+	if _, err := decryptFile(enc, cenc.Keys{defaultKID: testKeys[defaultKID]}); !errors.Is(err, cenc.ErrKeyNotFound) {
+		t.Errorf("err = %v, want ErrKeyNotFound", err)
+	}
+
+	// Without senc, saiz and saio the samples cannot be decrypted.
+	enc, _ = encryptedFile(t, mp4.SchemeCENC, true, []testFragment{{defaultKID, 2}})
+	r := mp4.NewReader(enc)
+	for r.Next() {
+		if r.Type() == mp4.TypeMoof {
+			for _, typ := range []mp4.BoxType{mp4.TypeSaiz, mp4.TypeSaio} {
+				i := bytes.Index(r.RawBox(), typ[:])
+				copy(r.RawBox()[i:], mp4.TypeFree[:])
+			}
+		}
+	}
+	if _, err := decryptFile(enc, testKeys); !errors.Is(err, cenc.ErrMissingSampleInfo) {
+		t.Errorf("err = %v, want ErrMissingSampleInfo", err)
+	}
+}
@@ -0,0 +1,92 @@
+package cenc
+
+import (
+	"github.com/tetsuo/mp4"
+)
+
+// trackFragment holds a traf box with its samples, as located by
+// mp4.ReadTrackFragments, and the boxes describing their encryption.
+type trackFragment struct {
+	mp4.TrackFragment
+
+	senc        []byte
+	sencFlags   uint32
+	saiz        []byte
+	saizFlags   uint32
+	saio        []byte
+	saioFlags   uint32
+	saioVersion uint8
+
+	// seig sample group of the fragment, nil if absent.
+	sbgp *mp4.SampleToGroup
+	sgpd []mp4.TrackEncryption
+}
+
+// readTrackFragment reads the encryption boxes of the traf box r is at,
+// whose samples tf holds.
+func readTrackFragment(r *mp4.Reader, tf mp4.TrackFragment) (trackFragment, error) {
+	f := trackFragment{TrackFragment: tf}
+	var err error
+	r.Enter()
+	defer r.Exit()
+	for r.Next() && err == nil {
+		switch r.Type() {
+		case mp4.TypeSenc:
+			f.senc, f.sencFlags = r.Data(), r.Flags()
+		case mp4.TypeSaiz:
+			f.saiz, f.saizFlags = r.Data(), r.Flags()
+		case mp4.TypeSaio:
+			f.saio, f.saioFlags, f.saioVersion = r.Data(), r.Flags(), r.Version()
+		case mp4.TypeSbgp:
+			var g mp4.SampleToGroup
+			if g, err = mp4.ReadSbgp(r.Data(), r.Version()); err == nil && g.GroupingType == mp4.GroupingSeig {
+				f.sbgp = &g
+			}
+		case mp4.TypeSgpd:
+			f.sgpd, err = readSeigGroups(r, f.sgpd)
+		}
+	}
+	return f, err
+}
+
+// readSeigGroups appends the entries of the sgpd box r is at to groups if
+// it describes seig sample groups.
+func readSeigGroups(r *mp4.Reader, groups []mp4.TrackEncryption) ([]mp4.TrackEncryption, error) {
+	d, err := mp4.ReadSgpd(r.Data(), r.Version())
+	if err != nil || d.GroupingType != mp4.GroupingSeig {
+		return groups, err
+	}
+	for _, e := range d.Entries {
+		t, err := mp4.ReadSeig(e)
+		if err != nil {
+			return groups, err
+		}
+		groups = append(groups, t)
+	}
+	return groups, nil
+}
+
+// readTrex returns the sample defaults of the trex boxes of moov box raw
+// by track ID. They locate the samples of clear tracks' fragments too,
+// which place the data of the track fragments that follow them.
+func readTrex(moov []byte) map[uint32]mp4.SampleDefaults {
+	defaults := make(map[uint32]mp4.SampleDefaults)
+	r := mp4.NewReader(moov)
+	r.Next()
+	r.Enter()
+	defer r.Exit()
+	for r.Next() {
+		if r.Type() != mp4.TypeMvex {
+			continue
+		}
+		r.Enter()
+		for r.Next() {
+			if r.Type() == mp4.TypeTrex && len(r.Data()) >= 20 {
+				id, _, duration, size, flags := r.ReadTrex()
+				defaults[id] = mp4.SampleDefaults{Duration: duration, Size: size, Flags: flags}
+			}
+		}
+		r.Exit()
+	}
+	return defaults
+}
@@ -0,0 +1,513 @@
+package cenc
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+
+	"github.com/tetsuo/mp4"
+	"github.com/tetsuo/mp4/track"
+)
+
+var (
+	ErrNotFragmented    = errors.New("cenc: file is not fragmented")
+	ErrUnsupportedTrack = errors.New("cenc: track is not an audio or video track")
+	ErrAuxInfoSize      = errors.New("cenc: sample encryption entry exceeds 255 bytes")
+	ErrSegmentSize      = errors.New("cenc: segment data offset exceeds 2GB")
+)
+
+// EncryptOptions configures EncryptFile.
+type EncryptOptions struct {
+	Scheme [4]byte // mp4.SchemeCENC or mp4.SchemeCBCS
+
+	// Keys holds the keys of the tracks to encrypt by track ID; other
+	// tracks stay clear. The first key of a track is its default, written
+	// to tenc. Given more, the track's fragments rotate through them,
+	// KeyPeriod fragments per key, each naming its key in a seig sample
+	// group.
+	Keys      map[uint32][]Key
+	KeyPeriod int // 1 if 0
+
+	// ClearLead is the number of leading fragments of each encrypted track
+	// left clear. Their samples are mapped to a seig sample group entry
+	// that is not protected, and key rotation starts after them.
+	ClearLead int
+
+	// PSSH lists the pssh boxes to add to moov.
+	PSSH []mp4.ProtectionSystemHeader
+}
+
+// trackEncrypter encrypts the fragments of one track.
+type trackEncrypter struct {
+	kind      track.TrackKind
+	encs      []*Encrypter // one per key
+	fragments int          // track fragments encrypted so far
+}
+
+// packager holds the state of one EncryptFile call.
+type packager struct {
+	scheme    [4]byte
+	period    int
+	clearLead int
+	pssh      []mp4.ProtectionSystemHeader
+	tracks    map[uint32]*trackEncrypter
+	defaults  map[uint32]mp4.SampleDefaults // trex defaults, which locate samples
+}
+
+// EncryptFile writes an encrypted copy of the fragmented size-byte MP4 file
+// read from src to dst.
+//
+// Sample entries of encrypted tracks become encv or enca entries with a
+// sinf box, and each of their track fragments gets senc, saiz and saio
+// boxes. As fragments grow, every tfhd is rewritten to default-base-is-moof
+// with explicit trun data offsets and sidx sizes are updated; mfra boxes,
+// whose offsets would go stale, are dropped.
+//
+// saiz records the size of each sample's senc entry in a byte, so samples
+// with more subsamples than fit in 255 bytes, 41 with 8-byte IVs, are
+// rejected with ErrAuxInfoSize. Runs whose data starts 2GB or more past
+// their moof are rejected with ErrSegmentSize.
+func EncryptFile(dst io.Writer, src io.ReaderAt, size int64, opts EncryptOptions) error {
+	buf := make([]byte, size)
+	if n, err := src.ReadAt(buf, 0); n < len(buf) {
+		return err
+	}
+
+	var moov []byte
+	r := mp4.NewReader(buf)
+	for r.Next() {
+		if r.Type() == mp4.TypeMoov {
+			moov = r.RawBox()
+			break
+		}
+	}
+	tracks, _, err := track.ParseTracks(moov)
+	if err != nil {
+		return err
+	}
+
+	p := &packager{
+		scheme:    opts.Scheme,
+		period:    max(opts.KeyPeriod, 1),
+		clearLead: max(opts.ClearLead, 0),
+		pssh:      opts.PSSH,
+		tracks:    make(map[uint32]*trackEncrypter),
+		defaults:  readTrex(moov),
+	}
+	for id, keys := range opts.Keys {
+		t := track.FindTrack(tracks, id)
+		if t == nil || len(keys) == 0 || t.Kind != track.TrackVideo && t.Kind != track.TrackAudio {
+			return ErrUnsupportedTrack
+		}
+		te := &trackEncrypter{kind: t.Kind}
+		for _, k := range keys {
+			e, err := NewEncrypter(t, opts.Scheme, k)
+			if err != nil {
+				return err
+			}
+			te.encs = append(te.encs, e)
+		}
+		p.tracks[id] = te
+	}
+
+	// Top-level boxes are rewritten one by one; newPos maps their input
+	// offsets to output offsets for sidx.
+	var out [][]byte
+	var sidxs []int64
+	newPos := make(map[int64]int64)
+	var inPos, outPos int64
+	r = mp4.NewReader(buf)
+	for r.Next() {
+		raw := r.RawBox()
+		b := raw
+		switch r.Type() {
+		case mp4.TypeMoov:
+			b, err = p.writeMoov(raw)
+		case mp4.TypeMoof:
+			b, err = p.writeMoof(buf, raw, inPos)
+		case mp4.TypeMfra:
+			b = nil
+		case mp4.TypeSidx:
+			sidxs = append(sidxs, inPos)
+		}
+		if err != nil {
+			return err
+		}
+		newPos[inPos] = outPos
+		out = append(out, b)
+		inPos += int64(len(raw))
+		outPos += int64(len(b))
+	}
+	newPos[inPos] = outPos
+
+	for _, pos := range sidxs {
+		updateSidx(buf[pos:], pos, newPos)
+	}
+	for _, b := range out {
+		if _, err := dst.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeMoov returns moov box raw with the sample entries of encrypted
+// tracks protected and the pssh boxes added.
+func (p *packager) writeMoov(raw []byte) ([]byte, error) {
+	size := len(raw) + 1024*len(p.tracks)
+	for _, h := range p.pssh {
+		size += 36 + 16*len(h.KeyIDs) + len(h.Data)
+	}
+	w := mp4.NewWriter(make([]byte, size))
+	fragmented := false
+
+	r := mp4.NewReader(raw)
+	r.Next()
+	w.StartBox(mp4.TypeMoov)
+	r.Enter()
+	for r.Next() {
+		switch r.Type() {
+		case mp4.TypeMvex:
+			fragmented = true
+			w.Write(r.RawBox())
+		case mp4.TypeTrak:
+			if te := p.tracks[trakID(r.RawBox())]; te != nil {
+				p.writeTrak(&w, &r, te)
+			} else {
+				w.Write(r.RawBox())
+			}
+		default:
+			w.Write(r.RawBox())
+		}
+	}
+	r.Exit()
+	for _, h := range p.pssh {
+		w.WritePssh(h)
+	}
+	w.EndBox()
+
+	if !fragmented {
+		return nil, ErrNotFragmented
+	}
+	return w.Bytes(), w.Err()
+}
+
+// trakID returns the track ID from the tkhd box of trak box raw.
+func trakID(raw []byte) uint32 {
+	r := mp4.NewReader(raw)
+	r.Next()
+	r.Enter()
+	for r.Next() {
+		if r.Type() == mp4.TypeTkhd {
+			id, _, _, _ := r.ReadTkhd()
+			return id
+		}
+	}
+	return 0
+}
+
+// writeTrak copies the trak box r is at to w, turning the sample entries
+// in its stsd box into encv or enca entries holding a sinf box.
+func (p *packager) writeTrak(w *mp4.Writer, r *mp4.Reader, te *trackEncrypter) {
+	path := []mp4.BoxType{mp4.TypeTrak, mp4.TypeMdia, mp4.TypeMinf, mp4.TypeStbl}
+	var copyAlong func(path []mp4.BoxType)
+	copyAlong = func(path []mp4.BoxType) {
+		w.StartBox(r.Type())
+		r.Enter()
+		for r.Next() {
+			switch {
+			case len(path) > 1 && r.Type() == path[1]:
+				copyAlong(path[1:])
+			case len(path) == 1 && r.Type() == mp4.TypeStsd:
+				p.writeStsd(w, r, te)
+			default:
+				w.Write(r.RawBox())
+			}
+		}
+		r.Exit()
+		w.EndBox()
+	}
+	copyAlong(path)
+}
+
+// writeStsd writes the stsd box r is at with protected sample entries.
+func (p *packager) writeStsd(w *mp4.Writer, r *mp4.Reader, te *trackEncrypter) {
+	entryType := mp4.TypeEncv
+	if te.kind == track.TrackAudio {
+		entryType = mp4.TypeEnca
+	}
+	enc := te.encs[0].Encryption()
+
+	data := r.Data()
+	w.StartFullBox(mp4.TypeStsd, r.Version(), r.Flags())
+	w.Write(data[:4]) // entry count
+	er := mp4.NewReader(data[4:])
+	for er.Next() {
+		w.StartBox(entryType)
+		w.Write(er.Data())
+		w.WriteSinf(mp4.ProtectionInfo{
+			OriginalFormat: er.Type(),
+			Scheme:         mp4.ProtectionScheme{Type: p.scheme, Version: 0x00010000},
+			Encryption:     &enc,
+		})
+		w.EndBox()
+	}
+	w.EndBox()
+}
+
+// trafOut is a track fragment read and encrypted, ready to be written.
+type trafOut struct {
+	f trackFragment
+
+	// Encrypter and senc entries of the samples, nil for clear tracks and
+	// fragments of the clear lead.
+	enc     *Encrypter
+	entries []mp4.SampleEncryption
+	sizes   mp4.SampleAuxInfoSizes
+	rotate  bool // name the key in a seig sample group
+
+	clearLead bool // of a track's clear lead, left clear
+}
+
+// writeMoof encrypts the samples of the moof box raw at moofOffset in buf
+// and returns the moof box with their encryption information.
+func (p *packager) writeMoof(buf, raw []byte, moofOffset int64) ([]byte, error) {
+	frags, err := mp4.ReadTrackFragments(raw, moofOffset, p.defaults)
+	if err != nil {
+		return nil, err
+	}
+	var trafs []trafOut
+	size := len(raw) + 64
+
+	r := mp4.NewReader(raw)
+	r.Next()
+	r.Enter()
+	for r.Next() {
+		if r.Type() != mp4.TypeTraf {
+			continue
+		}
+		f, err := readTrackFragment(&r, frags[len(trafs)])
+		if err != nil {
+			return nil, err
+		}
+		t := trafOut{f: f}
+		size += 64 + 4*len(f.Runs)
+
+		te := p.tracks[f.Header.TrackID]
+		switch {
+		case te != nil && te.fragments < p.clearLead:
+			t.clearLead = true
+			te.fragments++
+			size += 128
+		case te != nil:
+			t.enc = te.encs[(te.fragments-p.clearLead)/p.period%len(te.encs)]
+			t.rotate = len(te.encs) > 1
+			te.fragments++
+			for _, s := range f.Samples {
+				end := s.Offset + int64(s.Size)
+				if s.Offset < 0 || end > int64(len(buf)) {
+					return nil, mp4.ErrTruncated
+				}
+				e, err := t.enc.EncryptSample(buf[s.Offset:end])
+				if err != nil {
+					return nil, err
+				}
+				t.entries = append(t.entries, e)
+				size += len(e.IV) + 3 + 6*len(e.Subsamples)
+			}
+			if t.sizes, err = auxInfoSizes(t.entries); err != nil {
+				return nil, err
+			}
+			size += 256
+		}
+		trafs = append(trafs, t)
+	}
+	r.Exit()
+
+	// Written once to learn how much the moof grows, which shifts the
+	// sample data, then again with the final data offsets.
+	w := mp4.NewWriter(make([]byte, size))
+	if err := p.buildMoof(&w, raw, trafs, moofOffset, 0); err != nil {
+		return nil, err
+	}
+	delta := int64(w.Len() - len(raw))
+	w.Reset()
+	if err := p.buildMoof(&w, raw, trafs, moofOffset, delta); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), w.Err()
+}
+
+// buildMoof writes moof box raw to w with trafs, whose sample data has
+// moved delta bytes further from the moof.
+func (p *packager) buildMoof(w *mp4.Writer, raw []byte, trafs []trafOut, moofOffset, delta int64) error {
+	r := mp4.NewReader(raw)
+	r.Next()
+	w.StartBox(mp4.TypeMoof)
+	r.Enter()
+	i := 0
+	for r.Next() {
+		if r.Type() != mp4.TypeTraf {
+			w.Write(r.RawBox())
+			continue
+		}
+		if err := writeTraf(w, &r, &trafs[i], moofOffset, delta); err != nil {
+			r.Exit()
+			return err
+		}
+		i++
+	}
+	r.Exit()
+	w.EndBox()
+	return nil
+}
+
+// writeTraf writes the traf box r is at, based at the moof, which starts
+// at the beginning of w. It returns ErrSegmentSize if the data of a run
+// starts beyond the reach of a trun data offset.
+func writeTraf(w *mp4.Writer, r *mp4.Reader, t *trafOut, moofOffset, delta int64) error {
+	w.StartBox(mp4.TypeTraf)
+	r.Enter()
+	run := 0
+	for r.Next() {
+		switch {
+		case r.Type() == mp4.TypeTfhd:
+			h := t.f.Header
+			h.Flags = h.Flags&^mp4.TfhdBaseDataOffsetPresent | mp4.TfhdDefaultBaseIsMoof
+			h.BaseDataOffset = 0
+			w.WriteTrackFragmentHeader(h)
+		case r.Type() == mp4.TypeTrun:
+			fr := t.f.Runs[run]
+			dataOffset := fr.Offset - moofOffset + delta
+			if dataOffset > math.MaxInt32 || dataOffset < math.MinInt32 {
+				r.Exit()
+				return ErrSegmentSize
+			}
+			fr.Flags |= mp4.TrunDataOffsetPresent
+			fr.DataOffset = int32(dataOffset)
+			w.WriteTrackRun(fr.TrackRun)
+			run++
+		case (t.enc != nil || t.clearLead) && isProtectionBox(r):
+			// Replaced below.
+		default:
+			w.Write(r.RawBox())
+		}
+	}
+	r.Exit()
+
+	if t.clearLead {
+		writeSeigGroup(w, len(t.f.Samples), mp4.TrackEncryption{})
+	}
+	if t.enc != nil {
+		if t.rotate {
+			writeSeigGroup(w, len(t.entries), t.enc.Encryption())
+		}
+		senc := w.Len()
+		w.WriteSenc(t.entries)
+		w.WriteSaiz(t.sizes)
+		// The first entry follows the senc header, full box header and
+		// sample count.
+		w.WriteSaio(mp4.SampleAuxInfoOffsets{Offsets: []uint64{uint64(senc + 16)}})
+	}
+	w.EndBox()
+	return nil
+}
+
+// writeSeigGroup maps the n samples of a track fragment to a seig sample
+// group entry, described in the fragment, holding e.
+func writeSeigGroup(w *mp4.Writer, n int, e mp4.TrackEncryption) {
+	w.WriteSbgp(mp4.SampleToGroup{
+		GroupingType: mp4.GroupingSeig,
+		Entries:      []mp4.SampleToGroupEntry{{SampleCount: uint32(n), GroupDescriptionIndex: 0x10001}},
+	})
+	w.WriteSgpd(mp4.SampleGroupDescription{
+		GroupingType: mp4.GroupingSeig,
+		Entries:      [][]byte{mp4.AppendSeig(nil, e)},
+	})
+}
+
+// auxInfoSizes returns the saiz box describing the senc entries, or
+// ErrAuxInfoSize if an entry is too large for saiz to describe.
+func auxInfoSizes(entries []mp4.SampleEncryption) (mp4.SampleAuxInfoSizes, error) {
+	subsamples := false
+	for _, e := range entries {
+		if e.Subsamples != nil {
+			subsamples = true
+			break
+		}
+	}
+	s := mp4.SampleAuxInfoSizes{SampleCount: uint32(len(entries)), Sizes: make([]uint8, len(entries))}
+	same := true
+	for i, e := range entries {
+		n := len(e.IV)
+		if subsamples {
+			n += 2 + 6*len(e.Subsamples)
+		}
+		if n > 0xff {
+			return s, ErrAuxInfoSize
+		}
+		s.Sizes[i] = uint8(n)
+		same = same && s.Sizes[i] == s.Sizes[0]
+	}
+	if same && len(entries) > 0 && s.Sizes[0] != 0 {
+		s.DefaultSize, s.Sizes = s.Sizes[0], nil
+	}
+	return s, nil
+}
+
+// updateSidx rewrites the first offset and referenced sizes of the sidx
+// box at the start of data, at inPos in the input, for the output offsets
+// newPos gives the input's top-level boxes.
+func updateSidx(data []byte, inPos int64, newPos map[int64]int64) {
+	r := mp4.NewReader(data)
+	if !r.Next() {
+		return
+	}
+	d := r.Data()
+	end := inPos + int64(len(r.RawBox()))
+	// reference ID, timescale, earliest presentation time, first offset
+	var first uint64
+	var firstPtr, ptr int
+	if r.Version() == 0 {
+		firstPtr, ptr = 12, 16
+		if len(d) < ptr+4 {
+			return
+		}
+		first = uint64(binary.BigEndian.Uint32(d[firstPtr:]))
+	} else {
+		firstPtr, ptr = 16, 24
+		if len(d) < ptr+4 {
+			return
+		}
+		first = binary.BigEndian.Uint64(d[firstPtr:])
+	}
+	count := int(binary.BigEndian.Uint16(d[ptr+2:]))
+	ptr += 4
+
+	a := end + int64(first)
+	na, ok := newPos[a]
+	if !ok {
+		return
+	}
+	newFirst := uint64(na - newPos[inPos] - int64(len(r.RawBox())))
+	if r.Version() == 0 {
+		binary.BigEndian.PutUint32(d[firstPtr:], uint32(newFirst))
+	} else {
+		binary.BigEndian.PutUint64(d[firstPtr:], newFirst)
+	}
+	for range count {
+		if len(d) < ptr+12 {
+			return
+		}
+		v := binary.BigEndian.Uint32(d[ptr:])
+		b := a + int64(v&0x7fffffff)
+		nb, ok := newPos[b]
+		if !ok {
+			return
+		}
+		binary.BigEndian.PutUint32(d[ptr:], v&0x80000000|uint32(nb-na)&0x7fffffff)
+		a, na = b, nb
+		ptr += 12
+	}
+}
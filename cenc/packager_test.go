@@ -0,0 +1,297 @@
+package cenc_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/tetsuo/mp4"
+	"github.com/tetsuo/mp4/cenc"
+	"github.com/tetsuo/mp4/internal/mp4test"
+	"github.com/tetsuo/mp4/track"
+)
+
+var testAudioKey = cenc.Key{ID: rotatedKID, Key: testKeys[rotatedKID]}
+
+var testKey2 = cenc.Key{
+	ID:  [16]byte{0x50, 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5a, 0x5b, 0x5c, 0x5d, 0x5e, 0x5f},
+	Key: []byte{0x60, 0x61, 0x62, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69, 0x6a, 0x6b, 0x6c, 0x6d, 0x6e, 0x6f},
+}
+
+// testMovie returns a movie with an AVC track and a FLAC track, which
+// holds no samples unless progressive.
+func testMovie(video, audio [][]byte) *mp4test.Movie {
+	si := mp4.FlacStreamInfo{MinBlockSize: 4096, MaxBlockSize: 4096, SampleRate: 48000, Channels: 2, BitsPerSample: 16}
+	return &mp4test.Movie{
+		TimeScale: 1000,
+		Tracks: []mp4test.Track{{
+			ID: 1, Handler: mp4test.Video, TimeScale: 1000, Width: 1920, Height: 1080,
+			Entry: mp4test.VisualEntry(mp4.TypeAvc1, 1920, 1080, func(w *mp4.Writer) {
+				w.WriteAvcC(testAVC)
+			}),
+			Samples:  video,
+			Duration: 1000,
+		}, {
+			ID: 2, Handler: mp4test.Audio, TimeScale: 48000,
+			Entry: mp4test.AudioEntry(mp4.TypeFlac, 2, 48000, func(w *mp4.Writer) {
+				w.WriteDfla(mp4.FlacConfig{Blocks: []mp4.FlacMetadataBlock{si.Block()}})
+			}),
+			Samples:  audio,
+			Duration: 24000,
+		}},
+	}
+}
+
+// testSamples returns n one-second IDR samples of one slice each, and
+// twice as many half-second audio samples whose sizes are not a multiple
+// of the AES block size.
+func testSamples(n int) (video, audio [][]byte) {
+	for i := range n {
+		slice := bytes.Clone(testIDRSlice)
+		slice[len(slice)-1] = byte(i)
+		video = append(video, append([]byte{0, 0, 0, byte(len(slice))}, slice...))
+	}
+	for i := range 2 * n {
+		audio = append(audio, bytes.Repeat([]byte{byte(i)}, 100))
+	}
+	return video, audio
+}
+
+// fragmentedFile returns the testMovie of video and audio as a fragmented
+// file with a fragment per video sample, each holding two audio samples.
+func fragmentedFile(t *testing.T, video, audio [][]byte) []byte {
+	t.Helper()
+	movie := testMovie(nil, nil)
+	movie.Extra = func(w *mp4.Writer) {
+		w.StartBox(mp4.TypeMvex)
+		w.WriteTrex(1, 1, 1000, 0, 0)
+		w.WriteTrex(2, 1, 24000, 0, 0)
+		w.EndBox()
+	}
+	file := movie.Build()
+
+	for i, v := range video {
+		samples := [][][]byte{{v}, audio[2*i : 2*i+2]}
+		runs := make([]mp4.TrackRun, len(samples))
+		var mdat []byte
+		for j, s := range samples {
+			runs[j].Flags = mp4.TrunDataOffsetPresent | mp4.TrunSampleSizePresent
+			runs[j].DataOffset = int32(len(mdat))
+			for _, d := range s {
+				runs[j].Entries = append(runs[j].Entries, mp4.TrunEntry{Size: uint32(len(d))})
+				mdat = append(mdat, d...)
+			}
+		}
+
+		w := mp4.NewWriter(make([]byte, 4096+len(mdat)))
+		writeMoof := func(base int32) {
+			w.Reset()
+			w.StartBox(mp4.TypeMoof)
+			w.WriteMfhd(uint32(i + 1))
+			for j, run := range runs {
+				w.StartBox(mp4.TypeTraf)
+				w.WriteTrackFragmentHeader(mp4.TrackFragmentHeader{Flags: mp4.TfhdDefaultBaseIsMoof, TrackID: uint32(j + 1)})
+				w.WriteTfdt(uint64(i) * []uint64{1000, 48000}[j])
+				run.DataOffset += base
+				w.WriteTrackRun(run)
+				w.EndBox()
+			}
+			w.EndBox()
+		}
+		// The moof is written twice: data offsets are known once its size
+		// is.
+		writeMoof(0)
+		writeMoof(int32(w.Len() + 8))
+		w.StartBox(mp4.TypeMdat)
+		w.Write(mdat)
+		w.EndBox()
+		if w.Err() != nil {
+			t.Fatal(w.Err())
+		}
+		file = append(file, w.Bytes()...)
+	}
+	return file
+}
+
+// fileSample is the data of a sample of a fragmented file and the index
+// of its fragment.
+type fileSample struct {
+	data     []byte
+	fragment int
+}
+
+// fileSamples returns the tracks of a fragmented file and their samples by
+// track ID.
+func fileSamples(t *testing.T, file []byte) ([]*track.Track, map[uint32][]fileSample) {
+	t.Helper()
+	moov := mp4test.Moov(file)
+	tracks, _, err := track.ParseTracks(moov)
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples := make(map[uint32][]fileSample)
+	var pos int64
+	n := 0
+	r := mp4.NewReader(file)
+	for r.Next() {
+		if r.Type() == mp4.TypeMoof {
+			frags, err := mp4.ReadTrackFragments(r.RawBox(), pos, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, f := range frags {
+				for _, s := range f.Samples {
+					samples[f.Header.TrackID] = append(samples[f.Header.TrackID], fileSample{file[s.Offset : s.Offset+int64(s.Size)], n})
+				}
+			}
+			n++
+		}
+		pos += int64(len(r.RawBox()))
+	}
+	return tracks, samples
+}
+
+// encryptFile returns file encrypted with opts.
+func encryptFile(t *testing.T, file []byte, opts cenc.EncryptOptions) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	if err := cenc.EncryptFile(&b, bytes.NewReader(file), int64(len(file)), opts); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestEncryptFile(t *testing.T) {
+	keys := cenc.Keys{testKey.ID: testKey.Key, testKey2.ID: testKey2.Key, testAudioKey.ID: testAudioKey.Key}
+	tests := []struct {
+		name string
+		opts cenc.EncryptOptions
+	}{
+		{"cenc", cenc.EncryptOptions{
+			Scheme: mp4.SchemeCENC,
+			Keys:   map[uint32][]cenc.Key{1: {testKey}, 2: {testAudioKey}},
+			PSSH:   []mp4.ProtectionSystemHeader{{SystemID: mp4.SystemCommon, KeyIDs: [][16]byte{testKey.ID}}},
+		}},
+		{"cbcs", cenc.EncryptOptions{
+			Scheme: mp4.SchemeCBCS,
+			Keys:   map[uint32][]cenc.Key{1: {testKey}, 2: {testAudioKey}},
+		}},
+		{"video only", cenc.EncryptOptions{
+			Scheme: mp4.SchemeCENC,
+			Keys:   map[uint32][]cenc.Key{1: {testKey}},
+		}},
+		{"rotation", cenc.EncryptOptions{
+			Scheme:    mp4.SchemeCENC,
+			Keys:      map[uint32][]cenc.Key{1: {testKey, testKey2}},
+			KeyPeriod: 1,
+		}},
+		{"clear lead cenc", cenc.EncryptOptions{
+			Scheme:    mp4.SchemeCENC,
+			Keys:      map[uint32][]cenc.Key{1: {testKey}, 2: {testAudioKey}},
+			ClearLead: 1,
+		}},
+		{"clear lead cbcs rotation", cenc.EncryptOptions{
+			Scheme:    mp4.SchemeCBCS,
+			Keys:      map[uint32][]cenc.Key{1: {testKey, testKey2}, 2: {testAudioKey}},
+			KeyPeriod: 2,
+			ClearLead: 1,
+		}},
+	}
+	video, audio := testSamples(4)
+	clear := fragmentedFile(t, video, audio)
+	_, want := fileSamples(t, clear)
+	if len(want[1]) != 4 || len(want[2]) != 8 {
+		t.Fatalf("got %d video and %d audio samples, want 4 and 8", len(want[1]), len(want[2]))
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc := encryptFile(t, clear, tt.opts)
+			tracks, samples := fileSamples(t, enc)
+			for _, tr := range tracks {
+				_, encrypted := tt.opts.Keys[tr.ID]
+				if encrypted != (tr.Protection != nil) {
+					t.Fatalf("track %d protection = %v, want %v", tr.ID, tr.Protection, encrypted)
+				}
+				if encrypted && tr.Protection.Scheme.Type != tt.opts.Scheme {
+					t.Errorf("track %d scheme = %q, want %q", tr.ID, tr.Protection.Scheme.Type, tt.opts.Scheme)
+				}
+				for j, s := range samples[tr.ID] {
+					protected := encrypted && s.fragment >= tt.opts.ClearLead
+					if bytes.Equal(s.data, want[tr.ID][j].data) == protected {
+						t.Errorf("track %d sample %d protected = %v, want %v", tr.ID, j, !protected, protected)
+					}
+				}
+			}
+
+			dec, err := decryptFile(enc, keys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, got := fileSamples(t, dec)
+			for id, samples := range want {
+				for j, s := range samples {
+					if !bytes.Equal(got[id][j].data, s.data) {
+						t.Errorf("track %d sample %d = % x, want % x", id, j, got[id][j].data, s.data)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEncryptFileRotationKeys(t *testing.T) {
+	video, audio := testSamples(4)
+	enc := encryptFile(t, fragmentedFile(t, video, audio), cenc.EncryptOptions{
+		Scheme:    mp4.SchemeCENC,
+		Keys:      map[uint32][]cenc.Key{1: {testKey, testKey2}},
+		KeyPeriod: 1,
+	})
+	if _, err := decryptFile(enc, cenc.Keys{testKey.ID: testKey.Key}); !errors.Is(err, cenc.ErrKeyNotFound) {
+		t.Errorf("err = %v, want ErrKeyNotFound", err)
+	}
+}
+
+func TestEncryptFileErrors(t *testing.T) {
+	encrypt := func(file []byte, opts cenc.EncryptOptions) error {
+		var b bytes.Buffer
+		return cenc.EncryptFile(&b, bytes.NewReader(file), int64(len(file)), opts)
+	}
+
+	progressive := testMovie(testSamples(4)).Build()
+	err := encrypt(progressive, cenc.EncryptOptions{
+		Scheme: mp4.SchemeCENC,
+		Keys:   map[uint32][]cenc.Key{1: {testKey}},
+	})
+	if !errors.Is(err, cenc.ErrNotFragmented) {
+		t.Errorf("progressive: err = %v, want ErrNotFragmented", err)
+	}
+
+	video, audio := testSamples(4)
+	file := fragmentedFile(t, video, audio)
+	err = encrypt(file, cenc.EncryptOptions{
+		Scheme: mp4.SchemeCENC,
+		Keys:   map[uint32][]cenc.Key{3: {testKey}},
+	})
+	if !errors.Is(err, cenc.ErrUnsupportedTrack) {
+		t.Errorf("missing track: err = %v, want ErrUnsupportedTrack", err)
+	}
+	err = encrypt(file, cenc.EncryptOptions{
+		Scheme: [4]byte{'c', 'e', 'n', 's'},
+		Keys:   map[uint32][]cenc.Key{1: {testKey}},
+	})
+	if !errors.Is(err, cenc.ErrUnsupportedScheme) {
+		t.Errorf("cens: err = %v, want ErrUnsupportedScheme", err)
+	}
+
+	// A sample of 50 slices has a 50-subsample senc entry of 310 bytes,
+	// which saiz cannot describe.
+	video, audio = testSamples(1)
+	video[0] = bytes.Repeat(video[0], 50)
+	err = encrypt(fragmentedFile(t, video, audio), cenc.EncryptOptions{
+		Scheme: mp4.SchemeCENC,
+		Keys:   map[uint32][]cenc.Key{1: {testKey}},
+	})
+	if !errors.Is(err, cenc.ErrAuxInfoSize) {
+		t.Errorf("50 slices: err = %v, want ErrAuxInfoSize", err)
+	}
+}
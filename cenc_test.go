@@ -0,0 +1,247 @@
+package mp4_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/tetsuo/mp4"
+)
+
+var testKID = [16]byte{0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f}
+
+func TestSchmRoundTrip(t *testing.T) {
+	for _, want := range []mp4.ProtectionScheme{
+		{Type: mp4.SchemeCENC, Version: 0x00010000},
+		{Type: mp4.SchemeCBCS, Version: 0x00010000, URI: "https://example.com/drm"},
+	} {
+		r := writeBox(t, func(w *mp4.Writer) { w.WriteSchm(want) })
+		s, err := mp4.ReadSchm(r.Data(), r.Flags())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != want {
+			t.Errorf("got %+v, want %+v", s, want)
+		}
+	}
+}
+
+// encryptionParams are tenc defaults for cenc with 8-byte IVs and for
+// cbcs with a 1:9 pattern and a constant IV.
+var encryptionParams = []mp4.TrackEncryption{
+	{DefaultIsProtected: true, DefaultPerSampleIVSize: 8, DefaultKID: testKID},
+	{
+		DefaultCryptByteBlock: 1, DefaultSkipByteBlock: 9, DefaultIsProtected: true, DefaultKID: testKID,
+		DefaultConstantIV: []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+	},
+}
+
+func TestTencRoundTrip(t *testing.T) {
+	for i, want := range encryptionParams {
+		r := writeBox(t, func(w *mp4.Writer) { w.WriteTenc(want) })
+		if r.Version() != uint8(i) {
+			t.Errorf("version = %d, want %d", r.Version(), i)
+		}
+		te, err := mp4.ReadTenc(r.Data(), r.Version())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(te, want) {
+			t.Errorf("got %+v, want %+v", te, want)
+		}
+
+		s, err := mp4.ReadSeig(mp4.AppendSeig(nil, want))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(s, want) {
+			t.Errorf("seig: got %+v, want %+v", s, want)
+		}
+	}
+}
+
+func TestSinfRoundTrip(t *testing.T) {
+	want := mp4.ProtectionInfo{
+		OriginalFormat: mp4.TypeAvc1,
+		Scheme:         mp4.ProtectionScheme{Type: mp4.SchemeCBCS, Version: 0x00010000},
+		Encryption:     &encryptionParams[1],
+	}
+	r := writeBox(t, func(w *mp4.Writer) { w.WriteSinf(want) })
+	p, err := mp4.ReadSinf(r.Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("got %+v, want %+v", p, want)
+	}
+
+	// frma is required.
+	r = writeBox(t, func(w *mp4.Writer) {
+		w.StartBox(mp4.TypeSinf)
+		w.WriteSchm(want.Scheme)
+		w.EndBox()
+	})
+	if _, err := mp4.ReadSinf(r.Data()); err != mp4.ErrTruncated {
+		t.Errorf("no frma: err = %v, want %v", err, mp4.ErrTruncated)
+	}
+}
+
+func TestPsshRoundTrip(t *testing.T) {
+	for _, want := range []mp4.ProtectionSystemHeader{
+		{SystemID: mp4.SystemWidevine, Data: []byte{0x12, 0x10, 0x01}},
+		{SystemID: mp4.SystemCommon, KeyIDs: [][16]byte{testKID, {1}}, Data: []byte{}},
+	} {
+		r := writeBox(t, func(w *mp4.Writer) { w.WritePssh(want) })
+		p, err := mp4.ReadPssh(r.Data(), r.Version())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(p, want) {
+			t.Errorf("version %d: got %+v, want %+v", r.Version(), p, want)
+		}
+	}
+}
+
+func TestSencRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		ivSize  int
+		entries []mp4.SampleEncryption
+	}{
+		{
+			name:   "per-sample IVs",
+			ivSize: 8,
+			entries: []mp4.SampleEncryption{
+				{IV: []byte{0, 0, 0, 0, 0, 0, 0, 1}},
+				{IV: []byte{0, 0, 0, 0, 0, 0, 0, 2}},
+			},
+		},
+		{
+			name:   "subsamples with a constant IV",
+			ivSize: 0,
+			entries: []mp4.SampleEncryption{
+				{Subsamples: []mp4.Subsample{{ClearBytes: 10, ProtectedBytes: 64}, {ClearBytes: 5, ProtectedBytes: 0}}},
+				{Subsamples: []mp4.Subsample{}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := writeBox(t, func(w *mp4.Writer) { w.WriteSenc(tt.entries) })
+			entries, err := mp4.ReadSenc(r.Data(), r.Flags(), tt.ivSize, len(tt.entries))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(entries, tt.entries) {
+				t.Errorf("got %+v, want %+v", entries, tt.entries)
+			}
+			if _, err := mp4.ReadSenc(r.Data()[:len(r.Data())-1], r.Flags(), tt.ivSize, len(tt.entries)); err != mp4.ErrTruncated {
+				t.Errorf("truncated: err = %v, want %v", err, mp4.ErrTruncated)
+			}
+		})
+	}
+}
+
+func TestSencHugeCount(t *testing.T) {
+	data := []byte{0xff, 0xff, 0xff, 0xff}
+	tests := []struct {
+		name        string
+		flags       uint32
+		ivSize      int
+		sampleCount int
+	}{
+		{"per-sample IVs", 0, 8, 1 << 30},
+		{"subsamples", mp4.SencUseSubsamples, 0, 1 << 30},
+		{"constant IV without subsamples", 0, 0, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := mp4.ReadSenc(data, tt.flags, tt.ivSize, tt.sampleCount); err != mp4.ErrTruncated {
+				t.Errorf("err = %v, want %v", err, mp4.ErrTruncated)
+			}
+		})
+	}
+}
+
+func TestSaizSaioRoundTrip(t *testing.T) {
+	for _, want := range []mp4.SampleAuxInfoSizes{
+		{DefaultSize: 16, SampleCount: 30},
+		{AuxInfoType: mp4.SchemeCENC, SampleCount: 3, Sizes: []uint8{8, 22, 16}},
+	} {
+		r := writeBox(t, func(w *mp4.Writer) { w.WriteSaiz(want) })
+		s, err := mp4.ReadSaiz(r.Data(), r.Flags())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(s, want) {
+			t.Errorf("saiz: got %+v, want %+v", s, want)
+		}
+		if s.Size(1) != want.Size(1) || s.Size(5) != want.Size(5) {
+			t.Errorf("saiz sizes differ")
+		}
+	}
+
+	for _, want := range []mp4.SampleAuxInfoOffsets{
+		{Offsets: []uint64{100, 2000}},
+		{AuxInfoType: mp4.SchemeCBCS, Offsets: []uint64{1 << 32}},
+	} {
+		r := writeBox(t, func(w *mp4.Writer) { w.WriteSaio(want) })
+		s, err := mp4.ReadSaio(r.Data(), r.Version(), r.Flags())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(s, want) {
+			t.Errorf("saio version %d: got %+v, want %+v", r.Version(), s, want)
+		}
+	}
+}
+
+func TestSbgpRoundTrip(t *testing.T) {
+	for _, want := range []mp4.SampleToGroup{
+		{GroupingType: mp4.GroupingSeig, Entries: []mp4.SampleToGroupEntry{{SampleCount: 2, GroupDescriptionIndex: 0}, {SampleCount: 3, GroupDescriptionIndex: 0x10001}}},
+		{GroupingType: [4]byte{'r', 'o', 'l', 'l'}, GroupingTypeParameter: 7, Entries: []mp4.SampleToGroupEntry{}},
+	} {
+		r := writeBox(t, func(w *mp4.Writer) { w.WriteSbgp(want) })
+		s, err := mp4.ReadSbgp(r.Data(), r.Version())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(s, want) {
+			t.Errorf("version %d: got %+v, want %+v", r.Version(), s, want)
+		}
+	}
+
+	s := mp4.SampleToGroup{Entries: []mp4.SampleToGroupEntry{{SampleCount: 2, GroupDescriptionIndex: 1}, {SampleCount: 1, GroupDescriptionIndex: 2}}}
+	for i, want := range []uint32{1, 1, 2, 0} {
+		if g := s.GroupIndex(i); g != want {
+			t.Errorf("sample %d: group %d, want %d", i, g, want)
+		}
+	}
+}
+
+func TestSgpdRoundTrip(t *testing.T) {
+	seig := mp4.AppendSeig(nil, encryptionParams[0])
+	for _, want := range []mp4.SampleGroupDescription{
+		{GroupingType: mp4.GroupingSeig, Entries: [][]byte{seig, seig}},
+		{GroupingType: mp4.GroupingSeig, DefaultDescriptionIndex: 2, Entries: [][]byte{seig, mp4.AppendSeig(nil, encryptionParams[1])}},
+	} {
+		r := writeBox(t, func(w *mp4.Writer) { w.WriteSgpd(want) })
+		s, err := mp4.ReadSgpd(r.Data(), r.Version())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(s, want) {
+			t.Errorf("version %d: got %+v, want %+v", r.Version(), s, want)
+		}
+	}
+
+	// Version 0 entries are split evenly.
+	v0 := append([]byte("roll\x00\x00\x00\x02"), 0, 1, 0, 2)
+	s, err := mp4.ReadSgpd(v0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Entries) != 2 || !bytes.Equal(s.Entries[1], []byte{0, 2}) {
+		t.Errorf("version 0 entries = %v", s.Entries)
+	}
+}
@@ -0,0 +1,266 @@
+package mp4
+
+import (
+	"math"
+	"math/bits"
+)
+
+// Stream structure flags of a chnl box.
+const (
+	ChannelStructured = 1 << 0
+	ObjectStructured  = 1 << 1
+)
+
+// SpeakerPositionExplicit is the chnl speaker position code for a position
+// given by azimuth and elevation.
+const SpeakerPositionExplicit = 126
+
+// SpeakerPosition is one loudspeaker of a chnl box listing its layout.
+// Position is an ISO/IEC 23091-3 OutputChannelPosition; Azimuth and
+// Elevation, in degrees, are only meaningful for SpeakerPositionExplicit.
+type SpeakerPosition struct {
+	Position  uint8
+	Azimuth   int16
+	Elevation int8
+}
+
+// ChannelLayout holds a parsed chnl box (ISO/IEC 14496-12).
+type ChannelLayout struct {
+	StreamStructure uint8 // ChannelStructured and/or ObjectStructured
+
+	// DefinedLayout is an ISO/IEC 23091-3 ChannelConfiguration, or 0 if the
+	// layout is given by Speakers. Bit i of OmittedChannelsMap marks
+	// channel i of the defined layout as absent from the stream.
+	DefinedLayout      uint8
+	Speakers           []SpeakerPosition
+	OmittedChannelsMap uint64
+
+	ObjectCount uint8 // audio objects, version 0 only
+
+	// Version 1 fields; zero otherwise.
+	FormatOrdering         uint8
+	BaseChannelCount       uint8
+	ChannelOrderDefinition uint8
+}
+
+// definedLayoutChannels is the channel count of each ISO/IEC 23091-3
+// ChannelConfiguration, indexed by value.
+var definedLayoutChannels = [...]uint8{
+	0, 1, 2, 3, 4, 5, 6, 8, 2, 3, 4, 7, 8, 24, 8, 12, 10, 12, 14, 12, 14,
+}
+
+// DefinedLayoutChannels returns the number of channels of an ISO/IEC
+// 23091-3 ChannelConfiguration, or 0 if the value is unknown.
+func DefinedLayoutChannels(layout uint8) int {
+	if int(layout) >= len(definedLayoutChannels) {
+		return 0
+	}
+	return int(definedLayoutChannels[layout])
+}
+
+// Channels returns the number of loudspeaker channels present in the
+// stream, or 0 if the box does not describe them or uses an unknown
+// defined layout.
+func (c *ChannelLayout) Channels() int {
+	if c.StreamStructure&ChannelStructured == 0 {
+		return 0
+	}
+	if c.DefinedLayout == 0 {
+		return len(c.Speakers)
+	}
+	n := DefinedLayoutChannels(c.DefinedLayout)
+	if n == 0 {
+		return 0
+	}
+	return n - bits.OnesCount64(c.OmittedChannelsMap&(1<<n-1))
+}
+
+// ReadChnl parses chnl box data (after version+flags). Version 0 boxes
+// that list speaker positions take their count from the sample entry, so
+// channelCount must be the entry's channel count.
+func ReadChnl(data []byte, version uint8, channelCount uint16) (ChannelLayout, error) {
+	var c ChannelLayout
+	if len(data) < 1 {
+		return c, ErrTruncated
+	}
+	ptr := 1
+	if version == 0 {
+		c.StreamStructure = data[0]
+	} else {
+		if len(data) < 2 {
+			return c, ErrTruncated
+		}
+		c.StreamStructure = data[0] >> 4
+		c.FormatOrdering = data[0] & 0x0f
+		c.BaseChannelCount = data[1]
+		ptr = 2
+	}
+
+	if c.StreamStructure&ChannelStructured != 0 {
+		if ptr+1 > len(data) {
+			return c, ErrTruncated
+		}
+		c.DefinedLayout = data[ptr]
+		ptr++
+		if c.DefinedLayout == 0 {
+			n := int(channelCount)
+			if version != 0 {
+				if ptr+1 > len(data) {
+					return c, ErrTruncated
+				}
+				n = int(data[ptr])
+				ptr++
+			}
+			c.Speakers = make([]SpeakerPosition, 0, n)
+			for range n {
+				if ptr+1 > len(data) {
+					return c, ErrTruncated
+				}
+				s := SpeakerPosition{Position: data[ptr]}
+				ptr++
+				if s.Position == SpeakerPositionExplicit {
+					if ptr+3 > len(data) {
+						return c, ErrTruncated
+					}
+					s.Azimuth = int16(be.Uint16(data[ptr:]))
+					s.Elevation = int8(data[ptr+2])
+					ptr += 3
+				}
+				c.Speakers = append(c.Speakers, s)
+			}
+		} else {
+			omitted := true
+			if version != 0 {
+				if ptr+1 > len(data) {
+					return c, ErrTruncated
+				}
+				c.ChannelOrderDefinition = data[ptr] >> 1 & 0x07
+				omitted = data[ptr]&0x01 != 0
+				ptr++
+			}
+			if omitted {
+				if ptr+8 > len(data) {
+					return c, ErrTruncated
+				}
+				c.OmittedChannelsMap = be.Uint64(data[ptr:])
+				ptr += 8
+			}
+		}
+	}
+
+	if version == 0 && c.StreamStructure&ObjectStructured != 0 {
+		if ptr+1 > len(data) {
+			return c, ErrTruncated
+		}
+		c.ObjectCount = data[ptr]
+	}
+	return c, nil
+}
+
+// WriteChnl writes a complete version 0 chnl box. Speakers must hold one
+// entry per channel of the sample entry when DefinedLayout is 0.
+func (w *Writer) WriteChnl(c ChannelLayout) {
+	w.StartFullBox(TypeChnl, 0, 0)
+	w.putUint8(c.StreamStructure)
+	if c.StreamStructure&ChannelStructured != 0 {
+		w.putUint8(c.DefinedLayout)
+		if c.DefinedLayout == 0 {
+			for _, s := range c.Speakers {
+				w.putUint8(s.Position)
+				if s.Position == SpeakerPositionExplicit {
+					w.putUint16(uint16(s.Azimuth))
+					w.putUint8(uint8(s.Elevation))
+				}
+			}
+		} else {
+			w.putUint64(c.OmittedChannelsMap)
+		}
+	}
+	if c.StreamStructure&ObjectStructured != 0 {
+		w.putUint8(c.ObjectCount)
+	}
+	w.EndBox()
+}
+
+// QuickTime AudioChannelLayoutTag values that select how the layout is
+// described. Other tags name a predefined layout and carry its channel
+// count in the low 16 bits, e.g. 121<<16|6 for MPEG 5.1 (L R C LFE Ls Rs).
+const (
+	ChannelLayoutTagUseDescriptions = 0 << 16
+	ChannelLayoutTagUseBitmap       = 1 << 16
+)
+
+// AudioChannelDescription is one channel of a QuickTime chan box that
+// uses channel descriptions.
+type AudioChannelDescription struct {
+	Label       uint32 // AudioChannelLabel, e.g. 1 left, 2 right, 3 centre
+	Flags       uint32
+	Coordinates [3]float32
+}
+
+// audioChannelDescriptionSize is the encoded size of an
+// AudioChannelDescription.
+const audioChannelDescriptionSize = 20
+
+// AudioChannelLayout holds a parsed QuickTime chan box, a Core Audio
+// AudioChannelLayout.
+type AudioChannelLayout struct {
+	Tag          uint32
+	Bitmap       uint32 // AudioChannelBitmap, for ChannelLayoutTagUseBitmap
+	Descriptions []AudioChannelDescription
+}
+
+// Channels returns the number of channels the layout describes.
+func (l *AudioChannelLayout) Channels() int {
+	switch l.Tag {
+	case ChannelLayoutTagUseDescriptions:
+		return len(l.Descriptions)
+	case ChannelLayoutTagUseBitmap:
+		return bits.OnesCount32(l.Bitmap)
+	}
+	return int(l.Tag & 0xffff)
+}
+
+// ReadChan parses chan box data (after version+flags).
+func ReadChan(data []byte) (AudioChannelLayout, error) {
+	var l AudioChannelLayout
+	if len(data) < 12 {
+		return l, ErrTruncated
+	}
+	l.Tag = be.Uint32(data[0:4])
+	l.Bitmap = be.Uint32(data[4:8])
+	n := int(be.Uint32(data[8:12]))
+	if n > (len(data)-12)/audioChannelDescriptionSize {
+		return l, ErrTruncated
+	}
+	l.Descriptions = make([]AudioChannelDescription, n)
+	for i := range l.Descriptions {
+		b := data[12+i*audioChannelDescriptionSize:]
+		l.Descriptions[i] = AudioChannelDescription{
+			Label: be.Uint32(b[0:4]),
+			Flags: be.Uint32(b[4:8]),
+			Coordinates: [3]float32{
+				math.Float32frombits(be.Uint32(b[8:12])),
+				math.Float32frombits(be.Uint32(b[12:16])),
+				math.Float32frombits(be.Uint32(b[16:20])),
+			},
+		}
+	}
+	return l, nil
+}
+
+// WriteChan writes a complete chan box.
+func (w *Writer) WriteChan(l AudioChannelLayout) {
+	w.StartFullBox(TypeChan, 0, 0)
+	w.putUint32(l.Tag)
+	w.putUint32(l.Bitmap)
+	w.putUint32(uint32(len(l.Descriptions)))
+	for _, d := range l.Descriptions {
+		w.putUint32(d.Label)
+		w.putUint32(d.Flags)
+		for _, c := range d.Coordinates {
+			w.putUint32(math.Float32bits(c))
+		}
+	}
+	w.EndBox()
+}
@@ -0,0 +1,129 @@
+package mp4_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tetsuo/mp4"
+)
+
+func TestChnlRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		layout   mp4.ChannelLayout
+		channels uint16 // of the sample entry
+		want     int
+	}{
+		{
+			name:     "defined layout with an omitted channel",
+			layout:   mp4.ChannelLayout{StreamStructure: mp4.ChannelStructured, DefinedLayout: 6, OmittedChannelsMap: 1 << 3},
+			channels: 5,
+			want:     5,
+		},
+		{
+			name: "speaker positions and objects",
+			layout: mp4.ChannelLayout{
+				StreamStructure: mp4.ChannelStructured | mp4.ObjectStructured,
+				Speakers: []mp4.SpeakerPosition{
+					{Position: 0}, {Position: 1},
+					{Position: mp4.SpeakerPositionExplicit, Azimuth: -110, Elevation: 35},
+				},
+				ObjectCount: 4,
+			},
+			channels: 3,
+			want:     3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := writeBox(t, func(w *mp4.Writer) { w.WriteChnl(tt.layout) })
+			c, err := mp4.ReadChnl(r.Data(), r.Version(), tt.channels)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(c, tt.layout) {
+				t.Errorf("got %+v, want %+v", c, tt.layout)
+			}
+			if n := c.Channels(); n != tt.want {
+				t.Errorf("channels = %d, want %d", n, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadChnlV1(t *testing.T) {
+	// Channel structured, format ordering 1, base channel count 2, an
+	// explicit list of two speakers.
+	c, err := mp4.ReadChnl([]byte{0x11, 2, 0, 2, 0, 1}, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := mp4.ChannelLayout{
+		StreamStructure:  mp4.ChannelStructured,
+		FormatOrdering:   1,
+		BaseChannelCount: 2,
+		Speakers:         []mp4.SpeakerPosition{{Position: 0}, {Position: 1}},
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("got %+v, want %+v", c, want)
+	}
+
+	// A defined layout with channel order definition 2 and no omitted
+	// channels map.
+	c, err = mp4.ReadChnl([]byte{0x10, 6, 6, 0x04}, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.DefinedLayout != 6 || c.ChannelOrderDefinition != 2 || c.Channels() != 6 {
+		t.Errorf("got %+v", c)
+	}
+}
+
+func TestChanRoundTrip(t *testing.T) {
+	tests := []struct {
+		layout mp4.AudioChannelLayout
+		want   int
+	}{
+		{mp4.AudioChannelLayout{Tag: 121<<16 | 6, Descriptions: []mp4.AudioChannelDescription{}}, 6},
+		{mp4.AudioChannelLayout{Tag: mp4.ChannelLayoutTagUseBitmap, Bitmap: 0x3f, Descriptions: []mp4.AudioChannelDescription{}}, 6},
+		{mp4.AudioChannelLayout{Tag: mp4.ChannelLayoutTagUseDescriptions, Descriptions: []mp4.AudioChannelDescription{
+			{Label: 1}, {Label: 2}, {Label: 100, Flags: 1, Coordinates: [3]float32{-30, 0, 1}},
+		}}, 3},
+	}
+	for _, tt := range tests {
+		r := writeBox(t, func(w *mp4.Writer) { w.WriteChan(tt.layout) })
+		l, err := mp4.ReadChan(r.Data())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(l, tt.layout) {
+			t.Errorf("got %+v, want %+v", l, tt.layout)
+		}
+		if n := l.Channels(); n != tt.want {
+			t.Errorf("tag %#x: channels = %d, want %d", tt.layout.Tag, n, tt.want)
+		}
+	}
+}
+
+func TestReadAudioSampleEntryAllocs(t *testing.T) {
+	w := mp4.NewWriter(make([]byte, 256))
+	w.StartBox(mp4.TypeMp4a)
+	w.WriteAudioSampleEntry(1, 2, 16, 48000)
+	w.WriteChnl(mp4.ChannelLayout{StreamStructure: mp4.ChannelStructured, DefinedLayout: 2})
+	w.EndBox()
+	r := mp4.NewReader(w.Bytes())
+	r.Next()
+	data := r.Data()
+
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = mp4.ReadAudioSampleEntry(data)
+	})
+	if allocs != 0 {
+		t.Errorf("ReadAudioSampleEntry allocates %v times, want 0", allocs)
+	}
+	a := mp4.ReadAudioSampleEntry(data)
+	a.ReadExtensions(data)
+	if a.Chnl == nil || a.Chnl.Channels() != 2 {
+		t.Errorf("chnl = %+v, want stereo layout", a.Chnl)
+	}
+}
@@ -2,6 +2,7 @@
 package main
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -81,6 +82,18 @@ func main() {
 			}
 			r := mp4.NewReader(buf)
 			node.Children = buildTree(&r)
+		} else if e.Type == mp4.TypeMeta {
+			// Top-level meta (HEIF): parse the whole box so its version and
+			// flags are read like nested ones.
+			buf := make([]byte, e.Size)
+			if err := sc.ReadBox(buf); err != nil {
+				fmt.Fprintf(os.Stderr, "error reading meta: %v\n", err)
+				continue
+			}
+			r := mp4.NewReader(buf)
+			if nodes := buildTree(&r); len(nodes) > 0 {
+				node = nodes[0]
+			}
 		} else if e.Type == mp4.TypeFtyp {
 			buf := make([]byte, e.DataSize())
 			if err := sc.ReadBody(buf); err != nil {
@@ -123,7 +136,7 @@ func buildTree(r *mp4.Reader) []BoxNode {
 			Size: r.Size(),
 		}
 
-		if mp4.IsFullBox(r.Type()) {
+		if r.IsFullBox() {
 			v := r.Version()
 			f := r.Flags()
 			node.Version = &v
@@ -147,6 +160,8 @@ func buildTree(r *mp4.Reader) []BoxNode {
 				node.Children = append(node.Children, child)
 			}
 			r.Exit()
+		} else if r.Type() == mp4.TypeIlst {
+			node.Children = buildIlstNodes(r.Data())
 		}
 
 		nodes = append(nodes, node)
@@ -155,6 +170,68 @@ func buildTree(r *mp4.Reader) []BoxNode {
 	return nodes
 }
 
+// buildIlstNodes returns one node per iTunes metadata item, with its value
+// as info. Binary values such as cover art are shown by length.
+func buildIlstNodes(data []byte) []BoxNode {
+	var nodes []BoxNode
+	r := mp4.NewReader(data)
+	for r.Next() {
+		node := BoxNode{Type: itemTypeString(r.Type()), Size: r.Size()}
+		if m, err := mp4.ReadIlst(r.RawBox()); err == nil && len(m.Items) > 0 {
+			describeItem(&node, &m.Items[0])
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// describeItem sets the info of an ilst item node from its first value.
+func describeItem(node *BoxNode, it *mp4.MetadataItem) {
+	node.Info = make(map[string]any)
+	if it.Type == mp4.ItemFreeform {
+		node.Info["name"] = it.Mean + ":" + it.Name
+	}
+	if len(it.Data) == 0 {
+		return
+	}
+	d := &it.Data[0]
+	switch {
+	case d.Type == mp4.DataTypeUTF8 || d.Type == mp4.DataTypeUTF16:
+		node.Info["value"] = d.Text()
+	case d.Type == mp4.DataTypeSignedInt || d.Type == mp4.DataTypeUnsignedInt:
+		if v, ok := d.Int(); ok {
+			node.Info["value"] = v
+		}
+	case d.Type == mp4.DataTypeFloat32 || d.Type == mp4.DataTypeFloat64:
+		if v, ok := d.Float(); ok {
+			node.Info["value"] = v
+		}
+	case (it.Type == mp4.ItemTrack || it.Type == mp4.ItemDisc) && len(d.Value) >= 6:
+		n := uint16(d.Value[2])<<8 | uint16(d.Value[3])
+		total := uint16(d.Value[4])<<8 | uint16(d.Value[5])
+		node.Info["value"] = fmt.Sprintf("%d/%d", n, total)
+	default:
+		n := 0
+		for _, d := range it.Data {
+			n += len(d.Value)
+		}
+		node.DataLength = &n
+	}
+}
+
+// itemTypeString renders an ilst item type, showing the leading 0xa9 byte
+// of types like "\xa9nam" as the copyright sign, and key indexes of
+// keys-based metadata as "#1".
+func itemTypeString(t mp4.BoxType) string {
+	switch t[0] {
+	case 0xa9:
+		return "©" + string(t[1:])
+	case 0:
+		return fmt.Sprintf("#%d", uint32(t[1])<<16|uint32(t[2])<<8|uint32(t[3]))
+	}
+	return string(t[:])
+}
+
 func buildSampleEntryNode(r *mp4.Reader) BoxNode {
 	boxType := r.Type()
 	node := BoxNode{
@@ -164,7 +241,8 @@ func buildSampleEntryNode(r *mp4.Reader) BoxNode {
 	}
 
 	switch r.Type() {
-	case mp4.TypeAvc1:
+	case mp4.TypeAvc1, mp4.TypeHvc1, mp4.TypeHev1, mp4.TypeDvh1, mp4.TypeDvhe, mp4.TypeDav1,
+		mp4.TypeVvc1, mp4.TypeVvi1, mp4.TypeAv01, mp4.TypeEncv:
 		v := mp4.ReadVisualSampleEntry(r.Data())
 		node.Info["width"] = v.Width
 		node.Info["height"] = v.Height
@@ -179,25 +257,47 @@ func buildSampleEntryNode(r *mp4.Reader) BoxNode {
 				Type: string(childType[:]),
 				Size: r.Size(),
 			}
-			if mp4.IsFullBox(r.Type()) {
+			if r.IsFullBox() {
 				ver := r.Version()
 				flg := r.Flags()
 				child.Version = &ver
 				child.Flags = &flg
 			}
-			if r.Type() == mp4.TypeAvcC {
+			switch r.Type() {
+			case mp4.TypeAvcC:
 				codec := mp4.ReadAvcC(r.Data())
 				child.Info = map[string]any{"codec": codec}
+			case mp4.TypeHvcC:
+				if c, err := mp4.ReadHEVCConfig(r.Data()); err == nil {
+					child.Info = map[string]any{"codec": c.Codec()}
+				}
+			case mp4.TypeVvcC:
+				if c, err := mp4.ReadVVCConfig(r.Data()); err == nil {
+					child.Info = map[string]any{"codec": c.Codec()}
+				}
+			case mp4.TypeAv1C:
+				if c, err := mp4.ReadAV1Config(r.Data()); err == nil {
+					child.Info = map[string]any{"codec": c.Codec()}
+				}
+			case mp4.TypeDvcC, mp4.TypeDvvC, mp4.TypeDvwC:
+				if c, err := mp4.ReadDolbyVisionConfig(r.Data()); err == nil {
+					child.Info = map[string]any{"codec": c.Codec()}
+				}
+			case mp4.TypeSinf:
+				child.Info = sinfInfo(r.Data())
 			}
 			node.Children = append(node.Children, child)
 		}
 		r.Exit()
 
-	case mp4.TypeMp4a:
+	case mp4.TypeMp4a, mp4.TypeMp3, mp4.TypeFlac, mp4.TypeAlac,
+		mp4.TypeMha1, mp4.TypeMha2, mp4.TypeMhm1, mp4.TypeMhm2, mp4.TypeAc4,
+		mp4.TypeIpcm, mp4.TypeFpcm, mp4.TypeLpcm, mp4.TypeTwos, mp4.TypeSowt,
+		mp4.TypeIn24, mp4.TypeIn32, mp4.TypeFl32, mp4.TypeFl64, mp4.TypeEnca:
 		a := mp4.ReadAudioSampleEntry(r.Data())
 		node.Info["channelCount"] = a.ChannelCount
 		node.Info["sampleSize"] = a.SampleSize
-		node.Info["sampleRate"] = a.SampleRate >> 16
+		node.Info["sampleRate"] = a.Rate()
 
 		// Enter to find esds and other children
 		r.Enter()
@@ -208,22 +308,66 @@ func buildSampleEntryNode(r *mp4.Reader) BoxNode {
 				Type: string(childType[:]),
 				Size: r.Size(),
 			}
-			if mp4.IsFullBox(r.Type()) {
+			if r.IsFullBox() {
 				ver := r.Version()
 				flg := r.Flags()
 				child.Version = &ver
 				child.Flags = &flg
 			}
-			if r.Type() == mp4.TypeEsds {
+			switch r.Type() {
+			case mp4.TypeEsds:
 				codec := mp4.ReadEsdsCodec(r.Data())
 				child.Info = map[string]any{"codec": codec}
+			case mp4.TypeDfla:
+				c, err := mp4.ReadDfla(r.Data())
+				if si, ok := c.StreamInfo(); err == nil && ok {
+					child.Info = map[string]any{
+						"channelCount": si.Channels,
+						"sampleSize":   si.BitsPerSample,
+						"sampleRate":   si.SampleRate,
+					}
+				}
+			case mp4.TypeAlac:
+				if c, err := mp4.ReadAlacConfig(r.Data()); err == nil {
+					child.Info = map[string]any{
+						"channelCount": c.NumChannels,
+						"sampleSize":   c.BitDepth,
+						"sampleRate":   c.SampleRate,
+					}
+				}
+			case mp4.TypeMhaC:
+				if c, err := mp4.ReadMhaC(r.Data()); err == nil {
+					child.Info = map[string]any{"codec": c.Codec(), "channelCount": c.Channels()}
+				}
+			case mp4.TypeDac4:
+				if c, err := mp4.ReadAC4Config(r.Data()); err == nil {
+					child.Info = map[string]any{"codec": c.Codec(), "channelCount": c.Channels()}
+				}
+			case mp4.TypePcmC:
+				if c, err := mp4.ReadPcmC(r.Data()); err == nil {
+					child.Info = map[string]any{"sampleSize": c.SampleSize}
+				}
+			case mp4.TypeSrat:
+				if rate, err := mp4.ReadSrat(r.Data()); err == nil {
+					child.Info = map[string]any{"sampleRate": rate}
+				}
+			case mp4.TypeChnl:
+				if c, err := mp4.ReadChnl(r.Data(), r.Version(), a.ChannelCount); err == nil {
+					child.Info = map[string]any{"channelCount": c.Channels()}
+				}
+			case mp4.TypeChan:
+				if l, err := mp4.ReadChan(r.Data()); err == nil {
+					child.Info = map[string]any{"channelCount": l.Channels()}
+				}
+			case mp4.TypeSinf:
+				child.Info = sinfInfo(r.Data())
 			}
 			node.Children = append(node.Children, child)
 		}
 		r.Exit()
 
 	default:
-		if mp4.IsFullBox(r.Type()) {
+		if r.IsFullBox() {
 			ver := r.Version()
 			flg := r.Flags()
 			node.Version = &ver
@@ -236,6 +380,23 @@ func buildSampleEntryNode(r *mp4.Reader) BoxNode {
 	return node
 }
 
+// sinfInfo returns the original format, scheme and default key ID of an
+// encrypted sample entry's sinf box.
+func sinfInfo(data []byte) map[string]any {
+	p, err := mp4.ReadSinf(data)
+	if err != nil {
+		return nil
+	}
+	info := map[string]any{
+		"format": p.OriginalFormat.String(),
+		"scheme": string(p.Scheme.Type[:]),
+	}
+	if p.Encryption != nil {
+		info["kid"] = hex.EncodeToString(p.Encryption.DefaultKID[:])
+	}
+	return info
+}
+
 func collectBoxInfo(r *mp4.Reader) map[string]any {
 	info := make(map[string]any)
 
@@ -345,6 +506,109 @@ func collectBoxInfo(r *mp4.Reader) map[string]any {
 	case mp4.TypeMdat:
 		info["dataLength"] = len(r.Data())
 
+	case mp4.TypeIlst:
+		// Items are listed as children.
+
+	case mp4.TypeKeys:
+		if keys, err := mp4.ReadKeys(r.Data()); err == nil {
+			names := make([]string, len(keys))
+			for i, k := range keys {
+				names[i] = k.Name
+			}
+			info["keys"] = names
+		}
+
+	case mp4.TypePitm:
+		if id, err := mp4.ReadPitm(r.Data(), r.Version()); err == nil {
+			info["itemId"] = id
+		}
+
+	case mp4.TypeIinf:
+		if items, err := mp4.ReadIinf(r.Data(), r.Version()); err == nil {
+			info["entries"] = len(items)
+		}
+
+	case mp4.TypeIloc:
+		if locs, err := mp4.ReadIloc(r.Data(), r.Version()); err == nil {
+			info["entries"] = len(locs)
+		}
+
+	case mp4.TypeIref:
+		if refs, err := mp4.ReadIref(r.Data(), r.Version()); err == nil {
+			info["entries"] = len(refs)
+		}
+
+	case mp4.TypeIpma:
+		if entries, err := mp4.ReadIpma(r.Data(), r.Version(), r.Flags()); err == nil {
+			info["entries"] = len(entries)
+		}
+
+	case mp4.TypeIspe:
+		if e, err := mp4.ReadIspe(r.Data()); err == nil {
+			info["width"] = e.Width
+			info["height"] = e.Height
+		}
+
+	case mp4.TypeIrot:
+		if deg, err := mp4.ReadIrot(r.Data()); err == nil {
+			info["angle"] = deg
+		}
+
+	case mp4.TypeImir:
+		if axis, err := mp4.ReadImir(r.Data()); err == nil {
+			info["axis"] = axis
+		}
+
+	case mp4.TypePixi:
+		if p, err := mp4.ReadPixi(r.Data()); err == nil {
+			info["bits"] = p.BitsPerChannel
+		}
+
+	case mp4.TypeAuxC:
+		if a, err := mp4.ReadAuxC(r.Data()); err == nil {
+			info["auxType"] = a.Type
+		}
+
+	case mp4.TypeAv1C:
+		if c, err := mp4.ReadAV1Config(r.Data()); err == nil {
+			info["codec"] = c.Codec()
+		}
+
+	case mp4.TypePssh:
+		if p, err := mp4.ReadPssh(r.Data(), r.Version()); err == nil {
+			info["systemId"] = hex.EncodeToString(p.SystemID[:])
+			if len(p.KeyIDs) > 0 {
+				info["entries"] = len(p.KeyIDs)
+			}
+		}
+
+	case mp4.TypeSenc:
+		if len(r.Data()) >= 4 {
+			info["entries"] = r.EntryCount()
+		}
+
+	case mp4.TypeSaiz:
+		if s, err := mp4.ReadSaiz(r.Data(), r.Flags()); err == nil {
+			info["entries"] = s.SampleCount
+		}
+
+	case mp4.TypeSaio:
+		if s, err := mp4.ReadSaio(r.Data(), r.Version(), r.Flags()); err == nil {
+			info["entries"] = len(s.Offsets)
+		}
+
+	case mp4.TypeSbgp:
+		if s, err := mp4.ReadSbgp(r.Data(), r.Version()); err == nil {
+			info["grouping"] = string(s.GroupingType[:])
+			info["entries"] = len(s.Entries)
+		}
+
+	case mp4.TypeSgpd:
+		if s, err := mp4.ReadSgpd(r.Data(), r.Version()); err == nil {
+			info["grouping"] = string(s.GroupingType[:])
+			info["entries"] = len(s.Entries)
+		}
+
 	case mp4.TypeVmhd:
 		// graphicsMode and opcolor
 	case mp4.TypeSmhd:
@@ -376,6 +640,16 @@ func printTree(nodes []BoxNode, format Format) {
 	}
 }
 
+// isVisualEntry reports whether the box type is a visual sample entry
+// whose dimensions are printed as WxH.
+func isVisualEntry(t string) bool {
+	switch t {
+	case "avc1", "hvc1", "hev1", "dvh1", "dvhe", "dav1", "vvc1", "vvi1", "av01", "encv":
+		return true
+	}
+	return false
+}
+
 // printNodeText prints a single node in text format
 func printNodeText(node BoxNode, depth int) {
 	indent := strings.Repeat("  ", depth)
@@ -410,13 +684,13 @@ func printNodeText(node BoxNode, depth int) {
 			case "trackId":
 				fmt.Printf(" trackId=%v", val)
 			case "width":
-				if depth > 0 && node.Type == "avc1" {
+				if depth > 0 && isVisualEntry(node.Type) {
 					// Special handling for sample entries
 					continue
 				}
 				fmt.Printf(" width=%v", val)
 			case "height":
-				if depth > 0 && node.Type == "avc1" {
+				if depth > 0 && isVisualEntry(node.Type) {
 					continue
 				}
 				fmt.Printf(" height=%v", val)
@@ -446,12 +720,38 @@ func printNodeText(node BoxNode, depth int) {
 				fmt.Printf(" compressor=%q", val)
 			case "codec":
 				fmt.Printf(" codec=%v", val)
+			case "keys":
+				if keys, ok := val.([]string); ok {
+					fmt.Printf(" keys=[%s]", strings.Join(keys, ","))
+				}
+			case "value":
+				fmt.Printf(" value=%q", fmt.Sprint(val))
+			case "itemId":
+				fmt.Printf(" itemId=%v", val)
+			case "angle":
+				fmt.Printf(" angle=%v", val)
+			case "axis":
+				fmt.Printf(" axis=%v", val)
+			case "format":
+				fmt.Printf(" format=%v", val)
+			case "scheme":
+				fmt.Printf(" scheme=%v", val)
+			case "kid":
+				fmt.Printf(" kid=%v", val)
+			case "systemId":
+				fmt.Printf(" systemId=%v", val)
+			case "bits":
+				fmt.Printf(" bits=%v", val)
+			case "auxType":
+				fmt.Printf(" auxType=%v", val)
+			case "grouping":
+				fmt.Printf(" grouping=%v", val)
 			case "dataLength":
 				// Skip, will be handled by DataLength field
 			}
 		}
-		// Special formatting for avc1 and mp4a
-		if node.Type == "avc1" {
+		// Special formatting for visual sample entries
+		if isVisualEntry(node.Type) {
 			if w, haveW := node.Info["width"]; haveW {
 				if h, haveH := node.Info["height"]; haveH {
 					fmt.Printf(" %vx%v", w, h)
@@ -2,87 +2,255 @@ package mp4
 
 import "strconv"
 
-// ReadEsdsCodec extracts the MIME codec string from esds box data.
-// It parses the MPEG-4 descriptor chain to find the OTI (Object Type Indication)
-// and audio configuration. Returns a string like "40.2" for AAC-LC.
-func ReadEsdsCodec(data []byte) string {
-	if len(data) < 2 {
-		return ""
-	}
+// MPEG-4 descriptor tags used in esds.
+const (
+	DescrTagES                  = 0x03
+	DescrTagDecoderConfig       = 0x04
+	DescrTagDecoderSpecificInfo = 0x05
+	DescrTagSLConfig            = 0x06
+)
 
-	// Expect ESDescriptor (tag 0x03)
-	ptr, end := 0, len(data)
-	if data[ptr] != 0x03 {
-		return ""
-	}
-	ptr++
+// Object type indications (ISO/IEC 14496-1 Table 5) for audio.
+const (
+	OTIMPEG4Audio   = 0x40
+	OTIMPEG2AACMain = 0x66
+	OTIMPEG2AACLC   = 0x67
+	OTIMPEG2AACSSR  = 0x68
+	OTIMPEG2Audio   = 0x69 // MPEG-2 BC audio (MP3 with MPEG-2 sample rates)
+	OTIMPEG1Audio   = 0x6b // MPEG-1 audio (MP3)
+)
 
-	// Skip length bytes (variable-length encoding)
-	ptr = skipDescriptorLength(data, ptr, end)
-	if ptr < 0 || ptr+3 > end {
-		return ""
-	}
+// Stream types for DecoderConfigDescriptor.
+const (
+	StreamTypeVisual = 0x04
+	StreamTypeAudio  = 0x05
+)
+
+// slConfigPredefMP4 is the SLConfigDescriptor predefined value for MP4 files.
+const slConfigPredefMP4 = 0x02
+
+// MPEG-4 audio object types of interest for codec strings.
+const (
+	AOTAACMain = 1
+	AOTAACLC   = 2
+	AOTSBR     = 5  // HE-AAC
+	AOTPS      = 29 // HE-AAC v2
+)
+
+// ESDescriptor holds a parsed ES_Descriptor from esds box data.
+type ESDescriptor struct {
+	ESID           uint16
+	StreamPriority uint8
+	DependsOnESID  uint16 // 0 if streamDependenceFlag is not set
+	URL            string
+	OCRESID        uint16 // 0 if OCRstreamFlag is not set
+	DecoderConfig  DecoderConfigDescriptor
+}
+
+// DecoderConfigDescriptor holds a parsed DecoderConfigDescriptor.
+type DecoderConfigDescriptor struct {
+	ObjectTypeIndication uint8
+	StreamType           uint8 // 6 bits
+	UpStream             bool
+	BufferSizeDB         uint32 // 24 bits
+	MaxBitrate           uint32
+	AvgBitrate           uint32
+	DecoderSpecificInfo  []byte // points into the original buffer when read
+}
 
-	// ES_ID (2 bytes) + stream dependency flags (1 byte)
+// ReadEsds parses esds box data (after version+flags) into an ES_Descriptor.
+func ReadEsds(data []byte) (ESDescriptor, error) {
+	var d ESDescriptor
+	ptr, end, ok := readDescriptorHeader(data, 0, len(data), DescrTagES)
+	if !ok || ptr+3 > end {
+		return d, ErrTruncated
+	}
+	d.ESID = be.Uint16(data[ptr:])
 	flags := data[ptr+2]
+	d.StreamPriority = flags & 0x1f
 	ptr += 3
 
-	// Skip optional fields based on flags
 	if flags&0x80 != 0 { // streamDependenceFlag
+		if ptr+2 > end {
+			return d, ErrTruncated
+		}
+		d.DependsOnESID = be.Uint16(data[ptr:])
 		ptr += 2
 	}
 	if flags&0x40 != 0 { // URL_Flag
-		if ptr >= end {
-			return ""
+		if ptr >= end || ptr+1+int(data[ptr]) > end {
+			return d, ErrTruncated
 		}
 		urlLen := int(data[ptr])
+		d.URL = string(data[ptr+1 : ptr+1+urlLen])
 		ptr += 1 + urlLen
 	}
 	if flags&0x20 != 0 { // OCRstreamFlag
+		if ptr+2 > end {
+			return d, ErrTruncated
+		}
+		d.OCRESID = be.Uint16(data[ptr:])
 		ptr += 2
 	}
 
-	if ptr >= end {
-		return ""
+	ptr, dcEnd, ok := readDescriptorHeader(data, ptr, end, DescrTagDecoderConfig)
+	if !ok || ptr+13 > dcEnd {
+		return d, ErrTruncated
+	}
+	dc := &d.DecoderConfig
+	dc.ObjectTypeIndication = data[ptr]
+	dc.StreamType = data[ptr+1] >> 2
+	dc.UpStream = data[ptr+1]&0x02 != 0
+	dc.BufferSizeDB = uint32(data[ptr+2])<<16 | uint32(data[ptr+3])<<8 | uint32(data[ptr+4])
+	dc.MaxBitrate = be.Uint32(data[ptr+5:])
+	dc.AvgBitrate = be.Uint32(data[ptr+9:])
+	ptr += 13
+
+	if dsiPtr, dsiEnd, ok := readDescriptorHeader(data, ptr, dcEnd, DescrTagDecoderSpecificInfo); ok {
+		dc.DecoderSpecificInfo = data[dsiPtr:dsiEnd]
 	}
+	return d, nil
+}
 
-	// Expect DecoderConfigDescriptor (tag 0x04)
-	if data[ptr] != 0x04 {
-		return ""
+// readDescriptorHeader expects a descriptor with the given tag at ptr and
+// returns the start and end of its payload, clamped to end.
+func readDescriptorHeader(data []byte, ptr, end int, tag byte) (int, int, bool) {
+	if ptr >= end || data[ptr] != tag {
+		return 0, 0, false
 	}
 	ptr++
-	ptr = skipDescriptorLength(data, ptr, end)
-	if ptr < 0 || ptr+13 > end {
-		return ""
+	size := 0
+	for i := 0; ; i++ {
+		if ptr >= end || i == 4 {
+			return 0, 0, false
+		}
+		b := data[ptr]
+		ptr++
+		size = size<<7 | int(b&0x7f)
+		if b&0x80 == 0 {
+			break
+		}
 	}
+	// Some muxers write descriptor sizes that overrun the box; clamp.
+	return ptr, min(ptr+size, end), true
+}
+
+// AudioSpecificConfig returns the parsed DecoderSpecificInfo for MPEG-4
+// audio streams.
+func (d *ESDescriptor) AudioSpecificConfig() (AudioSpecificConfig, error) {
+	return ReadAudioSpecificConfig(d.DecoderConfig.DecoderSpecificInfo)
+}
 
-	oti := data[ptr]
+// Codec returns the RFC 6381 codec string suffix after "mp4a.", like "40.2".
+// For MPEG-4 audio the object type accounts for SBR and PS signalling, so
+// HE-AAC reports "40.5" and HE-AAC v2 "40.29".
+func (d *ESDescriptor) Codec() string {
+	oti := d.DecoderConfig.ObjectTypeIndication
 	if oti == 0 {
 		return ""
 	}
+	s := hexByte(oti)
+	if oti != OTIMPEG4Audio {
+		return s
+	}
+	asc, err := d.AudioSpecificConfig()
+	if err != nil || asc.CodecObjectType() == 0 {
+		return s
+	}
+	return s + "." + strconv.Itoa(int(asc.CodecObjectType()))
+}
 
-	// Format OTI as hex
-	otiStr := hexByte(oti)
+// ReadEsdsCodec extracts the MIME codec string from esds box data.
+// Returns a string like "40.2" for AAC-LC, or "" if the data is invalid.
+func ReadEsdsCodec(data []byte) string {
+	d, err := ReadEsds(data)
+	if err != nil {
+		return ""
+	}
+	return d.Codec()
+}
 
-	// Skip to DecoderSpecificInfo: OTI(1)+streamType(1)+bufferSizeDB(3)+maxBitrate(4)+avgBitrate(4) = 13
-	ptr += 13
+// WriteEsds writes a complete esds box. An SLConfigDescriptor with the
+// predefined MP4 value is appended as required by ISO/IEC 14496-14.
+func (w *Writer) WriteEsds(d ESDescriptor) {
+	dc := &d.DecoderConfig
+	dsiSize := 0
+	if len(dc.DecoderSpecificInfo) > 0 {
+		dsiSize = descriptorSize(len(dc.DecoderSpecificInfo))
+	}
+	dcSize := 13 + dsiSize
+	esSize := 3 + descriptorSize(dcSize) + descriptorSize(1)
+	flags := d.StreamPriority & 0x1f
+	if d.DependsOnESID != 0 {
+		flags |= 0x80
+		esSize += 2
+	}
+	if d.URL != "" {
+		flags |= 0x40
+		esSize += 1 + len(d.URL)
+	}
+	if d.OCRESID != 0 {
+		flags |= 0x20
+		esSize += 2
+	}
 
-	if ptr >= end || data[ptr] != 0x05 {
-		// No DecoderSpecificInfo, return just OTI
-		return otiStr
+	w.StartFullBox(TypeEsds, 0, 0)
+	w.putDescriptorHeader(DescrTagES, esSize)
+	w.putUint16(d.ESID)
+	w.putUint8(flags)
+	if d.DependsOnESID != 0 {
+		w.putUint16(d.DependsOnESID)
 	}
-	ptr++
-	ptr = skipDescriptorLength(data, ptr, end)
-	if ptr < 0 || ptr >= end {
-		return otiStr
+	if d.URL != "" {
+		w.putUint8(uint8(len(d.URL)))
+		w.putBytes([]byte(d.URL))
+	}
+	if d.OCRESID != 0 {
+		w.putUint16(d.OCRESID)
 	}
 
-	// Extract audio object type from first byte
-	audioConfig := (data[ptr] & 0xf8) >> 3
-	if audioConfig == 0 {
-		return otiStr
+	w.putDescriptorHeader(DescrTagDecoderConfig, dcSize)
+	w.putUint8(dc.ObjectTypeIndication)
+	b := dc.StreamType<<2 | 0x01 // reserved bit
+	if dc.UpStream {
+		b |= 0x02
+	}
+	w.putUint8(b)
+	w.putUint8(uint8(dc.BufferSizeDB >> 16))
+	w.putUint16(uint16(dc.BufferSizeDB))
+	w.putUint32(dc.MaxBitrate)
+	w.putUint32(dc.AvgBitrate)
+	if len(dc.DecoderSpecificInfo) > 0 {
+		w.putDescriptorHeader(DescrTagDecoderSpecificInfo, len(dc.DecoderSpecificInfo))
+		w.putBytes(dc.DecoderSpecificInfo)
+	}
+
+	w.putDescriptorHeader(DescrTagSLConfig, 1)
+	w.putUint8(slConfigPredefMP4)
+	w.EndBox()
+}
+
+// descriptorSize returns the total size of a descriptor with the given
+// payload size, including tag and length bytes.
+func descriptorSize(payload int) int {
+	n := 1
+	for v := payload >> 7; v > 0; v >>= 7 {
+		n++
+	}
+	return 1 + n + payload
+}
+
+// putDescriptorHeader writes a descriptor tag and its minimal-length size.
+func (w *Writer) putDescriptorHeader(tag byte, size int) {
+	w.putUint8(tag)
+	n := descriptorSize(size) - size - 1
+	for i := n - 1; i >= 0; i-- {
+		b := byte(size>>(7*i)) & 0x7f
+		if i > 0 {
+			b |= 0x80
+		}
+		w.putUint8(b)
 	}
-	return otiStr + "." + strconv.Itoa(int(audioConfig))
 }
 
 // hexByte formats a byte as a lowercase hex string without leading zeros beyond one digit.
@@ -96,19 +264,6 @@ func hexByte(b byte) string {
 	return string(buf[:])
 }
 
-// skipDescriptorLength skips the variable-length descriptor length field.
-// Returns the new position, or -1 on error.
-func skipDescriptorLength(data []byte, ptr, end int) int {
-	for ptr < end {
-		b := data[ptr]
-		ptr++
-		if b&0x80 == 0 {
-			return ptr
-		}
-	}
-	return -1
-}
-
 const hexChars = "0123456789abcdef"
 
 // hexDigit returns the lowercase hex character for a 4-bit nibble.
@@ -0,0 +1,90 @@
+package mp4
+
+// DolbyVisionConfig holds a parsed DOVIDecoderConfigurationRecord, carried
+// in dvcC (profiles 0-7), dvvC (profiles 8-10) or dvwC (profiles above 10).
+type DolbyVisionConfig struct {
+	VersionMajor uint8
+	VersionMinor uint8
+	Profile      uint8 // 7 bits
+	Level        uint8 // 6 bits
+	RPUPresent   bool
+	ELPresent    bool
+	BLPresent    bool
+
+	// BLSignalCompatibilityID describes how the base layer decodes without
+	// Dolby Vision: 0 none, 1 HDR10, 2 SDR, 4 HLG, 6 HDR10 (profile 8.1 with
+	// Blu-ray signalling).
+	BLSignalCompatibilityID uint8
+}
+
+// doviConfigSize is the size of DOVIDecoderConfigurationRecord including
+// its reserved trailing bytes.
+const doviConfigSize = 24
+
+// ReadDolbyVisionConfig parses dvcC, dvvC or dvwC box data.
+func ReadDolbyVisionConfig(data []byte) (DolbyVisionConfig, error) {
+	if len(data) < 5 {
+		return DolbyVisionConfig{}, ErrTruncated
+	}
+	return DolbyVisionConfig{
+		VersionMajor:            data[0],
+		VersionMinor:            data[1],
+		Profile:                 data[2] >> 1,
+		Level:                   (data[2]&0x01)<<5 | data[3]>>3,
+		RPUPresent:              data[3]&0x04 != 0,
+		ELPresent:               data[3]&0x02 != 0,
+		BLPresent:               data[3]&0x01 != 0,
+		BLSignalCompatibilityID: data[4] >> 4,
+	}, nil
+}
+
+// BoxType returns the configuration box type for the profile: dvcC for
+// profiles up to 7, dvvC for 8 to 10 and dvwC above.
+func (c *DolbyVisionConfig) BoxType() BoxType {
+	switch {
+	case c.Profile <= 7:
+		return TypeDvcC
+	case c.Profile <= 10:
+		return TypeDvvC
+	}
+	return TypeDvwC
+}
+
+// Codec returns the RFC 6381 suffix for Dolby Vision codec strings as a
+// two-digit profile and level, e.g. "08.06" for "dvh1.08.06".
+func (c *DolbyVisionConfig) Codec() string {
+	var buf [5]byte
+	buf[0] = '0' + c.Profile/10%10
+	buf[1] = '0' + c.Profile%10
+	buf[2] = '.'
+	buf[3] = '0' + c.Level/10%10
+	buf[4] = '0' + c.Level%10
+	return string(buf[:])
+}
+
+// WriteDolbyVisionConfig writes a complete dvcC, dvvC or dvwC box, chosen
+// from the profile. A zero version is written as 1.0.
+func (w *Writer) WriteDolbyVisionConfig(c DolbyVisionConfig) {
+	w.StartBox(c.BoxType())
+	major, minor := c.VersionMajor, c.VersionMinor
+	if major == 0 {
+		major = 1
+	}
+	w.putUint8(major)
+	w.putUint8(minor)
+	w.putUint8(c.Profile<<1 | (c.Level>>5)&0x01)
+	b := (c.Level & 0x1f) << 3
+	if c.RPUPresent {
+		b |= 0x04
+	}
+	if c.ELPresent {
+		b |= 0x02
+	}
+	if c.BLPresent {
+		b |= 0x01
+	}
+	w.putUint8(b)
+	w.putUint8(c.BLSignalCompatibilityID << 4)
+	w.putZeros(doviConfigSize - 5)
+	w.EndBox()
+}
@@ -0,0 +1,28 @@
+package mp4_test
+
+import (
+	"testing"
+
+	"github.com/tetsuo/mp4"
+)
+
+func TestDolbyVisionConfigRoundTrip(t *testing.T) {
+	for _, c := range []mp4.DolbyVisionConfig{
+		{VersionMajor: 1, Profile: 5, Level: 6, RPUPresent: true, BLPresent: true},
+		{VersionMajor: 1, Profile: 8, Level: 9, RPUPresent: true, BLPresent: true, BLSignalCompatibilityID: 4},
+		{VersionMajor: 2, VersionMinor: 1, Profile: 10, Level: 13, RPUPresent: true, BLPresent: true, BLSignalCompatibilityID: 1},
+		{VersionMajor: 1, Profile: 20, Level: 1, RPUPresent: true, ELPresent: true},
+	} {
+		r := writeBox(t, func(w *mp4.Writer) { w.WriteDolbyVisionConfig(c) })
+		if r.Type() != c.BoxType() {
+			t.Errorf("profile %d: box type = %v, want %v", c.Profile, r.Type(), c.BoxType())
+		}
+		got, err := mp4.ReadDolbyVisionConfig(r.Data())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c {
+			t.Errorf("got %+v, want %+v", got, c)
+		}
+	}
+}
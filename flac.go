@@ -0,0 +1,134 @@
+package mp4
+
+// FLAC metadata block types.
+const (
+	FlacBlockStreamInfo    = 0
+	FlacBlockPadding       = 1
+	FlacBlockApplication   = 2
+	FlacBlockSeekTable     = 3
+	FlacBlockVorbisComment = 4
+	FlacBlockCueSheet      = 5
+	FlacBlockPicture       = 6
+)
+
+// flacStreamInfoSize is the fixed size of a STREAMINFO block body.
+const flacStreamInfoSize = 34
+
+// FlacMetadataBlock is one FLAC metadata block carried in a dfLa box.
+// The last-metadata-block flag is derived from the block position when
+// writing and is not stored.
+type FlacMetadataBlock struct {
+	Type uint8
+	Data []byte // block body; points into the original buffer when read
+}
+
+// FlacStreamInfo holds the fields of a FLAC STREAMINFO metadata block.
+type FlacStreamInfo struct {
+	MinBlockSize  uint16
+	MaxBlockSize  uint16
+	MinFrameSize  uint32 // 24 bits, 0 if unknown
+	MaxFrameSize  uint32 // 24 bits, 0 if unknown
+	SampleRate    uint32 // 20 bits, in Hz
+	Channels      uint8  // 1-8
+	BitsPerSample uint8  // 4-32
+	TotalSamples  uint64 // 36 bits, 0 if unknown
+	MD5           [16]byte
+}
+
+// FlacConfig holds the metadata blocks of a dfLa box.
+type FlacConfig struct {
+	Blocks []FlacMetadataBlock
+}
+
+// StreamInfo returns the decoded STREAMINFO block. The boolean is false if
+// the config has no valid STREAMINFO block.
+func (c *FlacConfig) StreamInfo() (FlacStreamInfo, bool) {
+	for _, b := range c.Blocks {
+		if b.Type == FlacBlockStreamInfo {
+			si, err := ReadFlacStreamInfo(b.Data)
+			return si, err == nil
+		}
+	}
+	return FlacStreamInfo{}, false
+}
+
+// ReadDfla parses dfLa box data (after version+flags) into its metadata blocks.
+func ReadDfla(data []byte) (FlacConfig, error) {
+	var c FlacConfig
+	ptr := 0
+	for ptr < len(data) {
+		if ptr+4 > len(data) {
+			return c, ErrTruncated
+		}
+		hdr := be.Uint32(data[ptr:])
+		last := hdr&0x80000000 != 0
+		typ := uint8(hdr>>24) & 0x7f
+		n := int(hdr & 0x00ffffff)
+		ptr += 4
+		if ptr+n > len(data) {
+			return c, ErrTruncated
+		}
+		c.Blocks = append(c.Blocks, FlacMetadataBlock{Type: typ, Data: data[ptr : ptr+n]})
+		ptr += n
+		if last {
+			break
+		}
+	}
+	return c, nil
+}
+
+// ReadFlacStreamInfo decodes a 34-byte STREAMINFO block body.
+func ReadFlacStreamInfo(data []byte) (FlacStreamInfo, error) {
+	if len(data) < flacStreamInfoSize {
+		return FlacStreamInfo{}, ErrTruncated
+	}
+	// sampleRate(20)+channels-1(3)+bitsPerSample-1(5)+totalSamples(36) = 64 bits
+	v := be.Uint64(data[10:18])
+	si := FlacStreamInfo{
+		MinBlockSize:  be.Uint16(data[0:2]),
+		MaxBlockSize:  be.Uint16(data[2:4]),
+		MinFrameSize:  uint32(data[4])<<16 | uint32(data[5])<<8 | uint32(data[6]),
+		MaxFrameSize:  uint32(data[7])<<16 | uint32(data[8])<<8 | uint32(data[9]),
+		SampleRate:    uint32(v >> 44),
+		Channels:      uint8(v>>41&0x07) + 1,
+		BitsPerSample: uint8(v>>36&0x1f) + 1,
+		TotalSamples:  v & 0x0000000fffffffff,
+	}
+	copy(si.MD5[:], data[18:34])
+	return si, nil
+}
+
+// Block encodes the stream info as a STREAMINFO metadata block.
+func (si FlacStreamInfo) Block() FlacMetadataBlock {
+	buf := make([]byte, flacStreamInfoSize)
+	be.PutUint16(buf[0:2], si.MinBlockSize)
+	be.PutUint16(buf[2:4], si.MaxBlockSize)
+	buf[4], buf[5], buf[6] = byte(si.MinFrameSize>>16), byte(si.MinFrameSize>>8), byte(si.MinFrameSize)
+	buf[7], buf[8], buf[9] = byte(si.MaxFrameSize>>16), byte(si.MaxFrameSize>>8), byte(si.MaxFrameSize)
+	v := uint64(si.SampleRate&0xfffff)<<44 |
+		uint64((si.Channels-1)&0x07)<<41 |
+		uint64((si.BitsPerSample-1)&0x1f)<<36 |
+		si.TotalSamples&0x0000000fffffffff
+	be.PutUint64(buf[10:18], v)
+	copy(buf[18:34], si.MD5[:])
+	return FlacMetadataBlock{Type: FlacBlockStreamInfo, Data: buf}
+}
+
+// WriteDfla writes a complete dfLa box. The STREAMINFO block must come first;
+// the last-metadata-block flag is set on the final block.
+//
+// The enclosing fLaC sample entry stores the sample rate as 16.16 fixed point,
+// so rates above 65535 Hz must be written as 0 there; readers should take the
+// rate from STREAMINFO.
+func (w *Writer) WriteDfla(c FlacConfig) {
+	w.StartFullBox(TypeDfla, 0, 0)
+	for i, b := range c.Blocks {
+		hdr := uint32(b.Type&0x7f)<<24 | uint32(len(b.Data))&0x00ffffff
+		if i == len(c.Blocks)-1 {
+			hdr |= 0x80000000
+		}
+		w.putUint32(hdr)
+		w.putBytes(b.Data)
+	}
+	w.EndBox()
+}
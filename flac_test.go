@@ -0,0 +1,63 @@
+package mp4_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tetsuo/mp4"
+)
+
+func TestDflaRoundTrip(t *testing.T) {
+	si := mp4.FlacStreamInfo{
+		MinBlockSize:  4096,
+		MaxBlockSize:  4096,
+		MinFrameSize:  14,
+		MaxFrameSize:  12000,
+		SampleRate:    96000,
+		Channels:      2,
+		BitsPerSample: 24,
+		TotalSamples:  1 << 33,
+		MD5:           [16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+	}
+	c := mp4.FlacConfig{Blocks: []mp4.FlacMetadataBlock{
+		si.Block(),
+		{Type: mp4.FlacBlockVorbisComment, Data: []byte{0, 0, 0, 0, 0, 0, 0, 0}},
+	}}
+	r := writeBox(t, func(w *mp4.Writer) { w.WriteDfla(c) })
+	if r.Type() != mp4.TypeDfla {
+		t.Fatalf("type = %v, want dfLa", r.Type())
+	}
+	got, err := mp4.ReadDfla(r.Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, c) {
+		t.Errorf("got %+v, want %+v", got, c)
+	}
+	if gotSI, ok := got.StreamInfo(); !ok || gotSI != si {
+		t.Errorf("stream info = %+v, %v, want %+v", gotSI, ok, si)
+	}
+}
+
+func TestAlacConfigRoundTrip(t *testing.T) {
+	c := mp4.AlacConfig{
+		FrameLength:   4096,
+		BitDepth:      16,
+		PB:            40,
+		MB:            10,
+		KB:            14,
+		NumChannels:   2,
+		MaxRun:        255,
+		MaxFrameBytes: 16392,
+		AvgBitRate:    1411200,
+		SampleRate:    176400,
+	}
+	r := writeBox(t, func(w *mp4.Writer) { w.WriteAlacConfig(c) })
+	got, err := mp4.ReadAlacConfig(r.Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != c {
+		t.Errorf("got %+v, want %+v", got, c)
+	}
+}
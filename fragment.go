@@ -0,0 +1,298 @@
+package mp4
+
+import "errors"
+
+// ErrInvalidFragment is returned by ReadTrackFragments for buffers that do
+// not hold a moof box or whose track fragments lack a tfhd box.
+var ErrInvalidFragment = errors.New("mp4: invalid track fragment")
+
+// TrackFragmentHeader holds all fields of a tfhd box. Optional fields are
+// zero unless the matching Tfhd flag is set in Flags.
+type TrackFragmentHeader struct {
+	Flags                  uint32
+	TrackID                uint32
+	BaseDataOffset         uint64
+	SampleDescriptionIndex uint32
+	DefaultSampleDuration  uint32
+	DefaultSampleSize      uint32
+	DefaultSampleFlags     uint32
+}
+
+// ReadTrackFragmentHeader parses tfhd box data (after version+flags).
+func ReadTrackFragmentHeader(data []byte, flags uint32) (TrackFragmentHeader, error) {
+	h := TrackFragmentHeader{Flags: flags}
+	if len(data) < 4 {
+		return h, ErrTruncated
+	}
+	h.TrackID = be.Uint32(data)
+	ptr := 4
+	if flags&TfhdBaseDataOffsetPresent != 0 {
+		if len(data) < ptr+8 {
+			return h, ErrTruncated
+		}
+		h.BaseDataOffset = be.Uint64(data[ptr:])
+		ptr += 8
+	}
+	read32 := func(flag uint32, dst *uint32) bool {
+		if flags&flag == 0 {
+			return true
+		}
+		if len(data) < ptr+4 {
+			return false
+		}
+		*dst = be.Uint32(data[ptr:])
+		ptr += 4
+		return true
+	}
+	if !read32(TfhdSampleDescriptionIndexPresent, &h.SampleDescriptionIndex) ||
+		!read32(TfhdDefaultSampleDurationPresent, &h.DefaultSampleDuration) ||
+		!read32(TfhdDefaultSampleSizePresent, &h.DefaultSampleSize) ||
+		!read32(TfhdDefaultSampleFlagsPresent, &h.DefaultSampleFlags) {
+		return h, ErrTruncated
+	}
+	return h, nil
+}
+
+// WriteTrackFragmentHeader writes a complete tfhd box with the optional
+// fields selected by h.Flags.
+func (w *Writer) WriteTrackFragmentHeader(h TrackFragmentHeader) {
+	w.StartFullBox(TypeTfhd, 0, h.Flags)
+	w.putUint32(h.TrackID)
+	if h.Flags&TfhdBaseDataOffsetPresent != 0 {
+		w.putUint64(h.BaseDataOffset)
+	}
+	if h.Flags&TfhdSampleDescriptionIndexPresent != 0 {
+		w.putUint32(h.SampleDescriptionIndex)
+	}
+	if h.Flags&TfhdDefaultSampleDurationPresent != 0 {
+		w.putUint32(h.DefaultSampleDuration)
+	}
+	if h.Flags&TfhdDefaultSampleSizePresent != 0 {
+		w.putUint32(h.DefaultSampleSize)
+	}
+	if h.Flags&TfhdDefaultSampleFlagsPresent != 0 {
+		w.putUint32(h.DefaultSampleFlags)
+	}
+	w.EndBox()
+}
+
+// TrackRun holds all fields of a trun box. DataOffset and FirstSampleFlags
+// are zero unless the matching Trun flag is set in Flags. Version 1 makes
+// composition time offsets signed.
+type TrackRun struct {
+	Version          uint8
+	Flags            uint32
+	DataOffset       int32
+	FirstSampleFlags uint32
+	Entries          []TrunEntry
+}
+
+// ReadTrackRun parses trun box data (after version+flags).
+func ReadTrackRun(data []byte, version uint8, flags uint32) (TrackRun, error) {
+	run := TrackRun{Version: version, Flags: flags}
+	it := NewTrunIter(data, flags)
+	if it.buf == nil {
+		return run, ErrTruncated
+	}
+	run.DataOffset = it.DataOffset()
+	run.FirstSampleFlags = it.FirstSampleFlags()
+	// Bound the allocation by the entries the data can hold.
+	if it.stride > 0 && it.Count() > uint32((len(data)-it.entriesStart)/it.stride) {
+		return run, ErrTruncated
+	}
+	run.Entries = make([]TrunEntry, 0, min(it.Count(), uint32(len(data))))
+	for e, ok := it.Next(); ok; e, ok = it.Next() {
+		run.Entries = append(run.Entries, e)
+	}
+	return run, nil
+}
+
+// WriteTrackRun writes a complete trun box with the version and optional
+// fields of r.
+func (w *Writer) WriteTrackRun(r TrackRun) {
+	w.StartFullBox(TypeTrun, r.Version, r.Flags)
+	w.putUint32(uint32(len(r.Entries)))
+	if r.Flags&TrunDataOffsetPresent != 0 {
+		w.putInt32(r.DataOffset)
+	}
+	if r.Flags&TrunFirstSampleFlagsPresent != 0 {
+		w.putUint32(r.FirstSampleFlags)
+	}
+	for _, e := range r.Entries {
+		if r.Flags&TrunSampleDurationPresent != 0 {
+			w.putUint32(e.Duration)
+		}
+		if r.Flags&TrunSampleSizePresent != 0 {
+			w.putUint32(e.Size)
+		}
+		if r.Flags&TrunSampleFlagsPresent != 0 {
+			w.putUint32(e.Flags)
+		}
+		if r.Flags&TrunSampleCompositionTimeOffsetPresent != 0 {
+			w.putInt32(e.CompositionTimeOffset)
+		}
+	}
+	w.EndBox()
+}
+
+// SampleDefaults holds the sample values a track fragment's truns fall
+// back on, from the track's trex box.
+type SampleDefaults struct {
+	Duration uint32
+	Size     uint32
+	Flags    uint32
+}
+
+// FragmentSample is one sample of a track fragment, with the defaults of
+// tfhd and trex applied.
+type FragmentSample struct {
+	Offset                int64 // file offset of the sample data
+	Size                  uint32
+	Duration              uint32
+	Flags                 uint32
+	CompositionTimeOffset int32
+}
+
+// FragmentRun is a trun box of a track fragment and the file offset of
+// its sample data.
+type FragmentRun struct {
+	TrackRun
+	Offset int64
+}
+
+// TrackFragment is a traf box with the samples of its truns located.
+type TrackFragment struct {
+	Header        TrackFragmentHeader
+	DecodeTime    uint64 // from tfdt, if HasDecodeTime
+	HasDecodeTime bool
+	Runs          []FragmentRun
+	Samples       []FragmentSample // of all runs, in order
+}
+
+// ReadTrackFragments returns the track fragments of a moof box. The moof
+// buffer must include the box header, and moofOffset is its offset in the
+// file, which sample offsets are based on. defaults holds the trex
+// defaults of each track by track ID.
+//
+// Sample durations, sizes and flags not given in trun come from tfhd, then
+// from defaults. Without a base data offset or default-base-is-moof, the
+// data of each track fragment follows that of the previous one, starting
+// at the moof.
+func ReadTrackFragments(moof []byte, moofOffset int64, defaults map[uint32]SampleDefaults) ([]TrackFragment, error) {
+	r := NewReader(moof)
+	if !r.Next() || r.Type() != TypeMoof {
+		return nil, ErrInvalidFragment
+	}
+	nextBase := moofOffset
+	var frags []TrackFragment
+	r.Enter()
+	defer r.Exit()
+	for r.Next() {
+		if r.Type() != TypeTraf {
+			continue
+		}
+		f, end, err := readTraf(&r, moofOffset, nextBase, defaults)
+		if err != nil {
+			return nil, err
+		}
+		frags = append(frags, f)
+		nextBase = end
+	}
+	return frags, nil
+}
+
+// readTraf reads the traf box r is at and returns it with the end offset
+// of its sample data.
+func readTraf(r *Reader, moofOffset, nextBase int64, defaults map[uint32]SampleDefaults) (TrackFragment, int64, error) {
+	var f TrackFragment
+	var def SampleDefaults
+	var haveTfhd bool
+	var base, pos int64
+
+	r.Enter()
+	defer r.Exit()
+	for r.Next() {
+		switch r.Type() {
+		case TypeTfhd:
+			var err error
+			if f.Header, err = ReadTrackFragmentHeader(r.Data(), r.Flags()); err != nil {
+				return f, 0, err
+			}
+			h := f.Header
+			haveTfhd = true
+
+			def = defaults[h.TrackID]
+			if h.Flags&TfhdDefaultSampleDurationPresent != 0 {
+				def.Duration = h.DefaultSampleDuration
+			}
+			if h.Flags&TfhdDefaultSampleSizePresent != 0 {
+				def.Size = h.DefaultSampleSize
+			}
+			if h.Flags&TfhdDefaultSampleFlagsPresent != 0 {
+				def.Flags = h.DefaultSampleFlags
+			}
+
+			switch {
+			case h.Flags&TfhdBaseDataOffsetPresent != 0:
+				base = int64(h.BaseDataOffset)
+			case h.Flags&TfhdDefaultBaseIsMoof != 0:
+				base = moofOffset
+			default:
+				base = nextBase
+			}
+			pos = base
+
+		case TypeTfdt:
+			need := 4
+			if r.Version() == 1 {
+				need = 8
+			}
+			if len(r.Data()) >= need {
+				f.DecodeTime = r.ReadTfdt()
+				f.HasDecodeTime = true
+			}
+
+		case TypeTrun:
+			if !haveTfhd {
+				return f, 0, ErrInvalidFragment
+			}
+			run, err := ReadTrackRun(r.Data(), r.Version(), r.Flags())
+			if err != nil {
+				return f, 0, err
+			}
+			if run.Flags&TrunDataOffsetPresent != 0 {
+				pos = base + int64(run.DataOffset)
+			}
+			f.Runs = append(f.Runs, FragmentRun{TrackRun: run, Offset: pos})
+			for i, e := range run.Entries {
+				s := FragmentSample{
+					Offset:   pos,
+					Size:     def.Size,
+					Duration: def.Duration,
+					Flags:    def.Flags,
+				}
+				if i == 0 && run.Flags&TrunFirstSampleFlagsPresent != 0 {
+					s.Flags = run.FirstSampleFlags
+				}
+				if run.Flags&TrunSampleDurationPresent != 0 {
+					s.Duration = e.Duration
+				}
+				if run.Flags&TrunSampleSizePresent != 0 {
+					s.Size = e.Size
+				}
+				if run.Flags&TrunSampleFlagsPresent != 0 {
+					s.Flags = e.Flags
+				}
+				if run.Flags&TrunSampleCompositionTimeOffsetPresent != 0 {
+					s.CompositionTimeOffset = e.CompositionTimeOffset
+				}
+				f.Samples = append(f.Samples, s)
+				pos += int64(s.Size)
+			}
+		}
+	}
+	if !haveTfhd {
+		return f, 0, ErrInvalidFragment
+	}
+	return f, pos, nil
+}
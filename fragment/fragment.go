@@ -0,0 +1,432 @@
+// Package fragment converts the tracks of a progressive MP4 file into
+// fragmented MP4: an init segment holding the track setup and media
+// segments holding the samples.
+package fragment
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"time"
+
+	"github.com/tetsuo/mp4"
+	"github.com/tetsuo/mp4/track"
+)
+
+var (
+	ErrNoTracks      = errors.New("fragment: no tracks")
+	ErrNoSamples     = errors.New("fragment: tracks have no samples")
+	ErrInvalidTarget = errors.New("fragment: target duration must be positive")
+	ErrSegmentRange  = errors.New("fragment: segment index out of range")
+	ErrSegmentSize   = errors.New("fragment: segment data offset exceeds 2GB")
+	ErrSampleEntries = errors.New("fragment: track has several sample descriptions")
+)
+
+// Sample flags of trun entries: sample_depends_on and
+// sample_is_non_sync_sample.
+const (
+	syncSampleFlags    = 0x02000000 // depends on no other sample
+	nonSyncSampleFlags = 0x01010000 // depends on others, not a sync sample
+)
+
+var (
+	brandIso6 = [4]byte{'i', 's', 'o', '6'}
+	brandMsdh = [4]byte{'m', 's', 'd', 'h'}
+	brandMsix = [4]byte{'m', 's', 'i', 'x'}
+	brandMp41 = [4]byte{'m', 'p', '4', '1'}
+)
+
+// Fragmenter writes the tracks of a progressive MP4 file as an init
+// segment and media segments.
+type Fragmenter struct {
+	tracks []*track.Track
+	r      io.ReaderAt
+	ref    *track.Track
+
+	// cuts[i][j] is the index of the first sample of track j in segment i;
+	// cuts[len(cuts)-1] holds the sample counts.
+	cuts [][]int
+
+	buf []byte
+}
+
+// New returns a Fragmenter for tracks, whose sample data is read from r.
+//
+// Media segments are cut at the sync samples of the first video track, or
+// of the first track if there is no video, and last at least target except
+// for the final one. Samples of the other tracks go to the segment their
+// decode time falls in.
+//
+// Every fragment of a track refers to the sample description its trex box
+// names, so tracks whose stsd box holds several sample entries are
+// rejected with ErrSampleEntries.
+func New(tracks []*track.Track, r io.ReaderAt, target time.Duration) (*Fragmenter, error) {
+	if len(tracks) == 0 {
+		return nil, ErrNoTracks
+	}
+	if target <= 0 {
+		return nil, ErrInvalidTarget
+	}
+	f := &Fragmenter{tracks: tracks, r: r}
+	for _, t := range tracks {
+		if sampleEntryCount(t.StsdRaw()) > 1 {
+			return nil, ErrSampleEntries
+		}
+		if len(t.Samples) == 0 {
+			continue
+		}
+		if f.ref == nil || t.Kind == track.TrackVideo && f.ref.Kind != track.TrackVideo {
+			f.ref = t
+		}
+	}
+	if f.ref == nil {
+		return nil, ErrNoSamples
+	}
+	f.split(target)
+	return f, nil
+}
+
+// sampleEntryCount returns the number of sample entries in stsd box raw.
+func sampleEntryCount(raw []byte) int {
+	r := mp4.NewReader(raw)
+	if !r.Next() || len(r.Data()) < 4 {
+		return 0
+	}
+	n := 0
+	er := mp4.NewReader(r.Data()[4:])
+	for er.Next() {
+		n++
+	}
+	return n
+}
+
+// split computes the segment boundaries.
+func (f *Fragmenter) split(target time.Duration) {
+	ref := f.ref
+	step := int64(target) * int64(ref.TimeScale) / int64(time.Second)
+	if step == 0 {
+		step = 1
+	}
+
+	// Decode times of the reference track at which segments start.
+	starts := []int64{ref.Samples[0].DTS}
+	for _, s := range ref.Samples[1:] {
+		if s.IsSync && s.DTS-starts[len(starts)-1] >= step {
+			starts = append(starts, s.DTS)
+		}
+	}
+
+	f.cuts = make([][]int, len(starts)+1)
+	for i, start := range starts {
+		f.cuts[i] = make([]int, len(f.tracks))
+		if i == 0 {
+			continue // every segment-0 cut is sample 0
+		}
+		for j, t := range f.tracks {
+			// First sample at or after start, compared across timescales.
+			n := f.cuts[i-1][j]
+			for n < len(t.Samples) && t.Samples[n].DTS*int64(ref.TimeScale) < start*int64(t.TimeScale) {
+				n++
+			}
+			f.cuts[i][j] = n
+		}
+	}
+	last := make([]int, len(f.tracks))
+	for j, t := range f.tracks {
+		last[j] = len(t.Samples)
+	}
+	f.cuts[len(starts)] = last
+}
+
+// NumSegments returns the number of media segments.
+func (f *Fragmenter) NumSegments() int { return len(f.cuts) - 1 }
+
+// SegmentTime returns the decode time at which media segment i starts and
+// its duration, on the timeline of the track segments are cut at.
+func (f *Fragmenter) SegmentTime(i int) (start, duration time.Duration) {
+	if i < 0 || i >= f.NumSegments() {
+		return 0, 0
+	}
+	j := f.refIndex()
+	s := f.ref.Samples
+	from, to := s[f.cuts[i][j]].DTS, s[len(s)-1].DTS+int64(s[len(s)-1].Duration)
+	if i+1 < f.NumSegments() {
+		to = s[f.cuts[i+1][j]].DTS
+	}
+	return track.TicksToDuration(from, f.ref.TimeScale), track.TicksToDuration(to-from, f.ref.TimeScale)
+}
+
+func (f *Fragmenter) refIndex() int {
+	for j, t := range f.tracks {
+		if t == f.ref {
+			return j
+		}
+	}
+	return 0
+}
+
+// WriteInit writes the init segment to w: an ftyp box and a moov box whose
+// tracks carry the sample descriptions and edit lists of the progressive
+// file, empty sample tables and an mvex box with a trex box per track.
+// Durations in the movie, track and media headers are 0.
+func (f *Fragmenter) WriteInit(w io.Writer) error {
+	size := 1024
+	var nextID uint32
+	for _, t := range f.tracks {
+		size += 512 + len(t.StsdRaw()) + len(t.TkhdRaw()) + len(t.MdhdRaw()) +
+			len(t.HdlrRaw()) + len(t.DinfRaw()) + len(t.EdtsRaw())
+		nextID = max(nextID, t.ID)
+	}
+	// Edit list durations are in the movie timescale of the source.
+	timescale := f.tracks[0].MovieTimeScale()
+	if timescale == 0 {
+		timescale = 1000
+	}
+	mw := mp4.NewWriter(make([]byte, size))
+	mw.WriteFtyp(brandIso6, 0, [][4]byte{brandIso6, brandMp41})
+
+	mw.StartBox(mp4.TypeMoov)
+	mw.WriteMvhd(timescale, 0, nextID+1)
+	for _, t := range f.tracks {
+		writeTrak(&mw, t)
+	}
+	mw.StartBox(mp4.TypeMvex)
+	for _, t := range f.tracks {
+		descIdx := t.SampleDescIdx
+		if descIdx == 0 {
+			descIdx = 1
+		}
+		mw.WriteTrex(t.ID, descIdx, 0, 0, 0)
+	}
+	mw.EndBox() // mvex
+	mw.EndBox() // moov
+
+	if err := mw.Err(); err != nil {
+		return err
+	}
+	_, err := w.Write(mw.Bytes())
+	return err
+}
+
+// writeTrak writes the trak box of t for an init segment. tkhd, edts,
+// mdhd, hdlr, dinf and stsd are copied from the progressive file, with the
+// tkhd and mdhd durations set to 0.
+func writeTrak(w *mp4.Writer, t *track.Track) {
+	w.StartBox(mp4.TypeTrak)
+	w.StartFullBox(mp4.TypeTkhd, t.TkhdVersion(), t.TkhdFlags())
+	w.Write(clearDuration(t.TkhdRaw(), t.TkhdVersion(), 16, 24))
+	w.EndBox()
+	w.Write(t.EdtsRaw())
+
+	w.StartBox(mp4.TypeMdia)
+	w.StartFullBox(mp4.TypeMdhd, t.MdhdVersion(), 0)
+	w.Write(clearDuration(t.MdhdRaw(), t.MdhdVersion(), 12, 20))
+	w.EndBox()
+	w.Write(t.HdlrRaw())
+
+	w.StartBox(mp4.TypeMinf)
+	switch {
+	case t.HasVmhd():
+		w.WriteVmhd()
+	case t.Kind == track.TrackAudio:
+		w.WriteSmhd()
+	case t.Kind == track.TrackSubtitle:
+		w.StartFullBox(mp4.TypeSthd, 0, 0)
+		w.EndBox()
+	default:
+		w.StartFullBox(mp4.TypeNmhd, 0, 0)
+		w.EndBox()
+	}
+	if t.HasDinf() {
+		w.Write(t.DinfRaw())
+	} else {
+		w.StartBox(mp4.TypeDinf)
+		w.WriteDref()
+		w.EndBox()
+	}
+
+	w.StartBox(mp4.TypeStbl)
+	w.Write(t.StsdRaw())
+	w.WriteStts(nil)
+	w.WriteStsc(nil)
+	w.WriteStsz(0, nil)
+	w.WriteStco(nil)
+	w.EndBox() // stbl
+	w.EndBox() // minf
+	w.EndBox() // mdia
+	w.EndBox() // trak
+}
+
+// clearDuration returns a copy of tkhd or mdhd box data whose duration
+// field, at off0 in version 0 boxes and at off1 in version 1 boxes, is 0.
+func clearDuration(data []byte, version uint8, off0, off1 int) []byte {
+	data = append([]byte(nil), data...)
+	off, n := off0, 4
+	if version == 1 {
+		off, n = off1, 8
+	}
+	if len(data) >= off+n {
+		clear(data[off : off+n])
+	}
+	return data
+}
+
+// WriteSegment writes media segment i to w: an styp box, then a moof box
+// with a traf box per track that has samples in the segment, then an mdat
+// box with their data. The moof sequence number is i+1. Each traf has a
+// tfdt box with the decode time of its first sample, and its trun data
+// offset is relative to the moof; segments in which a run would start 2 GiB
+// or more past the moof are rejected with ErrSegmentSize.
+func (f *Fragmenter) WriteSegment(w io.Writer, i int) error {
+	if i < 0 || i >= f.NumSegments() {
+		return ErrSegmentRange
+	}
+	from, to := f.cuts[i], f.cuts[i+1]
+
+	// Entries and data size of each track fragment.
+	runs := make([][]mp4.TrunEntry, len(f.tracks))
+	var dataSize int64
+	n := 0
+	for j, t := range f.tracks {
+		samples := t.Samples[from[j]:to[j]]
+		if len(samples) == 0 {
+			continue
+		}
+		run := make([]mp4.TrunEntry, len(samples))
+		for k, s := range samples {
+			run[k] = mp4.TrunEntry{
+				Duration:              s.Duration,
+				Size:                  s.Size,
+				Flags:                 nonSyncSampleFlags,
+				CompositionTimeOffset: s.PresentationOffset,
+			}
+			if s.IsSync {
+				run[k].Flags = syncSampleFlags
+			}
+			dataSize += int64(s.Size)
+		}
+		runs[j] = run
+		n += len(run)
+	}
+
+	mw := mp4.NewWriter(make([]byte, 512+len(f.tracks)*128+n*16))
+	mw.WriteStyp(brandMsdh, 0, [][4]byte{brandMsdh, brandMsix})
+	moofOffset := mw.Len()
+	if err := f.writeMoof(&mw, uint32(i+1), from, runs, 0); err != nil {
+		return err
+	}
+	// Data offsets are known once the size of the moof is.
+	mdatOffset := mw.Len() - moofOffset + 8
+	if dataSize+8 > 0xffffffff {
+		mdatOffset += 8
+	}
+	mw.Reset()
+	mw.WriteStyp(brandMsdh, 0, [][4]byte{brandMsdh, brandMsix})
+	if err := f.writeMoof(&mw, uint32(i+1), from, runs, int64(mdatOffset)); err != nil {
+		return err
+	}
+	if err := mw.Err(); err != nil {
+		return err
+	}
+	if _, err := w.Write(mw.Bytes()); err != nil {
+		return err
+	}
+	return f.writeMdat(w, from, to, dataSize)
+}
+
+// writeMoof writes the moof box of a segment whose samples start at from.
+// dataOffset is the offset of the first sample from the start of the moof.
+// It returns ErrSegmentSize if the data of a run starts beyond the reach
+// of the signed 32-bit trun data offset.
+func (f *Fragmenter) writeMoof(w *mp4.Writer, seq uint32, from []int, runs [][]mp4.TrunEntry, dataOffset int64) error {
+	w.StartBox(mp4.TypeMoof)
+	w.WriteMfhd(seq)
+	for j, t := range f.tracks {
+		run := runs[j]
+		if len(run) == 0 {
+			continue
+		}
+		first := t.Samples[from[j]]
+		if dataOffset > math.MaxInt32 {
+			return ErrSegmentSize
+		}
+
+		trun := mp4.TrackRun{
+			Flags: mp4.TrunDataOffsetPresent | mp4.TrunSampleDurationPresent |
+				mp4.TrunSampleSizePresent | mp4.TrunSampleFlagsPresent,
+			DataOffset: int32(dataOffset),
+			Entries:    run,
+		}
+		// Negative composition time offsets need version 1.
+		for _, e := range run {
+			if e.CompositionTimeOffset != 0 {
+				trun.Flags |= mp4.TrunSampleCompositionTimeOffsetPresent
+			}
+			if e.CompositionTimeOffset < 0 {
+				trun.Version = 1
+			}
+		}
+
+		w.StartBox(mp4.TypeTraf)
+		w.WriteTfhd(mp4.TfhdDefaultBaseIsMoof, t.ID)
+		w.WriteTfdt(uint64(max(first.DTS, 0)))
+		w.WriteTrackRun(trun)
+		w.EndBox()
+
+		for _, e := range run {
+			dataOffset += int64(e.Size)
+		}
+	}
+	w.EndBox()
+	return nil
+}
+
+// writeMdat writes the mdat box of a segment, copying the sample data of
+// each track in moof order.
+func (f *Fragmenter) writeMdat(w io.Writer, from, to []int, dataSize int64) error {
+	var hdr []byte
+	if dataSize+8 > 0xffffffff {
+		hdr = make([]byte, 16)
+		hdr[3] = 1
+		copy(hdr[4:], mp4.TypeMdat[:])
+		binary.BigEndian.PutUint64(hdr[8:], uint64(dataSize+16))
+	} else {
+		hdr = make([]byte, 8)
+		binary.BigEndian.PutUint32(hdr, uint32(dataSize+8))
+		copy(hdr[4:], mp4.TypeMdat[:])
+	}
+	if _, err := w.Write(hdr); err != nil {
+		return err
+	}
+
+	for j, t := range f.tracks {
+		for _, s := range t.Samples[from[j]:to[j]] {
+			if cap(f.buf) < int(s.Size) {
+				f.buf = make([]byte, s.Size)
+			}
+			b := f.buf[:s.Size]
+			if n, err := f.r.ReadAt(b, s.Offset); n < len(b) {
+				return err
+			}
+			if _, err := w.Write(b); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Write writes the init segment followed by every media segment to w,
+// producing a single fragmented MP4 file.
+func (f *Fragmenter) Write(w io.Writer) error {
+	if err := f.WriteInit(w); err != nil {
+		return err
+	}
+	for i := range f.NumSegments() {
+		if err := f.WriteSegment(w, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package fragment_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/tetsuo/mp4"
+	"github.com/tetsuo/mp4/fragment"
+	"github.com/tetsuo/mp4/internal/mp4test"
+	"github.com/tetsuo/mp4/track"
+)
+
+// testMovie is a three-second movie: a video track of six half-second
+// samples with sync samples every second, composition offsets and an edit
+// list, and an audio track of twelve quarter-second samples.
+func testMovie() []byte {
+	var video, audio [][]byte
+	for i := range 6 {
+		video = append(video, bytes.Repeat([]byte{byte(i)}, 10+i))
+	}
+	for i := range 12 {
+		audio = append(audio, bytes.Repeat([]byte{0x80 | byte(i)}, 4+i))
+	}
+	si := mp4.FlacStreamInfo{MinBlockSize: 4096, MaxBlockSize: 4096, SampleRate: 48000, Channels: 2, BitsPerSample: 16}
+	m := mp4test.Movie{
+		TimeScale: 600,
+		Tracks: []mp4test.Track{{
+			ID: 1, Handler: mp4test.Video, TimeScale: 1000, Width: 640, Height: 360,
+			Entry:    mp4test.VisualEntry(mp4.TypeAvc1, 640, 360, nil),
+			Samples:  video,
+			Duration: 500,
+			Sync:     []uint32{1, 3, 5},
+			CTTS:     []mp4.CttsEntry{{Count: 6, Offset: 500}},
+			Edits:    []mp4.ElstEntry{{SegmentDuration: 1800, MediaTime: 500, MediaRateInt: 1}},
+		}, {
+			ID: 2, Handler: mp4test.Audio, TimeScale: 48000,
+			Entry: mp4test.AudioEntry(mp4.TypeFlac, 2, 48000, func(w *mp4.Writer) {
+				w.WriteDfla(mp4.FlacConfig{Blocks: []mp4.FlacMetadataBlock{si.Block()}})
+			}),
+			Samples:  audio,
+			Duration: 12000,
+		}},
+	}
+	return m.Build()
+}
+
+func parseTracks(t *testing.T, file []byte) ([]*track.Track, uint64) {
+	t.Helper()
+	tracks, duration, err := track.ParseTracks(mp4test.Moov(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tracks, duration
+}
+
+func TestFragmenter(t *testing.T) {
+	file := testMovie()
+	src, _ := parseTracks(t, file)
+	f, err := fragment.New(src, bytes.NewReader(file), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := f.NumSegments(); n != 3 {
+		t.Fatalf("segments = %d, want 3", n)
+	}
+	for i := range 3 {
+		start, duration := f.SegmentTime(i)
+		if start != time.Duration(i)*time.Second || duration != time.Second {
+			t.Errorf("segment %d time = %v+%v, want %ds+1s", i, start, duration, i)
+		}
+	}
+
+	var b bytes.Buffer
+	if err := f.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.Bytes()
+
+	tracks, duration := parseTracks(t, out)
+	if duration != 0 {
+		t.Errorf("movie duration = %d, want 0", duration)
+	}
+	if len(tracks) != len(src) {
+		t.Fatalf("got %d tracks, want %d", len(tracks), len(src))
+	}
+	for i, tr := range tracks {
+		if tr.ID != src[i].ID || tr.Codec() != src[i].Codec() {
+			t.Errorf("track %d = %d %q, want %d %q", i, tr.ID, tr.Codec(), src[i].ID, src[i].Codec())
+		}
+		if tr.Duration != 0 {
+			t.Errorf("track %d duration = %d, want 0", tr.ID, tr.Duration)
+		}
+		if len(tr.Samples) != 0 {
+			t.Errorf("track %d has %d samples in moov", tr.ID, len(tr.Samples))
+		}
+		if !bytes.Equal(tr.EdtsRaw(), src[i].EdtsRaw()) {
+			t.Errorf("track %d edts = % x, want % x", tr.ID, tr.EdtsRaw(), src[i].EdtsRaw())
+		}
+	}
+
+	if err := track.ParseFragments(bytes.NewReader(out), int64(len(out)), tracks); err != nil {
+		t.Fatal(err)
+	}
+	for i, tr := range tracks {
+		want := src[i].Samples
+		if len(tr.Samples) != len(want) {
+			t.Fatalf("track %d has %d samples, want %d", tr.ID, len(tr.Samples), len(want))
+		}
+		for j, s := range tr.Samples {
+			w := want[j]
+			data := out[s.Offset : s.Offset+int64(s.Size)]
+			if !bytes.Equal(data, file[w.Offset:w.Offset+int64(w.Size)]) {
+				t.Errorf("track %d sample %d data = % x", tr.ID, j, data)
+			}
+			s.Offset = w.Offset
+			if s != w {
+				t.Errorf("track %d sample %d = %+v, want %+v", tr.ID, j, s, w)
+			}
+		}
+	}
+}
+
+func TestWriteSegment(t *testing.T) {
+	file := testMovie()
+	src, _ := parseTracks(t, file)
+	f, err := fragment.New(src, bytes.NewReader(file), 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The second segment starts at the sync sample at two seconds.
+	if n := f.NumSegments(); n != 2 {
+		t.Fatalf("segments = %d, want 2", n)
+	}
+
+	var b bytes.Buffer
+	if err := f.WriteSegment(&b, 1); err != nil {
+		t.Fatal(err)
+	}
+	seg := b.Bytes()
+	r := mp4.NewReader(seg)
+	var types []mp4.BoxType
+	var moof []byte
+	var pos, moofOffset int64
+	for r.Next() {
+		if r.Type() == mp4.TypeMoof {
+			moof, moofOffset = r.RawBox(), pos
+		}
+		types = append(types, r.Type())
+		pos += int64(len(r.RawBox()))
+	}
+	want := []mp4.BoxType{mp4.TypeStyp, mp4.TypeMoof, mp4.TypeMdat}
+	if len(types) != len(want) || types[0] != want[0] || types[1] != want[1] || types[2] != want[2] {
+		t.Fatalf("boxes = %q, want %q", types, want)
+	}
+
+	tracks, _ := parseTracks(t, file)
+	for _, tr := range tracks {
+		tr.Samples = nil
+	}
+	if err := track.ParseFragment(moof, moofOffset, tracks); err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks[0].Samples) != 2 || tracks[0].Samples[0].DTS != 2000 || !tracks[0].Samples[0].IsSync {
+		t.Errorf("video samples = %+v, want 2 from DTS 2000", tracks[0].Samples)
+	}
+	if len(tracks[1].Samples) != 4 || tracks[1].Samples[0].DTS != 96000 {
+		t.Errorf("audio samples = %+v, want 4 from DTS 96000", tracks[1].Samples)
+	}
+
+	if err := f.WriteSegment(&b, 2); !errors.Is(err, fragment.ErrSegmentRange) {
+		t.Errorf("segment 2: err = %v, want ErrSegmentRange", err)
+	}
+}
+
+func TestWriteSegmentDataOffsetOverflow(t *testing.T) {
+	file := testMovie()
+	src, _ := parseTracks(t, file)
+	f, err := fragment.New(src, bytes.NewReader(file), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The two video samples of the first segment hold 2 GiB, so the audio
+	// run starts out of reach of the trun data offset. No sample data is
+	// read before the moof is written.
+	src[0].Samples[0].Size = 1 << 30
+	src[0].Samples[1].Size = 1 << 30
+	if err := f.WriteSegment(io.Discard, 0); !errors.Is(err, fragment.ErrSegmentSize) {
+		t.Errorf("err = %v, want ErrSegmentSize", err)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	file := testMovie()
+	src, _ := parseTracks(t, file)
+	if _, err := fragment.New(nil, bytes.NewReader(file), time.Second); !errors.Is(err, fragment.ErrNoTracks) {
+		t.Errorf("no tracks: err = %v, want ErrNoTracks", err)
+	}
+	if _, err := fragment.New(src, bytes.NewReader(file), 0); !errors.Is(err, fragment.ErrInvalidTarget) {
+		t.Errorf("zero target: err = %v, want ErrInvalidTarget", err)
+	}
+	m := mp4test.Movie{TimeScale: 1000, Tracks: []mp4test.Track{{
+		ID: 1, Handler: mp4test.Video, TimeScale: 1000, Width: 640, Height: 360,
+		Entry: func(w *mp4.Writer) {
+			mp4test.VisualEntry(mp4.TypeAvc1, 640, 360, nil)(w)
+			mp4test.VisualEntry(mp4.TypeAvc1, 1280, 720, nil)(w)
+		},
+		Samples: [][]byte{{0}}, Duration: 1000,
+	}}}
+	two := m.Build()
+	multi, _ := parseTracks(t, two)
+	if _, err := fragment.New(multi, bytes.NewReader(two), time.Second); !errors.Is(err, fragment.ErrSampleEntries) {
+		t.Errorf("two sample entries: err = %v, want ErrSampleEntries", err)
+	}
+	for _, tr := range src {
+		tr.Samples = nil
+	}
+	if _, err := fragment.New(src, bytes.NewReader(file), time.Second); !errors.Is(err, fragment.ErrNoSamples) {
+		t.Errorf("no samples: err = %v, want ErrNoSamples", err)
+	}
+}
@@ -0,0 +1,124 @@
+package mp4_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/tetsuo/mp4"
+)
+
+func TestTrackFragmentHeaderRoundTrip(t *testing.T) {
+	for _, want := range []mp4.TrackFragmentHeader{
+		{Flags: mp4.TfhdDefaultBaseIsMoof, TrackID: 1},
+		{
+			Flags: mp4.TfhdBaseDataOffsetPresent | mp4.TfhdSampleDescriptionIndexPresent | mp4.TfhdDefaultSampleDurationPresent |
+				mp4.TfhdDefaultSampleSizePresent | mp4.TfhdDefaultSampleFlagsPresent,
+			TrackID:                2,
+			BaseDataOffset:         1 << 33,
+			SampleDescriptionIndex: 1,
+			DefaultSampleDuration:  1024,
+			DefaultSampleSize:      300,
+			DefaultSampleFlags:     0x01010000,
+		},
+	} {
+		r := writeBox(t, func(w *mp4.Writer) { w.WriteTrackFragmentHeader(want) })
+		h, err := mp4.ReadTrackFragmentHeader(r.Data(), r.Flags())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h != want {
+			t.Errorf("got %+v, want %+v", h, want)
+		}
+	}
+}
+
+func TestTrackRunRoundTrip(t *testing.T) {
+	entries := []mp4.TrunEntry{{Duration: 100, Size: 10, CompositionTimeOffset: 200}, {Duration: 100, Size: 20, CompositionTimeOffset: -100}}
+	for _, want := range []mp4.TrackRun{
+		{
+			Version:          1,
+			Flags:            mp4.TrunDataOffsetPresent | mp4.TrunFirstSampleFlagsPresent | mp4.TrunSampleDurationPresent | mp4.TrunSampleSizePresent | mp4.TrunSampleCompositionTimeOffsetPresent,
+			DataOffset:       -8,
+			FirstSampleFlags: 0x02000000,
+			Entries:          entries,
+		},
+		{Flags: mp4.TrunSampleSizePresent, Entries: []mp4.TrunEntry{{Size: 10}, {Size: 20}}},
+	} {
+		r := writeBox(t, func(w *mp4.Writer) { w.WriteTrackRun(want) })
+		run, err := mp4.ReadTrackRun(r.Data(), r.Version(), r.Flags())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(run, want) {
+			t.Errorf("got %+v, want %+v", run, want)
+		}
+	}
+
+	// A sample count the data cannot hold.
+	if _, err := mp4.ReadTrackRun([]byte{0, 0, 1, 0, 0, 0, 0, 10}, 0, mp4.TrunSampleSizePresent); !errors.Is(err, mp4.ErrTruncated) {
+		t.Errorf("err = %v, want ErrTruncated", err)
+	}
+}
+
+func TestReadTrackFragments(t *testing.T) {
+	w := mp4.NewWriter(make([]byte, 4096))
+	w.StartBox(mp4.TypeMoof)
+	w.WriteMfhd(1)
+	// Track 1 takes its sizes from trex and is based at the moof.
+	w.StartBox(mp4.TypeTraf)
+	w.WriteTrackFragmentHeader(mp4.TrackFragmentHeader{Flags: mp4.TfhdDefaultBaseIsMoof, TrackID: 1})
+	w.WriteTfdt(9000)
+	w.WriteTrackRun(mp4.TrackRun{
+		Flags:            mp4.TrunDataOffsetPresent | mp4.TrunFirstSampleFlagsPresent,
+		DataOffset:       100,
+		FirstSampleFlags: 0x02000000,
+		Entries:          make([]mp4.TrunEntry, 2),
+	})
+	w.WriteTrackRun(mp4.TrackRun{Flags: mp4.TrunSampleSizePresent, Entries: []mp4.TrunEntry{{Size: 7}}})
+	w.EndBox()
+	// Track 2 has no trex defaults and follows the data of track 1.
+	w.StartBox(mp4.TypeTraf)
+	w.WriteTrackFragmentHeader(mp4.TrackFragmentHeader{
+		Flags:                 mp4.TfhdDefaultSampleDurationPresent | mp4.TfhdDefaultSampleSizePresent,
+		TrackID:               2,
+		DefaultSampleDuration: 1024,
+		DefaultSampleSize:     3,
+	})
+	w.WriteTrackRun(mp4.TrackRun{Flags: mp4.TrunSampleCompositionTimeOffsetPresent, Entries: []mp4.TrunEntry{{CompositionTimeOffset: -2}}})
+	w.EndBox()
+	w.EndBox()
+
+	frags, err := mp4.ReadTrackFragments(w.Bytes(), 1000, map[uint32]mp4.SampleDefaults{1: {Duration: 512, Size: 5, Flags: 0x01010000}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frags) != 2 {
+		t.Fatalf("got %d track fragments, want 2", len(frags))
+	}
+	if f := frags[0]; !f.HasDecodeTime || f.DecodeTime != 9000 || len(f.Runs) != 2 || f.Runs[0].Offset != 1100 || f.Runs[1].Offset != 1110 {
+		t.Errorf("track 1: decode time %d, runs %+v", f.DecodeTime, f.Runs)
+	}
+	want := []mp4.FragmentSample{
+		{Offset: 1100, Size: 5, Duration: 512, Flags: 0x02000000},
+		{Offset: 1105, Size: 5, Duration: 512, Flags: 0x01010000},
+		{Offset: 1110, Size: 7, Duration: 512, Flags: 0x01010000},
+	}
+	if !reflect.DeepEqual(frags[0].Samples, want) {
+		t.Errorf("track 1 samples = %+v, want %+v", frags[0].Samples, want)
+	}
+	want = []mp4.FragmentSample{{Offset: 1117, Size: 3, Duration: 1024, CompositionTimeOffset: -2}}
+	if f := frags[1]; f.HasDecodeTime || !reflect.DeepEqual(f.Samples, want) {
+		t.Errorf("track 2 samples = %+v, want %+v", f.Samples, want)
+	}
+
+	w.Reset()
+	w.StartBox(mp4.TypeMoof)
+	w.StartBox(mp4.TypeTraf)
+	w.WriteTrackRun(mp4.TrackRun{})
+	w.EndBox()
+	w.EndBox()
+	if _, err := mp4.ReadTrackFragments(w.Bytes(), 0, nil); !errors.Is(err, mp4.ErrInvalidFragment) {
+		t.Errorf("trun before tfhd: err = %v, want ErrInvalidFragment", err)
+	}
+}
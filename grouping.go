@@ -0,0 +1,351 @@
+package mp4
+
+// TrackGroup is one track group type box of a trgr box. Tracks whose trgr
+// boxes hold a group of the same type and ID belong to the same group.
+type TrackGroup struct {
+	Type     BoxType // e.g. TypeMsrc or TypeSter
+	ID       uint32  // track_group_id
+	LeftView bool    // ster only: the track carries the left view
+}
+
+// ReadTrgr parses trgr box data, the track group type boxes it contains.
+// Group types other than msrc and ster are returned with their ID.
+func ReadTrgr(data []byte) ([]TrackGroup, error) {
+	var groups []TrackGroup
+	r := NewReader(data)
+	for r.Next() {
+		d := r.Data()
+		if !r.IsFullBox() {
+			// Every track group type box is a full box.
+			if len(d) < 4 {
+				return groups, ErrTruncated
+			}
+			d = d[4:]
+		}
+		if len(d) < 4 {
+			return groups, ErrTruncated
+		}
+		g := TrackGroup{Type: r.Type(), ID: be.Uint32(d)}
+		if g.Type == TypeSter {
+			if len(d) < 8 {
+				return groups, ErrTruncated
+			}
+			g.LeftView = d[4]&0x80 != 0
+		}
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
+
+// WriteTrgr writes a complete trgr box. Nothing is written if groups is
+// empty.
+func (w *Writer) WriteTrgr(groups []TrackGroup) {
+	if len(groups) == 0 {
+		return
+	}
+	w.StartBox(TypeTrgr)
+	for _, g := range groups {
+		w.StartFullBox(g.Type, 0, 0)
+		w.putUint32(g.ID)
+		if g.Type == TypeSter {
+			if g.LeftView {
+				w.putUint32(0x80000000)
+			} else {
+				w.putUint32(0)
+			}
+		}
+		w.EndBox()
+	}
+	w.EndBox()
+}
+
+// TrackSelection holds a parsed tsel box. Tracks in the same alternate
+// group with the same non-zero SwitchGroup may be switched between during
+// playback; Attributes name what tells them apart, e.g. "lang" or "bwas".
+type TrackSelection struct {
+	SwitchGroup int32
+	Attributes  []BoxType
+}
+
+// ReadTsel parses tsel box data (after version+flags).
+func ReadTsel(data []byte) (TrackSelection, error) {
+	var s TrackSelection
+	if len(data) < 4 || len(data)%4 != 0 {
+		return s, ErrTruncated
+	}
+	s.SwitchGroup = int32(be.Uint32(data))
+	for i := 4; i < len(data); i += 4 {
+		s.Attributes = append(s.Attributes, BoxType(data[i:i+4]))
+	}
+	return s, nil
+}
+
+// WriteTsel writes a complete tsel box.
+func (w *Writer) WriteTsel(s TrackSelection) {
+	w.StartFullBox(TypeTsel, 0, 0)
+	w.putUint32(uint32(s.SwitchGroup))
+	for _, a := range s.Attributes {
+		w.putBytes(a[:])
+	}
+	w.EndBox()
+}
+
+// SchemeDASHRole is the kind scheme of DASH roles such as "main",
+// "caption" or "description" (ISO/IEC 23009-1).
+const SchemeDASHRole = "urn:mpeg:dash:role:2011"
+
+// Kind holds a parsed kind box: a role of the track, named by a value in a
+// scheme such as SchemeDASHRole. Value may be empty when the scheme alone
+// identifies the role.
+type Kind struct {
+	SchemeURI string
+	Value     string
+}
+
+// ReadKind parses kind box data (after version+flags). A missing
+// terminator on the value is tolerated.
+func ReadKind(data []byte) (Kind, error) {
+	var k Kind
+	var ptr int
+	var ok bool
+	if k.SchemeURI, ptr, ok = readCString(data, 0); !ok {
+		return k, ErrTruncated
+	}
+	if k.Value, _, ok = readCString(data, ptr); !ok {
+		k.Value = string(data[ptr:])
+	}
+	return k, nil
+}
+
+// WriteKind writes a complete kind box.
+func (w *Writer) WriteKind(k Kind) {
+	w.StartFullBox(TypeKind, 0, 0)
+	w.putBytes([]byte(k.SchemeURI))
+	w.putUint8(0)
+	w.putBytes([]byte(k.Value))
+	w.putUint8(0)
+	w.EndBox()
+}
+
+// Label holds a parsed labl box, a human-readable label for a track or,
+// if IsGroupLabel is set, for the track group or alternate group with
+// the given ID.
+type Label struct {
+	IsGroupLabel bool
+	ID           uint16
+	Language     string // BCP 47 tag
+	Text         string
+}
+
+// ReadLabl parses labl box data (after version+flags).
+func ReadLabl(data []byte) (Label, error) {
+	var l Label
+	if len(data) < 4 {
+		return l, ErrTruncated
+	}
+	l.IsGroupLabel = data[0]&0x80 != 0
+	l.ID = be.Uint16(data[2:4])
+	ptr := 4
+	var ok bool
+	if l.Language, ptr, ok = readCString(data, ptr); !ok {
+		return l, ErrTruncated
+	}
+	if l.Text, _, ok = readCString(data, ptr); !ok {
+		l.Text = string(data[ptr:])
+	}
+	return l, nil
+}
+
+// WriteLabl writes a complete labl box.
+func (w *Writer) WriteLabl(l Label) {
+	w.StartFullBox(TypeLabl, 0, 0)
+	if l.IsGroupLabel {
+		w.putUint16(0x8000)
+	} else {
+		w.putUint16(0)
+	}
+	w.putUint16(l.ID)
+	w.putBytes([]byte(l.Language))
+	w.putUint8(0)
+	w.putBytes([]byte(l.Text))
+	w.putUint8(0)
+	w.EndBox()
+}
+
+// SampleToGroupEntry maps a run of consecutive samples to a sample group
+// description entry.
+type SampleToGroupEntry struct {
+	SampleCount uint32
+
+	// GroupDescriptionIndex is the 1-based index of the entry in the sgpd
+	// box of the same grouping type, 0 for no group. In track fragments,
+	// indices above 0x10000 refer to the sgpd box of the fragment.
+	GroupDescriptionIndex uint32
+}
+
+// SampleToGroup holds a parsed sbgp box.
+type SampleToGroup struct {
+	GroupingType          [4]byte // e.g. GroupingSeig
+	GroupingTypeParameter uint32  // version 1 only
+	Entries               []SampleToGroupEntry
+}
+
+// ReadSbgp parses sbgp box data (after version+flags).
+func ReadSbgp(data []byte, version uint8) (SampleToGroup, error) {
+	var s SampleToGroup
+	if len(data) < 8 {
+		return s, ErrTruncated
+	}
+	s.GroupingType = [4]byte(data[0:4])
+	ptr := 4
+	if version == 1 {
+		if len(data) < 12 {
+			return s, ErrTruncated
+		}
+		s.GroupingTypeParameter = be.Uint32(data[4:8])
+		ptr = 8
+	}
+	count := int(be.Uint32(data[ptr:]))
+	ptr += 4
+	if count > (len(data)-ptr)/8 {
+		return s, ErrTruncated
+	}
+	s.Entries = make([]SampleToGroupEntry, count)
+	for i := range s.Entries {
+		s.Entries[i] = SampleToGroupEntry{
+			SampleCount:           be.Uint32(data[ptr:]),
+			GroupDescriptionIndex: be.Uint32(data[ptr+4:]),
+		}
+		ptr += 8
+	}
+	return s, nil
+}
+
+// GroupIndex returns the group description index of sample i (0-based),
+// 0 if the sample is in no group.
+func (s SampleToGroup) GroupIndex(i int) uint32 {
+	for _, e := range s.Entries {
+		if i < int(e.SampleCount) {
+			return e.GroupDescriptionIndex
+		}
+		i -= int(e.SampleCount)
+	}
+	return 0
+}
+
+// WriteSbgp writes a complete sbgp box, in version 1 if a grouping type
+// parameter is set.
+func (w *Writer) WriteSbgp(s SampleToGroup) {
+	if s.GroupingTypeParameter != 0 {
+		w.StartFullBox(TypeSbgp, 1, 0)
+		w.putBytes(s.GroupingType[:])
+		w.putUint32(s.GroupingTypeParameter)
+	} else {
+		w.StartFullBox(TypeSbgp, 0, 0)
+		w.putBytes(s.GroupingType[:])
+	}
+	w.putUint32(uint32(len(s.Entries)))
+	for _, e := range s.Entries {
+		w.putUint32(e.SampleCount)
+		w.putUint32(e.GroupDescriptionIndex)
+	}
+	w.EndBox()
+}
+
+// SampleGroupDescription holds a parsed sgpd box. Entries are left raw
+// since their layout depends on the grouping type.
+type SampleGroupDescription struct {
+	GroupingType [4]byte
+
+	// DefaultDescriptionIndex is the entry of samples not mapped by any
+	// sbgp box, 0 for none. Version 2 and later only.
+	DefaultDescriptionIndex uint32
+
+	Entries [][]byte
+}
+
+// ReadSgpd parses sgpd box data (after version+flags). Version 0 boxes do
+// not record entry sizes; their entries are assumed to be of equal size.
+func ReadSgpd(data []byte, version uint8) (SampleGroupDescription, error) {
+	var s SampleGroupDescription
+	if len(data) < 8 {
+		return s, ErrTruncated
+	}
+	s.GroupingType = [4]byte(data[0:4])
+	ptr := 4
+	var defaultLength uint32
+	if version >= 1 {
+		defaultLength = be.Uint32(data[ptr:])
+		ptr += 4
+	}
+	if version >= 2 {
+		if len(data) < ptr+4 {
+			return s, ErrTruncated
+		}
+		s.DefaultDescriptionIndex = be.Uint32(data[ptr:])
+		ptr += 4
+	}
+	if len(data) < ptr+4 {
+		return s, ErrTruncated
+	}
+	count := int(be.Uint32(data[ptr:]))
+	ptr += 4
+	if version == 0 && count > 0 {
+		if (len(data)-ptr)%count != 0 {
+			return s, ErrTruncated
+		}
+		defaultLength = uint32((len(data) - ptr) / count)
+	}
+	if count > len(data)-ptr {
+		return s, ErrTruncated
+	}
+	s.Entries = make([][]byte, 0, count)
+	for range count {
+		n := int(defaultLength)
+		if version >= 1 && n == 0 {
+			if len(data) < ptr+4 {
+				return s, ErrTruncated
+			}
+			n = int(be.Uint32(data[ptr:]))
+			ptr += 4
+		}
+		if n > len(data)-ptr {
+			return s, ErrTruncated
+		}
+		s.Entries = append(s.Entries, data[ptr:ptr+n])
+		ptr += n
+	}
+	return s, nil
+}
+
+// WriteSgpd writes a complete sgpd box, in version 2 if a default
+// description index is set and version 1 otherwise.
+func (w *Writer) WriteSgpd(s SampleGroupDescription) {
+	var length uint32 // default_length, 0 if entries differ in size
+	for i, e := range s.Entries {
+		if i == 0 {
+			length = uint32(len(e))
+		} else if uint32(len(e)) != length {
+			length = 0
+			break
+		}
+	}
+	if s.DefaultDescriptionIndex != 0 {
+		w.StartFullBox(TypeSgpd, 2, 0)
+	} else {
+		w.StartFullBox(TypeSgpd, 1, 0)
+	}
+	w.putBytes(s.GroupingType[:])
+	w.putUint32(length)
+	if s.DefaultDescriptionIndex != 0 {
+		w.putUint32(s.DefaultDescriptionIndex)
+	}
+	w.putUint32(uint32(len(s.Entries)))
+	for _, e := range s.Entries {
+		if length == 0 {
+			w.putUint32(uint32(len(e)))
+		}
+		w.putBytes(e)
+	}
+	w.EndBox()
+}
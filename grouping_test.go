@@ -0,0 +1,103 @@
+package mp4_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tetsuo/mp4"
+)
+
+func TestTrgrRoundTrip(t *testing.T) {
+	want := []mp4.TrackGroup{
+		{Type: mp4.TypeMsrc, ID: 7},
+		{Type: mp4.TypeSter, ID: 8, LeftView: true},
+		{Type: mp4.TypeSter, ID: 9},
+		{Type: mp4.BoxType{'x', 'g', 'r', 'p'}, ID: 10},
+	}
+	r := writeBox(t, func(w *mp4.Writer) {
+		w.WriteTrgr(want)
+		w.WriteTrgr(nil)
+	})
+	if r.Type() != mp4.TypeTrgr {
+		t.Fatalf("type = %v, want trgr", r.Type())
+	}
+	groups, err := mp4.ReadTrgr(r.Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(groups, want) {
+		t.Errorf("got %+v, want %+v", groups, want)
+	}
+	if r.Next() {
+		t.Error("trgr written for no groups")
+	}
+}
+
+func TestTselRoundTrip(t *testing.T) {
+	want := mp4.TrackSelection{SwitchGroup: -2, Attributes: []mp4.BoxType{{'l', 'a', 'n', 'g'}, {'b', 'w', 'a', 's'}}}
+	r := writeBox(t, func(w *mp4.Writer) { w.WriteTsel(want) })
+	s, err := mp4.ReadTsel(r.Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("got %+v, want %+v", s, want)
+	}
+	if _, err := mp4.ReadTsel([]byte{0, 0, 0, 1, 'l', 'a'}); err != mp4.ErrTruncated {
+		t.Errorf("partial attribute: err = %v, want %v", err, mp4.ErrTruncated)
+	}
+}
+
+func TestKindRoundTrip(t *testing.T) {
+	for _, want := range []mp4.Kind{
+		{SchemeURI: mp4.SchemeDASHRole, Value: "caption"},
+		{SchemeURI: "urn:example:kind"},
+	} {
+		r := writeBox(t, func(w *mp4.Writer) { w.WriteKind(want) })
+		k, err := mp4.ReadKind(r.Data())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if k != want {
+			t.Errorf("got %+v, want %+v", k, want)
+		}
+	}
+
+	// The value's terminator may be missing.
+	k, err := mp4.ReadKind([]byte("urn:x\x00main"))
+	if err != nil || k.Value != "main" {
+		t.Errorf("unterminated value: got %+v, %v", k, err)
+	}
+	if _, err := mp4.ReadKind([]byte("urn:x")); err != mp4.ErrTruncated {
+		t.Errorf("unterminated scheme: err = %v, want %v", err, mp4.ErrTruncated)
+	}
+}
+
+func TestLablRoundTrip(t *testing.T) {
+	for _, want := range []mp4.Label{
+		{ID: 2, Language: "en", Text: "Director's commentary"},
+		{IsGroupLabel: true, ID: 1, Language: "fr-CA", Text: "Audio"},
+	} {
+		r := writeBox(t, func(w *mp4.Writer) { w.WriteLabl(want) })
+		l, err := mp4.ReadLabl(r.Data())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if l != want {
+			t.Errorf("got %+v, want %+v", l, want)
+		}
+	}
+}
+
+func TestTkhdAlternateGroup(t *testing.T) {
+	for _, duration := range []uint64{1000, 1 << 33} {
+		r := writeBox(t, func(w *mp4.Writer) { w.WriteTkhdAlternateGroup(3, 1, duration, 0, 0, 2) })
+		if g := r.ReadTkhdAlternateGroup(); g != 2 {
+			t.Errorf("version %d: alternate group = %d, want 2", r.Version(), g)
+		}
+	}
+	r := writeBox(t, func(w *mp4.Writer) { w.WriteTkhd(3, 1, 1000, 0, 0) })
+	if g := r.ReadTkhdAlternateGroup(); g != 0 {
+		t.Errorf("alternate group = %d, want 0", g)
+	}
+}
@@ -0,0 +1,363 @@
+// Package heif reads HEIF still-image files such as HEIC photos: the items
+// declared in the top-level meta box, their properties, and their data.
+package heif
+
+import (
+	"errors"
+	"io"
+
+	"github.com/tetsuo/mp4"
+)
+
+var (
+	ErrMetaNotFound   = errors.New("heif: meta box not found")
+	ErrItemNotFound   = errors.New("heif: item not found")
+	ErrNoLocation     = errors.New("heif: item has no location")
+	ErrUnsupportedLoc = errors.New("heif: unsupported item location")
+	ErrInvalidBox     = errors.New("heif: box size out of range")
+)
+
+// Rotation is the value of an irot property: an anticlockwise rotation in
+// degrees, 0, 90, 180 or 270.
+type Rotation int
+
+// Mirror is the value of an imir property: mp4.MirrorVertical or
+// mp4.MirrorHorizontal.
+type Mirror uint8
+
+// Property is an item property from the ipco box. Value holds the parsed
+// property for the types this package knows:
+//
+//	hvcC  mp4.HEVCConfig
+//	av1C  mp4.AV1Config
+//	ispe  mp4.ImageSpatialExtents
+//	colr  mp4.ColourInformation
+//	pasp  mp4.PixelAspectRatio
+//	clap  mp4.CleanAperture
+//	irot  Rotation
+//	imir  Mirror
+//	pixi  mp4.PixelInformation
+//	auxC  mp4.AuxiliaryType
+//
+// and the raw box data (after version+flags for full boxes) otherwise.
+type Property struct {
+	Type      mp4.BoxType
+	Essential bool
+	Value     any
+}
+
+// Item is one item of a HEIF file.
+type Item struct {
+	mp4.ItemInfo
+	Properties []Property          // in association order
+	References []mp4.ItemReference // references from this item
+	Location   *mp4.ItemLocation   // nil if the item has no iloc entry
+}
+
+// Property returns the first property of the given type, or nil.
+func (it *Item) Property(typ mp4.BoxType) *Property {
+	for i := range it.Properties {
+		if it.Properties[i].Type == typ {
+			return &it.Properties[i]
+		}
+	}
+	return nil
+}
+
+// Size returns the image size from the ispe property, before rotation
+// and mirroring. ok is false if the item has none.
+func (it *Item) Size() (width, height uint32, ok bool) {
+	if p := it.Property(mp4.TypeIspe); p != nil {
+		if e, isExt := p.Value.(mp4.ImageSpatialExtents); isExt {
+			return e.Width, e.Height, true
+		}
+	}
+	return 0, 0, false
+}
+
+// Rotation returns the anticlockwise rotation in degrees from the irot
+// property, 0 if the item has none.
+func (it *Item) Rotation() int {
+	if p := it.Property(mp4.TypeIrot); p != nil {
+		if r, ok := p.Value.(Rotation); ok {
+			return int(r)
+		}
+	}
+	return 0
+}
+
+// Mirror returns the mirror axis from the imir property. ok is false if
+// the item is not mirrored.
+func (it *Item) Mirror() (axis uint8, ok bool) {
+	if p := it.Property(mp4.TypeImir); p != nil {
+		if m, isMirror := p.Value.(Mirror); isMirror {
+			return uint8(m), true
+		}
+	}
+	return 0, false
+}
+
+// ReferencedItems returns the IDs this item references with the given
+// type, e.g. 'dimg' for the tiles of a grid.
+func (it *Item) ReferencedItems(refType mp4.BoxType) []uint32 {
+	var ids []uint32
+	for _, ref := range it.References {
+		if ref.Type == refType {
+			ids = append(ids, ref.ToIDs...)
+		}
+	}
+	return ids
+}
+
+// File is a parsed HEIF file.
+type File struct {
+	Ftyp      mp4.FtypInfo // zero if the file has no ftyp box
+	PrimaryID uint32
+	Items     []Item
+
+	r    io.ReaderAt
+	size int64
+	idat []byte
+}
+
+// Open parses the top-level meta box of the size-byte file read from r.
+// Item data is read from r on demand by ItemData.
+func Open(r io.ReaderAt, size int64) (*File, error) {
+	f := &File{r: r, size: size}
+	sc := mp4.NewScanner(io.NewSectionReader(r, 0, size))
+	for sc.Next() {
+		e := sc.Entry()
+		if e.Type != mp4.TypeFtyp && e.Type != mp4.TypeMeta {
+			continue
+		}
+		// Box sizes come from the file; check them before allocating.
+		if e.Size < int64(e.HeaderSize) || e.Size > size-e.Offset {
+			return nil, ErrInvalidBox
+		}
+		if e.Type == mp4.TypeFtyp {
+			buf := make([]byte, e.DataSize())
+			if err := sc.ReadBody(buf); err != nil {
+				return nil, err
+			}
+			f.Ftyp = mp4.ReadFtyp(buf)
+			continue
+		}
+		buf := make([]byte, e.Size)
+		if err := sc.ReadBox(buf); err != nil {
+			return nil, err
+		}
+		if err := f.parseMeta(buf); err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return nil, ErrMetaNotFound
+}
+
+// parseMeta parses the complete meta box in buf.
+func (f *File) parseMeta(buf []byte) error {
+	mr := mp4.NewReader(buf)
+	if !mr.Next() {
+		return mp4.ErrTruncated
+	}
+	var (
+		infos []mp4.ItemInfo
+		locs  []mp4.ItemLocation
+		refs  []mp4.ItemReference
+		props []Property
+		assoc []mp4.ItemPropertyAssociation
+		err   error
+	)
+	mr.Enter()
+	for mr.Next() && err == nil {
+		switch mr.Type() {
+		case mp4.TypePitm:
+			f.PrimaryID, err = mp4.ReadPitm(mr.Data(), mr.Version())
+		case mp4.TypeIinf:
+			infos, err = mp4.ReadIinf(mr.Data(), mr.Version())
+		case mp4.TypeIloc:
+			locs, err = mp4.ReadIloc(mr.Data(), mr.Version())
+		case mp4.TypeIref:
+			refs, err = mp4.ReadIref(mr.Data(), mr.Version())
+		case mp4.TypeIdat:
+			f.idat = mr.Data()
+		case mp4.TypeIprp:
+			mr.Enter()
+			for mr.Next() && err == nil {
+				switch mr.Type() {
+				case mp4.TypeIpco:
+					props, err = readIpco(mr.Data())
+				case mp4.TypeIpma:
+					var a []mp4.ItemPropertyAssociation
+					a, err = mp4.ReadIpma(mr.Data(), mr.Version(), mr.Flags())
+					assoc = append(assoc, a...)
+				}
+			}
+			mr.Exit()
+		}
+	}
+	mr.Exit()
+	if err != nil {
+		return err
+	}
+
+	f.Items = make([]Item, len(infos))
+	for i, info := range infos {
+		it := &f.Items[i]
+		it.ItemInfo = info
+		for j := range locs {
+			if locs[j].ID == info.ID {
+				it.Location = &locs[j]
+				break
+			}
+		}
+		for _, ref := range refs {
+			if ref.FromID == info.ID {
+				it.References = append(it.References, ref)
+			}
+		}
+		for _, a := range assoc {
+			if a.ItemID != info.ID {
+				continue
+			}
+			for _, pa := range a.Associations {
+				// Index 0 means no property.
+				if pa.Index == 0 || int(pa.Index) > len(props) {
+					continue
+				}
+				p := props[pa.Index-1]
+				p.Essential = pa.Essential
+				it.Properties = append(it.Properties, p)
+			}
+		}
+	}
+	return nil
+}
+
+// readIpco parses the properties of ipco box data in order.
+func readIpco(data []byte) ([]Property, error) {
+	var props []Property
+	r := mp4.NewReader(data)
+	for r.Next() {
+		p := Property{Type: r.Type()}
+		var err error
+		switch r.Type() {
+		case mp4.TypeHvcC:
+			p.Value, err = mp4.ReadHEVCConfig(r.Data())
+		case mp4.TypeAv1C:
+			p.Value, err = mp4.ReadAV1Config(r.Data())
+		case mp4.TypeIspe:
+			p.Value, err = mp4.ReadIspe(r.Data())
+		case mp4.TypeColr:
+			p.Value, err = mp4.ReadColr(r.Data())
+		case mp4.TypePasp:
+			p.Value, err = mp4.ReadPasp(r.Data())
+		case mp4.TypeClap:
+			p.Value, err = mp4.ReadClap(r.Data())
+		case mp4.TypeIrot:
+			var deg int
+			deg, err = mp4.ReadIrot(r.Data())
+			p.Value = Rotation(deg)
+		case mp4.TypeImir:
+			var axis uint8
+			axis, err = mp4.ReadImir(r.Data())
+			p.Value = Mirror(axis)
+		case mp4.TypePixi:
+			p.Value, err = mp4.ReadPixi(r.Data())
+		case mp4.TypeAuxC:
+			p.Value, err = mp4.ReadAuxC(r.Data())
+		default:
+			p.Value = r.Data()
+		}
+		if err != nil {
+			return props, err
+		}
+		props = append(props, p)
+	}
+	return props, nil
+}
+
+// HasBrand reports whether brand is the major brand or one of the
+// compatible brands of the file.
+func (f *File) HasBrand(brand [4]byte) bool {
+	if f.Ftyp.MajorBrand == brand {
+		return true
+	}
+	for _, b := range f.Ftyp.Compatible {
+		if b == brand {
+			return true
+		}
+	}
+	return false
+}
+
+// Primary returns the primary item, or nil if the file has none.
+func (f *File) Primary() *Item {
+	return f.Item(f.PrimaryID)
+}
+
+// Item returns the item with the given ID, or nil.
+func (f *File) Item(id uint32) *Item {
+	for i := range f.Items {
+		if f.Items[i].ID == id {
+			return &f.Items[i]
+		}
+	}
+	return nil
+}
+
+// ItemData returns the data of the item with the given ID, the
+// concatenation of its extents. Items stored in the file or in the idat box
+// are supported; items in other files or constructed from other items are
+// not.
+func (f *File) ItemData(id uint32) ([]byte, error) {
+	it := f.Item(id)
+	if it == nil {
+		return nil, ErrItemNotFound
+	}
+	loc := it.Location
+	if loc == nil {
+		return nil, ErrNoLocation
+	}
+	if loc.DataReferenceIndex != 0 {
+		return nil, ErrUnsupportedLoc
+	}
+
+	var srcSize int64
+	switch loc.ConstructionMethod {
+	case mp4.ConstructionFileOffset:
+		srcSize = f.size
+	case mp4.ConstructionIdatOffset:
+		srcSize = int64(len(f.idat))
+	default:
+		return nil, ErrUnsupportedLoc
+	}
+
+	var out []byte
+	for _, e := range loc.Extents {
+		start := loc.BaseOffset + e.Offset
+		if start < loc.BaseOffset || start > uint64(srcSize) {
+			return nil, mp4.ErrTruncated
+		}
+		length := e.Length
+		if length == 0 {
+			length = uint64(srcSize) - start
+		}
+		if length > uint64(srcSize)-start {
+			return nil, mp4.ErrTruncated
+		}
+		if loc.ConstructionMethod == mp4.ConstructionIdatOffset {
+			out = append(out, f.idat[start:start+length]...)
+			continue
+		}
+		n := len(out)
+		out = append(out, make([]byte, length)...)
+		if m, err := f.r.ReadAt(out[n:], int64(start)); m < len(out[n:]) {
+			return nil, err
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,165 @@
+package heif_test
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/tetsuo/mp4"
+	"github.com/tetsuo/mp4/heif"
+)
+
+var (
+	hvc1 = mp4.BoxType{'h', 'v', 'c', '1'}
+	cdsc = mp4.BoxType{'c', 'd', 's', 'c'}
+)
+
+// testImage and testExif are the data of the image item in mdat and of
+// the Exif item in idat.
+var (
+	testImage = []byte("coded image data")
+	testExif  = []byte("\x00\x00\x00\x06Exif\x00\x00")
+)
+
+// buildFile returns a HEIF file with an image item whose data is at
+// offset, an Exif item in idat, and an XMP item without a location.
+func buildFile(offset uint64) []byte {
+	w := mp4.NewWriter(make([]byte, 4096))
+	w.WriteFtyp([4]byte{'h', 'e', 'i', 'c'}, 0, [][4]byte{{'m', 'i', 'f', '1'}, {'h', 'e', 'i', 'c'}})
+	w.StartFullBox(mp4.TypeMeta, 0, 0)
+	w.WriteHdlr([4]byte{'p', 'i', 'c', 't'}, "")
+	w.WritePitm(1)
+	w.WriteIloc([]mp4.ItemLocation{
+		{ID: 1, Extents: []mp4.ItemExtent{{Offset: offset, Length: 6}, {Offset: offset + 6, Length: uint64(len(testImage) - 6)}}},
+		{ID: 2, ConstructionMethod: mp4.ConstructionIdatOffset, Extents: []mp4.ItemExtent{{Offset: 0, Length: 0}}},
+	})
+	w.WriteIinf([]mp4.ItemInfo{
+		{ID: 1, Type: hvc1},
+		{ID: 2, Type: mp4.ItemTypeExif, Hidden: true},
+		{ID: 3, Type: mp4.ItemTypeMime, ContentType: "application/rdf+xml"},
+	})
+	w.WriteIref([]mp4.ItemReference{{Type: cdsc, FromID: 2, ToIDs: []uint32{1}}})
+	w.StartBox(mp4.TypeIprp)
+	w.StartBox(mp4.TypeIpco)
+	w.WriteIspe(mp4.ImageSpatialExtents{Width: 4032, Height: 3024})
+	w.WriteIrot(270)
+	w.WriteImir(mp4.MirrorHorizontal)
+	w.StartBox(mp4.BoxType{'x', 'p', 'r', 'p'})
+	w.Write([]byte{1, 2, 3})
+	w.EndBox()
+	w.EndBox()
+	w.WriteIpma([]mp4.ItemPropertyAssociation{{
+		ItemID: 1,
+		Associations: []mp4.PropertyAssociation{
+			{Index: 1}, {Index: 2, Essential: true}, {Index: 3, Essential: true}, {Index: 4},
+			{Index: 0}, {Index: 9}, // no property, and out of range
+		},
+	}})
+	w.EndBox()
+	w.StartBox(mp4.TypeIdat)
+	w.Write(testExif)
+	w.EndBox()
+	w.EndBox()
+	w.StartBox(mp4.TypeMdat)
+	w.Write(testImage)
+	w.EndBox()
+	return bytes.Clone(w.Bytes())
+}
+
+func open(t *testing.T, file []byte) *heif.File {
+	t.Helper()
+	f, err := heif.Open(bytes.NewReader(file), int64(len(file)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestOpen(t *testing.T) {
+	file := buildFile(0)
+	file = buildFile(uint64(len(file) - len(testImage)))
+	f := open(t, file)
+
+	if !f.HasBrand([4]byte{'m', 'i', 'f', '1'}) || f.HasBrand([4]byte{'a', 'v', 'i', 'f'}) {
+		t.Errorf("brands = %+v", f.Ftyp)
+	}
+	if len(f.Items) != 3 {
+		t.Fatalf("got %d items, want 3", len(f.Items))
+	}
+	it := f.Primary()
+	if it == nil || it.ID != 1 || it.Type != hvc1 {
+		t.Fatalf("primary item = %+v", it)
+	}
+	if w, h, ok := it.Size(); !ok || w != 4032 || h != 3024 {
+		t.Errorf("size = %dx%d, %v", w, h, ok)
+	}
+	if r := it.Rotation(); r != 270 {
+		t.Errorf("rotation = %d, want 270", r)
+	}
+	if axis, ok := it.Mirror(); !ok || axis != mp4.MirrorHorizontal {
+		t.Errorf("mirror = %d, %v", axis, ok)
+	}
+	var types []string
+	for _, p := range it.Properties {
+		types = append(types, p.Type.String())
+	}
+	if want := []string{"ispe", "irot", "imir", "xprp"}; !reflect.DeepEqual(types, want) {
+		t.Errorf("properties = %q, want %q", types, want)
+	}
+	if p := it.Property(mp4.TypeIrot); p == nil || !p.Essential {
+		t.Errorf("irot = %+v, want essential", p)
+	}
+	if p := it.Property(mp4.BoxType{'x', 'p', 'r', 'p'}); p == nil || !bytes.Equal(p.Value.([]byte), []byte{1, 2, 3}) {
+		t.Errorf("unknown property = %+v, want its raw data", p)
+	}
+
+	exif := f.Item(2)
+	if exif == nil || !exif.Hidden || !reflect.DeepEqual(exif.ReferencedItems(cdsc), []uint32{1}) {
+		t.Errorf("Exif item = %+v", exif)
+	}
+	if _, _, ok := exif.Size(); ok {
+		t.Error("Exif item has a size")
+	}
+
+	if data, err := f.ItemData(1); err != nil || !bytes.Equal(data, testImage) {
+		t.Errorf("image data = %q, %v", data, err)
+	}
+	if data, err := f.ItemData(2); err != nil || !bytes.Equal(data, testExif) {
+		t.Errorf("Exif data = %q, %v", data, err)
+	}
+	if _, err := f.ItemData(3); err != heif.ErrNoLocation {
+		t.Errorf("XMP item: err = %v, want %v", err, heif.ErrNoLocation)
+	}
+	if _, err := f.ItemData(4); err != heif.ErrItemNotFound {
+		t.Errorf("missing item: err = %v, want %v", err, heif.ErrItemNotFound)
+	}
+
+	// Extents past the end of the file are rejected.
+	f = open(t, buildFile(uint64(len(file))))
+	if _, err := f.ItemData(1); err != mp4.ErrTruncated {
+		t.Errorf("extent past the end: err = %v, want %v", err, mp4.ErrTruncated)
+	}
+
+	// So are offsets whose sum with the base offset wraps around.
+	f = open(t, file)
+	f.Item(1).Location.BaseOffset = math.MaxUint64
+	if _, err := f.ItemData(1); err != mp4.ErrTruncated {
+		t.Errorf("wrapping offset: err = %v, want %v", err, mp4.ErrTruncated)
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	w := mp4.NewWriter(make([]byte, 64))
+	w.WriteFtyp([4]byte{'h', 'e', 'i', 'c'}, 0, nil)
+	file := bytes.Clone(w.Bytes())
+	if _, err := heif.Open(bytes.NewReader(file), int64(len(file))); err != heif.ErrMetaNotFound {
+		t.Errorf("no meta: err = %v, want %v", err, heif.ErrMetaNotFound)
+	}
+
+	// A meta box claiming more bytes than the file has.
+	file = append(file, 0, 0, 0x10, 0, 'm', 'e', 't', 'a', 0, 0, 0, 0)
+	if _, err := heif.Open(bytes.NewReader(file), int64(len(file))); err != heif.ErrInvalidBox {
+		t.Errorf("oversized meta: err = %v, want %v", err, heif.ErrInvalidBox)
+	}
+}
@@ -0,0 +1,220 @@
+package mp4
+
+import "strconv"
+
+// HEVC NAL unit types carried in hvcC arrays.
+const (
+	HEVCNALVPS       = 32
+	HEVCNALSPS       = 33
+	HEVCNALPPS       = 34
+	HEVCNALPrefixSEI = 39
+	HEVCNALSuffixSEI = 40
+)
+
+// HEVCProfileTierLevel holds the general profile_tier_level fields shared by
+// hvcC, VPS and SPS.
+type HEVCProfileTierLevel struct {
+	ProfileSpace       uint8 // 0-3
+	Tier               bool  // true for High tier
+	ProfileIdc         uint8
+	CompatibilityFlags uint32
+	ConstraintFlags    uint64 // 48-bit constraint indicator flags
+	LevelIdc           uint8
+}
+
+// Codec returns the RFC 6381 suffix for hvc1/hev1 codec strings as defined in
+// ISO/IEC 14496-15 Annex E, e.g. "1.6.L93.B0".
+func (p *HEVCProfileTierLevel) Codec() string {
+	buf := make([]byte, 0, 32)
+	if p.ProfileSpace > 0 {
+		buf = append(buf, 'A'+p.ProfileSpace-1)
+	}
+	buf = strconv.AppendUint(buf, uint64(p.ProfileIdc), 10)
+	buf = append(buf, '.')
+
+	// Compatibility flags are written in reverse bit order.
+	var rev uint32
+	for i := range 32 {
+		if p.CompatibilityFlags&(1<<i) != 0 {
+			rev |= 1 << (31 - i)
+		}
+	}
+	buf = strconv.AppendUint(buf, uint64(rev), 16)
+
+	buf = append(buf, '.')
+	if p.Tier {
+		buf = append(buf, 'H')
+	} else {
+		buf = append(buf, 'L')
+	}
+	buf = strconv.AppendUint(buf, uint64(p.LevelIdc), 10)
+
+	// Constraint bytes, with trailing zero bytes omitted.
+	n := 6
+	for n > 0 && byte(p.ConstraintFlags>>(48-8*n)) == 0 {
+		n--
+	}
+	for i := range n {
+		b := byte(p.ConstraintFlags >> (40 - 8*i))
+		buf = append(buf, '.')
+		buf = strconv.AppendUint(buf, uint64(b), 16)
+	}
+	return upperHex(buf)
+}
+
+// upperHex returns s with lowercase hex letters converted to uppercase.
+func upperHex(s []byte) string {
+	for i, c := range s {
+		if c >= 'a' && c <= 'f' {
+			s[i] = c - 'a' + 'A'
+		}
+	}
+	return string(s)
+}
+
+// HEVCNALArray is one array of same-typed NAL units in hvcC.
+type HEVCNALArray struct {
+	Completeness bool
+	NALUnitType  uint8
+	NALUnits     [][]byte
+}
+
+// HEVCConfig holds a parsed HEVCDecoderConfigurationRecord (hvcC box data).
+type HEVCConfig struct {
+	ConfigurationVersion      uint8
+	PTL                       HEVCProfileTierLevel
+	MinSpatialSegmentationIdc uint16
+	ParallelismType           uint8
+	ChromaFormat              uint8 // chroma_format_idc
+	BitDepthLuma              uint8
+	BitDepthChroma            uint8
+	AvgFrameRate              uint16 // frames per 256 seconds, 0 if unspecified
+	ConstantFrameRate         uint8
+	NumTemporalLayers         uint8
+	TemporalIDNested          bool
+	NALLengthSize             uint8 // bytes per NAL unit length prefix: 1, 2 or 4
+	Arrays                    []HEVCNALArray
+}
+
+// hvcCHeaderSize is the fixed part of hvcC before numOfArrays.
+const hvcCHeaderSize = 22
+
+// ReadHEVCConfig parses hvcC box data. NAL unit slices point into data.
+func ReadHEVCConfig(data []byte) (HEVCConfig, error) {
+	var c HEVCConfig
+	if len(data) < hvcCHeaderSize+1 {
+		return c, ErrTruncated
+	}
+	c.ConfigurationVersion = data[0]
+	c.PTL = HEVCProfileTierLevel{
+		ProfileSpace:       data[1] >> 6,
+		Tier:               data[1]&0x20 != 0,
+		ProfileIdc:         data[1] & 0x1f,
+		CompatibilityFlags: be.Uint32(data[2:6]),
+		ConstraintFlags:    uint64(be.Uint16(data[6:8]))<<32 | uint64(be.Uint32(data[8:12])),
+		LevelIdc:           data[12],
+	}
+	c.MinSpatialSegmentationIdc = be.Uint16(data[13:15]) & 0x0fff
+	c.ParallelismType = data[15] & 0x03
+	c.ChromaFormat = data[16] & 0x03
+	c.BitDepthLuma = data[17]&0x07 + 8
+	c.BitDepthChroma = data[18]&0x07 + 8
+	c.AvgFrameRate = be.Uint16(data[19:21])
+	c.ConstantFrameRate = data[21] >> 6
+	c.NumTemporalLayers = data[21] >> 3 & 0x07
+	c.TemporalIDNested = data[21]&0x04 != 0
+	c.NALLengthSize = data[21]&0x03 + 1
+
+	numArrays := int(data[22])
+	ptr := hvcCHeaderSize + 1
+	for range numArrays {
+		if ptr+3 > len(data) {
+			return c, ErrTruncated
+		}
+		a := HEVCNALArray{
+			Completeness: data[ptr]&0x80 != 0,
+			NALUnitType:  data[ptr] & 0x3f,
+		}
+		numNalus := int(be.Uint16(data[ptr+1:]))
+		ptr += 3
+		for range numNalus {
+			if ptr+2 > len(data) {
+				return c, ErrTruncated
+			}
+			n := int(be.Uint16(data[ptr:]))
+			ptr += 2
+			if ptr+n > len(data) {
+				return c, ErrTruncated
+			}
+			a.NALUnits = append(a.NALUnits, data[ptr:ptr+n])
+			ptr += n
+		}
+		c.Arrays = append(c.Arrays, a)
+	}
+	return c, nil
+}
+
+// NALUnits returns the NAL units of the given type from all arrays.
+func (c *HEVCConfig) NALUnits(nalType uint8) [][]byte {
+	var out [][]byte
+	for _, a := range c.Arrays {
+		if a.NALUnitType == nalType {
+			out = append(out, a.NALUnits...)
+		}
+	}
+	return out
+}
+
+// Codec returns the codec string suffix, e.g. "1.6.L93.B0".
+func (c *HEVCConfig) Codec() string { return c.PTL.Codec() }
+
+// WriteHvcC writes a complete hvcC box.
+func (w *Writer) WriteHvcC(c HEVCConfig) {
+	w.StartBox(TypeHvcC)
+	version := c.ConfigurationVersion
+	if version == 0 {
+		version = 1
+	}
+	lengthSize := c.NALLengthSize
+	if lengthSize == 0 {
+		lengthSize = 4
+	}
+	bitDepthLuma := max(c.BitDepthLuma, 8)
+	bitDepthChroma := max(c.BitDepthChroma, 8)
+
+	w.putUint8(version)
+	b := c.PTL.ProfileSpace<<6 | c.PTL.ProfileIdc&0x1f
+	if c.PTL.Tier {
+		b |= 0x20
+	}
+	w.putUint8(b)
+	w.putUint32(c.PTL.CompatibilityFlags)
+	w.putUint16(uint16(c.PTL.ConstraintFlags >> 32))
+	w.putUint32(uint32(c.PTL.ConstraintFlags))
+	w.putUint8(c.PTL.LevelIdc)
+	w.putUint16(0xf000 | c.MinSpatialSegmentationIdc&0x0fff)
+	w.putUint8(0xfc | c.ParallelismType&0x03)
+	w.putUint8(0xfc | c.ChromaFormat&0x03)
+	w.putUint8(0xf8 | (bitDepthLuma-8)&0x07)
+	w.putUint8(0xf8 | (bitDepthChroma-8)&0x07)
+	w.putUint16(c.AvgFrameRate)
+	b = c.ConstantFrameRate<<6 | (c.NumTemporalLayers&0x07)<<3 | (lengthSize-1)&0x03
+	if c.TemporalIDNested {
+		b |= 0x04
+	}
+	w.putUint8(b)
+	w.putUint8(uint8(len(c.Arrays)))
+	for _, a := range c.Arrays {
+		b = a.NALUnitType & 0x3f
+		if a.Completeness {
+			b |= 0x80
+		}
+		w.putUint8(b)
+		w.putUint16(uint16(len(a.NALUnits)))
+		for _, n := range a.NALUnits {
+			w.putUint16(uint16(len(n)))
+			w.putBytes(n)
+		}
+	}
+	w.EndBox()
+}
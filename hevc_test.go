@@ -0,0 +1,117 @@
+package mp4_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tetsuo/mp4"
+)
+
+// packBits packs a bit string, spaces ignored, padding the last byte with
+// zeros.
+func packBits(bits string) []byte {
+	bits = strings.ReplaceAll(bits, " ", "")
+	b := make([]byte, (len(bits)+7)/8)
+	for i, c := range bits {
+		if c == '1' {
+			b[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return b
+}
+
+// nalUnit packs a NAL unit header and a bit string of its payload, spaces
+// ignored, adding emulation prevention bytes.
+func nalUnit(header []byte, bits string) []byte {
+	nal := append([]byte(nil), header...)
+	zeros := 0
+	for _, c := range packBits(bits) {
+		if zeros >= 2 && c <= 3 {
+			nal = append(nal, 3)
+			zeros = 0
+		}
+		if c == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		nal = append(nal, c)
+	}
+	return nal
+}
+
+// testHEVCSPS is a Main profile 1080p SPS with PQ transfer and 59.94 Hz
+// timing in its VUI.
+var testHEVCSPS = nalUnit([]byte{0x42, 0x01},
+	"0000 000 1"+ // sps_video_parameter_set_id, sps_max_sub_layers_minus1, temporal_id_nesting
+		"00 0 00001 01100000000000000000000000000000 1001"+ // Main profile
+		"00000000000000000000000000000000000000000000 01111011"+ // level 4.1
+		"1 010 000000000011110000001 000000000010001000001"+ // sps_id, 4:2:0, 1920x1088
+		"1 1 1 1 00101"+ // conformance window cropping 8 rows at the bottom
+		"1 1 00101 1 1 1 1"+ // bit depths, log2_max_pic_order_cnt_lsb 8, ordering info
+		"1 011 1 011 1 1 0"+ // 8x8 to 32x32 coding blocks, transform blocks, no scaling list
+		"1 1 0"+ // amp, sample_adaptive_offset, no pcm
+		"1 0 1 1"+ // no short-term sets, no long-term pictures, temporal mvp, strong intra smoothing
+		"1 0 0 1 101 0 1 00001001 00010000 00001001 0 000 0"+ // vui: BT.2020 primaries, PQ transfer
+		"1 00000000000000000000001111101001 00000000000000001110101001100000"+ // 1001/60000 timing
+		"0 0 0 0"+
+		"1")
+
+func TestHvcCRoundTrip(t *testing.T) {
+	c := mp4.HEVCConfig{
+		ConfigurationVersion: 1,
+		PTL: mp4.HEVCProfileTierLevel{
+			ProfileIdc:         1,
+			CompatibilityFlags: 0x60000000,
+			ConstraintFlags:    0x900000000000,
+			LevelIdc:           123,
+		},
+		MinSpatialSegmentationIdc: 0,
+		ChromaFormat:              1,
+		BitDepthLuma:              8,
+		BitDepthChroma:            8,
+		NumTemporalLayers:         1,
+		TemporalIDNested:          true,
+		NALLengthSize:             4,
+		Arrays: []mp4.HEVCNALArray{
+			{Completeness: true, NALUnitType: mp4.HEVCNALSPS, NALUnits: [][]byte{testHEVCSPS}},
+		},
+	}
+	r := writeBox(t, func(w *mp4.Writer) { w.WriteHvcC(c) })
+	if r.Type() != mp4.TypeHvcC {
+		t.Fatalf("type = %v, want hvcC", r.Type())
+	}
+	got, err := mp4.ReadHEVCConfig(r.Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, c) {
+		t.Errorf("got %+v, want %+v", got, c)
+	}
+	if s := got.Codec(); s != "1.6.L123.90" {
+		t.Errorf("codec = %q, want 1.6.L123.90", s)
+	}
+}
+
+func TestReadHEVCSPS(t *testing.T) {
+	s, err := mp4.ReadHEVCSPS(testHEVCSPS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.CodedWidth != 1920 || s.CodedHeight != 1088 {
+		t.Errorf("coded size = %dx%d, want 1920x1088", s.CodedWidth, s.CodedHeight)
+	}
+	if s.Width() != 1920 || s.Height() != 1080 {
+		t.Errorf("size = %dx%d, want 1920x1080", s.Width(), s.Height())
+	}
+	if s.PTL.ProfileIdc != 1 || s.PTL.LevelIdc != 123 {
+		t.Errorf("profile %d level %d, want 1 and 123", s.PTL.ProfileIdc, s.PTL.LevelIdc)
+	}
+	if r := mp4.VideoRange(s.VUI.TransferCharacteristics); r != "PQ" {
+		t.Errorf("video range = %q, want PQ", r)
+	}
+	if f := s.FrameRate(); f < 59.94 || f > 59.95 {
+		t.Errorf("frame rate = %v, want 59.94", f)
+	}
+}
@@ -0,0 +1,345 @@
+package mp4
+
+// Transfer characteristics code points (ISO/IEC 23091-2) that signal HDR.
+const (
+	TransferPQ  = 16 // SMPTE ST 2084, used by HDR10 and Dolby Vision
+	TransferHLG = 18 // ARIB STD-B67 hybrid log-gamma
+)
+
+// VideoRange classifies a transfer characteristics code point as "PQ",
+// "HLG" or "SDR", matching the HLS VIDEO-RANGE attribute values.
+func VideoRange(transfer uint8) string {
+	switch transfer {
+	case TransferPQ:
+		return "PQ"
+	case TransferHLG:
+		return "HLG"
+	}
+	return "SDR"
+}
+
+// HEVCVPS holds the leading fields of an H.265 video parameter set.
+type HEVCVPS struct {
+	ID                uint8
+	MaxLayers         uint8
+	MaxSubLayers      uint8
+	TemporalIDNesting bool
+	PTL               HEVCProfileTierLevel
+
+	TimingInfo     bool // timing fields below are present
+	NumUnitsInTick uint32
+	TimeScale      uint32
+}
+
+// HEVCSPS holds the fields of an H.265 sequence parameter set needed to
+// describe the picture format.
+type HEVCSPS struct {
+	VPSID             uint8
+	MaxSubLayers      uint8
+	TemporalIDNesting bool
+	PTL               HEVCProfileTierLevel
+	ID                uint32
+
+	ChromaFormat       uint8 // chroma_format_idc
+	SeparateColorPlane bool
+	BitDepthLuma       uint8
+	BitDepthChroma     uint8
+
+	// Decoded picture size in luma samples before the conformance window.
+	CodedWidth  uint32
+	CodedHeight uint32
+
+	// Conformance window offsets in luma samples.
+	ConfWinLeft   uint32
+	ConfWinRight  uint32
+	ConfWinTop    uint32
+	ConfWinBottom uint32
+
+	Log2MaxPicOrderCntLsb uint8
+
+	VUIPresent bool
+	VUI        VUIInfo
+
+	// Fields the slice segment header syntax depends on.
+	ctbLog2Size    uint8
+	sao            bool
+	stRpsDeltaPocs []int // NumDeltaPocs of each st_ref_pic_set
+	stRpsUsed      []int // pictures each st_ref_pic_set uses for the current one
+	longTermRefs   bool
+	ltUsed         []bool // used_by_curr_pic_lt_sps_flag
+	temporalMVP    bool
+}
+
+// Width returns the picture width inside the conformance window.
+func (s *HEVCSPS) Width() uint32 { return s.CodedWidth - s.ConfWinLeft - s.ConfWinRight }
+
+// Height returns the picture height inside the conformance window.
+func (s *HEVCSPS) Height() uint32 { return s.CodedHeight - s.ConfWinTop - s.ConfWinBottom }
+
+// FrameRate returns the frame rate from VUI timing info, or 0 if absent.
+func (s *HEVCSPS) FrameRate() float64 {
+	if !s.VUI.TimingInfo || s.VUI.NumUnitsInTick == 0 {
+		return 0
+	}
+	return float64(s.VUI.TimeScale) / float64(s.VUI.NumUnitsInTick)
+}
+
+// readHEVCPTL reads profile_tier_level(1, maxSubLayersMinus1), keeping the
+// general fields and skipping sub-layer ones.
+func readHEVCPTL(br *BitReader, maxSubLayersMinus1 int) HEVCProfileTierLevel {
+	var p HEVCProfileTierLevel
+	p.ProfileSpace = uint8(br.ReadBits(2))
+	p.Tier = br.ReadFlag()
+	p.ProfileIdc = uint8(br.ReadBits(5))
+	p.CompatibilityFlags = br.ReadBits(32)
+	p.ConstraintFlags = br.ReadBits64(48)
+	p.LevelIdc = uint8(br.ReadBits(8))
+
+	var profilePresent, levelPresent [8]bool
+	for i := range maxSubLayersMinus1 {
+		profilePresent[i] = br.ReadFlag()
+		levelPresent[i] = br.ReadFlag()
+	}
+	if maxSubLayersMinus1 > 0 {
+		br.Skip(2 * (8 - maxSubLayersMinus1)) // reserved_zero_2bits
+	}
+	for i := range maxSubLayersMinus1 {
+		if profilePresent[i] {
+			br.Skip(88)
+		}
+		if levelPresent[i] {
+			br.Skip(8)
+		}
+	}
+	return p
+}
+
+// ReadHEVCVPS parses an H.265 VPS NAL unit, including its two-byte NAL
+// header, up to the VPS timing info.
+func ReadHEVCVPS(nal []byte) (HEVCVPS, error) {
+	var v HEVCVPS
+	if len(nal) < 4 {
+		return v, ErrTruncated
+	}
+	rbsp := UnescapeRBSP(make([]byte, 0, len(nal)), nal[2:])
+	br := NewBitReader(rbsp)
+
+	v.ID = uint8(br.ReadBits(4))
+	br.Skip(2) // vps_base_layer_internal_flag, vps_base_layer_available_flag
+	v.MaxLayers = uint8(br.ReadBits(6)) + 1
+	maxSubLayersMinus1 := int(br.ReadBits(3))
+	v.MaxSubLayers = uint8(maxSubLayersMinus1) + 1
+	v.TemporalIDNesting = br.ReadFlag()
+	br.Skip(16) // vps_reserved_0xffff_16bits
+	if maxSubLayersMinus1 > 6 {
+		return v, ErrInvalidParameterSet
+	}
+	v.PTL = readHEVCPTL(&br, maxSubLayersMinus1)
+
+	first := maxSubLayersMinus1
+	if br.ReadFlag() { // vps_sub_layer_ordering_info_present_flag
+		first = 0
+	}
+	for i := first; i <= maxSubLayersMinus1; i++ {
+		br.ReadUE() // vps_max_dec_pic_buffering_minus1
+		br.ReadUE() // vps_max_num_reorder_pics
+		br.ReadUE() // vps_max_latency_increase_plus1
+	}
+	maxLayerID := int(br.ReadBits(6))
+	numLayerSets := int(br.ReadUE()) + 1
+	if numLayerSets > 1024 {
+		return v, ErrInvalidParameterSet
+	}
+	br.Skip((numLayerSets - 1) * (maxLayerID + 1)) // layer_id_included_flag
+	if err := br.Err(); err != nil {
+		return v, err
+	}
+	if br.ReadFlag() { // vps_timing_info_present_flag
+		v.NumUnitsInTick = br.ReadBits(32)
+		v.TimeScale = br.ReadBits(32)
+		v.TimingInfo = br.Err() == nil
+	}
+	return v, nil
+}
+
+// ReadHEVCSPS parses an H.265 SPS NAL unit, including its two-byte NAL
+// header, as stored in hvcC. Parsing stops after the VUI timing info.
+func ReadHEVCSPS(nal []byte) (HEVCSPS, error) {
+	var s HEVCSPS
+	if len(nal) < 4 {
+		return s, ErrTruncated
+	}
+	rbsp := UnescapeRBSP(make([]byte, 0, len(nal)), nal[2:])
+	br := NewBitReader(rbsp)
+
+	s.VPSID = uint8(br.ReadBits(4))
+	maxSubLayersMinus1 := int(br.ReadBits(3))
+	s.MaxSubLayers = uint8(maxSubLayersMinus1) + 1
+	s.TemporalIDNesting = br.ReadFlag()
+	if maxSubLayersMinus1 > 6 {
+		return s, ErrInvalidParameterSet
+	}
+	s.PTL = readHEVCPTL(&br, maxSubLayersMinus1)
+	s.ID = br.ReadUE()
+
+	s.ChromaFormat = uint8(br.ReadUE())
+	if s.ChromaFormat == 3 {
+		s.SeparateColorPlane = br.ReadFlag()
+	}
+	s.CodedWidth = br.ReadUE()
+	s.CodedHeight = br.ReadUE()
+	if br.ReadFlag() { // conformance_window_flag
+		subWidth, subHeight := uint32(1), uint32(1)
+		if !s.SeparateColorPlane {
+			if s.ChromaFormat == 1 || s.ChromaFormat == 2 {
+				subWidth = 2
+			}
+			if s.ChromaFormat == 1 {
+				subHeight = 2
+			}
+		}
+		s.ConfWinLeft = br.ReadUE() * subWidth
+		s.ConfWinRight = br.ReadUE() * subWidth
+		s.ConfWinTop = br.ReadUE() * subHeight
+		s.ConfWinBottom = br.ReadUE() * subHeight
+		if s.ConfWinLeft+s.ConfWinRight >= s.CodedWidth || s.ConfWinTop+s.ConfWinBottom >= s.CodedHeight {
+			return s, ErrInvalidParameterSet
+		}
+	}
+	s.BitDepthLuma = uint8(br.ReadUE()) + 8
+	s.BitDepthChroma = uint8(br.ReadUE()) + 8
+	s.Log2MaxPicOrderCntLsb = uint8(br.ReadUE()) + 4
+
+	first := maxSubLayersMinus1
+	if br.ReadFlag() { // sps_sub_layer_ordering_info_present_flag
+		first = 0
+	}
+	for i := first; i <= maxSubLayersMinus1; i++ {
+		br.ReadUE() // sps_max_dec_pic_buffering_minus1
+		br.ReadUE() // sps_max_num_reorder_pics
+		br.ReadUE() // sps_max_latency_increase_plus1
+	}
+
+	minCbLog2Size := br.ReadUE() + 3
+	s.ctbLog2Size = uint8(minCbLog2Size + br.ReadUE())
+	br.ReadUE()        // log2_min_luma_transform_block_size_minus2
+	br.ReadUE()        // log2_diff_max_min_luma_transform_block_size
+	br.ReadUE()        // max_transform_hierarchy_depth_inter
+	br.ReadUE()        // max_transform_hierarchy_depth_intra
+	if br.ReadFlag() { // scaling_list_enabled_flag
+		if br.ReadFlag() { // sps_scaling_list_data_present_flag
+			skipHEVCScalingListData(&br)
+		}
+	}
+	br.Skip(1) // amp_enabled_flag
+	s.sao = br.ReadFlag()
+	if br.ReadFlag() { // pcm_enabled_flag
+		br.Skip(8)  // pcm_sample_bit_depth_luma/chroma_minus1
+		br.ReadUE() // log2_min_pcm_luma_coding_block_size_minus3
+		br.ReadUE() // log2_diff_max_min_pcm_luma_coding_block_size
+		br.Skip(1)  // pcm_loop_filter_disabled_flag
+	}
+
+	numStRps := int(br.ReadUE())
+	if numStRps > 64 {
+		return s, ErrInvalidParameterSet
+	}
+	s.stRpsDeltaPocs = make([]int, numStRps)
+	s.stRpsUsed = make([]int, numStRps)
+	for i := range numStRps {
+		s.stRpsDeltaPocs[i], s.stRpsUsed[i] = skipStRefPicSet(&br, i, numStRps, s.stRpsDeltaPocs[:i])
+		if br.Err() != nil {
+			return s, br.Err()
+		}
+	}
+	s.longTermRefs = br.ReadFlag()
+	if s.longTermRefs {
+		n := br.ReadUE()
+		if n > 32 {
+			return s, ErrInvalidParameterSet
+		}
+		s.ltUsed = make([]bool, n)
+		for i := range s.ltUsed {
+			br.Skip(int(s.Log2MaxPicOrderCntLsb)) // lt_ref_pic_poc_lsb_sps
+			s.ltUsed[i] = br.ReadFlag()
+		}
+	}
+	s.temporalMVP = br.ReadFlag()
+	br.Skip(1) // strong_intra_smoothing_enabled_flag
+
+	if err := br.Err(); err != nil {
+		return s, err
+	}
+
+	s.VUIPresent = br.ReadFlag()
+	if s.VUIPresent {
+		// Truncated VUI is tolerated; fields past the end stay zero.
+		readVUI(&br, &s.VUI, false)
+	}
+	return s, nil
+}
+
+// skipHEVCScalingListData skips a scaling_list_data() syntax structure.
+func skipHEVCScalingListData(br *BitReader) {
+	for sizeID := range 4 {
+		step := 1
+		if sizeID == 3 {
+			step = 3
+		}
+		for matrixID := 0; matrixID < 6; matrixID += step {
+			if !br.ReadFlag() { // scaling_list_pred_mode_flag
+				br.ReadUE() // scaling_list_pred_matrix_id_delta
+				continue
+			}
+			coefNum := min(64, 1<<(4+sizeID<<1))
+			if sizeID > 1 {
+				br.ReadSE() // scaling_list_dc_coef_minus8
+			}
+			for range coefNum {
+				br.ReadSE() // scaling_list_delta_coef
+			}
+		}
+	}
+}
+
+// skipStRefPicSet skips st_ref_pic_set(idx) of an SPS with numSets sets,
+// or of a slice header if idx is numSets. It returns the NumDeltaPocs of
+// the set, which later sets predicted from it depend on, and the number
+// of its pictures used by the current picture. numDeltaPocs holds the
+// NumDeltaPocs of the sets before idx.
+func skipStRefPicSet(br *BitReader, idx, numSets int, numDeltaPocs []int) (n, used int) {
+	if idx != 0 && br.ReadFlag() { // inter_ref_pic_set_prediction_flag
+		ref := idx - 1
+		if idx == numSets {
+			ref = idx - int(br.ReadUE()) - 1 // delta_idx_minus1
+			if ref < 0 {
+				br.err = ErrInvalidParameterSet
+				return 0, 0
+			}
+		}
+		br.Skip(1)  // delta_rps_sign
+		br.ReadUE() // abs_delta_rps_minus1
+		for range numDeltaPocs[ref] + 1 {
+			if br.ReadFlag() { // used_by_curr_pic_flag
+				n++
+				used++
+			} else if br.ReadFlag() { // use_delta_flag
+				n++
+			}
+		}
+		return n, used
+	}
+	neg := int(br.ReadUE())
+	pos := int(br.ReadUE())
+	if neg > 16 || pos > 16 {
+		br.err = ErrInvalidParameterSet
+		return 0, 0
+	}
+	for range neg + pos {
+		br.ReadUE()        // delta_poc_s0/s1_minus1
+		if br.ReadFlag() { // used_by_curr_pic_s0/s1_flag
+			used++
+		}
+	}
+	return neg + pos, used
+}
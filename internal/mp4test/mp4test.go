@@ -0,0 +1,196 @@
+// Package mp4test builds small progressive MP4 files for tests.
+package mp4test
+
+import (
+	"github.com/tetsuo/mp4"
+)
+
+// Handler types.
+var (
+	Video    = [4]byte{'v', 'i', 'd', 'e'}
+	Audio    = [4]byte{'s', 'o', 'u', 'n'}
+	Text     = [4]byte{'t', 'e', 'x', 't'}
+	Subtitle = [4]byte{'s', 'u', 'b', 't'}
+)
+
+// Track describes one track of a test movie.
+type Track struct {
+	ID        uint32
+	Handler   [4]byte
+	TimeScale uint32
+	Width     uint16 // tkhd size of video tracks
+	Height    uint16
+
+	AlternateGroup int16 // tkhd alternate group, 0 for none
+
+	// Entry writes the sample entry box of the stsd box.
+	Entry func(w *mp4.Writer)
+
+	Samples  [][]byte
+	Duration uint32   // of every sample
+	Sync     []uint32 // stss sample numbers, nil if every sample is sync
+	CTTS     []mp4.CttsEntry
+	Edits    []mp4.ElstEntry
+
+	// Extra writes additional trak children such as tref or udta; may be
+	// nil.
+	Extra func(w *mp4.Writer)
+}
+
+// Movie describes a test movie.
+type Movie struct {
+	TimeScale uint32
+	Tracks    []Track
+
+	// Extra writes additional moov children such as udta; may be nil.
+	Extra func(w *mp4.Writer)
+}
+
+// Build returns the movie as a progressive file: an ftyp box, the moov box
+// and an mdat box holding the samples of each track in one chunk.
+func (m *Movie) Build() []byte {
+	size := 1 << 16
+	for _, t := range m.Tracks {
+		for _, s := range t.Samples {
+			size += len(s)
+		}
+	}
+	w := mp4.NewWriter(make([]byte, size))
+	w.WriteFtyp([4]byte{'i', 's', 'o', 'm'}, 0, [][4]byte{{'i', 's', 'o', 'm'}, {'m', 'p', '4', '1'}})
+
+	// The moov box is written twice: chunk offsets are known once its
+	// size is.
+	m.writeMoov(&w, 0)
+	mdat := uint32(w.Len())
+	w.Reset()
+	w.WriteFtyp([4]byte{'i', 's', 'o', 'm'}, 0, [][4]byte{{'i', 's', 'o', 'm'}, {'m', 'p', '4', '1'}})
+	m.writeMoov(&w, mdat+8)
+
+	w.StartBox(mp4.TypeMdat)
+	for _, t := range m.Tracks {
+		for _, s := range t.Samples {
+			w.Write(s)
+		}
+	}
+	w.EndBox()
+	return append([]byte(nil), w.Bytes()...)
+}
+
+func (m *Movie) writeMoov(w *mp4.Writer, offset uint32) {
+	var movieDuration uint64
+	var nextID uint32
+	for _, t := range m.Tracks {
+		d := uint64(len(t.Samples)) * uint64(t.Duration) * uint64(m.TimeScale) / uint64(t.TimeScale)
+		movieDuration = max(movieDuration, d)
+		nextID = max(nextID, t.ID)
+	}
+
+	w.StartBox(mp4.TypeMoov)
+	w.WriteMvhd(m.TimeScale, movieDuration, nextID+1)
+	for _, t := range m.Tracks {
+		writeTrak(w, &t, m.TimeScale, offset)
+		for _, s := range t.Samples {
+			offset += uint32(len(s))
+		}
+	}
+	if m.Extra != nil {
+		m.Extra(w)
+	}
+	w.EndBox()
+}
+
+func writeTrak(w *mp4.Writer, t *Track, movieTimeScale, offset uint32) {
+	n := uint32(len(t.Samples))
+	duration := uint64(n) * uint64(t.Duration)
+
+	w.StartBox(mp4.TypeTrak)
+	w.WriteTkhdAlternateGroup(0x03, t.ID, duration*uint64(movieTimeScale)/uint64(t.TimeScale),
+		uint32(t.Width)<<16, uint32(t.Height)<<16, t.AlternateGroup)
+	if t.Edits != nil {
+		w.StartBox(mp4.TypeEdts)
+		w.WriteElst(t.Edits)
+		w.EndBox()
+	}
+	if t.Extra != nil {
+		t.Extra(w)
+	}
+
+	w.StartBox(mp4.TypeMdia)
+	w.WriteMdhd(t.TimeScale, duration, 0x55c4) // und
+	w.WriteHdlr(t.Handler, "")
+	w.StartBox(mp4.TypeMinf)
+	switch t.Handler {
+	case Video:
+		w.WriteVmhd()
+	case Audio:
+		w.WriteSmhd()
+	default:
+		w.StartFullBox(mp4.TypeNmhd, 0, 0)
+		w.EndBox()
+	}
+	w.StartBox(mp4.TypeDinf)
+	w.WriteDref()
+	w.EndBox()
+
+	w.StartBox(mp4.TypeStbl)
+	w.StartFullBox(mp4.TypeStsd, 0, 0)
+	w.Write([]byte{0, 0, 0, 1})
+	t.Entry(w)
+	w.EndBox()
+	w.WriteStts([]mp4.SttsEntry{{Count: n, Duration: t.Duration}})
+	if t.CTTS != nil {
+		w.WriteCtts(t.CTTS)
+	}
+	if t.Sync != nil {
+		w.WriteStss(t.Sync)
+	}
+	w.WriteStsc([]mp4.StscEntry{{FirstChunk: 1, SamplesPerChunk: n, SampleDescriptionId: 1}})
+	sizes := make([]uint32, n)
+	for i, s := range t.Samples {
+		sizes[i] = uint32(len(s))
+	}
+	w.WriteStsz(0, sizes)
+	w.WriteStco([]uint32{offset})
+	w.EndBox() // stbl
+	w.EndBox() // minf
+	w.EndBox() // mdia
+	w.EndBox() // trak
+}
+
+// Moov returns the moov box of file, nil if it has none.
+func Moov(file []byte) []byte {
+	r := mp4.NewReader(file)
+	for r.Next() {
+		if r.Type() == mp4.TypeMoov {
+			return r.RawBox()
+		}
+	}
+	return nil
+}
+
+// VisualEntry returns an Entry function writing a visual sample entry of
+// type typ whose children are written by children, which may be nil.
+func VisualEntry(typ mp4.BoxType, width, height uint16, children func(w *mp4.Writer)) func(w *mp4.Writer) {
+	return func(w *mp4.Writer) {
+		w.StartBox(typ)
+		w.WriteVisualSampleEntry(1, width, height, 1, 24, "")
+		if children != nil {
+			children(w)
+		}
+		w.EndBox()
+	}
+}
+
+// AudioEntry returns an Entry function writing a version 0 audio sample
+// entry of type typ, with a rate in Hz below 65536, whose children are
+// written by children, which may be nil.
+func AudioEntry(typ mp4.BoxType, channels uint16, rate uint32, children func(w *mp4.Writer)) func(w *mp4.Writer) {
+	return func(w *mp4.Writer) {
+		w.StartBox(typ)
+		w.WriteAudioSampleEntry(1, channels, 16, rate<<16)
+		if children != nil {
+			children(w)
+		}
+		w.EndBox()
+	}
+}
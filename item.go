@@ -0,0 +1,727 @@
+package mp4
+
+// ReadPitm parses pitm box data (after version+flags) and returns the
+// primary item ID, 16 bits in version 0 and 32 bits otherwise.
+func ReadPitm(data []byte, version uint8) (uint32, error) {
+	if version == 0 {
+		if len(data) < 2 {
+			return 0, ErrTruncated
+		}
+		return uint32(be.Uint16(data)), nil
+	}
+	if len(data) < 4 {
+		return 0, ErrTruncated
+	}
+	return be.Uint32(data), nil
+}
+
+// WritePitm writes a complete pitm box, in version 1 if id needs 32 bits.
+func (w *Writer) WritePitm(id uint32) {
+	if id > 0xffff {
+		w.StartFullBox(TypePitm, 1, 0)
+		w.putUint32(id)
+	} else {
+		w.StartFullBox(TypePitm, 0, 0)
+		w.putUint16(uint16(id))
+	}
+	w.EndBox()
+}
+
+// Item types of infe entries.
+var (
+	ItemTypeMime = BoxType{'m', 'i', 'm', 'e'} // content described by ContentType
+	ItemTypeURI  = BoxType{'u', 'r', 'i', ' '} // content described by URIType
+	ItemTypeGrid = BoxType{'g', 'r', 'i', 'd'} // image grid derived from dimg references
+	ItemTypeExif = BoxType{'E', 'x', 'i', 'f'} // Exif metadata
+)
+
+// ItemInfo holds a parsed infe box.
+type ItemInfo struct {
+	ID              uint32
+	ProtectionIndex uint16  // 0 if the item is not protected
+	Type            BoxType // e.g. 'hvc1', ItemTypeGrid; zero for version 0 and 1 entries
+	Name            string
+	ContentType     string // mime items and version 0 and 1 entries
+	ContentEncoding string // mime items and version 0 and 1 entries, "" if absent
+	URIType         string // uri items
+	Hidden          bool   // flags bit 0: not intended to be displayed
+}
+
+// ReadInfe parses infe box data (after version+flags).
+func ReadInfe(data []byte, version uint8, flags uint32) (ItemInfo, error) {
+	e := ItemInfo{Hidden: flags&1 != 0}
+	ptr := 0
+	switch {
+	case version < 2:
+		if len(data) < 4 {
+			return e, ErrTruncated
+		}
+		e.ID = uint32(be.Uint16(data))
+		e.ProtectionIndex = be.Uint16(data[2:])
+		ptr = 4
+	case version == 2:
+		if len(data) < 8 {
+			return e, ErrTruncated
+		}
+		e.ID = uint32(be.Uint16(data))
+		e.ProtectionIndex = be.Uint16(data[2:])
+		e.Type = BoxType(data[4:8])
+		ptr = 8
+	default:
+		if len(data) < 10 {
+			return e, ErrTruncated
+		}
+		e.ID = be.Uint32(data)
+		e.ProtectionIndex = be.Uint16(data[4:])
+		e.Type = BoxType(data[6:10])
+		ptr = 10
+	}
+
+	var ok bool
+	if e.Name, ptr, ok = readCString(data, ptr); !ok {
+		// Some writers omit the terminator of the last string.
+		e.Name = string(data[ptr:])
+		return e, nil
+	}
+	switch {
+	case version < 2 || e.Type == ItemTypeMime:
+		if e.ContentType, ptr, ok = readCString(data, ptr); !ok {
+			e.ContentType = string(data[ptr:])
+			return e, nil
+		}
+		// content_encoding is optional.
+		if s, _, ok := readCString(data, ptr); ok {
+			e.ContentEncoding = s
+		} else {
+			e.ContentEncoding = string(data[ptr:])
+		}
+	case e.Type == ItemTypeURI:
+		if e.URIType, _, ok = readCString(data, ptr); !ok {
+			e.URIType = string(data[ptr:])
+		}
+	}
+	return e, nil
+}
+
+// ReadIinf parses iinf box data (after version+flags) into its item
+// information entries.
+func ReadIinf(data []byte, version uint8) ([]ItemInfo, error) {
+	ptr := 2
+	if version > 0 {
+		ptr = 4
+	}
+	if len(data) < ptr {
+		return nil, ErrTruncated
+	}
+	var items []ItemInfo
+	r := NewReader(data[ptr:])
+	for r.Next() {
+		if r.Type() != TypeInfe {
+			continue
+		}
+		e, err := ReadInfe(r.Data(), r.Version(), r.Flags())
+		if err != nil {
+			return items, err
+		}
+		items = append(items, e)
+	}
+	return items, nil
+}
+
+// WriteIinf writes a complete iinf box with one infe box per item, in
+// version 2, or 3 for IDs that need 32 bits.
+func (w *Writer) WriteIinf(items []ItemInfo) {
+	if len(items) > 0xffff {
+		w.StartFullBox(TypeIinf, 1, 0)
+		w.putUint32(uint32(len(items)))
+	} else {
+		w.StartFullBox(TypeIinf, 0, 0)
+		w.putUint16(uint16(len(items)))
+	}
+	for _, e := range items {
+		var flags uint32
+		if e.Hidden {
+			flags = 1
+		}
+		if e.ID > 0xffff {
+			w.StartFullBox(TypeInfe, 3, flags)
+			w.putUint32(e.ID)
+		} else {
+			w.StartFullBox(TypeInfe, 2, flags)
+			w.putUint16(uint16(e.ID))
+		}
+		w.putUint16(e.ProtectionIndex)
+		w.putBytes(e.Type[:])
+		w.putBytes([]byte(e.Name))
+		w.putUint8(0)
+		switch e.Type {
+		case ItemTypeMime:
+			w.putBytes([]byte(e.ContentType))
+			w.putUint8(0)
+			if e.ContentEncoding != "" {
+				w.putBytes([]byte(e.ContentEncoding))
+				w.putUint8(0)
+			}
+		case ItemTypeURI:
+			w.putBytes([]byte(e.URIType))
+			w.putUint8(0)
+		}
+		w.EndBox()
+	}
+	w.EndBox()
+}
+
+// Item construction methods of iloc entries.
+const (
+	ConstructionFileOffset = 0 // extents are offsets in the file
+	ConstructionIdatOffset = 1 // extents are offsets in the idat box
+	ConstructionItemOffset = 2 // extents are offsets in referenced items
+)
+
+// ItemExtent is one extent of an item's data. A zero Length means the
+// extent runs to the end of its source.
+type ItemExtent struct {
+	Index  uint64 // extent_index, for ConstructionItemOffset
+	Offset uint64 // relative to the item's BaseOffset
+	Length uint64
+}
+
+// ItemLocation is one entry of an iloc box.
+type ItemLocation struct {
+	ID                 uint32
+	ConstructionMethod uint8
+	DataReferenceIndex uint16 // 0 for this file
+	BaseOffset         uint64
+	Extents            []ItemExtent
+}
+
+// ReadIloc parses iloc box data (after version+flags), versions 0 to 2.
+func ReadIloc(data []byte, version uint8) ([]ItemLocation, error) {
+	if len(data) < 2 {
+		return nil, ErrTruncated
+	}
+	offsetSize := int(data[0] >> 4)
+	lengthSize := int(data[0] & 0x0f)
+	baseOffsetSize := int(data[1] >> 4)
+	indexSize := 0
+	if version > 0 {
+		indexSize = int(data[1] & 0x0f)
+	}
+	for _, n := range [...]int{offsetSize, lengthSize, baseOffsetSize, indexSize} {
+		if n != 0 && n != 4 && n != 8 {
+			return nil, ErrTruncated
+		}
+	}
+	ptr := 2
+	readN := func(n int) (uint64, bool) {
+		if ptr+n > len(data) {
+			return 0, false
+		}
+		var v uint64
+		for _, b := range data[ptr : ptr+n] {
+			v = v<<8 | uint64(b)
+		}
+		ptr += n
+		return v, true
+	}
+
+	idSize := 2
+	if version == 2 {
+		idSize = 4
+	}
+	count, ok := readN(idSize)
+	if !ok {
+		return nil, ErrTruncated
+	}
+	locs := make([]ItemLocation, 0, min(int(count), len(data)/4))
+	for range count {
+		var l ItemLocation
+		id, ok := readN(idSize)
+		if !ok {
+			return locs, ErrTruncated
+		}
+		l.ID = uint32(id)
+		if version > 0 {
+			cm, ok := readN(2)
+			if !ok {
+				return locs, ErrTruncated
+			}
+			l.ConstructionMethod = uint8(cm & 0x0f)
+		}
+		dri, ok1 := readN(2)
+		base, ok2 := readN(baseOffsetSize)
+		n, ok3 := readN(2)
+		if !ok1 || !ok2 || !ok3 {
+			return locs, ErrTruncated
+		}
+		l.DataReferenceIndex = uint16(dri)
+		l.BaseOffset = base
+		// Extents with no fields take no bytes; only one of them is
+		// meaningful, so a larger count is rejected rather than allocated.
+		extentSize := indexSize + offsetSize + lengthSize
+		if extentSize == 0 && n > 1 || extentSize > 0 && int(n) > (len(data)-ptr)/extentSize {
+			return locs, ErrTruncated
+		}
+		for range n {
+			index, ok1 := readN(indexSize)
+			offset, ok2 := readN(offsetSize)
+			length, ok3 := readN(lengthSize)
+			if !ok1 || !ok2 || !ok3 {
+				return locs, ErrTruncated
+			}
+			l.Extents = append(l.Extents, ItemExtent{Index: index, Offset: offset, Length: length})
+		}
+		locs = append(locs, l)
+	}
+	return locs, nil
+}
+
+// WriteIloc writes a complete iloc box. Field sizes are chosen to fit the
+// values, and the version is the lowest that can represent the entries:
+// 2 for IDs that need 32 bits, 1 for construction methods other than
+// ConstructionFileOffset or extent indexes, 0 otherwise.
+func (w *Writer) WriteIloc(locs []ItemLocation) {
+	var version uint8
+	var maxOffset, maxLength, maxBase, maxIndex uint64
+	for _, l := range locs {
+		if l.ID > 0xffff {
+			version = 2
+		} else if (l.ConstructionMethod != 0 || hasExtentIndex(l)) && version < 1 {
+			version = 1
+		}
+		maxBase = max(maxBase, l.BaseOffset)
+		for _, e := range l.Extents {
+			maxOffset = max(maxOffset, e.Offset)
+			maxLength = max(maxLength, e.Length)
+			maxIndex = max(maxIndex, e.Index)
+		}
+	}
+	offsetSize, lengthSize := ilocFieldSize(maxOffset), ilocFieldSize(maxLength)
+	baseOffsetSize, indexSize := ilocFieldSize(maxBase), ilocFieldSize(maxIndex)
+	if offsetSize == 0 {
+		offsetSize = 4 // extent_offset is commonly expected to be present
+	}
+	if lengthSize == 0 {
+		lengthSize = 4
+	}
+	if version == 0 {
+		indexSize = 0
+	}
+
+	putN := func(v uint64, n int) {
+		switch n {
+		case 4:
+			w.putUint32(uint32(v))
+		case 8:
+			w.putUint64(v)
+		}
+	}
+	w.StartFullBox(TypeIloc, version, 0)
+	w.putUint8(uint8(offsetSize<<4 | lengthSize))
+	w.putUint8(uint8(baseOffsetSize<<4 | indexSize))
+	if version == 2 {
+		w.putUint32(uint32(len(locs)))
+	} else {
+		w.putUint16(uint16(len(locs)))
+	}
+	for _, l := range locs {
+		if version == 2 {
+			w.putUint32(l.ID)
+		} else {
+			w.putUint16(uint16(l.ID))
+		}
+		if version > 0 {
+			w.putUint16(uint16(l.ConstructionMethod & 0x0f))
+		}
+		w.putUint16(l.DataReferenceIndex)
+		putN(l.BaseOffset, baseOffsetSize)
+		w.putUint16(uint16(len(l.Extents)))
+		for _, e := range l.Extents {
+			putN(e.Index, indexSize)
+			putN(e.Offset, offsetSize)
+			putN(e.Length, lengthSize)
+		}
+	}
+	w.EndBox()
+}
+
+func hasExtentIndex(l ItemLocation) bool {
+	for _, e := range l.Extents {
+		if e.Index != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ilocFieldSize returns the smallest iloc field size, 0, 4 or 8 bytes,
+// that holds v.
+func ilocFieldSize(v uint64) int {
+	switch {
+	case v == 0:
+		return 0
+	case v <= 0xffffffff:
+		return 4
+	}
+	return 8
+}
+
+// ItemReference is one reference type box of an iref box: references of
+// the given type from one item to others, e.g. 'thmb' from a thumbnail to
+// its image or 'dimg' from a grid to its tiles.
+type ItemReference struct {
+	Type   BoxType
+	FromID uint32
+	ToIDs  []uint32
+}
+
+// ReadIref parses iref box data (after version+flags). Item IDs are 16
+// bits in version 0 and 32 bits otherwise.
+func ReadIref(data []byte, version uint8) ([]ItemReference, error) {
+	idSize := 2
+	if version > 0 {
+		idSize = 4
+	}
+	readID := func(b []byte) uint32 {
+		if idSize == 2 {
+			return uint32(be.Uint16(b))
+		}
+		return be.Uint32(b)
+	}
+	var refs []ItemReference
+	r := NewReader(data)
+	for r.Next() {
+		d := r.Data()
+		if len(d) < idSize+2 {
+			return refs, ErrTruncated
+		}
+		ref := ItemReference{Type: r.Type(), FromID: readID(d)}
+		n := int(be.Uint16(d[idSize:]))
+		ptr := idSize + 2
+		if ptr+n*idSize > len(d) {
+			return refs, ErrTruncated
+		}
+		ref.ToIDs = make([]uint32, n)
+		for i := range ref.ToIDs {
+			ref.ToIDs[i] = readID(d[ptr:])
+			ptr += idSize
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// WriteIref writes a complete iref box, in version 1 if any ID needs 32
+// bits.
+func (w *Writer) WriteIref(refs []ItemReference) {
+	var version uint8
+	for _, ref := range refs {
+		if ref.FromID > 0xffff || maxUint32(ref.ToIDs) > 0xffff {
+			version = 1
+		}
+	}
+	putID := func(id uint32) {
+		if version == 0 {
+			w.putUint16(uint16(id))
+		} else {
+			w.putUint32(id)
+		}
+	}
+	w.StartFullBox(TypeIref, version, 0)
+	for _, ref := range refs {
+		w.StartBox(ref.Type)
+		putID(ref.FromID)
+		w.putUint16(uint16(len(ref.ToIDs)))
+		for _, id := range ref.ToIDs {
+			putID(id)
+		}
+		w.EndBox()
+	}
+	w.EndBox()
+}
+
+func maxUint32(s []uint32) uint32 {
+	var m uint32
+	for _, v := range s {
+		m = max(m, v)
+	}
+	return m
+}
+
+// PropertyAssociation links an item to a property of the ipco box by its
+// 1-based index. Essential properties must be understood to process the
+// item.
+type PropertyAssociation struct {
+	Index     uint16
+	Essential bool
+}
+
+// ItemPropertyAssociation is one entry of an ipma box.
+type ItemPropertyAssociation struct {
+	ItemID       uint32
+	Associations []PropertyAssociation
+}
+
+// ReadIpma parses ipma box data (after version+flags). Item IDs are 16
+// bits in version 0 and 32 bits otherwise; property indexes are 15 bits
+// if flags bit 0 is set and 7 bits otherwise.
+func ReadIpma(data []byte, version uint8, flags uint32) ([]ItemPropertyAssociation, error) {
+	if len(data) < 4 {
+		return nil, ErrTruncated
+	}
+	n := int(be.Uint32(data))
+	ptr := 4
+	entries := make([]ItemPropertyAssociation, 0, min(n, len(data)/3))
+	for range n {
+		var e ItemPropertyAssociation
+		if version < 1 {
+			if ptr+3 > len(data) {
+				return entries, ErrTruncated
+			}
+			e.ItemID = uint32(be.Uint16(data[ptr:]))
+			ptr += 2
+		} else {
+			if ptr+5 > len(data) {
+				return entries, ErrTruncated
+			}
+			e.ItemID = be.Uint32(data[ptr:])
+			ptr += 4
+		}
+		count := int(data[ptr])
+		ptr++
+		e.Associations = make([]PropertyAssociation, count)
+		for i := range e.Associations {
+			a := &e.Associations[i]
+			if flags&1 != 0 {
+				if ptr+2 > len(data) {
+					return entries, ErrTruncated
+				}
+				v := be.Uint16(data[ptr:])
+				a.Essential = v&0x8000 != 0
+				a.Index = v & 0x7fff
+				ptr += 2
+			} else {
+				if ptr+1 > len(data) {
+					return entries, ErrTruncated
+				}
+				a.Essential = data[ptr]&0x80 != 0
+				a.Index = uint16(data[ptr] & 0x7f)
+				ptr++
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// WriteIpma writes a complete ipma box, in version 1 if any item ID needs
+// 32 bits and with 15-bit property indexes if any index exceeds 127.
+func (w *Writer) WriteIpma(entries []ItemPropertyAssociation) {
+	var version uint8
+	var flags uint32
+	for _, e := range entries {
+		if e.ItemID > 0xffff {
+			version = 1
+		}
+		for _, a := range e.Associations {
+			if a.Index > 0x7f {
+				flags = 1
+			}
+		}
+	}
+	w.StartFullBox(TypeIpma, version, flags)
+	w.putUint32(uint32(len(entries)))
+	for _, e := range entries {
+		if version == 0 {
+			w.putUint16(uint16(e.ItemID))
+		} else {
+			w.putUint32(e.ItemID)
+		}
+		w.putUint8(uint8(len(e.Associations)))
+		for _, a := range e.Associations {
+			if flags&1 != 0 {
+				v := a.Index & 0x7fff
+				if a.Essential {
+					v |= 0x8000
+				}
+				w.putUint16(v)
+			} else {
+				v := uint8(a.Index & 0x7f)
+				if a.Essential {
+					v |= 0x80
+				}
+				w.putUint8(v)
+			}
+		}
+	}
+	w.EndBox()
+}
+
+// ImageSpatialExtents holds a parsed ispe box, the size of an image item
+// in pixels before any transformative properties.
+type ImageSpatialExtents struct {
+	Width  uint32
+	Height uint32
+}
+
+// ReadIspe parses ispe box data (after version+flags).
+func ReadIspe(data []byte) (ImageSpatialExtents, error) {
+	if len(data) < 8 {
+		return ImageSpatialExtents{}, ErrTruncated
+	}
+	return ImageSpatialExtents{Width: be.Uint32(data), Height: be.Uint32(data[4:])}, nil
+}
+
+// WriteIspe writes a complete ispe box.
+func (w *Writer) WriteIspe(e ImageSpatialExtents) {
+	w.StartFullBox(TypeIspe, 0, 0)
+	w.putUint32(e.Width)
+	w.putUint32(e.Height)
+	w.EndBox()
+}
+
+// ReadIrot parses irot box data and returns the anticlockwise rotation in
+// degrees: 0, 90, 180 or 270.
+func ReadIrot(data []byte) (int, error) {
+	if len(data) < 1 {
+		return 0, ErrTruncated
+	}
+	return int(data[0]&0x03) * 90, nil
+}
+
+// WriteIrot writes a complete irot box for an anticlockwise rotation in
+// degrees, which is rounded down to a multiple of 90.
+func (w *Writer) WriteIrot(degrees int) {
+	w.StartBox(TypeIrot)
+	w.putUint8(uint8(((degrees%360+360)%360)/90) & 0x03)
+	w.EndBox()
+}
+
+// Mirror axes of imir boxes.
+const (
+	MirrorVertical   = 0 // about a vertical axis: left and right swap
+	MirrorHorizontal = 1 // about a horizontal axis: top and bottom swap
+)
+
+// ReadImir parses imir box data and returns the mirror axis.
+func ReadImir(data []byte) (uint8, error) {
+	if len(data) < 1 {
+		return 0, ErrTruncated
+	}
+	return data[0] & 0x01, nil
+}
+
+// WriteImir writes a complete imir box.
+func (w *Writer) WriteImir(axis uint8) {
+	w.StartBox(TypeImir)
+	w.putUint8(axis & 0x01)
+	w.EndBox()
+}
+
+// PixelInformation holds a parsed pixi box, the bits per channel of each
+// channel of an image item.
+type PixelInformation struct {
+	BitsPerChannel []uint8
+}
+
+// ReadPixi parses pixi box data (after version+flags).
+func ReadPixi(data []byte) (PixelInformation, error) {
+	if len(data) < 1 || len(data) < 1+int(data[0]) {
+		return PixelInformation{}, ErrTruncated
+	}
+	return PixelInformation{BitsPerChannel: data[1 : 1+int(data[0])]}, nil
+}
+
+// WritePixi writes a complete pixi box.
+func (w *Writer) WritePixi(p PixelInformation) {
+	w.StartFullBox(TypePixi, 0, 0)
+	w.putUint8(uint8(len(p.BitsPerChannel)))
+	w.putBytes(p.BitsPerChannel)
+	w.EndBox()
+}
+
+// Auxiliary image types of auxC boxes.
+const (
+	AuxTypeAlpha     = "urn:mpeg:mpegB:cicp:systems:auxiliary:alpha"
+	AuxTypeDepth     = "urn:mpeg:mpegB:cicp:systems:auxiliary:depth"
+	AuxTypeHEVCAlpha = "urn:mpeg:hevc:2015:auxid:1" // used by older HEIF writers
+	AuxTypeHEVCDepth = "urn:mpeg:hevc:2015:auxid:2"
+)
+
+// AuxiliaryType holds a parsed auxC box, the kind of an auxiliary image
+// item such as an alpha plane.
+type AuxiliaryType struct {
+	Type    string // URN, e.g. AuxTypeAlpha
+	Subtype []byte // type-specific data, e.g. SEI messages
+}
+
+// IsAlpha reports whether the auxiliary image is an alpha plane.
+func (a *AuxiliaryType) IsAlpha() bool {
+	return a.Type == AuxTypeAlpha || a.Type == AuxTypeHEVCAlpha
+}
+
+// ReadAuxC parses auxC box data (after version+flags).
+func ReadAuxC(data []byte) (AuxiliaryType, error) {
+	s, ptr, ok := readCString(data, 0)
+	if !ok {
+		return AuxiliaryType{}, ErrTruncated
+	}
+	return AuxiliaryType{Type: s, Subtype: data[ptr:]}, nil
+}
+
+// WriteAuxC writes a complete auxC box.
+func (w *Writer) WriteAuxC(a AuxiliaryType) {
+	w.StartFullBox(TypeAuxC, 0, 0)
+	w.putBytes([]byte(a.Type))
+	w.putUint8(0)
+	w.putBytes(a.Subtype)
+	w.EndBox()
+}
+
+// ImageGrid is the data of a grid item: Rows × Columns input images, the
+// item's dimg references in row-major order, tiled and cropped to the
+// output size.
+type ImageGrid struct {
+	Rows         uint16 // 1 to 256
+	Columns      uint16 // 1 to 256
+	OutputWidth  uint32
+	OutputHeight uint32
+}
+
+// ReadImageGrid parses the item data of a grid item.
+func ReadImageGrid(data []byte) (ImageGrid, error) {
+	var g ImageGrid
+	if len(data) < 8 {
+		return g, ErrTruncated
+	}
+	g.Rows = uint16(data[2]) + 1
+	g.Columns = uint16(data[3]) + 1
+	if data[1]&1 == 0 {
+		g.OutputWidth = uint32(be.Uint16(data[4:]))
+		g.OutputHeight = uint32(be.Uint16(data[6:]))
+		return g, nil
+	}
+	if len(data) < 12 {
+		return g, ErrTruncated
+	}
+	g.OutputWidth = be.Uint32(data[4:])
+	g.OutputHeight = be.Uint32(data[8:])
+	return g, nil
+}
+
+// AppendImageGrid appends the item data of a grid item to dst, with 32-bit
+// output dimensions if either needs them.
+func AppendImageGrid(dst []byte, g ImageGrid) []byte {
+	large := g.OutputWidth > 0xffff || g.OutputHeight > 0xffff
+	var flags byte
+	if large {
+		flags = 1
+	}
+	dst = append(dst, 0, flags, byte(g.Rows-1), byte(g.Columns-1))
+	if large {
+		dst = be.AppendUint32(dst, g.OutputWidth)
+		return be.AppendUint32(dst, g.OutputHeight)
+	}
+	dst = be.AppendUint16(dst, uint16(g.OutputWidth))
+	return be.AppendUint16(dst, uint16(g.OutputHeight))
+}
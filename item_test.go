@@ -0,0 +1,166 @@
+package mp4_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tetsuo/mp4"
+)
+
+func TestPitmRoundTrip(t *testing.T) {
+	for _, tt := range []struct {
+		id      uint32
+		version uint8
+	}{{1, 0}, {0x10000, 1}} {
+		r := writeBox(t, func(w *mp4.Writer) { w.WritePitm(tt.id) })
+		if r.Version() != tt.version {
+			t.Errorf("id %d: version = %d, want %d", tt.id, r.Version(), tt.version)
+		}
+		if id, err := mp4.ReadPitm(r.Data(), r.Version()); err != nil || id != tt.id {
+			t.Errorf("got %d, %v, want %d", id, err, tt.id)
+		}
+	}
+}
+
+func TestIinfRoundTrip(t *testing.T) {
+	want := []mp4.ItemInfo{
+		{ID: 1, Type: mp4.BoxType{'h', 'v', 'c', '1'}, Name: "HEVC Image"},
+		{ID: 2, Type: mp4.ItemTypeExif, Hidden: true},
+		{ID: 3, Type: mp4.ItemTypeMime, Name: "XMP", ContentType: "application/rdf+xml", ContentEncoding: "deflate"},
+		{ID: 0x10004, ProtectionIndex: 1, Type: mp4.ItemTypeURI, URIType: "urn:example:data"},
+	}
+	r := writeBox(t, func(w *mp4.Writer) { w.WriteIinf(want) })
+	items, err := mp4.ReadIinf(r.Data(), r.Version())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(items, want) {
+		t.Errorf("got %+v, want %+v", items, want)
+	}
+}
+
+func TestReadInfeV0(t *testing.T) {
+	// Versions 0 and 1 name the content type directly; the encoding may
+	// be absent.
+	e, err := mp4.ReadInfe([]byte("\x00\x05\x00\x00meta\x00text/xml\x00"), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := mp4.ItemInfo{ID: 5, Name: "meta", ContentType: "text/xml"}
+	if e != want {
+		t.Errorf("got %+v, want %+v", e, want)
+	}
+}
+
+func TestIlocRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		locs    []mp4.ItemLocation
+		version uint8
+	}{
+		{
+			name: "file offsets",
+			locs: []mp4.ItemLocation{
+				{ID: 1, Extents: []mp4.ItemExtent{{Offset: 1000, Length: 500}}},
+				{ID: 2, BaseOffset: 1 << 33, Extents: []mp4.ItemExtent{{Offset: 0, Length: 10}, {Offset: 20, Length: 0}}},
+			},
+			version: 0,
+		},
+		{
+			name: "idat and item offsets",
+			locs: []mp4.ItemLocation{
+				{ID: 1, ConstructionMethod: mp4.ConstructionIdatOffset, Extents: []mp4.ItemExtent{{Offset: 0, Length: 8}}},
+				{ID: 2, ConstructionMethod: mp4.ConstructionItemOffset, Extents: []mp4.ItemExtent{{Index: 1, Offset: 4, Length: 4}}},
+			},
+			version: 1,
+		},
+		{
+			name:    "32-bit IDs",
+			locs:    []mp4.ItemLocation{{ID: 0x10000, DataReferenceIndex: 1, Extents: []mp4.ItemExtent{{Length: 1}}}},
+			version: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := writeBox(t, func(w *mp4.Writer) { w.WriteIloc(tt.locs) })
+			if r.Version() != tt.version {
+				t.Errorf("version = %d, want %d", r.Version(), tt.version)
+			}
+			locs, err := mp4.ReadIloc(r.Data(), r.Version())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(locs, tt.locs) {
+				t.Errorf("got %+v, want %+v", locs, tt.locs)
+			}
+		})
+	}
+
+	if _, err := mp4.ReadIloc([]byte{0x33, 0x00, 0, 0}, 0); err != mp4.ErrTruncated {
+		t.Errorf("3-byte offsets: err = %v, want %v", err, mp4.ErrTruncated)
+	}
+	// One item claiming 65535 extents, with empty and with 4-byte fields.
+	for _, sizes := range []byte{0x00, 0x44} {
+		data := []byte{sizes, 0x00, 0, 1, 0, 1, 0, 0, 0xff, 0xff, 0, 0, 0, 0, 0, 0, 0, 0}
+		if _, err := mp4.ReadIloc(data, 0); err != mp4.ErrTruncated {
+			t.Errorf("extent count with sizes %#02x: err = %v, want %v", sizes, err, mp4.ErrTruncated)
+		}
+	}
+}
+
+func TestIrefRoundTrip(t *testing.T) {
+	for _, want := range [][]mp4.ItemReference{
+		{
+			{Type: mp4.BoxType{'d', 'i', 'm', 'g'}, FromID: 1, ToIDs: []uint32{2, 3, 4, 5}},
+			{Type: mp4.BoxType{'c', 'd', 's', 'c'}, FromID: 6, ToIDs: []uint32{1}},
+		},
+		{{Type: mp4.BoxType{'t', 'h', 'm', 'b'}, FromID: 2, ToIDs: []uint32{0x10000}}},
+	} {
+		r := writeBox(t, func(w *mp4.Writer) { w.WriteIref(want) })
+		refs, err := mp4.ReadIref(r.Data(), r.Version())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(refs, want) {
+			t.Errorf("version %d: got %+v, want %+v", r.Version(), refs, want)
+		}
+	}
+}
+
+func TestIpmaRoundTrip(t *testing.T) {
+	for _, want := range [][]mp4.ItemPropertyAssociation{
+		{
+			{ItemID: 1, Associations: []mp4.PropertyAssociation{{Index: 1, Essential: true}, {Index: 2}}},
+			{ItemID: 2, Associations: []mp4.PropertyAssociation{}},
+		},
+		{{ItemID: 0x10000, Associations: []mp4.PropertyAssociation{{Index: 200, Essential: true}}}},
+	} {
+		r := writeBox(t, func(w *mp4.Writer) { w.WriteIpma(want) })
+		entries, err := mp4.ReadIpma(r.Data(), r.Version(), r.Flags())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(entries, want) {
+			t.Errorf("version %d, flags %d: got %+v, want %+v", r.Version(), r.Flags(), entries, want)
+		}
+	}
+}
+
+func TestImageTransformRoundTrip(t *testing.T) {
+	r := writeBox(t, func(w *mp4.Writer) { w.WriteIspe(mp4.ImageSpatialExtents{Width: 4032, Height: 3024}) })
+	if e, err := mp4.ReadIspe(r.Data()); err != nil || e != (mp4.ImageSpatialExtents{Width: 4032, Height: 3024}) {
+		t.Errorf("ispe = %+v, %v", e, err)
+	}
+	for _, tt := range []struct{ in, want int }{{90, 90}, {180, 180}, {-90, 270}, {450, 90}, {100, 90}} {
+		r := writeBox(t, func(w *mp4.Writer) { w.WriteIrot(tt.in) })
+		if deg, err := mp4.ReadIrot(r.Data()); err != nil || deg != tt.want {
+			t.Errorf("irot %d: got %d, %v, want %d", tt.in, deg, err, tt.want)
+		}
+	}
+	for _, axis := range []uint8{mp4.MirrorVertical, mp4.MirrorHorizontal} {
+		r := writeBox(t, func(w *mp4.Writer) { w.WriteImir(axis) })
+		if got, err := mp4.ReadImir(r.Data()); err != nil || got != axis {
+			t.Errorf("imir %d: got %d, %v", axis, got, err)
+		}
+	}
+}
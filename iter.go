@@ -484,10 +484,23 @@ type VisualSampleEntry struct {
 	CompressorName     string
 	Depth              uint16
 	ChildOffset        int // byte offset within data where child boxes begin
+
+	// Extension boxes found among the children by ReadExtensions, nil if
+	// absent or not read.
+	Pasp *PixelAspectRatio
+	Btrt *BitRate
+	Colr *ColourInformation
+	Clap *CleanAperture
+	Mdcv *MasteringDisplayColourVolume
+	Clli *ContentLightLevel
+
+	// Sinf is the protection information of encv entries, nil if absent.
+	Sinf *ProtectionInfo
 }
 
 // ReadVisualSampleEntry parses a visual sample entry from box data.
-// Child boxes (e.g. avcC) start at ChildOffset within the data.
+// Child boxes (e.g. avcC) start at ChildOffset within the data; call
+// ReadExtensions to decode the common ones.
 func ReadVisualSampleEntry(data []byte) VisualSampleEntry {
 	nameLen := min(int(data[42]), 31)
 	return VisualSampleEntry{
@@ -503,25 +516,183 @@ func ReadVisualSampleEntry(data []byte) VisualSampleEntry {
 	}
 }
 
+// ReadExtensions decodes the pasp, btrt, colr, clap, mdcv, clli and sinf
+// boxes among the children of the entry. data is the box data the entry
+// was read from.
+func (v *VisualSampleEntry) ReadExtensions(data []byte) {
+	r := NewReader(data[v.ChildOffset:])
+	for r.Next() {
+		switch r.Type() {
+		case TypePasp:
+			if p, err := ReadPasp(r.Data()); err == nil {
+				v.Pasp = &p
+			}
+		case TypeBtrt:
+			if b, err := ReadBtrt(r.Data()); err == nil {
+				v.Btrt = &b
+			}
+		case TypeColr:
+			// The first colr is preferred; later ones are fallbacks.
+			if v.Colr == nil {
+				if c, err := ReadColr(r.Data()); err == nil {
+					v.Colr = &c
+				}
+			}
+		case TypeClap:
+			if c, err := ReadClap(r.Data()); err == nil {
+				v.Clap = &c
+			}
+		case TypeMdcv:
+			if m, err := ReadMdcv(r.Data()); err == nil {
+				v.Mdcv = &m
+			}
+		case TypeClli:
+			if c, err := ReadClli(r.Data()); err == nil {
+				v.Clli = &c
+			}
+		case TypeSinf:
+			if p, err := ReadSinf(r.Data()); err == nil {
+				v.Sinf = &p
+			}
+		}
+	}
+}
+
+// VideoRange returns the HLS VIDEO-RANGE implied by the colr box, and false
+// if the entry has no nclx/nclc colour information.
+func (v *VisualSampleEntry) VideoRange() (string, bool) {
+	if v.Colr == nil || (v.Colr.ColourType != ColourTypeNclx && v.Colr.ColourType != ColourTypeNclc) {
+		return "", false
+	}
+	return VideoRange(uint8(v.Colr.TransferCharacteristics)), true
+}
+
 // AudioSampleEntry holds parsed fields from an audio sample entry (e.g. mp4a).
+//
+// QuickTime sound sample descriptions come in three layouts selected by
+// Version: version 0 is the 28-byte ISO layout, version 1 appends four
+// 32-bit packet fields, and version 2 replaces the rate and channel fields
+// with 32- and 64-bit ones. ISO version 1 entries, which keep the version 0
+// layout and signal high rates in an srat box, are told apart from
+// QuickTime ones by the child box that follows the 28-byte header.
 type AudioSampleEntry struct {
 	DataReferenceIndex uint16
+	Version            uint16
 	ChannelCount       uint16
-	SampleSize         uint16
-	SampleRate         uint32 // 16.16 fixed point
+	SampleSize         uint16 // bits per sample
+	SampleRate         uint32 // 16.16 fixed point, 0 if the rate does not fit
 	ChildOffset        int    // byte offset within data where child boxes begin
+
+	// QuickTime version 1 fields; zero otherwise.
+	SamplesPerPacket uint32
+	BytesPerPacket   uint32
+	BytesPerFrame    uint32
+	BytesPerSample   uint32
+
+	// QuickTime version 2 fields; zero otherwise.
+	SampleRate64                  float64 // in Hz
+	FormatSpecificFlags           uint32  // LPCM flags for lpcm entries
+	ConstBytesPerAudioPacket      uint32
+	ConstLPCMFramesPerAudioPacket uint32
+
+	// Channel layout boxes found among the children by ReadExtensions, nil
+	// if absent or not read.
+	Chnl *ChannelLayout
+	Chan *AudioChannelLayout
+
+	// Sinf is the protection information of enca entries, nil if absent.
+	Sinf *ProtectionInfo
 }
 
-// ReadAudioSampleEntry parses an audio sample entry from box data.
-// Child boxes (e.g. esds) start at ChildOffset within the data.
+// Sound sample description sizes by layout.
+const (
+	audioSampleEntrySize   = 28
+	audioSampleEntryV1Size = 44
+	audioSampleEntryV2Size = 64
+)
+
+// ReadAudioSampleEntry parses an audio sample entry from box data, which
+// must be at least 28 bytes. Child boxes (e.g. esds) start at ChildOffset
+// within the data; call ReadExtensions to decode the common ones. An entry
+// too short for its declared layout is read as version 0.
 func ReadAudioSampleEntry(data []byte) AudioSampleEntry {
-	return AudioSampleEntry{
+	a := AudioSampleEntry{
 		DataReferenceIndex: be.Uint16(data[6:8]),
+		Version:            be.Uint16(data[8:10]),
 		ChannelCount:       be.Uint16(data[16:18]),
 		SampleSize:         be.Uint16(data[18:20]),
 		SampleRate:         be.Uint32(data[24:28]),
-		ChildOffset:        28,
+		ChildOffset:        audioSampleEntrySize,
+	}
+	switch {
+	case a.Version == 1 && len(data) >= audioSampleEntryV1Size && !isBoxHeader(data[audioSampleEntrySize:]):
+		a.SamplesPerPacket = be.Uint32(data[28:32])
+		a.BytesPerPacket = be.Uint32(data[32:36])
+		a.BytesPerFrame = be.Uint32(data[36:40])
+		a.BytesPerSample = be.Uint32(data[40:44])
+		a.ChildOffset = audioSampleEntryV1Size
+	case a.Version == 2 && len(data) >= audioSampleEntryV2Size:
+		a.SampleRate64 = math.Float64frombits(be.Uint64(data[32:40]))
+		a.ChannelCount = uint16(be.Uint32(data[40:44]))
+		a.SampleSize = uint16(be.Uint32(data[48:52]))
+		a.FormatSpecificFlags = be.Uint32(data[52:56])
+		a.ConstBytesPerAudioPacket = be.Uint32(data[56:60])
+		a.ConstLPCMFramesPerAudioPacket = be.Uint32(data[60:64])
+		a.SampleRate = 0
+		if a.SampleRate64 > 0 && a.SampleRate64 < 65536 {
+			a.SampleRate = uint32(a.SampleRate64 * 65536)
+		}
+		a.ChildOffset = audioSampleEntryV2Size
+	}
+	return a
+}
+
+// ReadExtensions decodes the chnl, chan and sinf boxes among the children
+// of the entry. data is the box data the entry was read from.
+func (a *AudioSampleEntry) ReadExtensions(data []byte) {
+	r := NewReader(data[a.ChildOffset:])
+	for r.Next() {
+		switch r.Type() {
+		case TypeChnl:
+			if c, err := ReadChnl(r.Data(), r.Version(), a.ChannelCount); err == nil {
+				a.Chnl = &c
+			}
+		case TypeChan:
+			if l, err := ReadChan(r.Data()); err == nil {
+				a.Chan = &l
+			}
+		case TypeSinf:
+			if p, err := ReadSinf(r.Data()); err == nil {
+				a.Sinf = &p
+			}
+		}
+	}
+}
+
+// Rate returns the sample rate in Hz, rounded to the nearest integer.
+func (a *AudioSampleEntry) Rate() uint32 {
+	if a.Version == 2 && a.ChildOffset == audioSampleEntryV2Size {
+		return uint32(a.SampleRate64 + 0.5)
+	}
+	return a.SampleRate >> 16
+}
+
+// isBoxHeader reports whether b starts with a plausible box header: a size
+// of at least 8 that fits in b and a printable type.
+func isBoxHeader(b []byte) bool {
+	if len(b) < 8 {
+		return false
+	}
+	size := be.Uint32(b)
+	if size < 8 || int(size) > len(b) {
+		return false
+	}
+	for _, c := range b[4:8] {
+		if c < 0x20 || c > 0x7e {
+			return false
+		}
 	}
+	return true
 }
 
 // ReadAvcC extracts the codec profile string from avcC box data.
@@ -0,0 +1,497 @@
+package mp4
+
+import (
+	"math"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Handler types of meta boxes holding metadata items: iTunes metadata with
+// items named by type, and QuickTime metadata with items named by keys.
+var (
+	HandlerMdir = [4]byte{'m', 'd', 'i', 'r'}
+	HandlerMdta = [4]byte{'m', 'd', 't', 'a'}
+)
+
+// iTunes metadata item types. Items are boxes in ilst named by these
+// types; each holds one or more data boxes.
+var (
+	ItemTitle       = BoxType{0xa9, 'n', 'a', 'm'}
+	ItemArtist      = BoxType{0xa9, 'A', 'R', 'T'}
+	ItemAlbumArtist = BoxType{'a', 'A', 'R', 'T'}
+	ItemAlbum       = BoxType{0xa9, 'a', 'l', 'b'}
+	ItemGenre       = BoxType{0xa9, 'g', 'e', 'n'}
+	ItemDate        = BoxType{0xa9, 'd', 'a', 'y'}
+	ItemComment     = BoxType{0xa9, 'c', 'm', 't'}
+	ItemComposer    = BoxType{0xa9, 'w', 'r', 't'}
+	ItemEncoder     = BoxType{0xa9, 't', 'o', 'o'}
+	ItemLyrics      = BoxType{0xa9, 'l', 'y', 'r'}
+	ItemCopyright   = BoxType{'c', 'p', 'r', 't'}
+	ItemDescription = BoxType{'d', 'e', 's', 'c'}
+	ItemCover       = BoxType{'c', 'o', 'v', 'r'} // cover art, one data box per image
+	ItemTrack       = BoxType{'t', 'r', 'k', 'n'} // track number and total
+	ItemDisc        = BoxType{'d', 'i', 's', 'k'} // disc number and total
+	ItemTempo       = BoxType{'t', 'm', 'p', 'o'} // beats per minute
+	ItemCompilation = BoxType{'c', 'p', 'i', 'l'}
+	ItemFreeform    = BoxType{'-', '-', '-', '-'} // named by its mean and name boxes
+)
+
+// Well-known types of data box values.
+const (
+	DataTypeImplicit    = 0 // binary, as implied by the item type
+	DataTypeUTF8        = 1
+	DataTypeUTF16       = 2 // big-endian
+	DataTypeJPEG        = 13
+	DataTypePNG         = 14
+	DataTypeSignedInt   = 21 // big-endian, 1 to 8 bytes
+	DataTypeUnsignedInt = 22 // big-endian, 1 to 8 bytes
+	DataTypeFloat32     = 23 // big-endian IEEE 754
+	DataTypeFloat64     = 24 // big-endian IEEE 754
+	DataTypeBMP         = 27
+)
+
+// Common QuickTime metadata keys, as written by cameras and phones.
+const (
+	KeyLocationISO6709 = "com.apple.quicktime.location.ISO6709" // e.g. "+37.3349-122.0090+010.000/"
+	KeyMake            = "com.apple.quicktime.make"
+	KeyModel           = "com.apple.quicktime.model"
+	KeySoftware        = "com.apple.quicktime.software"
+	KeyCreationDate    = "com.apple.quicktime.creationdate" // ISO 8601
+)
+
+// MetadataKey is one entry of a QuickTime keys box.
+type MetadataKey struct {
+	Namespace [4]byte // HandlerMdta for reverse-DNS key names
+	Name      string
+}
+
+// MetadataData is the value of one data box.
+type MetadataData struct {
+	Type   uint32 // well-known type (24 bits), one of the DataType constants
+	Locale uint32
+	Value  []byte // points into the original buffer when read
+}
+
+// Text returns the value of a UTF-8 or UTF-16 data box as UTF-8, and ""
+// for other types.
+func (d *MetadataData) Text() string {
+	switch d.Type {
+	case DataTypeUTF8:
+		return string(d.Value)
+	case DataTypeUTF16:
+		u := make([]uint16, len(d.Value)/2)
+		for i := range u {
+			u[i] = be.Uint16(d.Value[2*i:])
+		}
+		buf := make([]byte, 0, len(u))
+		for _, c := range utf16.Decode(u) {
+			buf = utf8.AppendRune(buf, c)
+		}
+		return string(buf)
+	}
+	return ""
+}
+
+// Float returns the value of a floating point data box. The boolean is
+// false for other types.
+func (d *MetadataData) Float() (float64, bool) {
+	switch {
+	case d.Type == DataTypeFloat32 && len(d.Value) == 4:
+		return float64(math.Float32frombits(be.Uint32(d.Value))), true
+	case d.Type == DataTypeFloat64 && len(d.Value) == 8:
+		return math.Float64frombits(be.Uint64(d.Value)), true
+	}
+	return 0, false
+}
+
+// Int returns the value of an integer data box. The boolean is false for
+// other types and for sizes other than 1, 2, 3, 4 or 8 bytes.
+func (d *MetadataData) Int() (int64, bool) {
+	if d.Type != DataTypeSignedInt && d.Type != DataTypeUnsignedInt {
+		return 0, false
+	}
+	switch len(d.Value) {
+	case 1, 2, 3, 4, 8:
+	default:
+		return 0, false
+	}
+	var v uint64
+	for _, b := range d.Value {
+		v = v<<8 | uint64(b)
+	}
+	if d.Type == DataTypeSignedInt && len(d.Value) < 8 {
+		// Sign-extend from the value's width.
+		shift := 64 - 8*len(d.Value)
+		return int64(v<<shift) >> shift, true
+	}
+	return int64(v), true
+}
+
+// MetadataItem is one item of an ilst box.
+type MetadataItem struct {
+	Type BoxType // e.g. ItemTitle, or ItemFreeform
+
+	// Mean and Name identify freeform items, e.g. "com.apple.iTunes" and
+	// "iTunNORM"; empty for other items.
+	Mean string
+	Name string
+
+	Data []MetadataData
+}
+
+// Metadata holds the items of an ilst box in file order.
+//
+// With the mdta handler, items are named by Keys: the type of each item is
+// the 1-based index of its key as a big-endian integer. Use Keyed and
+// SetKeyed to access them by key name.
+type Metadata struct {
+	Handler [4]byte // HandlerMdir or HandlerMdta; zero means HandlerMdir when writing
+	Keys    []MetadataKey
+	Items   []MetadataItem
+}
+
+// ReadIlst parses ilst box data. Child boxes of an item other than data,
+// mean and name are ignored.
+func ReadIlst(data []byte) (Metadata, error) {
+	var m Metadata
+	r := NewReader(data)
+	for r.Next() {
+		item := MetadataItem{Type: r.Type()}
+		cr := NewReader(r.Data())
+		for cr.Next() {
+			d := cr.Data()
+			switch cr.Type() {
+			case TypeData:
+				if len(d) < 8 {
+					return m, ErrTruncated
+				}
+				item.Data = append(item.Data, MetadataData{
+					Type:   be.Uint32(d) & 0xffffff,
+					Locale: be.Uint32(d[4:]),
+					Value:  d[8:],
+				})
+			case TypeMean, TypeName:
+				// Both carry version and flags before the string.
+				if len(d) < 4 {
+					return m, ErrTruncated
+				}
+				if cr.Type() == TypeMean {
+					item.Mean = string(d[4:])
+				} else {
+					item.Name = string(d[4:])
+				}
+			}
+		}
+		m.Items = append(m.Items, item)
+	}
+	return m, nil
+}
+
+// ReadKeys parses keys box data (after version+flags).
+func ReadKeys(data []byte) ([]MetadataKey, error) {
+	if len(data) < 4 {
+		return nil, ErrTruncated
+	}
+	n := int(be.Uint32(data))
+	keys := make([]MetadataKey, 0, min(n, len(data)/8))
+	ptr := 4
+	for range n {
+		if ptr+8 > len(data) {
+			return keys, ErrTruncated
+		}
+		size := int(be.Uint32(data[ptr:]))
+		if size < 8 || ptr+size > len(data) {
+			return keys, ErrTruncated
+		}
+		var k MetadataKey
+		copy(k.Namespace[:], data[ptr+4:ptr+8])
+		k.Name = string(data[ptr+8 : ptr+size])
+		keys = append(keys, k)
+		ptr += size
+	}
+	return keys, nil
+}
+
+// ReadMeta parses meta box data, as returned by Reader.Data for either the
+// ISO or the QuickTime form, and returns the handler type, keys and ilst
+// items. It returns a Metadata without items if the meta box has no ilst.
+func ReadMeta(data []byte) (Metadata, error) {
+	var m Metadata
+	var handler [4]byte
+	var keys []MetadataKey
+	var err error
+	r := NewReader(data)
+	for r.Next() {
+		switch r.Type() {
+		case TypeHdlr:
+			handler = r.ReadHdlr()
+		case TypeKeys:
+			keys, err = ReadKeys(r.Data())
+		case TypeIlst:
+			m, err = ReadIlst(r.Data())
+		}
+		if err != nil {
+			break
+		}
+	}
+	m.Handler = handler
+	m.Keys = keys
+	return m, err
+}
+
+// Item returns the first item of the given type, or nil.
+func (m *Metadata) Item(typ BoxType) *MetadataItem {
+	for i := range m.Items {
+		if m.Items[i].Type == typ {
+			return &m.Items[i]
+		}
+	}
+	return nil
+}
+
+// Remove deletes all items of the given type.
+func (m *Metadata) Remove(typ BoxType) {
+	items := m.Items[:0]
+	for _, it := range m.Items {
+		if it.Type != typ {
+			items = append(items, it)
+		}
+	}
+	m.Items = items
+}
+
+// set replaces the first item of the given type with one holding a
+// single data box, or appends it.
+func (m *Metadata) set(typ BoxType, d MetadataData) {
+	if it := m.Item(typ); it != nil {
+		it.Data = []MetadataData{d}
+		return
+	}
+	m.Items = append(m.Items, MetadataItem{Type: typ, Data: []MetadataData{d}})
+}
+
+// first returns the first data box of the first item of the given type.
+func (m *Metadata) first(typ BoxType) *MetadataData {
+	if it := m.Item(typ); it != nil && len(it.Data) > 0 {
+		return &it.Data[0]
+	}
+	return nil
+}
+
+// Text returns the text of an item such as ItemTitle or ItemArtist, or ""
+// if the item is absent or not text.
+func (m *Metadata) Text(typ BoxType) string {
+	if d := m.first(typ); d != nil {
+		return d.Text()
+	}
+	return ""
+}
+
+// SetText sets a text item to a single UTF-8 value.
+func (m *Metadata) SetText(typ BoxType, s string) {
+	m.set(typ, MetadataData{Type: DataTypeUTF8, Value: []byte(s)})
+}
+
+// numberPair reads the number and total of a trkn or disk value.
+func (m *Metadata) numberPair(typ BoxType) (n, total uint16) {
+	d := m.first(typ)
+	if d == nil || len(d.Value) < 6 {
+		return 0, 0
+	}
+	return be.Uint16(d.Value[2:4]), be.Uint16(d.Value[4:6])
+}
+
+// TrackNumber returns the track number and total track count, zero if
+// absent.
+func (m *Metadata) TrackNumber() (n, total uint16) { return m.numberPair(ItemTrack) }
+
+// SetTrackNumber sets the track number and total; total may be 0.
+func (m *Metadata) SetTrackNumber(n, total uint16) {
+	v := make([]byte, 8)
+	be.PutUint16(v[2:], n)
+	be.PutUint16(v[4:], total)
+	m.set(ItemTrack, MetadataData{Type: DataTypeImplicit, Value: v})
+}
+
+// DiscNumber returns the disc number and total disc count, zero if absent.
+func (m *Metadata) DiscNumber() (n, total uint16) { return m.numberPair(ItemDisc) }
+
+// SetDiscNumber sets the disc number and total; total may be 0.
+func (m *Metadata) SetDiscNumber(n, total uint16) {
+	v := make([]byte, 6)
+	be.PutUint16(v[2:], n)
+	be.PutUint16(v[4:], total)
+	m.set(ItemDisc, MetadataData{Type: DataTypeImplicit, Value: v})
+}
+
+// Tempo returns the tempo in beats per minute, 0 if absent.
+func (m *Metadata) Tempo() uint16 {
+	d := m.first(ItemTempo)
+	if d == nil {
+		return 0
+	}
+	if v, ok := d.Int(); ok {
+		return uint16(v)
+	}
+	if d.Type == DataTypeImplicit && len(d.Value) == 2 {
+		return be.Uint16(d.Value)
+	}
+	return 0
+}
+
+// SetTempo sets the tempo in beats per minute.
+func (m *Metadata) SetTempo(bpm uint16) {
+	v := make([]byte, 2)
+	be.PutUint16(v, bpm)
+	m.set(ItemTempo, MetadataData{Type: DataTypeSignedInt, Value: v})
+}
+
+// Covers returns the cover art images. Each has Type DataTypeJPEG,
+// DataTypePNG or DataTypeBMP.
+func (m *Metadata) Covers() []MetadataData {
+	if it := m.Item(ItemCover); it != nil {
+		return it.Data
+	}
+	return nil
+}
+
+// AddCover appends a cover art image of the given data type.
+func (m *Metadata) AddCover(dataType uint32, image []byte) {
+	d := MetadataData{Type: dataType, Value: image}
+	if it := m.Item(ItemCover); it != nil {
+		it.Data = append(it.Data, d)
+		return
+	}
+	m.Items = append(m.Items, MetadataItem{Type: ItemCover, Data: []MetadataData{d}})
+}
+
+// Freeform returns the freeform item with the given mean and name, or nil.
+func (m *Metadata) Freeform(mean, name string) *MetadataItem {
+	for i := range m.Items {
+		it := &m.Items[i]
+		if it.Type == ItemFreeform && it.Mean == mean && it.Name == name {
+			return it
+		}
+	}
+	return nil
+}
+
+// SetFreeform sets a freeform item to a single UTF-8 value.
+func (m *Metadata) SetFreeform(mean, name, value string) {
+	d := MetadataData{Type: DataTypeUTF8, Value: []byte(value)}
+	if it := m.Freeform(mean, name); it != nil {
+		it.Data = []MetadataData{d}
+		return
+	}
+	m.Items = append(m.Items, MetadataItem{Type: ItemFreeform, Mean: mean, Name: name, Data: []MetadataData{d}})
+}
+
+// keyIndexType returns the item type naming the key at index i of Keys.
+func keyIndexType(i int) BoxType {
+	var t BoxType
+	be.PutUint32(t[:], uint32(i+1))
+	return t
+}
+
+// Keyed returns the item named by the given key of a keys-based
+// Metadata, e.g. KeyLocationISO6709, or nil.
+func (m *Metadata) Keyed(name string) *MetadataItem {
+	for i, k := range m.Keys {
+		if k.Name == name {
+			return m.Item(keyIndexType(i))
+		}
+	}
+	return nil
+}
+
+// SetKeyed sets the item named by the given key to a single value, adding
+// the key in the mdta namespace if it is new. It makes m keys-based: the
+// handler is set to HandlerMdta.
+func (m *Metadata) SetKeyed(name string, d MetadataData) {
+	m.Handler = HandlerMdta
+	for i, k := range m.Keys {
+		if k.Name == name {
+			m.set(keyIndexType(i), d)
+			return
+		}
+	}
+	m.Keys = append(m.Keys, MetadataKey{Namespace: HandlerMdta, Name: name})
+	m.set(keyIndexType(len(m.Keys)-1), d)
+}
+
+// WriteKeys writes a complete keys box.
+func (w *Writer) WriteKeys(keys []MetadataKey) {
+	w.StartFullBox(TypeKeys, 0, 0)
+	w.putUint32(uint32(len(keys)))
+	for _, k := range keys {
+		w.putUint32(uint32(8 + len(k.Name)))
+		w.putBytes(k.Namespace[:])
+		w.putBytes([]byte(k.Name))
+	}
+	w.EndBox()
+}
+
+// WriteIlst writes a complete ilst box.
+func (w *Writer) WriteIlst(m Metadata) {
+	w.StartBox(TypeIlst)
+	for _, it := range m.Items {
+		w.StartBox(it.Type)
+		if it.Type == ItemFreeform {
+			w.StartFullBox(TypeMean, 0, 0)
+			w.putBytes([]byte(it.Mean))
+			w.EndBox()
+			w.StartFullBox(TypeName, 0, 0)
+			w.putBytes([]byte(it.Name))
+			w.EndBox()
+		}
+		for _, d := range it.Data {
+			w.StartBox(TypeData)
+			w.putUint32(d.Type & 0xffffff)
+			w.putUint32(d.Locale)
+			w.putBytes(d.Value)
+			w.EndBox()
+		}
+		w.EndBox()
+	}
+	w.EndBox()
+}
+
+// WriteMeta writes a complete ISO meta box holding the metadata: an hdlr
+// box with m.Handler (mdir if unset), a keys box for keys-based metadata,
+// and the ilst box.
+func (w *Writer) WriteMeta(m Metadata) {
+	w.StartFullBox(TypeMeta, 0, 0)
+	w.writeMetaChildren(m)
+	w.EndBox()
+}
+
+// WriteQuickTimeMeta writes a complete meta box in the QuickTime form,
+// without version and flags, as used for keys-based metadata in moov of
+// QuickTime movies. The children are as for WriteMeta.
+func (w *Writer) WriteQuickTimeMeta(m Metadata) {
+	w.StartBox(TypeMeta)
+	w.writeMetaChildren(m)
+	w.EndBox()
+}
+
+func (w *Writer) writeMetaChildren(m Metadata) {
+	handler := m.Handler
+	if handler == [4]byte{} {
+		handler = HandlerMdir
+	}
+	w.WriteHdlr(handler, "")
+	if handler == HandlerMdta {
+		w.WriteKeys(m.Keys)
+	}
+	w.WriteIlst(m)
+}
+
+// WriteMetadata writes a complete udta box holding only a meta box with
+// iTunes metadata, for placement in moov. To combine the metadata with
+// other user data, such as a chpl box, write the udta box directly and
+// call WriteMeta within it.
+func (w *Writer) WriteMetadata(m Metadata) {
+	w.StartBox(TypeUdta)
+	w.WriteMeta(m)
+	w.EndBox()
+}
@@ -0,0 +1,151 @@
+package mp4_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tetsuo/mp4"
+)
+
+func TestIlstRoundTrip(t *testing.T) {
+	var m mp4.Metadata
+	m.SetText(mp4.ItemTitle, "Song")
+	m.SetText(mp4.ItemArtist, "Band")
+	m.SetText(mp4.ItemTitle, "Song (Remix)")
+	m.SetTrackNumber(3, 12)
+	m.SetDiscNumber(1, 2)
+	m.SetTempo(120)
+	m.AddCover(mp4.DataTypeJPEG, []byte{0xff, 0xd8, 0xff})
+	m.AddCover(mp4.DataTypePNG, []byte{0x89, 'P', 'N', 'G'})
+	m.SetFreeform("com.apple.iTunes", "iTunNORM", " 0000 0001")
+
+	r := writeBox(t, func(w *mp4.Writer) { w.WriteMeta(m) })
+	if r.Type() != mp4.TypeMeta || !r.IsFullBox() {
+		t.Fatalf("got %v, want an ISO meta box", r.Type())
+	}
+	got, err := mp4.ReadMeta(r.Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Handler = mp4.HandlerMdir
+	if !reflect.DeepEqual(got, m) {
+		t.Errorf("got %+v, want %+v", got, m)
+	}
+
+	if s := got.Text(mp4.ItemTitle); s != "Song (Remix)" {
+		t.Errorf("title = %q", s)
+	}
+	if n, total := got.TrackNumber(); n != 3 || total != 12 {
+		t.Errorf("track number = %d/%d, want 3/12", n, total)
+	}
+	if n, total := got.DiscNumber(); n != 1 || total != 2 {
+		t.Errorf("disc number = %d/%d, want 1/2", n, total)
+	}
+	if bpm := got.Tempo(); bpm != 120 {
+		t.Errorf("tempo = %d, want 120", bpm)
+	}
+	if covers := got.Covers(); len(covers) != 2 || covers[1].Type != mp4.DataTypePNG {
+		t.Errorf("covers = %+v", covers)
+	}
+	if it := got.Freeform("com.apple.iTunes", "iTunNORM"); it == nil || it.Data[0].Text() != " 0000 0001" {
+		t.Errorf("freeform item = %+v", it)
+	}
+
+	got.Remove(mp4.ItemCover)
+	if got.Covers() != nil || got.Text(mp4.ItemArtist) != "Band" {
+		t.Errorf("after Remove: %+v", got.Items)
+	}
+}
+
+func TestMetadataData(t *testing.T) {
+	utf16 := mp4.MetadataData{Type: mp4.DataTypeUTF16, Value: []byte{0, 'h', 0, 0xe9, 0xd8, 0x3d, 0xde, 0x00}}
+	if s := utf16.Text(); s != "hé😀" {
+		t.Errorf("UTF-16 text = %q", s)
+	}
+	if s := (&mp4.MetadataData{Type: mp4.DataTypeJPEG, Value: []byte("x")}).Text(); s != "" {
+		t.Errorf("JPEG text = %q, want empty", s)
+	}
+
+	ints := []struct {
+		d    mp4.MetadataData
+		want int64
+		ok   bool
+	}{
+		{mp4.MetadataData{Type: mp4.DataTypeSignedInt, Value: []byte{0xff, 0xfe}}, -2, true},
+		{mp4.MetadataData{Type: mp4.DataTypeSignedInt, Value: []byte{0x80, 0, 0}}, -1 << 23, true},
+		{mp4.MetadataData{Type: mp4.DataTypeUnsignedInt, Value: []byte{0xff, 0xfe}}, 0xfffe, true},
+		{mp4.MetadataData{Type: mp4.DataTypeUnsignedInt, Value: []byte{0, 0, 0, 0, 1}}, 0, false},
+		{mp4.MetadataData{Type: mp4.DataTypeUTF8, Value: []byte{1}}, 0, false},
+	}
+	for _, tt := range ints {
+		if v, ok := tt.d.Int(); v != tt.want || ok != tt.ok {
+			t.Errorf("Int(% x) = %d, %v, want %d, %v", tt.d.Value, v, ok, tt.want, tt.ok)
+		}
+	}
+
+	f32 := mp4.MetadataData{Type: mp4.DataTypeFloat32, Value: []byte{0x3f, 0xc0, 0, 0}}
+	if v, ok := f32.Float(); v != 1.5 || !ok {
+		t.Errorf("Float32 = %v, %v, want 1.5", v, ok)
+	}
+	f64 := mp4.MetadataData{Type: mp4.DataTypeFloat64, Value: []byte{0xc0, 0, 0, 0, 0, 0, 0, 0}}
+	if v, ok := f64.Float(); v != -2 || !ok {
+		t.Errorf("Float64 = %v, %v, want -2", v, ok)
+	}
+}
+
+func TestKeysRoundTrip(t *testing.T) {
+	want := []mp4.MetadataKey{
+		{Namespace: mp4.HandlerMdta, Name: mp4.KeyMake},
+		{Namespace: [4]byte{'u', 'd', 't', 'a'}, Name: "\xa9xyz"},
+	}
+	r := writeBox(t, func(w *mp4.Writer) { w.WriteKeys(want) })
+	keys, err := mp4.ReadKeys(r.Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("got %+v, want %+v", keys, want)
+	}
+	if _, err := mp4.ReadKeys(r.Data()[:len(r.Data())-1]); err != mp4.ErrTruncated {
+		t.Errorf("truncated: err = %v, want %v", err, mp4.ErrTruncated)
+	}
+}
+
+func TestQuickTimeMetaRoundTrip(t *testing.T) {
+	var m mp4.Metadata
+	m.SetKeyed(mp4.KeyMake, mp4.MetadataData{Type: mp4.DataTypeUTF8, Value: []byte("Apple")})
+	m.SetKeyed(mp4.KeyLocationISO6709, mp4.MetadataData{Type: mp4.DataTypeUTF8, Value: []byte("+37.3349-122.0090+010.000/")})
+	m.SetKeyed(mp4.KeyMake, mp4.MetadataData{Type: mp4.DataTypeUTF8, Value: []byte("Camera Co")})
+	if m.Handler != mp4.HandlerMdta || len(m.Keys) != 2 || len(m.Items) != 2 {
+		t.Fatalf("SetKeyed: %+v", m)
+	}
+	if typ := m.Items[1].Type; typ != (mp4.BoxType{0, 0, 0, 2}) {
+		t.Errorf("second item type = % x, want the key index 2", typ[:])
+	}
+
+	for _, qt := range []bool{true, false} {
+		r := writeBox(t, func(w *mp4.Writer) {
+			if qt {
+				w.WriteQuickTimeMeta(m)
+			} else {
+				w.WriteMeta(m)
+			}
+		})
+		if r.IsFullBox() == qt {
+			t.Errorf("QuickTime form %v: full box %v", qt, r.IsFullBox())
+		}
+		got, err := mp4.ReadMeta(r.Data())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, m) {
+			t.Errorf("QuickTime form %v: got %+v, want %+v", qt, got, m)
+		}
+		if it := got.Keyed(mp4.KeyMake); it == nil || it.Data[0].Text() != "Camera Co" {
+			t.Errorf("QuickTime form %v: make = %+v", qt, it)
+		}
+		if it := got.Keyed(mp4.KeyModel); it != nil {
+			t.Errorf("QuickTime form %v: model = %+v, want nil", qt, it)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package mp4
+
+import "errors"
+
+// ErrInvalidMPEGAudioHeader is returned when data does not start with a
+// valid MPEG audio frame header.
+var ErrInvalidMPEGAudioHeader = errors.New("mp4: invalid MPEG audio frame header")
+
+// MPEGAudioHeader holds the fields of an MPEG-1/2 audio frame header, as
+// found at the start of each MP3 sample. Sample entries of MP3 tracks
+// often leave the audio parameters unset, so they are read from here.
+type MPEGAudioHeader struct {
+	Version         uint8  // 1 for MPEG-1, 2 for MPEG-2, 25 for MPEG-2.5
+	Layer           uint8  // 1, 2 or 3
+	Bitrate         uint32 // in bits per second
+	SampleRate      uint32 // in Hz
+	Channels        uint16
+	Padding         bool
+	SamplesPerFrame uint32
+	FrameSize       uint32 // in bytes, including the header
+}
+
+var (
+	mpegAudioBitrates = [2][3][15]uint16{
+		{ // MPEG-1, layers 1 to 3
+			{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+			{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+		},
+		{ // MPEG-2 and 2.5, layers 1 to 3
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		},
+	}
+	mpegAudioSampleRates = [3]uint32{44100, 48000, 32000} // MPEG-1
+)
+
+// ReadMPEGAudioHeader parses the 4-byte frame header at the start of data.
+// Free-format frames (bitrate index 0) report a zero Bitrate and
+// FrameSize.
+func ReadMPEGAudioHeader(data []byte) (MPEGAudioHeader, error) {
+	var h MPEGAudioHeader
+	if len(data) < 4 {
+		return h, ErrTruncated
+	}
+	if data[0] != 0xff || data[1]&0xe0 != 0xe0 {
+		return h, ErrInvalidMPEGAudioHeader
+	}
+	versionBits := data[1] >> 3 & 0x03
+	layerBits := data[1] >> 1 & 0x03
+	bitrateIdx := data[2] >> 4
+	rateIdx := data[2] >> 2 & 0x03
+	if versionBits == 1 || layerBits == 0 || bitrateIdx == 15 || rateIdx == 3 {
+		return h, ErrInvalidMPEGAudioHeader
+	}
+
+	lsf := 1 // low sampling frequency table index
+	switch versionBits {
+	case 3:
+		h.Version = 1
+		lsf = 0
+		h.SampleRate = mpegAudioSampleRates[rateIdx]
+	case 2:
+		h.Version = 2
+		h.SampleRate = mpegAudioSampleRates[rateIdx] / 2
+	default:
+		h.Version = 25
+		h.SampleRate = mpegAudioSampleRates[rateIdx] / 4
+	}
+	h.Layer = 4 - layerBits
+	h.Bitrate = uint32(mpegAudioBitrates[lsf][h.Layer-1][bitrateIdx]) * 1000
+	h.Padding = data[2]&0x02 != 0
+	h.Channels = 2
+	if data[3]>>6 == 3 {
+		h.Channels = 1
+	}
+
+	switch {
+	case h.Layer == 1:
+		h.SamplesPerFrame = 384
+	case h.Layer == 3 && lsf == 1:
+		h.SamplesPerFrame = 576
+	default:
+		h.SamplesPerFrame = 1152
+	}
+	if h.Bitrate != 0 {
+		var pad uint32
+		if h.Padding {
+			pad = 1
+		}
+		if h.Layer == 1 {
+			h.FrameSize = (12*h.Bitrate/h.SampleRate + pad) * 4
+		} else {
+			h.FrameSize = h.SamplesPerFrame/8*h.Bitrate/h.SampleRate + pad
+		}
+	}
+	return h, nil
+}
@@ -0,0 +1,57 @@
+package mp4
+
+// MHAConfig holds a parsed mhaC box, the MPEG-H 3D Audio decoder
+// configuration record (ISO/IEC 23008-3).
+type MHAConfig struct {
+	ConfigurationVersion   uint8
+	ProfileLevelIndication uint8
+	ReferenceChannelLayout uint8  // ISO/IEC 23091-3 ChannelConfiguration
+	Config                 []byte // mpegh3daConfig; points into the original buffer when read
+}
+
+// ReadMhaC parses mhaC box data.
+func ReadMhaC(data []byte) (MHAConfig, error) {
+	var c MHAConfig
+	if len(data) < 5 {
+		return c, ErrTruncated
+	}
+	c.ConfigurationVersion = data[0]
+	c.ProfileLevelIndication = data[1]
+	c.ReferenceChannelLayout = data[2]
+	n := int(be.Uint16(data[3:5]))
+	if 5+n > len(data) {
+		return c, ErrTruncated
+	}
+	c.Config = data[5 : 5+n]
+	return c, nil
+}
+
+// Codec returns the RFC 6381 codec string suffix after the sample entry
+// type, the profile-level indication as in "0x0D".
+func (c *MHAConfig) Codec() string {
+	const upperHex = "0123456789ABCDEF"
+	pli := c.ProfileLevelIndication
+	return string([]byte{'0', 'x', upperHex[pli>>4], upperHex[pli&0x0f]})
+}
+
+// Channels returns the number of channels of the reference channel
+// layout, or 0 if it is not a known ChannelConfiguration.
+func (c *MHAConfig) Channels() int {
+	return DefinedLayoutChannels(c.ReferenceChannelLayout)
+}
+
+// WriteMhaC writes a complete mhaC box. A zero configuration version is
+// written as 1.
+func (w *Writer) WriteMhaC(c MHAConfig) {
+	version := c.ConfigurationVersion
+	if version == 0 {
+		version = 1
+	}
+	w.StartBox(TypeMhaC)
+	w.putUint8(version)
+	w.putUint8(c.ProfileLevelIndication)
+	w.putUint8(c.ReferenceChannelLayout)
+	w.putUint16(uint16(len(c.Config)))
+	w.putBytes(c.Config)
+	w.EndBox()
+}
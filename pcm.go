@@ -0,0 +1,58 @@
+package mp4
+
+// PCMConfig holds a parsed pcmC box (ISO/IEC 23003-5), the configuration of
+// ipcm (integer) and fpcm (floating point) sample entries.
+type PCMConfig struct {
+	LittleEndian bool
+	SampleSize   uint8 // bits per sample
+}
+
+// ReadPcmC parses pcmC box data (after version+flags).
+func ReadPcmC(data []byte) (PCMConfig, error) {
+	if len(data) < 2 {
+		return PCMConfig{}, ErrTruncated
+	}
+	return PCMConfig{
+		LittleEndian: data[0]&0x01 != 0,
+		SampleSize:   data[1],
+	}, nil
+}
+
+// WritePcmC writes a complete pcmC box.
+func (w *Writer) WritePcmC(c PCMConfig) {
+	w.StartFullBox(TypePcmC, 0, 0)
+	if c.LittleEndian {
+		w.putUint8(0x01)
+	} else {
+		w.putUint8(0)
+	}
+	w.putUint8(c.SampleSize)
+	w.EndBox()
+}
+
+// ReadSrat parses srat box data (after version+flags), the sample rate of
+// ISO version 1 audio sample entries whose rate does not fit 16.16.
+func ReadSrat(data []byte) (uint32, error) {
+	if len(data) < 4 {
+		return 0, ErrTruncated
+	}
+	return be.Uint32(data), nil
+}
+
+// WriteSrat writes a complete srat box.
+func (w *Writer) WriteSrat(sampleRate uint32) {
+	w.StartFullBox(TypeSrat, 0, 0)
+	w.putUint32(sampleRate)
+	w.EndBox()
+}
+
+// LPCM format flags carried in FormatSpecificFlags of QuickTime version 2
+// lpcm sound sample descriptions.
+const (
+	LPCMFlagFloat          = 1 << 0
+	LPCMFlagBigEndian      = 1 << 1
+	LPCMFlagSignedInteger  = 1 << 2
+	LPCMFlagPacked         = 1 << 3
+	LPCMFlagAlignedHigh    = 1 << 4
+	LPCMFlagNonInterleaved = 1 << 5
+)
@@ -0,0 +1,88 @@
+package mp4_test
+
+import (
+	"testing"
+
+	"github.com/tetsuo/mp4"
+)
+
+func TestPcmCRoundTrip(t *testing.T) {
+	for _, want := range []mp4.PCMConfig{{LittleEndian: true, SampleSize: 24}, {SampleSize: 16}} {
+		r := writeBox(t, func(w *mp4.Writer) { w.WritePcmC(want) })
+		c, err := mp4.ReadPcmC(r.Data())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c != want {
+			t.Errorf("got %+v, want %+v", c, want)
+		}
+	}
+
+	r := writeBox(t, func(w *mp4.Writer) { w.WriteSrat(192000) })
+	if rate, err := mp4.ReadSrat(r.Data()); err != nil || rate != 192000 {
+		t.Errorf("srat = %d, %v, want 192000", rate, err)
+	}
+}
+
+// soundEntry returns the data of an audio sample entry written by write.
+func soundEntry(t *testing.T, write func(w *mp4.Writer)) []byte {
+	t.Helper()
+	r := writeBox(t, func(w *mp4.Writer) {
+		w.StartBox(mp4.TypeLpcm)
+		write(w)
+		w.EndBox()
+	})
+	return r.Data()
+}
+
+func TestAudioSampleEntryV2(t *testing.T) {
+	data := soundEntry(t, func(w *mp4.Writer) {
+		w.WriteAudioSampleEntryV2(1, 6, 96000, 24, mp4.LPCMFlagSignedInteger|mp4.LPCMFlagPacked, 18, 1)
+		w.WriteSrat(48000) // a child box, to check ChildOffset
+	})
+	a := mp4.ReadAudioSampleEntry(data)
+	want := mp4.AudioSampleEntry{
+		DataReferenceIndex:            1,
+		Version:                       2,
+		ChannelCount:                  6,
+		SampleSize:                    24,
+		ChildOffset:                   64,
+		SampleRate64:                  96000,
+		FormatSpecificFlags:           mp4.LPCMFlagSignedInteger | mp4.LPCMFlagPacked,
+		ConstBytesPerAudioPacket:      18,
+		ConstLPCMFramesPerAudioPacket: 1,
+	}
+	if a != want {
+		t.Errorf("got %+v, want %+v", a, want)
+	}
+	if a.Rate() != 96000 {
+		t.Errorf("rate = %d, want 96000", a.Rate())
+	}
+}
+
+func TestAudioSampleEntryV1(t *testing.T) {
+	// QuickTime version 1: the packet fields follow the 28-byte header.
+	data := soundEntry(t, func(w *mp4.Writer) {
+		w.WriteAudioSampleEntry(1, 2, 16, 44100<<16)
+		w.Write([]byte{0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 4, 0, 0, 0, 2})
+	})
+	data[9] = 1
+	a := mp4.ReadAudioSampleEntry(data)
+	if a.Version != 1 || a.ChildOffset != 44 || a.SamplesPerPacket != 1 || a.BytesPerPacket != 2 ||
+		a.BytesPerFrame != 4 || a.BytesPerSample != 2 || a.Rate() != 44100 {
+		t.Errorf("QuickTime version 1: got %+v", a)
+	}
+
+	// ISO version 1: the header keeps the version 0 layout and a child box
+	// follows.
+	data = soundEntry(t, func(w *mp4.Writer) {
+		w.WriteAudioSampleEntry(1, 2, 16, 0)
+		w.WriteSrat(192000)
+		w.WritePcmC(mp4.PCMConfig{SampleSize: 16})
+	})
+	data[9] = 1
+	a = mp4.ReadAudioSampleEntry(data)
+	if a.Version != 1 || a.ChildOffset != 28 || a.BytesPerFrame != 0 {
+		t.Errorf("ISO version 1: got %+v", a)
+	}
+}
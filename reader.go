@@ -1,5 +1,11 @@
 package mp4
 
+import "errors"
+
+// ErrTruncated is returned by box parsers when the box data is shorter than
+// its syntax requires.
+var ErrTruncated = errors.New("mp4: truncated box data")
+
 // maxDepth limits the reader/writer nesting stack.
 const maxDepth = 16
 
@@ -64,6 +70,7 @@ type Reader struct {
 	dataStart int
 
 	// Full box fields
+	fullBox bool
 	version uint8
 	flags   uint32
 
@@ -118,7 +125,11 @@ func (r *Reader) Next() bool {
 	}
 
 	// Parse full box header if applicable
-	if IsFullBox(r.boxType) {
+	r.fullBox = IsFullBox(r.boxType)
+	if r.boxType == TypeMeta && isQuickTimeMeta(r.buf[ptr:r.boxEnd]) {
+		r.fullBox = false
+	}
+	if r.fullBox {
 		if r.boxEnd-ptr < 4 {
 			return false
 		}
@@ -135,12 +146,24 @@ func (r *Reader) Next() bool {
 	return true
 }
 
+// isQuickTimeMeta reports whether meta box data starts with the hdlr box
+// directly, as in QuickTime files, rather than after version and flags as
+// in ISO files.
+func isQuickTimeMeta(data []byte) bool {
+	return len(data) >= 8 && BoxType(data[4:8]) == TypeHdlr
+}
+
 // Type returns the current box's type.
 func (r *Reader) Type() BoxType { return r.boxType }
 
 // Size returns the current box's total size including header.
 func (r *Reader) Size() uint64 { return r.boxSize }
 
+// IsFullBox reports whether the current box has version and flags fields.
+// It differs from the package-level IsFullBox for meta boxes, which are
+// full boxes in ISO files but plain containers in QuickTime files.
+func (r *Reader) IsFullBox() bool { return r.fullBox }
+
 // Version returns the version field for full boxes.
 func (r *Reader) Version() uint8 { return r.version }
 
@@ -258,6 +281,16 @@ func (r *Reader) ReadTkhd() (trackId uint32, duration uint64, width, height uint
 	return
 }
 
+// ReadTkhdAlternateGroup extracts the alternate group from a tkhd box, 0 if
+// the track is not in one.
+func (r *Reader) ReadTkhdAlternateGroup() int16 {
+	data := r.Data()
+	if r.Version() == 1 {
+		return int16(be.Uint16(data[42:44]))
+	}
+	return int16(be.Uint16(data[30:32]))
+}
+
 // ReadMdhd extracts key fields from an mdhd box.
 // Returns timescale, duration, and language code.
 func (r *Reader) ReadMdhd() (timescale uint32, duration uint64, language uint16) {
@@ -0,0 +1,743 @@
+package mp4
+
+import (
+	"errors"
+	"math/bits"
+)
+
+var (
+	// ErrUnknownParameterSet is returned for a slice that refers to a
+	// parameter set the SliceHeaderParser has not been given.
+	ErrUnknownParameterSet = errors.New("mp4: slice refers to an unknown parameter set")
+
+	// ErrUnsupportedSlice is returned for slices using syntax the
+	// SliceHeaderParser does not decode: H.264 data partitioning and
+	// H.265 multi-layer, 3D and screen content coding extensions.
+	ErrUnsupportedSlice = errors.New("mp4: unsupported slice syntax")
+)
+
+// H.264 NAL unit types.
+const (
+	AVCNALSlice    = 1
+	AVCNALSliceIDR = 5
+	AVCNALSPS      = 7
+	AVCNALPPS      = 8
+)
+
+// avcPPS holds the fields of an H.264 picture parameter set the slice
+// header syntax depends on.
+type avcPPS struct {
+	spsID                  uint32
+	cabac                  bool // entropy_coding_mode_flag
+	bottomFieldPicOrder    bool
+	numSliceGroups         uint32
+	sliceGroupMapType      uint32
+	sliceGroupChangeRate   uint32
+	numRefIdxDefault       [2]uint32
+	weightedPred           bool
+	weightedBipredIdc      uint32
+	deblockingControl      bool
+	redundantPicCntPresent bool
+}
+
+// hevcPPS holds the fields of an H.265 picture parameter set the slice
+// segment header syntax depends on.
+type hevcPPS struct {
+	spsID                   uint32
+	dependentSlices         bool
+	outputFlagPresent       bool
+	numExtraSliceHeaderBits int
+	cabacInitPresent        bool
+	numRefIdxDefault        [2]uint32
+	sliceChromaQPOffsets    bool
+	weightedPred            bool
+	weightedBipred          bool
+	tiles                   bool
+	entropyCodingSync       bool
+	loopFilterAcrossSlices  bool
+	deblockingOverride      bool
+	deblockingDisabled      bool
+	listsModification       bool
+	sliceHeaderExtension    bool
+	chromaQPOffsetList      bool
+}
+
+// SliceHeaderParser finds where the slice header of an H.264 or H.265
+// coded slice NAL unit ends, which Common Encryption needs because slice
+// headers must stay clear. Slice headers can only be parsed with the
+// parameter sets they refer to, which the parser collects from the
+// decoder configuration record and from AddParameterSet. A
+// SliceHeaderParser is not safe for concurrent use.
+type SliceHeaderParser struct {
+	hevc    bool
+	buf     []byte // unescaped slice, reused across calls
+	avcSPS  map[uint32]*AVCSPS
+	avcPPS  map[uint32]*avcPPS
+	hevcSPS map[uint32]*HEVCSPS
+	hevcPPS map[uint32]*hevcPPS
+}
+
+// NewAVCSliceHeaderParser returns a SliceHeaderParser for the H.264 stream
+// described by c. Parameter sets of c that fail to parse are skipped.
+func NewAVCSliceHeaderParser(c *AVCConfig) *SliceHeaderParser {
+	p := &SliceHeaderParser{
+		avcSPS: make(map[uint32]*AVCSPS),
+		avcPPS: make(map[uint32]*avcPPS),
+	}
+	for _, nal := range c.SPS {
+		p.AddParameterSet(nal)
+	}
+	for _, nal := range c.PPS {
+		p.AddParameterSet(nal)
+	}
+	return p
+}
+
+// NewHEVCSliceHeaderParser returns a SliceHeaderParser for the H.265
+// stream described by c. Parameter sets of c that fail to parse are
+// skipped.
+func NewHEVCSliceHeaderParser(c *HEVCConfig) *SliceHeaderParser {
+	p := &SliceHeaderParser{
+		hevc:    true,
+		hevcSPS: make(map[uint32]*HEVCSPS),
+		hevcPPS: make(map[uint32]*hevcPPS),
+	}
+	for _, a := range c.Arrays {
+		for _, nal := range a.NALUnits {
+			p.AddParameterSet(nal)
+		}
+	}
+	return p
+}
+
+// AddParameterSet parses an SPS or PPS NAL unit, such as one carried in
+// band, replacing any earlier one with the same ID. Other NAL units are
+// ignored.
+func (p *SliceHeaderParser) AddParameterSet(nal []byte) error {
+	if len(nal) == 0 {
+		return ErrTruncated
+	}
+	if p.hevc {
+		switch nal[0] >> 1 & 0x3f {
+		case HEVCNALSPS:
+			s, err := ReadHEVCSPS(nal)
+			if err != nil {
+				return err
+			}
+			p.hevcSPS[s.ID] = &s
+		case HEVCNALPPS:
+			id, pps, err := readHEVCPPS(nal)
+			if err != nil {
+				return err
+			}
+			p.hevcPPS[id] = pps
+		}
+		return nil
+	}
+	switch nal[0] & 0x1f {
+	case AVCNALSPS:
+		s, err := ReadAVCSPS(nal)
+		if err != nil {
+			return err
+		}
+		p.avcSPS[s.ID] = &s
+	case AVCNALPPS:
+		id, pps, err := readAVCPPS(nal)
+		if err != nil {
+			return err
+		}
+		p.avcPPS[id] = pps
+	}
+	return nil
+}
+
+// HeaderSize returns the size of the slice header of a coded slice NAL
+// unit: the number of bytes from the start of nal, NAL unit header and
+// emulation prevention bytes included, up to and including the byte in
+// which the slice header ends.
+func (p *SliceHeaderParser) HeaderSize(nal []byte) (int, error) {
+	headerSize := 1
+	if p.hevc {
+		headerSize = 2
+	}
+	if len(nal) <= headerSize {
+		return 0, ErrTruncated
+	}
+	p.buf = UnescapeRBSP(p.buf[:0], nal[headerSize:])
+	br := NewBitReader(p.buf)
+	var n int
+	var err error
+	if p.hevc {
+		n, err = p.hevcHeaderBits(&br, nal)
+	} else {
+		n, err = p.avcHeaderBits(&br, nal[0])
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err := br.Err(); err != nil {
+		return 0, err
+	}
+	return headerSize + escapedSize(nal[headerSize:], (n+7)/8), nil
+}
+
+// escapedSize returns how many bytes of nal hold the first n bytes of its
+// raw byte sequence payload.
+func escapedSize(nal []byte, n int) int {
+	zeros := 0
+	for i, c := range nal {
+		if n == 0 {
+			return i
+		}
+		if zeros >= 2 && c == 3 {
+			zeros = 0
+			continue
+		}
+		if c == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		n--
+	}
+	return len(nal)
+}
+
+// ceilLog2 returns Ceil(Log2(n)) for n >= 1, the width of fields coding
+// an index below n.
+func ceilLog2(n uint32) int {
+	if n == 0 {
+		return 0
+	}
+	return bits.Len32(n - 1)
+}
+
+// readAVCPPS parses the leading fields of an H.264 PPS NAL unit, up to
+// redundant_pic_cnt_present_flag.
+func readAVCPPS(nal []byte) (uint32, *avcPPS, error) {
+	rbsp := UnescapeRBSP(make([]byte, 0, len(nal)), nal[1:])
+	br := NewBitReader(rbsp)
+	var p avcPPS
+	id := br.ReadUE()
+	p.spsID = br.ReadUE()
+	p.cabac = br.ReadFlag()
+	p.bottomFieldPicOrder = br.ReadFlag()
+	p.numSliceGroups = br.ReadUE() + 1
+	if p.numSliceGroups > 8 {
+		return 0, nil, ErrInvalidParameterSet
+	}
+	if p.numSliceGroups > 1 {
+		p.sliceGroupMapType = br.ReadUE()
+		switch p.sliceGroupMapType {
+		case 0:
+			for range p.numSliceGroups {
+				br.ReadUE() // run_length_minus1
+			}
+		case 2:
+			for range p.numSliceGroups - 1 {
+				br.ReadUE() // top_left
+				br.ReadUE() // bottom_right
+			}
+		case 3, 4, 5:
+			br.Skip(1) // slice_group_change_direction_flag
+			p.sliceGroupChangeRate = br.ReadUE() + 1
+		case 6:
+			n := br.ReadUE() + 1 // pic_size_in_map_units_minus1
+			if int64(n)*int64(ceilLog2(p.numSliceGroups)) > int64(br.BitsLeft()) {
+				return 0, nil, ErrTruncated
+			}
+			br.Skip(int(n) * ceilLog2(p.numSliceGroups)) // slice_group_id
+		}
+	}
+	p.numRefIdxDefault[0] = br.ReadUE() + 1
+	p.numRefIdxDefault[1] = br.ReadUE() + 1
+	p.weightedPred = br.ReadFlag()
+	p.weightedBipredIdc = br.ReadBits(2)
+	br.ReadSE() // pic_init_qp_minus26
+	br.ReadSE() // pic_init_qs_minus26
+	br.ReadSE() // chroma_qp_index_offset
+	p.deblockingControl = br.ReadFlag()
+	br.Skip(1) // constrained_intra_pred_flag
+	p.redundantPicCntPresent = br.ReadFlag()
+	if err := br.Err(); err != nil {
+		return 0, nil, err
+	}
+	if p.numRefIdxDefault[0] > 32 || p.numRefIdxDefault[1] > 32 {
+		return 0, nil, ErrInvalidParameterSet
+	}
+	return id, &p, nil
+}
+
+// avcHeaderBits reads an H.264 slice_header() and returns its size in
+// bits. nalHeader is the first byte of the NAL unit.
+func (p *SliceHeaderParser) avcHeaderBits(br *BitReader, nalHeader byte) (int, error) {
+	nalType := nalHeader & 0x1f
+	if nalType != AVCNALSlice && nalType != AVCNALSliceIDR {
+		return 0, ErrUnsupportedSlice
+	}
+	br.ReadUE() // first_mb_in_slice
+	sliceType := br.ReadUE() % 5
+	pps, ok := p.avcPPS[br.ReadUE()]
+	if !ok {
+		return 0, ErrUnknownParameterSet
+	}
+	sps, ok := p.avcSPS[pps.spsID]
+	if !ok {
+		return 0, ErrUnknownParameterSet
+	}
+	const (
+		sliceP  = 0
+		sliceB  = 1
+		sliceI  = 2
+		sliceSP = 3
+		sliceSI = 4
+	)
+
+	if sps.SeparateColorPlane {
+		br.Skip(2) // colour_plane_id
+	}
+	br.Skip(int(sps.Log2MaxFrameNum)) // frame_num
+	fieldPic := false
+	if !sps.FrameMbsOnly {
+		fieldPic = br.ReadFlag()
+		if fieldPic {
+			br.Skip(1) // bottom_field_flag
+		}
+	}
+	if nalType == AVCNALSliceIDR {
+		br.ReadUE() // idr_pic_id
+	}
+	switch {
+	case sps.PicOrderCntType == 0:
+		br.Skip(int(sps.Log2MaxPicOrderCntLsb)) // pic_order_cnt_lsb
+		if pps.bottomFieldPicOrder && !fieldPic {
+			br.ReadSE() // delta_pic_order_cnt_bottom
+		}
+	case sps.PicOrderCntType == 1 && !sps.deltaPicOrderAlwaysZero:
+		br.ReadSE() // delta_pic_order_cnt[0]
+		if pps.bottomFieldPicOrder && !fieldPic {
+			br.ReadSE() // delta_pic_order_cnt[1]
+		}
+	}
+	if pps.redundantPicCntPresent {
+		br.ReadUE() // redundant_pic_cnt
+	}
+	if sliceType == sliceB {
+		br.Skip(1) // direct_spatial_mv_pred_flag
+	}
+	numRefIdx := pps.numRefIdxDefault
+	if sliceType == sliceP || sliceType == sliceSP || sliceType == sliceB {
+		if br.ReadFlag() { // num_ref_idx_active_override_flag
+			numRefIdx[0] = br.ReadUE() + 1
+			if sliceType == sliceB {
+				numRefIdx[1] = br.ReadUE() + 1
+			}
+		}
+	}
+	if numRefIdx[0] > 32 || numRefIdx[1] > 32 {
+		return 0, ErrInvalidParameterSet
+	}
+	numLists := 0
+	switch sliceType {
+	case sliceP, sliceSP:
+		numLists = 1
+	case sliceB:
+		numLists = 2
+	}
+
+	// ref_pic_list_modification()
+	for range numLists {
+		if !br.ReadFlag() { // ref_pic_list_modification_flag_lX
+			continue
+		}
+		for br.Err() == nil {
+			idc := br.ReadUE() // modification_of_pic_nums_idc
+			if idc == 3 {
+				break
+			}
+			br.ReadUE() // abs_diff_pic_num_minus1 or long_term_pic_num
+		}
+	}
+
+	if pps.weightedPred && (sliceType == sliceP || sliceType == sliceSP) ||
+		pps.weightedBipredIdc == 1 && sliceType == sliceB {
+		// pred_weight_table()
+		chroma := !sps.SeparateColorPlane && sps.ChromaFormat != 0
+		br.ReadUE() // luma_log2_weight_denom
+		if chroma {
+			br.ReadUE() // chroma_log2_weight_denom
+		}
+		for l := range numLists {
+			for range numRefIdx[l] {
+				if br.ReadFlag() { // luma_weight_lX_flag
+					br.ReadSE() // luma_weight_lX
+					br.ReadSE() // luma_offset_lX
+				}
+				if chroma && br.ReadFlag() { // chroma_weight_lX_flag
+					for range 4 {
+						br.ReadSE() // chroma_weight_lX, chroma_offset_lX
+					}
+				}
+			}
+		}
+	}
+
+	if nalHeader&0x60 != 0 { // nal_ref_idc
+		// dec_ref_pic_marking()
+		if nalType == AVCNALSliceIDR {
+			br.Skip(2) // no_output_of_prior_pics_flag, long_term_reference_flag
+		} else if br.ReadFlag() { // adaptive_ref_pic_marking_mode_flag
+			// memory_management_control_operation
+			for op := br.ReadUE(); op != 0 && br.Err() == nil; op = br.ReadUE() {
+				switch op {
+				case 3:
+					br.ReadUE() // difference_of_pic_nums_minus1
+					br.ReadUE() // long_term_frame_idx
+				case 1, 2, 4, 6:
+					br.ReadUE() // difference_of_pic_nums_minus1, long_term_pic_num, max_long_term_frame_idx_plus1 or long_term_frame_idx
+				}
+			}
+		}
+	}
+	if pps.cabac && sliceType != sliceI && sliceType != sliceSI {
+		br.ReadUE() // cabac_init_idc
+	}
+	br.ReadSE() // slice_qp_delta
+	if sliceType == sliceSP || sliceType == sliceSI {
+		if sliceType == sliceSP {
+			br.Skip(1) // sp_for_switch_flag
+		}
+		br.ReadSE() // slice_qs_delta
+	}
+	if pps.deblockingControl {
+		if br.ReadUE() != 1 { // disable_deblocking_filter_idc
+			br.ReadSE() // slice_alpha_c0_offset_div2
+			br.ReadSE() // slice_beta_offset_div2
+		}
+	}
+	if pps.numSliceGroups > 1 && pps.sliceGroupMapType >= 3 && pps.sliceGroupMapType <= 5 {
+		frameHeightFactor := uint32(2)
+		if sps.FrameMbsOnly {
+			frameHeightFactor = 1
+		}
+		picSize := sps.CodedWidth / 16 * (sps.CodedHeight / 16 / frameHeightFactor)
+		// Ceil(Log2(PicSizeInMapUnits ÷ SliceGroupChangeRate + 1))
+		n := 0
+		for uint64(pps.sliceGroupChangeRate)<<n < uint64(picSize)+uint64(pps.sliceGroupChangeRate) {
+			n++
+		}
+		br.Skip(n) // slice_group_change_cycle
+	}
+	return br.Pos(), nil
+}
+
+// readHEVCPPS parses an H.265 PPS NAL unit.
+func readHEVCPPS(nal []byte) (uint32, *hevcPPS, error) {
+	if len(nal) < 3 {
+		return 0, nil, ErrTruncated
+	}
+	rbsp := UnescapeRBSP(make([]byte, 0, len(nal)), nal[2:])
+	br := NewBitReader(rbsp)
+	var p hevcPPS
+	id := br.ReadUE()
+	p.spsID = br.ReadUE()
+	p.dependentSlices = br.ReadFlag()
+	p.outputFlagPresent = br.ReadFlag()
+	p.numExtraSliceHeaderBits = int(br.ReadBits(3))
+	br.Skip(1) // sign_data_hiding_enabled_flag
+	p.cabacInitPresent = br.ReadFlag()
+	p.numRefIdxDefault[0] = br.ReadUE() + 1
+	p.numRefIdxDefault[1] = br.ReadUE() + 1
+	br.ReadSE() // init_qp_minus26
+	br.Skip(1)  // constrained_intra_pred_flag
+	transformSkip := br.ReadFlag()
+	if br.ReadFlag() { // cu_qp_delta_enabled_flag
+		br.ReadUE() // diff_cu_qp_delta_depth
+	}
+	br.ReadSE() // pps_cb_qp_offset
+	br.ReadSE() // pps_cr_qp_offset
+	p.sliceChromaQPOffsets = br.ReadFlag()
+	p.weightedPred = br.ReadFlag()
+	p.weightedBipred = br.ReadFlag()
+	br.Skip(1) // transquant_bypass_enabled_flag
+	p.tiles = br.ReadFlag()
+	p.entropyCodingSync = br.ReadFlag()
+	if p.tiles {
+		cols := br.ReadUE() + 1
+		rows := br.ReadUE() + 1
+		if cols > 64 || rows > 64 {
+			return 0, nil, ErrInvalidParameterSet
+		}
+		if !br.ReadFlag() { // uniform_spacing_flag
+			for range cols + rows - 2 {
+				br.ReadUE() // column_width_minus1, row_height_minus1
+			}
+		}
+		br.Skip(1) // loop_filter_across_tiles_enabled_flag
+	}
+	p.loopFilterAcrossSlices = br.ReadFlag()
+	if br.ReadFlag() { // deblocking_filter_control_present_flag
+		p.deblockingOverride = br.ReadFlag()
+		p.deblockingDisabled = br.ReadFlag()
+		if !p.deblockingDisabled {
+			br.ReadSE() // pps_beta_offset_div2
+			br.ReadSE() // pps_tc_offset_div2
+		}
+	}
+	if br.ReadFlag() { // pps_scaling_list_data_present_flag
+		skipHEVCScalingListData(&br)
+	}
+	p.listsModification = br.ReadFlag()
+	br.ReadUE() // log2_parallel_merge_level_minus2
+	p.sliceHeaderExtension = br.ReadFlag()
+	if br.ReadFlag() { // pps_extension_present_flag
+		rangeExt := br.ReadFlag()
+		if br.ReadBits(3) != 0 { // multilayer, 3d and scc extension flags
+			return 0, nil, ErrUnsupportedSlice
+		}
+		br.Skip(4) // pps_extension_4bits
+		if rangeExt {
+			if transformSkip {
+				br.ReadUE() // log2_max_transform_skip_block_size_minus2
+			}
+			br.Skip(1) // cross_component_prediction_enabled_flag
+			p.chromaQPOffsetList = br.ReadFlag()
+		}
+	}
+	if err := br.Err(); err != nil {
+		return 0, nil, err
+	}
+	if p.numRefIdxDefault[0] > 15 || p.numRefIdxDefault[1] > 15 {
+		return 0, nil, ErrInvalidParameterSet
+	}
+	return id, &p, nil
+}
+
+// hevcHeaderBits reads an H.265 slice_segment_header() up to and
+// including its byte_alignment() and returns its size in bits.
+func (p *SliceHeaderParser) hevcHeaderBits(br *BitReader, nal []byte) (int, error) {
+	nalType := nal[0] >> 1 & 0x3f
+	if nalType >= 32 {
+		return 0, ErrUnsupportedSlice
+	}
+	if nal[0]&1 != 0 || nal[1]>>3 != 0 { // nuh_layer_id
+		return 0, ErrUnsupportedSlice
+	}
+	const (
+		sliceB = 0
+		sliceP = 1
+		sliceI = 2
+
+		nalBLAWLP  = 16
+		nalIDRWRAD = 19
+		nalIDRNLP  = 20
+		nalIRAPMax = 23
+	)
+
+	first := br.ReadFlag() // first_slice_segment_in_pic_flag
+	if nalType >= nalBLAWLP && nalType <= nalIRAPMax {
+		br.Skip(1) // no_output_of_prior_pics_flag
+	}
+	pps, ok := p.hevcPPS[br.ReadUE()]
+	if !ok {
+		return 0, ErrUnknownParameterSet
+	}
+	sps, ok := p.hevcSPS[pps.spsID]
+	if !ok {
+		return 0, ErrUnknownParameterSet
+	}
+
+	dependent := false
+	if !first {
+		if pps.dependentSlices {
+			dependent = br.ReadFlag()
+		}
+		ctbSize := uint32(1) << sps.ctbLog2Size
+		widthCtbs := (sps.CodedWidth + ctbSize - 1) / ctbSize
+		heightCtbs := (sps.CodedHeight + ctbSize - 1) / ctbSize
+		br.Skip(ceilLog2(widthCtbs * heightCtbs)) // slice_segment_address
+	}
+	if !dependent {
+		br.Skip(pps.numExtraSliceHeaderBits) // slice_reserved_flag
+		sliceType := br.ReadUE()
+		if pps.outputFlagPresent {
+			br.Skip(1) // pic_output_flag
+		}
+		if sps.SeparateColorPlane {
+			br.Skip(2) // colour_plane_id
+		}
+		numPicTotalCurr := 0
+		temporalMVP := false
+		if nalType != nalIDRWRAD && nalType != nalIDRNLP {
+			br.Skip(int(sps.Log2MaxPicOrderCntLsb)) // slice_pic_order_cnt_lsb
+			numSets := len(sps.stRpsUsed)
+			if !br.ReadFlag() { // short_term_ref_pic_set_sps_flag
+				_, used := skipStRefPicSet(br, numSets, numSets, sps.stRpsDeltaPocs)
+				numPicTotalCurr += used
+			} else {
+				idx := 0
+				if numSets > 1 {
+					idx = int(br.ReadBits(ceilLog2(uint32(numSets)))) // short_term_ref_pic_set_idx
+				}
+				if idx >= numSets {
+					return 0, ErrInvalidParameterSet
+				}
+				numPicTotalCurr += sps.stRpsUsed[idx]
+			}
+			if sps.longTermRefs {
+				var numLtSPS uint32
+				if len(sps.ltUsed) > 0 {
+					numLtSPS = br.ReadUE() // num_long_term_sps
+				}
+				numLt := numLtSPS + br.ReadUE() // num_long_term_pics
+				if numLtSPS > uint32(len(sps.ltUsed)) || numLt > 32 {
+					return 0, ErrInvalidParameterSet
+				}
+				for i := range numLt {
+					if i < numLtSPS {
+						idx := 0
+						if len(sps.ltUsed) > 1 {
+							idx = int(br.ReadBits(ceilLog2(uint32(len(sps.ltUsed))))) // lt_idx_sps
+						}
+						if idx >= len(sps.ltUsed) {
+							return 0, ErrInvalidParameterSet
+						}
+						if sps.ltUsed[idx] {
+							numPicTotalCurr++
+						}
+					} else {
+						br.Skip(int(sps.Log2MaxPicOrderCntLsb)) // poc_lsb_lt
+						if br.ReadFlag() {                      // used_by_curr_pic_lt_flag
+							numPicTotalCurr++
+						}
+					}
+					if br.ReadFlag() { // delta_poc_msb_present_flag
+						br.ReadUE() // delta_poc_msb_cycle_lt
+					}
+				}
+			}
+			if sps.temporalMVP {
+				temporalMVP = br.ReadFlag() // slice_temporal_mvp_enabled_flag
+			}
+		}
+		saoLuma, saoChroma := false, false
+		chroma := !sps.SeparateColorPlane && sps.ChromaFormat != 0
+		if sps.sao {
+			saoLuma = br.ReadFlag()
+			if chroma {
+				saoChroma = br.ReadFlag()
+			}
+		}
+		if sliceType == sliceP || sliceType == sliceB {
+			numRefIdx := pps.numRefIdxDefault
+			if br.ReadFlag() { // num_ref_idx_active_override_flag
+				numRefIdx[0] = br.ReadUE() + 1
+				if sliceType == sliceB {
+					numRefIdx[1] = br.ReadUE() + 1
+				}
+			}
+			if numRefIdx[0] > 15 || numRefIdx[1] > 15 {
+				return 0, ErrInvalidParameterSet
+			}
+			numLists := 1
+			if sliceType == sliceB {
+				numLists = 2
+			}
+			if pps.listsModification && numPicTotalCurr > 1 {
+				// ref_pic_lists_modification()
+				for l := range numLists {
+					if br.ReadFlag() { // ref_pic_list_modification_flag_lX
+						br.Skip(int(numRefIdx[l]) * ceilLog2(uint32(numPicTotalCurr))) // list_entry_lX
+					}
+				}
+			}
+			if sliceType == sliceB {
+				br.Skip(1) // mvd_l1_zero_flag
+			}
+			if pps.cabacInitPresent {
+				br.Skip(1) // cabac_init_flag
+			}
+			if temporalMVP {
+				fromL0 := true
+				if sliceType == sliceB {
+					fromL0 = br.ReadFlag() // collocated_from_l0_flag
+				}
+				if fromL0 && numRefIdx[0] > 1 || !fromL0 && numRefIdx[1] > 1 {
+					br.ReadUE() // collocated_ref_idx
+				}
+			}
+			if pps.weightedPred && sliceType == sliceP || pps.weightedBipred && sliceType == sliceB {
+				// pred_weight_table()
+				br.ReadUE() // luma_log2_weight_denom
+				if chroma {
+					br.ReadSE() // delta_chroma_log2_weight_denom
+				}
+				for l := range numLists {
+					n := int(numRefIdx[l])
+					luma := br.ReadBits(n) // luma_weight_lX_flag
+					var chromaFlags uint32
+					if chroma {
+						chromaFlags = br.ReadBits(n) // chroma_weight_lX_flag
+					}
+					for i := range n {
+						bit := uint32(1) << (n - 1 - i)
+						if luma&bit != 0 {
+							br.ReadSE() // delta_luma_weight_lX
+							br.ReadSE() // luma_offset_lX
+						}
+						if chromaFlags&bit != 0 {
+							for range 4 {
+								br.ReadSE() // delta_chroma_weight_lX, delta_chroma_offset_lX
+							}
+						}
+					}
+				}
+			}
+			br.ReadUE() // five_minus_max_num_merge_cand
+		}
+		br.ReadSE() // slice_qp_delta
+		if pps.sliceChromaQPOffsets {
+			br.ReadSE() // slice_cb_qp_offset
+			br.ReadSE() // slice_cr_qp_offset
+		}
+		if pps.chromaQPOffsetList {
+			br.Skip(1) // cu_chroma_qp_offset_enabled_flag
+		}
+		override := false
+		if pps.deblockingOverride {
+			override = br.ReadFlag() // deblocking_filter_override_flag
+		}
+		deblockingDisabled := pps.deblockingDisabled
+		if override {
+			deblockingDisabled = br.ReadFlag() // slice_deblocking_filter_disabled_flag
+			if !deblockingDisabled {
+				br.ReadSE() // slice_beta_offset_div2
+				br.ReadSE() // slice_tc_offset_div2
+			}
+		}
+		if pps.loopFilterAcrossSlices && (saoLuma || saoChroma || !deblockingDisabled) {
+			br.Skip(1) // slice_loop_filter_across_slices_enabled_flag
+		}
+	}
+	if pps.tiles || pps.entropyCodingSync {
+		n := br.ReadUE() // num_entry_point_offsets
+		if n > 0 {
+			size := int(br.ReadUE()) + 1 // offset_len_minus1
+			if size > 32 || int64(n)*int64(size) > int64(br.BitsLeft()) {
+				return 0, ErrInvalidParameterSet
+			}
+			br.Skip(int(n) * size) // entry_point_offset_minus1
+		}
+	}
+	if pps.sliceHeaderExtension {
+		n := br.ReadUE() // slice_segment_header_extension_length
+		if n > 256 {
+			return 0, ErrInvalidParameterSet
+		}
+		br.Skip(int(n) * 8)
+	}
+	// byte_alignment(): a one bit, then zero bits up to a byte boundary.
+	br.Skip(1)
+	br.ByteAlign()
+	return br.Pos(), nil
+}
@@ -0,0 +1,108 @@
+package mp4_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tetsuo/mp4"
+)
+
+// sliceData stands in for the coded macroblocks or CTUs after a slice
+// header.
+var sliceData = strings.Repeat("10101010", 40)
+
+func TestAVCSliceHeaderSize(t *testing.T) {
+	c := mp4.AVCConfig{
+		NALLengthSize: 4,
+		SPS:           [][]byte{testSPS},
+		// x264: CABAC, three default references, weighted P prediction,
+		// deblocking filter control.
+		PPS: [][]byte{{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0}},
+	}
+	p := mp4.NewAVCSliceHeaderParser(&c)
+
+	tests := []struct {
+		name string
+		nal  []byte
+		want int
+	}{
+		{
+			// The 16 zero bits of the idr_pic_id prefix need an emulation
+			// prevention byte inside the header.
+			name: "IDR",
+			nal: nalUnit([]byte{0x65},
+				"1 0001000 1 0000"+ // first_mb_in_slice, slice_type I, pps_id, frame_num
+					"00000000000000001 0000000000000000"+ // idr_pic_id 65535
+					"000000 0 0 1 1 1 1"+ // pic_order_cnt_lsb, dec_ref_pic_marking, slice_qp_delta, deblocking
+					"111111"+ // cabac_alignment_one_bit
+					sliceData),
+			want: 1 + 9,
+		},
+		{
+			name: "P with weighted prediction",
+			nal: nalUnit([]byte{0x41},
+				"1 00110 1 0001 000010"+ // first_mb_in_slice, slice_type P, pps_id, frame_num, pic_order_cnt_lsb
+					"1 1 0"+ // num_ref_idx_active_override_flag, one reference, no list modification
+					"1 1 1 010 1 0"+ // pred_weight_table
+					"0 1 00101 1 1 1"+ // dec_ref_pic_marking, cabac_init_idc, slice_qp_delta, deblocking
+					"11"+ // cabac_alignment_one_bit
+					sliceData),
+			want: 1 + 5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.HeaderSize(tt.nal)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("header size = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := p.HeaderSize([]byte{0x65, 0xb4, 0x80}); err != mp4.ErrUnknownParameterSet {
+		t.Errorf("unknown PPS: err = %v, want %v", err, mp4.ErrUnknownParameterSet)
+	}
+}
+
+func TestHEVCSliceHeaderSize(t *testing.T) {
+	sps := nalUnit([]byte{0x42, 0x01},
+		"0000 000 1"+ // sps_video_parameter_set_id, sps_max_sub_layers_minus1, temporal_id_nesting
+			"00 0 00001 01100000000000000000000000000000 1001"+ // Main profile
+			"00000000000000000000000000000000000000000000 01011101"+ // level 3.1
+			"1 010 000000010000001 0000001000001 0"+ // sps_id, 4:2:0, 128x64, no conformance window
+			"1 1 00101 1 1 1 1"+ // bit depths, log2_max_pic_order_cnt_lsb 8, ordering info
+			"1 010 1 010 1 1 0"+ // 8x8 to 16x16 coding blocks, transform blocks, no scaling list
+			"1 1 0"+ // amp, sample_adaptive_offset, no pcm
+			"011 010 1 1 1"+ // two short-term sets; the first has one picture in use
+			"0 011 1 1 1 1 1"+ // the second has two, explicitly coded
+			"0 1 1 0 0"+ // no long-term pictures, temporal mvp, strong intra smoothing, no vui or extension
+			"1")
+	pps := nalUnit([]byte{0x44, 0x01},
+		"1 1 0 0 000 0 1 1 1 1 0 0 0 1 1 0 0 0 0"+ // cabac_init_present, one reference by default
+			"0 1 1 0 0 0 1 0 0"+ // entropy_coding_sync, loop filter across slices
+			"1")
+	c := mp4.HEVCConfig{NALLengthSize: 4, Arrays: []mp4.HEVCNALArray{
+		{NALUnitType: mp4.HEVCNALSPS, NALUnits: [][]byte{sps}},
+		{NALUnitType: mp4.HEVCNALPPS, NALUnits: [][]byte{pps}},
+	}}
+	p := mp4.NewHEVCSliceHeaderParser(&c)
+
+	slice := nalUnit([]byte{0x02, 0x01},
+		"0 1 00011 010 00000100"+ // not first, pps_id, slice_segment_address 3, slice_type P, pic_order_cnt_lsb
+			"1 1 1 1 0"+ // the second short-term set, temporal mvp, sao luma but not chroma
+			"1 010 0 010 1"+ // two references, cabac_init_flag, collocated_ref_idx, max merge candidates
+			"011 1"+ // slice_qp_delta, slice_loop_filter_across_slices_enabled_flag
+			"011 0001000 00010000 00100000"+ // two 8-bit entry point offsets
+			"10"+ // byte_alignment
+			sliceData)
+	got, err := p.HeaderSize(slice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 2+8 {
+		t.Errorf("header size = %d, want %d", got, 2+8)
+	}
+}
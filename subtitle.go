@@ -0,0 +1,168 @@
+package mp4
+
+import "bytes"
+
+// WVTTSampleEntry holds a parsed wvtt (WebVTT) sample entry.
+type WVTTSampleEntry struct {
+	DataReferenceIndex uint16
+	Config             string // vttC: the WebVTT file header, e.g. "WEBVTT"
+	Label              string // vlab: source label, "" if absent
+	ChildOffset        int    // byte offset within data where child boxes begin
+}
+
+// ReadWVTTSampleEntry parses wvtt sample entry box data.
+func ReadWVTTSampleEntry(data []byte) (WVTTSampleEntry, error) {
+	if len(data) < 8 {
+		return WVTTSampleEntry{}, ErrTruncated
+	}
+	e := WVTTSampleEntry{
+		DataReferenceIndex: be.Uint16(data[6:8]),
+		ChildOffset:        8,
+	}
+	r := NewReader(data[e.ChildOffset:])
+	for r.Next() {
+		switch r.Type() {
+		case TypeVttC:
+			e.Config = string(r.Data())
+		case TypeVlab:
+			e.Label = string(r.Data())
+		}
+	}
+	return e, nil
+}
+
+// XMLSubtitleSampleEntry holds a parsed stpp (XML subtitle, e.g. TTML)
+// sample entry.
+type XMLSubtitleSampleEntry struct {
+	DataReferenceIndex uint16
+	Namespace          string // space-separated XML namespaces, e.g. "http://www.w3.org/ns/ttml"
+	SchemaLocation     string // space-separated schema URLs, "" if absent
+	AuxiliaryMIMETypes string // MIME types of images or fonts used, "" if absent
+	ChildOffset        int    // byte offset within data where child boxes begin
+}
+
+// ReadXMLSubtitleSampleEntry parses stpp sample entry box data.
+func ReadXMLSubtitleSampleEntry(data []byte) (XMLSubtitleSampleEntry, error) {
+	if len(data) < 8 {
+		return XMLSubtitleSampleEntry{}, ErrTruncated
+	}
+	e := XMLSubtitleSampleEntry{DataReferenceIndex: be.Uint16(data[6:8])}
+	ptr := 8
+	var ok bool
+	if e.Namespace, ptr, ok = readCString(data, ptr); !ok {
+		return e, ErrTruncated
+	}
+	// Both remaining strings are optional; some muxers omit them entirely.
+	if s, next, ok := readCString(data, ptr); ok {
+		e.SchemaLocation, ptr = s, next
+		if s, next, ok := readCString(data, ptr); ok {
+			e.AuxiliaryMIMETypes, ptr = s, next
+		}
+	}
+	e.ChildOffset = ptr
+	return e, nil
+}
+
+// readCString reads a null-terminated string starting at ptr and returns it
+// with the offset after the terminator.
+func readCString(data []byte, ptr int) (string, int, bool) {
+	if ptr >= len(data) {
+		return "", ptr, false
+	}
+	n := bytes.IndexByte(data[ptr:], 0)
+	if n < 0 {
+		return "", ptr, false
+	}
+	return string(data[ptr : ptr+n]), ptr + n + 1, true
+}
+
+// VTTCue is one cue carried in a wvtt sample as a vttc box.
+type VTTCue struct {
+	ID       string // iden, "" if absent
+	Settings string // sttg, e.g. "align:start line:0", "" if absent
+	Payload  string // payl, the cue text
+}
+
+// ReadVTTSample parses the cues in a wvtt sample. A sample holding only a
+// vtte box marks a gap and yields no cues; vtta comment boxes are skipped.
+func ReadVTTSample(data []byte) []VTTCue {
+	var cues []VTTCue
+	r := NewReader(data)
+	for r.Next() {
+		if r.Type() != TypeVttc {
+			continue
+		}
+		var c VTTCue
+		r.Enter()
+		for r.Next() {
+			switch r.Type() {
+			case TypeIden:
+				c.ID = string(r.Data())
+			case TypeSttg:
+				c.Settings = string(r.Data())
+			case TypePayl:
+				c.Payload = string(r.Data())
+			}
+		}
+		r.Exit()
+		cues = append(cues, c)
+	}
+	return cues
+}
+
+// WriteWVTTSampleEntry writes a complete wvtt sample entry box with its
+// vttC box and, if label is non-empty, a vlab box.
+func (w *Writer) WriteWVTTSampleEntry(dataRefIdx uint16, config, label string) {
+	w.StartBox(TypeWvtt)
+	w.putZeros(6)
+	w.putUint16(dataRefIdx)
+	w.StartBox(TypeVttC)
+	w.putBytes([]byte(config))
+	w.EndBox()
+	if label != "" {
+		w.StartBox(TypeVlab)
+		w.putBytes([]byte(label))
+		w.EndBox()
+	}
+	w.EndBox()
+}
+
+// WriteXMLSubtitleSampleEntry writes a complete stpp sample entry box.
+func (w *Writer) WriteXMLSubtitleSampleEntry(e XMLSubtitleSampleEntry) {
+	w.StartBox(TypeStpp)
+	w.putZeros(6)
+	w.putUint16(e.DataReferenceIndex)
+	w.putBytes([]byte(e.Namespace))
+	w.putUint8(0)
+	w.putBytes([]byte(e.SchemaLocation))
+	w.putUint8(0)
+	w.putBytes([]byte(e.AuxiliaryMIMETypes))
+	w.putUint8(0)
+	w.EndBox()
+}
+
+// WriteVTTCue writes a vttc box for one cue, as part of a wvtt sample.
+func (w *Writer) WriteVTTCue(c VTTCue) {
+	w.StartBox(TypeVttc)
+	if c.ID != "" {
+		w.StartBox(TypeIden)
+		w.putBytes([]byte(c.ID))
+		w.EndBox()
+	}
+	if c.Settings != "" {
+		w.StartBox(TypeSttg)
+		w.putBytes([]byte(c.Settings))
+		w.EndBox()
+	}
+	w.StartBox(TypePayl)
+	w.putBytes([]byte(c.Payload))
+	w.EndBox()
+	w.EndBox()
+}
+
+// WriteVTTEmpty writes a vtte box, the whole content of a wvtt sample that
+// covers a gap between cues.
+func (w *Writer) WriteVTTEmpty() {
+	w.StartBox(TypeVtte)
+	w.EndBox()
+}
@@ -0,0 +1,65 @@
+package mp4_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tetsuo/mp4"
+)
+
+func TestWVTTSampleEntryRoundTrip(t *testing.T) {
+	r := writeBox(t, func(w *mp4.Writer) { w.WriteWVTTSampleEntry(1, "WEBVTT\n\nSTYLE\n::cue { color: red }", "English") })
+	if r.Type() != mp4.TypeWvtt {
+		t.Fatalf("type = %v, want wvtt", r.Type())
+	}
+	e, err := mp4.ReadWVTTSampleEntry(r.Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := mp4.WVTTSampleEntry{
+		DataReferenceIndex: 1,
+		Config:             "WEBVTT\n\nSTYLE\n::cue { color: red }",
+		Label:              "English",
+		ChildOffset:        8,
+	}
+	if e != want {
+		t.Errorf("got %+v, want %+v", e, want)
+	}
+}
+
+func TestXMLSubtitleSampleEntryRoundTrip(t *testing.T) {
+	want := mp4.XMLSubtitleSampleEntry{
+		DataReferenceIndex: 1,
+		Namespace:          "http://www.w3.org/ns/ttml",
+		AuxiliaryMIMETypes: "image/png",
+	}
+	r := writeBox(t, func(w *mp4.Writer) { w.WriteXMLSubtitleSampleEntry(want) })
+	e, err := mp4.ReadXMLSubtitleSampleEntry(r.Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want.ChildOffset = 8 + len(want.Namespace) + 1 + 1 + len(want.AuxiliaryMIMETypes) + 1
+	if e != want {
+		t.Errorf("got %+v, want %+v", e, want)
+	}
+}
+
+func TestVTTSampleRoundTrip(t *testing.T) {
+	cues := []mp4.VTTCue{
+		{ID: "1", Settings: "align:start line:0", Payload: "Hello"},
+		{Payload: "<v Bob>World"},
+	}
+	w := mp4.NewWriter(make([]byte, 256))
+	for _, c := range cues {
+		w.WriteVTTCue(c)
+	}
+	if got := mp4.ReadVTTSample(w.Bytes()); !reflect.DeepEqual(got, cues) {
+		t.Errorf("got %+v, want %+v", got, cues)
+	}
+
+	w.Reset()
+	w.WriteVTTEmpty()
+	if got := mp4.ReadVTTSample(w.Bytes()); got != nil {
+		t.Errorf("empty sample: got %+v, want no cues", got)
+	}
+}
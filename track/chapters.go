@@ -0,0 +1,190 @@
+package track
+
+import (
+	"io"
+	"time"
+
+	"github.com/tetsuo/mp4"
+)
+
+// Chapter is a titled time range on the movie timeline.
+type Chapter struct {
+	Title string
+	Start time.Duration
+	End   time.Duration
+}
+
+// Chapters returns the chapters of a movie. QuickTime chapter tracks,
+// referenced from another track with a chap track reference, are preferred;
+// otherwise the Nero chpl box in moov/udta is used. The moov buffer is as
+// for ParseTracks, and file holds the data the chapter track's sample
+// offsets refer to. Returns nil if the movie has no chapters.
+func Chapters(moov []byte, file io.ReaderAt) ([]Chapter, error) {
+	tracks, _, err := ParseTracks(moov)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tracks {
+		for _, ct := range t.ReferencedTracks(tracks, mp4.TypeChap) {
+			if _, ok := ct.Entry.(*SubtitleEntry); ok && ct.Entry.Type() == mp4.TypeTx3g {
+				return readChapterTrack(ct, file)
+			}
+		}
+	}
+	return readNeroChapters(moov)
+}
+
+// readChapterTrack reads one chapter per sample of a tx3g track.
+func readChapterTrack(t *Track, file io.ReaderAt) ([]Chapter, error) {
+	if t.TimeScale == 0 {
+		return nil, ErrInvalidTrack
+	}
+	chapters := make([]Chapter, 0, len(t.Samples))
+	var buf []byte
+	for _, s := range t.Samples {
+		if cap(buf) < int(s.Size) {
+			buf = make([]byte, s.Size)
+		}
+		buf = buf[:s.Size]
+		if n, err := file.ReadAt(buf, s.Offset); n < len(buf) {
+			return chapters, err
+		}
+		ts, err := mp4.ReadTextSample(buf)
+		if err != nil {
+			return chapters, err
+		}
+		chapters = append(chapters, Chapter{
+			Title: ts.Text,
+			Start: TicksToDuration(s.PTS(), t.TimeScale),
+			End:   TicksToDuration(s.PTS()+int64(s.Duration), t.TimeScale),
+		})
+	}
+	return chapters, nil
+}
+
+// readNeroChapters reads moov/udta/chpl. Each chapter ends where the next
+// one starts, and the last one at the end of the movie.
+func readNeroChapters(moov []byte) ([]Chapter, error) {
+	mr := mp4.NewReader(moov)
+	if !mr.Next() || mr.Type() != mp4.TypeMoov {
+		return nil, ErrMoovNotFound
+	}
+	var end time.Duration
+	var nero []mp4.NeroChapter
+	var err error
+	mr.Enter()
+	for mr.Next() {
+		switch mr.Type() {
+		case mp4.TypeMvhd:
+			ts, dur, _ := mr.ReadMvhd()
+			if ts != 0 {
+				end = TicksToDuration(int64(dur), ts)
+			}
+		case mp4.TypeUdta:
+			mr.Enter()
+			for mr.Next() {
+				if mr.Type() == mp4.TypeChpl {
+					nero, err = mp4.ReadChpl(mr.Data(), mr.Version())
+				}
+			}
+			mr.Exit()
+		}
+	}
+	mr.Exit()
+	if err != nil {
+		return nil, err
+	}
+
+	chapters := make([]Chapter, len(nero))
+	for i, c := range nero {
+		chapters[i] = Chapter{
+			Title: c.Title,
+			Start: time.Duration(c.Start) * 100,
+			End:   end,
+		}
+		if i > 0 {
+			chapters[i-1].End = chapters[i].Start
+		}
+	}
+	if len(chapters) == 0 {
+		return nil, nil
+	}
+	return chapters, nil
+}
+
+// chapterTimescale is the media timescale of written chapter tracks.
+const chapterTimescale = 1000
+
+// AppendChapterSamples appends the tx3g samples for a chapter track written
+// by WriteChapterTrak, one per chapter, and returns the extended buffer.
+func AppendChapterSamples(dst []byte, chapters []Chapter) []byte {
+	for _, c := range chapters {
+		w := mp4.NewWriter(make([]byte, 2+len(c.Title)))
+		w.WriteTextSample(mp4.TextSample{Text: c.Title})
+		dst = append(dst, w.Bytes()...)
+	}
+	return dst
+}
+
+// WriteChapterTrak writes a trak box for a tx3g chapter track. The samples
+// produced by AppendChapterSamples for the same chapters must be stored
+// as a single chunk at chunkOffset. Chapters must be in order; gaps are
+// absorbed by the preceding chapter. The track is disabled so players do
+// not render it as subtitles; reference it from the main track with a chap
+// track reference, written by mp4.Writer.WriteTref. Nothing is written if
+// chapters is empty, since a track without samples cannot describe its
+// chunk.
+func WriteChapterTrak(w *mp4.Writer, trackID, movieTimescale uint32, chapters []Chapter, chunkOffset uint64) {
+	if len(chapters) == 0 {
+		return
+	}
+	toMedia := func(d time.Duration) uint64 {
+		return uint64(d / (time.Second / chapterTimescale))
+	}
+	stts := make([]mp4.SttsEntry, len(chapters))
+	sizes := make([]uint32, len(chapters))
+	var duration uint64
+	for i, c := range chapters {
+		end := c.End
+		if i+1 < len(chapters) {
+			end = chapters[i+1].Start
+		}
+		d := toMedia(end) - min(toMedia(c.Start), toMedia(end))
+		if i == 0 {
+			// The first sample starts at zero, so it covers any lead-in.
+			d = toMedia(end)
+		}
+		stts[i] = mp4.SttsEntry{Count: 1, Duration: uint32(d)}
+		sizes[i] = uint32(len(AppendChapterSamples(nil, chapters[i:i+1])))
+		duration += d
+	}
+
+	w.StartBox(mp4.TypeTrak)
+	w.WriteTkhd(0, trackID, duration*uint64(movieTimescale)/chapterTimescale, 0, 0)
+	w.StartBox(mp4.TypeMdia)
+	w.WriteMdhd(chapterTimescale, duration, 0x55c4) // "und"
+	w.WriteHdlr(htText, "Chapters")
+	w.StartBox(mp4.TypeMinf)
+	w.StartFullBox(mp4.TypeNmhd, 0, 0)
+	w.EndBox()
+	w.StartBox(mp4.TypeDinf)
+	w.WriteDref()
+	w.EndBox()
+	w.StartBox(mp4.TypeStbl)
+	w.StartFullBox(mp4.TypeStsd, 0, 0)
+	w.Write([]byte{0, 0, 0, 1})
+	w.WriteTextSampleEntry(mp4.TextSampleEntry{DataReferenceIndex: 1})
+	w.EndBox()
+	w.WriteStts(stts)
+	w.WriteStsc([]mp4.StscEntry{{FirstChunk: 1, SamplesPerChunk: uint32(len(chapters)), SampleDescriptionId: 1}})
+	w.WriteStsz(0, sizes)
+	if chunkOffset > 0xffffffff {
+		w.WriteCo64([]uint64{chunkOffset})
+	} else {
+		w.WriteStco([]uint32{uint32(chunkOffset)})
+	}
+	w.EndBox()
+	w.EndBox()
+	w.EndBox()
+	w.EndBox()
+}
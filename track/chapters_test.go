@@ -0,0 +1,123 @@
+package track_test
+
+import (
+	"bytes"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tetsuo/mp4"
+	"github.com/tetsuo/mp4/internal/mp4test"
+	"github.com/tetsuo/mp4/track"
+)
+
+// videoTrack is a one-second video track for movies that need a main
+// track.
+func videoTrack(extra func(w *mp4.Writer)) mp4test.Track {
+	return mp4test.Track{
+		ID: 1, Handler: mp4test.Video, TimeScale: 1000, Width: 640, Height: 360,
+		Entry:    mp4test.VisualEntry(mp4.BoxType{'a', 'v', 'c', '1'}, 640, 360, nil),
+		Samples:  [][]byte{{0, 0, 0, 0}},
+		Duration: 1000,
+		Extra:    extra,
+	}
+}
+
+func TestChapterTrack(t *testing.T) {
+	chapters := []track.Chapter{
+		{Title: "Opening", Start: 0, End: 1500 * time.Millisecond},
+		{Title: "Middle", Start: 1500 * time.Millisecond, End: 4 * time.Second},
+		// Too long for a tx3g sample, so cut before the last rune.
+		{Title: "a" + strings.Repeat("€", 0x5555), Start: 4 * time.Second, End: 5 * time.Second},
+	}
+	// The chapter samples are appended after the mdat box, so the movie
+	// is built once to find their offset.
+	build := func(offset uint64) []byte {
+		m := mp4test.Movie{
+			TimeScale: 600,
+			Tracks: []mp4test.Track{videoTrack(func(w *mp4.Writer) {
+				w.StartBox(mp4.TypeTref)
+				w.StartBox(mp4.TypeChap)
+				w.Write([]byte{0, 0, 0, 2})
+				w.EndBox()
+				w.EndBox()
+			})},
+			Extra: func(w *mp4.Writer) { track.WriteChapterTrak(w, 2, 600, chapters, offset) },
+		}
+		return m.Build()
+	}
+	file := build(0)
+	file = build(uint64(len(file)))
+	file = track.AppendChapterSamples(file, chapters)
+
+	got, err := track.Chapters(mp4test.Moov(file), bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := slices.Clone(chapters)
+	want[2].Title = "a" + strings.Repeat("€", 0x5554)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestNeroChapters(t *testing.T) {
+	m := mp4test.Movie{
+		TimeScale: 1000,
+		Tracks:    []mp4test.Track{videoTrack(nil)},
+		Extra: func(w *mp4.Writer) {
+			w.StartBox(mp4.TypeUdta)
+			w.WriteChpl([]mp4.NeroChapter{{Start: 0, Title: "One"}, {Start: 4_000_000, Title: "Two"}})
+			w.EndBox()
+		},
+	}
+	file := m.Build()
+	got, err := track.Chapters(mp4test.Moov(file), bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []track.Chapter{
+		{Title: "One", Start: 0, End: 400 * time.Millisecond},
+		{Title: "Two", Start: 400 * time.Millisecond, End: time.Second},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestNeroChaptersLongMovie(t *testing.T) {
+	// 2e10 ticks at 90 kHz overflow uint64 nanoseconds if the movie
+	// duration is scaled in one multiplication.
+	long := videoTrack(nil)
+	long.TimeScale = 90000
+	long.Samples = [][]byte{{0}, {0}, {0}, {0}, {0}}
+	long.Duration = 4000000000
+	m := mp4test.Movie{
+		TimeScale: 90000,
+		Tracks:    []mp4test.Track{long},
+		Extra: func(w *mp4.Writer) {
+			w.StartBox(mp4.TypeUdta)
+			w.WriteChpl([]mp4.NeroChapter{{Start: 0, Title: "One"}})
+			w.EndBox()
+		},
+	}
+	file := m.Build()
+	got, err := track.Chapters(mp4test.Moov(file), bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []track.Chapter{{Title: "One", Start: 0, End: 222222*time.Second + 222222222}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestWriteChapterTrakEmpty(t *testing.T) {
+	w := mp4.NewWriter(make([]byte, 1024))
+	track.WriteChapterTrak(&w, 2, 600, nil, 0)
+	if w.Len() != 0 {
+		t.Errorf("wrote %d bytes for no chapters, want 0", w.Len())
+	}
+}
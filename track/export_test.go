@@ -0,0 +1,4 @@
+package track
+
+// EntryDecoders exposes the sample entry registry so tests can restore it.
+var EntryDecoders = entryDecoders
@@ -0,0 +1,130 @@
+package track
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/tetsuo/mp4"
+)
+
+// sampleIsNonSync is the sample_is_non_sync_sample bit of trex, tfhd and
+// trun sample flags.
+const sampleIsNonSync = 0x00010000
+
+// TrackFragment is one traf box of a moof with its samples located.
+type TrackFragment struct {
+	Header  mp4.TrackFragmentHeader
+	Samples []Sample
+	Runs    []TrackRun // one per trun box, in order
+}
+
+// TrackRun is the span of the samples of one trun box.
+type TrackRun struct {
+	Offset int64 // file offset of the run's sample data
+	Count  int   // number of samples
+}
+
+// ParseFragment appends the samples of a moof box to the Samples of the
+// tracks they belong to. The moof buffer must include the box header, and
+// moofOffset is its offset in the file, which sample offsets are based on.
+//
+// Sample durations, sizes and flags not given in trun come from tfhd, then
+// from the track's trex box. Decode times start at the tfdt of each track
+// fragment, or else continue from the track's last sample. Track fragments
+// of tracks not in tracks are skipped.
+func ParseFragment(moof []byte, moofOffset int64, tracks []*Track) error {
+	frags, err := ReadFragment(moof, moofOffset, tracks)
+	if err != nil {
+		return err
+	}
+	for _, f := range frags {
+		if t := FindTrack(tracks, f.Header.TrackID); t != nil {
+			t.Samples = append(t.Samples, f.Samples...)
+		}
+	}
+	return nil
+}
+
+// ReadFragment returns the track fragments of a moof box, with their
+// samples located as ParseFragment locates them, without adding them to
+// the tracks. The samples of track fragments of tracks not in tracks get
+// only the defaults of their tfhd; they still place the data of the track
+// fragments that follow them.
+func ReadFragment(moof []byte, moofOffset int64, tracks []*Track) ([]TrackFragment, error) {
+	r := mp4.NewReader(moof)
+	if !r.Next() || r.Type() != mp4.TypeMoof {
+		return nil, ErrMoofNotFound
+	}
+	defaults := make(map[uint32]mp4.SampleDefaults, len(tracks))
+	for _, t := range tracks {
+		defaults[t.ID] = t.raw.trex
+	}
+	frags, err := mp4.ReadTrackFragments(moof, moofOffset, defaults)
+	if err != nil {
+		return nil, fmt.Errorf("%w: moof at %d: %v", ErrCorruptData, moofOffset, err)
+	}
+
+	// Decode time following the samples read so far, by track ID.
+	nextDTS := make(map[uint32]int64)
+	out := make([]TrackFragment, len(frags))
+	for i, f := range frags {
+		id := f.Header.TrackID
+		dts, ok := nextDTS[id]
+		if t := FindTrack(tracks, id); t != nil && !ok {
+			if n := len(t.Samples); n > 0 {
+				last := t.Samples[n-1]
+				dts = last.DTS + int64(last.Duration)
+			}
+		}
+		if f.HasDecodeTime {
+			dts = int64(f.DecodeTime)
+		}
+
+		tf := TrackFragment{Header: f.Header, Samples: make([]Sample, len(f.Samples))}
+		for j, s := range f.Samples {
+			tf.Samples[j] = Sample{
+				TrackID:            id,
+				Offset:             s.Offset,
+				Size:               s.Size,
+				Duration:           s.Duration,
+				DTS:                dts,
+				PresentationOffset: s.CompositionTimeOffset,
+				IsSync:             s.Flags&sampleIsNonSync == 0,
+			}
+			dts += int64(s.Duration)
+		}
+		for _, run := range f.Runs {
+			tf.Runs = append(tf.Runs, TrackRun{Offset: run.Offset, Count: len(run.Entries)})
+		}
+		nextDTS[id] = dts
+		out[i] = tf
+	}
+	return out, nil
+}
+
+// ParseFragments calls ParseFragment for every top-level moof box of the
+// size-byte file read from r.
+func ParseFragments(r io.ReaderAt, size int64, tracks []*Track) error {
+	sc := mp4.NewScanner(io.NewSectionReader(r, 0, size))
+	var buf []byte
+	for sc.Next() {
+		e := sc.Entry()
+		if e.Type != mp4.TypeMoof {
+			continue
+		}
+		if e.Size < int64(e.HeaderSize) || e.Size > size-e.Offset {
+			return fmt.Errorf("%w: moof at %d: size %d out of range", ErrCorruptData, e.Offset, e.Size)
+		}
+		if int64(cap(buf)) < e.Size {
+			buf = make([]byte, e.Size)
+		}
+		buf = buf[:e.Size]
+		if err := sc.ReadBox(buf); err != nil {
+			return err
+		}
+		if err := ParseFragment(buf, e.Offset, tracks); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
@@ -0,0 +1,207 @@
+package track_test
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/tetsuo/mp4"
+	"github.com/tetsuo/mp4/internal/mp4test"
+	"github.com/tetsuo/mp4/track"
+)
+
+// initTracks returns the tracks of an init segment: a video track whose
+// fragment samples default to 100 ticks, 50 bytes and non-sync, and a
+// text track whose samples default to 1000 ticks and 20 bytes.
+func initTracks(t *testing.T) []*track.Track {
+	t.Helper()
+	video := videoTrack(nil)
+	video.Samples = nil
+	text := textTrack(2, nil)
+	text.Samples = nil
+	return parseMovie(t, mp4test.Movie{
+		TimeScale: 1000,
+		Tracks:    []mp4test.Track{video, text},
+		Extra: func(w *mp4.Writer) {
+			w.StartBox(mp4.TypeMvex)
+			w.WriteTrex(1, 1, 100, 50, 0x00010000)
+			w.WriteTrex(2, 1, 1000, 20, 0)
+			w.EndBox()
+		},
+	})
+}
+
+// box returns a box of type typ whose children are written by write.
+func box(typ mp4.BoxType, write func(w *mp4.Writer)) []byte {
+	w := mp4.NewWriter(make([]byte, 4096))
+	w.StartBox(typ)
+	write(&w)
+	w.EndBox()
+	return append([]byte(nil), w.Bytes()...)
+}
+
+// free returns a free box of n bytes.
+func free(n int) []byte {
+	return box(mp4.TypeFree, func(w *mp4.Writer) { w.Write(make([]byte, n-8)) })
+}
+
+func TestParseFragments(t *testing.T) {
+	// The video fragment is based at the moof, with two runs; the second
+	// continues where the first ends. The fragment of the unknown track 9
+	// follows it, then the text fragment, which has neither a base data
+	// offset nor data offsets.
+	moof1 := box(mp4.TypeMoof, func(w *mp4.Writer) {
+		w.WriteMfhd(1)
+		w.StartBox(mp4.TypeTraf)
+		w.WriteTrackFragmentHeader(mp4.TrackFragmentHeader{
+			Flags:             mp4.TfhdDefaultBaseIsMoof | mp4.TfhdDefaultSampleSizePresent,
+			TrackID:           1,
+			DefaultSampleSize: 30,
+		})
+		w.WriteTfdt(5000)
+		w.WriteTrackRun(mp4.TrackRun{
+			Version:          1,
+			Flags:            mp4.TrunDataOffsetPresent | mp4.TrunFirstSampleFlagsPresent | mp4.TrunSampleCompositionTimeOffsetPresent,
+			DataOffset:       200,
+			FirstSampleFlags: 0x02000000,
+			Entries:          []mp4.TrunEntry{{CompositionTimeOffset: 100}, {CompositionTimeOffset: -50}, {}},
+		})
+		w.WriteTrun(mp4.TrunSampleDurationPresent|mp4.TrunSampleSizePresent, 0, []mp4.TrunEntry{{Duration: 200, Size: 70}})
+		w.EndBox()
+
+		w.StartBox(mp4.TypeTraf)
+		w.WriteTfhd(0, 9)
+		w.WriteTrun(mp4.TrunSampleSizePresent, 0, []mp4.TrunEntry{{Size: 10}, {Size: 10}})
+		w.EndBox()
+
+		w.StartBox(mp4.TypeTraf)
+		w.WriteTfhd(0, 2)
+		w.WriteTrun(0, 0, make([]mp4.TrunEntry, 2))
+		w.EndBox()
+	})
+	// The second text fragment has a base data offset and continues the
+	// decode times of the first.
+	moof2 := box(mp4.TypeMoof, func(w *mp4.Writer) {
+		w.WriteMfhd(2)
+		w.StartBox(mp4.TypeTraf)
+		w.WriteTrackFragmentHeader(mp4.TrackFragmentHeader{
+			Flags:                 mp4.TfhdBaseDataOffsetPresent | mp4.TfhdDefaultSampleDurationPresent,
+			TrackID:               2,
+			BaseDataOffset:        8000,
+			DefaultSampleDuration: 500,
+		})
+		w.WriteTrun(mp4.TrunDataOffsetPresent, 16, make([]mp4.TrunEntry, 1))
+		w.EndBox()
+	})
+
+	var file []byte
+	file = append(file, free(1000)...)
+	file = append(file, moof1...)
+	file = append(file, free(5000-len(file))...)
+	file = append(file, moof2...)
+
+	tracks := initTracks(t)
+	if err := track.ParseFragments(bytes.NewReader(file), int64(len(file)), tracks); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]track.Sample{{
+		{TrackID: 1, Offset: 1200, Size: 30, Duration: 100, DTS: 5000, PresentationOffset: 100, IsSync: true},
+		{TrackID: 1, Offset: 1230, Size: 30, Duration: 100, DTS: 5100, PresentationOffset: -50},
+		{TrackID: 1, Offset: 1260, Size: 30, Duration: 100, DTS: 5200},
+		{TrackID: 1, Offset: 1290, Size: 70, Duration: 200, DTS: 5300},
+	}, {
+		{TrackID: 2, Offset: 1380, Size: 20, Duration: 1000, DTS: 0, IsSync: true},
+		{TrackID: 2, Offset: 1400, Size: 20, Duration: 1000, DTS: 1000, IsSync: true},
+		{TrackID: 2, Offset: 8016, Size: 20, Duration: 500, DTS: 2000, IsSync: true},
+	}}
+	for i, tr := range tracks {
+		if !reflect.DeepEqual(tr.Samples, want[i]) {
+			t.Errorf("track %d samples:\n got %+v\nwant %+v", tr.ID, tr.Samples, want[i])
+		}
+	}
+}
+
+func TestReadFragment(t *testing.T) {
+	// Two fragments of the video track, the second continuing the decode
+	// times of the first, around one of the unknown track 9.
+	moof := box(mp4.TypeMoof, func(w *mp4.Writer) {
+		w.WriteMfhd(1)
+		w.StartBox(mp4.TypeTraf)
+		w.WriteTfhd(mp4.TfhdDefaultBaseIsMoof, 1)
+		w.WriteTfdt(1000)
+		w.WriteTrun(mp4.TrunDataOffsetPresent, 100, make([]mp4.TrunEntry, 2))
+		w.WriteTrun(0, 0, nil)
+		w.EndBox()
+
+		w.StartBox(mp4.TypeTraf)
+		w.WriteTfhd(0, 9)
+		w.WriteTrun(mp4.TrunSampleSizePresent, 0, []mp4.TrunEntry{{Size: 10}})
+		w.EndBox()
+
+		w.StartBox(mp4.TypeTraf)
+		w.WriteTfhd(0, 1)
+		w.WriteTrun(0, 0, make([]mp4.TrunEntry, 1))
+		w.EndBox()
+	})
+	tracks := initTracks(t)
+	frags, err := track.ReadFragment(moof, 500, tracks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		id      uint32
+		samples []track.Sample
+		runs    []track.TrackRun
+	}{
+		{1, []track.Sample{
+			{TrackID: 1, Offset: 600, Size: 50, Duration: 100, DTS: 1000},
+			{TrackID: 1, Offset: 650, Size: 50, Duration: 100, DTS: 1100},
+		}, []track.TrackRun{{Offset: 600, Count: 2}, {Offset: 700, Count: 0}}},
+		{9, []track.Sample{{TrackID: 9, Offset: 700, Size: 10, IsSync: true}}, []track.TrackRun{{Offset: 700, Count: 1}}},
+		{1, []track.Sample{{TrackID: 1, Offset: 710, Size: 50, Duration: 100, DTS: 1200}}, []track.TrackRun{{Offset: 710, Count: 1}}},
+	}
+	if len(frags) != len(want) {
+		t.Fatalf("got %d track fragments, want %d", len(frags), len(want))
+	}
+	for i, f := range frags {
+		w := want[i]
+		if f.Header.TrackID != w.id || !reflect.DeepEqual(f.Samples, w.samples) || !reflect.DeepEqual(f.Runs, w.runs) {
+			t.Errorf("fragment %d: got %d %+v %+v\nwant %d %+v %+v", i, f.Header.TrackID, f.Samples, f.Runs, w.id, w.samples, w.runs)
+		}
+	}
+	if len(tracks[0].Samples) != 0 {
+		t.Errorf("ReadFragment added %d samples to the track", len(tracks[0].Samples))
+	}
+}
+
+func TestParseFragmentErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		moof []byte
+		want error
+	}{
+		{"not moof", free(16), track.ErrMoofNotFound},
+		{"trun before tfhd", box(mp4.TypeMoof, func(w *mp4.Writer) {
+			w.StartBox(mp4.TypeTraf)
+			w.WriteTrun(0, 0, make([]mp4.TrunEntry, 1))
+			w.WriteTfhd(0, 1)
+			w.EndBox()
+		}), track.ErrCorruptData},
+		{"truncated trun", box(mp4.TypeMoof, func(w *mp4.Writer) {
+			w.StartBox(mp4.TypeTraf)
+			w.WriteTfhd(0, 1)
+			w.StartFullBox(mp4.TypeTrun, 0, mp4.TrunSampleSizePresent)
+			w.Write([]byte{0, 0, 0, 3, 0, 0, 0, 10})
+			w.EndBox()
+			w.EndBox()
+		}), track.ErrCorruptData},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := track.ParseFragment(tt.moof, 0, initTracks(t)); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package track
+
+import "github.com/tetsuo/mp4"
+
+// Metadata returns the iTunes metadata of a movie: the ilst items of the
+// first meta box with an mdir handler in moov or moov/udta. The moov
+// buffer is as for ParseTracks. Returns an empty Metadata if the movie has
+// none.
+func Metadata(moov []byte) (mp4.Metadata, error) {
+	return findMeta(moov, mp4.HandlerMdir)
+}
+
+// KeyedMetadata returns the QuickTime metadata of a movie: the keys and
+// ilst items of the first meta box with an mdta handler in moov or
+// moov/udta, where cameras and phones store location and device details.
+// Look items up with Keyed. Returns an empty Metadata if the movie has
+// none.
+func KeyedMetadata(moov []byte) (mp4.Metadata, error) {
+	return findMeta(moov, mp4.HandlerMdta)
+}
+
+// findMeta returns the first meta box in moov or moov/udta, in file order,
+// with the given handler. Both the ISO and the QuickTime form are read; a
+// meta box without hdlr counts as mdir.
+func findMeta(moov []byte, handler [4]byte) (mp4.Metadata, error) {
+	mr := mp4.NewReader(moov)
+	if !mr.Next() || mr.Type() != mp4.TypeMoov {
+		return mp4.Metadata{}, ErrMoovNotFound
+	}
+	var found mp4.Metadata
+	var err error
+	var ok bool
+	check := func(r *mp4.Reader) {
+		if ok || r.Type() != mp4.TypeMeta {
+			return
+		}
+		m, e := mp4.ReadMeta(r.Data())
+		if m.Handler == handler || (handler == mp4.HandlerMdir && m.Handler == [4]byte{}) {
+			found, err, ok = m, e, true
+		}
+	}
+	mr.Enter()
+	for mr.Next() {
+		check(&mr)
+		if mr.Type() == mp4.TypeUdta {
+			mr.Enter()
+			for mr.Next() {
+				check(&mr)
+			}
+			mr.Exit()
+		}
+	}
+	mr.Exit()
+	return found, err
+}
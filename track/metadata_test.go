@@ -0,0 +1,67 @@
+package track_test
+
+import (
+	"testing"
+
+	"github.com/tetsuo/mp4"
+	"github.com/tetsuo/mp4/internal/mp4test"
+	"github.com/tetsuo/mp4/track"
+)
+
+func TestMetadata(t *testing.T) {
+	var m mp4.Metadata
+	m.SetText(mp4.ItemTitle, "Movie")
+	m.SetText(mp4.ItemEncoder, "mp4test")
+	file := (&mp4test.Movie{
+		TimeScale: 1000,
+		Tracks:    []mp4test.Track{videoTrack(nil)},
+		Extra:     func(w *mp4.Writer) { w.WriteMetadata(m) },
+	}).Build()
+	got, err := track.Metadata(mp4test.Moov(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Text(mp4.ItemTitle) != "Movie" || got.Text(mp4.ItemEncoder) != "mp4test" {
+		t.Errorf("got %+v", got.Items)
+	}
+
+	file = (&mp4test.Movie{TimeScale: 1000, Tracks: []mp4test.Track{videoTrack(nil)}}).Build()
+	got, err = track.Metadata(mp4test.Moov(file))
+	if err != nil || got.Items != nil {
+		t.Errorf("no metadata: got %+v, %v", got, err)
+	}
+	if _, err := track.Metadata(file); err != track.ErrMoovNotFound {
+		t.Errorf("no moov: err = %v, want %v", err, track.ErrMoovNotFound)
+	}
+}
+
+func TestKeyedMetadata(t *testing.T) {
+	var itunes, keyed mp4.Metadata
+	itunes.SetText(mp4.ItemTitle, "Clip")
+	keyed.SetKeyed(mp4.KeyModel, mp4.MetadataData{Type: mp4.DataTypeUTF8, Value: []byte("Phone")})
+	// QuickTime movies put the keyed meta box directly in moov.
+	file := (&mp4test.Movie{
+		TimeScale: 1000,
+		Tracks:    []mp4test.Track{videoTrack(nil)},
+		Extra: func(w *mp4.Writer) {
+			w.WriteQuickTimeMeta(keyed)
+			w.WriteMetadata(itunes)
+		},
+	}).Build()
+	moov := mp4test.Moov(file)
+
+	got, err := track.KeyedMetadata(moov)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if it := got.Keyed(mp4.KeyModel); it == nil || it.Data[0].Text() != "Phone" {
+		t.Errorf("model = %+v", it)
+	}
+	got, err = track.Metadata(moov)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Handler != mp4.HandlerMdir || got.Text(mp4.ItemTitle) != "Clip" {
+		t.Errorf("iTunes metadata = %+v", got)
+	}
+}
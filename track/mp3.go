@@ -0,0 +1,73 @@
+package track
+
+import (
+	"io"
+
+	"github.com/tetsuo/mp4"
+)
+
+// IsMP3 reports whether t carries MPEG-1 or MPEG-2 audio: an .mp3 sample
+// entry, or an mp4a one whose esds declares object type 0x6B or 0x69.
+func (t *Track) IsMP3() bool {
+	e, ok := t.Entry.(*AudioEntry)
+	if !ok {
+		return false
+	}
+	if e.EntryType == mp4.TypeMp3 {
+		return true
+	}
+	if es, ok := e.Config.(*mp4.ESDescriptor); ok {
+		oti := es.DecoderConfig.ObjectTypeIndication
+		return oti == mp4.OTIMPEG1Audio || oti == mp4.OTIMPEG2Audio
+	}
+	return false
+}
+
+// ProbeTracks fills in track parameters that only the sample data
+// carries, reading the samples from r, which holds the file the tracks'
+// sample offsets refer to. ParseTracks sees only the moov box, so it
+// cannot.
+//
+// MP3 sample entries often leave the audio parameters unset; the sample
+// rate and channel count of MP3 tracks are taken from the frame header of
+// their first sample, and the codec string becomes mp4a.6b for MPEG-1 or
+// mp4a.69 for MPEG-2 and 2.5 audio. Tracks whose first sample does not
+// start with a valid frame header are left as they are.
+func ProbeTracks(tracks []*Track, r io.ReaderAt) error {
+	for _, t := range tracks {
+		if !t.IsMP3() || len(t.Samples) == 0 {
+			continue
+		}
+		s := t.Samples[0]
+		var hdr [4]byte
+		if s.Size < uint32(len(hdr)) {
+			continue
+		}
+		if n, err := r.ReadAt(hdr[:], s.Offset); n < len(hdr) {
+			return err
+		}
+		h, err := mp4.ReadMPEGAudioHeader(hdr[:])
+		if err != nil {
+			continue
+		}
+		t.applyMPEGAudioHeader(&h)
+	}
+	return nil
+}
+
+// applyMPEGAudioHeader copies the audio parameters of an MP3 frame header
+// onto the track and its sample entry.
+func (t *Track) applyMPEGAudioHeader(h *mp4.MPEGAudioHeader) {
+	codec := "mp4a.69"
+	if h.Version == 1 {
+		codec = "mp4a.6b"
+	}
+	t.SampleRate = h.SampleRate
+	t.ChannelCount = h.Channels
+	t.codec = codec
+	if e, ok := t.Entry.(*AudioEntry); ok {
+		e.SampleRateHz = h.SampleRate
+		e.Channels = h.Channels
+		e.CodecString = codec
+	}
+}
@@ -0,0 +1,75 @@
+package track_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/tetsuo/mp4"
+	"github.com/tetsuo/mp4/internal/mp4test"
+	"github.com/tetsuo/mp4/track"
+)
+
+func TestProbeTracksMP3(t *testing.T) {
+	// MPEG-2 layer III, 64 kbit/s, 22050 Hz, mono, declared as MPEG-1 in
+	// esds by an mp4a entry without audio parameters.
+	mpeg2 := append([]byte{0xff, 0xf3, 0x80, 0xc0}, make([]byte, 284)...)
+	// MPEG-1 layer III, 128 kbit/s, 44100 Hz, joint stereo, in an .mp3
+	// entry.
+	mpeg1 := append([]byte{0xff, 0xfb, 0x90, 0x64}, make([]byte, 413)...)
+
+	esds := func(w *mp4.Writer) {
+		w.WriteEsds(mp4.ESDescriptor{ESID: 1, DecoderConfig: mp4.DecoderConfigDescriptor{
+			ObjectTypeIndication: mp4.OTIMPEG1Audio, StreamType: 5,
+		}})
+	}
+	m := mp4test.Movie{TimeScale: 1000, Tracks: []mp4test.Track{
+		{
+			ID: 1, Handler: mp4test.Audio, TimeScale: 22050,
+			Entry:   mp4test.AudioEntry(mp4.TypeMp4a, 0, 0, esds),
+			Samples: [][]byte{mpeg2, mpeg2}, Duration: 576,
+		},
+		{
+			ID: 2, Handler: mp4test.Audio, TimeScale: 44100,
+			Entry:   mp4test.AudioEntry(mp4.TypeMp3, 0, 0, nil),
+			Samples: [][]byte{mpeg1}, Duration: 1152,
+		},
+	}}
+	file := m.Build()
+
+	tracks, _, err := track.ParseTracks(mp4test.Moov(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) != 2 {
+		t.Fatalf("got %d tracks, want 2", len(tracks))
+	}
+	for _, tr := range tracks {
+		if !tr.IsMP3() {
+			t.Errorf("track %d: IsMP3 = false", tr.ID)
+		}
+	}
+	if c := tracks[0].Codec(); c != "mp4a.6b" {
+		t.Errorf("codec before probing = %q, want mp4a.6b from esds", c)
+	}
+
+	if err := track.ProbeTracks(tracks, bytes.NewReader(file)); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []struct {
+		codec    string
+		rate     uint32
+		channels uint16
+	}{
+		{"mp4a.69", 22050, 1},
+		{"mp4a.6b", 44100, 2},
+	} {
+		tr := tracks[i]
+		if tr.Codec() != want.codec || tr.SampleRate != want.rate || tr.ChannelCount != want.channels {
+			t.Errorf("track %d: got %s %d Hz %d channels, want %s %d Hz %d channels",
+				tr.ID, tr.Codec(), tr.SampleRate, tr.ChannelCount, want.codec, want.rate, want.channels)
+		}
+		if e := tr.Entry.(*track.AudioEntry); e.SampleRateHz != want.rate || e.Codec() != want.codec {
+			t.Errorf("track %d: entry not updated: %d Hz, %s", tr.ID, e.SampleRateHz, e.Codec())
+		}
+	}
+}
@@ -0,0 +1,631 @@
+package track
+
+import (
+	"github.com/tetsuo/mp4"
+)
+
+// SampleEntry is a decoded stsd sample entry. Decoders registered with
+// RegisterSampleEntry return one; the built-in ones return *VideoEntry,
+// *AudioEntry or *SubtitleEntry.
+type SampleEntry interface {
+	Type() mp4.BoxType // sample entry fourcc
+	Kind() TrackKind
+	Codec() string // RFC 6381 codec string, e.g. "avc1.64001f"
+}
+
+// VideoEntry is a SampleEntry for visual tracks.
+type VideoEntry struct {
+	mp4.VisualSampleEntry
+	EntryType   mp4.BoxType
+	CodecString string
+
+	// Config is the decoder configuration: *mp4.AVCConfig, *mp4.HEVCConfig,
+	// *mp4.VVCConfig or *mp4.AV1Config for the built-in decoders, nil if
+	// absent.
+	Config      any
+	DolbyVision *mp4.DolbyVisionConfig // nil if the entry has no dvcC/dvvC/dvwC
+}
+
+func (e *VideoEntry) Type() mp4.BoxType { return e.EntryType }
+func (e *VideoEntry) Kind() TrackKind   { return TrackVideo }
+func (e *VideoEntry) Codec() string     { return e.CodecString }
+
+// AudioEntry is a SampleEntry for audio tracks. Channels, SampleRateHz
+// and BitDepth are the effective values, which the codec configuration
+// may override from the sample entry header fields of the embedded
+// mp4.AudioSampleEntry.
+type AudioEntry struct {
+	mp4.AudioSampleEntry
+	EntryType    mp4.BoxType
+	CodecString  string
+	Channels     uint16
+	SampleRateHz uint32
+	BitDepth     uint16 // 0 if not signalled
+
+	// BytesPerFrame is the size of one sample across all channels for
+	// uncompressed audio, 0 for compressed formats.
+	BytesPerFrame uint32
+
+	// Config is the decoder configuration: *mp4.ESDescriptor,
+	// *mp4.FlacConfig, *mp4.AlacConfig, *mp4.PCMConfig, *mp4.MHAConfig or
+	// *mp4.AC4Config for the built-in decoders, nil if absent.
+	Config any
+}
+
+func (e *AudioEntry) Type() mp4.BoxType { return e.EntryType }
+func (e *AudioEntry) Kind() TrackKind   { return TrackAudio }
+func (e *AudioEntry) Codec() string     { return e.CodecString }
+
+// SubtitleEntry is a SampleEntry for subtitle and text tracks.
+type SubtitleEntry struct {
+	EntryType   mp4.BoxType
+	CodecString string
+
+	// Config is *mp4.WVTTSampleEntry, *mp4.XMLSubtitleSampleEntry or
+	// *mp4.TextSampleEntry for the built-in decoders.
+	Config any
+}
+
+func (e *SubtitleEntry) Type() mp4.BoxType { return e.EntryType }
+func (e *SubtitleEntry) Kind() TrackKind   { return TrackSubtitle }
+func (e *SubtitleEntry) Codec() string     { return e.CodecString }
+
+// EntryDecoder decodes sample entry box data (after the box header) for
+// the entry type it is registered under.
+type EntryDecoder func(typ mp4.BoxType, data []byte) (SampleEntry, error)
+
+var entryDecoders = map[mp4.BoxType]EntryDecoder{}
+
+func init() {
+	for _, t := range []mp4.BoxType{mp4.TypeAvc1} {
+		entryDecoders[t] = decodeAVCEntry
+	}
+	for _, t := range []mp4.BoxType{mp4.TypeHvc1, mp4.TypeHev1, mp4.TypeDvh1, mp4.TypeDvhe} {
+		entryDecoders[t] = decodeHEVCEntry
+	}
+	for _, t := range []mp4.BoxType{mp4.TypeAv01, mp4.TypeDav1} {
+		entryDecoders[t] = decodeAV1Entry
+	}
+	for _, t := range []mp4.BoxType{mp4.TypeVvc1, mp4.TypeVvi1} {
+		entryDecoders[t] = decodeVVCEntry
+	}
+	entryDecoders[mp4.TypeMp4a] = decodeMp4aEntry
+	entryDecoders[mp4.TypeMp3] = decodeMp3Entry
+	for _, t := range []mp4.BoxType{mp4.TypeMha1, mp4.TypeMha2, mp4.TypeMhm1, mp4.TypeMhm2} {
+		entryDecoders[t] = decodeMPEGHEntry
+	}
+	entryDecoders[mp4.TypeAc4] = decodeAC4Entry
+	entryDecoders[mp4.TypeFlac] = decodeFlacEntry
+	entryDecoders[mp4.TypeAlac] = decodeAlacEntry
+	entryDecoders[mp4.TypeIpcm] = decodeISOPCMEntry
+	entryDecoders[mp4.TypeFpcm] = decodeISOPCMEntry
+	entryDecoders[mp4.TypeLpcm] = decodeLpcmEntry
+	for _, t := range []mp4.BoxType{mp4.TypeTwos, mp4.TypeSowt, mp4.TypeIn24, mp4.TypeIn32, mp4.TypeFl32, mp4.TypeFl64} {
+		entryDecoders[t] = decodeQuickTimePCMEntry
+	}
+	entryDecoders[mp4.TypeWvtt] = decodeWvttEntry
+	entryDecoders[mp4.TypeStpp] = decodeStppEntry
+	entryDecoders[mp4.TypeTx3g] = decodeTx3gEntry
+	entryDecoders[mp4.TypeEncv] = decodeProtectedEntry
+	entryDecoders[mp4.TypeEnca] = decodeProtectedEntry
+}
+
+// RegisterSampleEntry registers dec for sample entries of type typ,
+// replacing any existing decoder, including the built-in ones. It must not
+// be called concurrently with ParseTracks; register from an init function.
+func RegisterSampleEntry(typ mp4.BoxType, dec EntryDecoder) {
+	entryDecoders[typ] = dec
+}
+
+// handlerKind returns the track kind expected for a handler type.
+func handlerKind(handlerType [4]byte) (TrackKind, bool) {
+	switch handlerType {
+	case htVide:
+		return TrackVideo, true
+	case htSoun:
+		return TrackAudio, true
+	case htText, htSubt, htSbtl:
+		return TrackSubtitle, true
+	}
+	return 0, false
+}
+
+// codecBuf builds codec strings without intermediate allocations. It is
+// sized for the longest strings in use, such as HEVC ones with all six
+// constraint bytes or VP9 ones with the optional fields.
+type codecBuf struct {
+	buf [64]byte
+	n   uint8
+}
+
+func (c *codecBuf) set(s string) {
+	c.n = uint8(copy(c.buf[:], s))
+}
+
+func (c *codecBuf) append(s string) {
+	c.n += uint8(copy(c.buf[c.n:], s))
+}
+
+func (c *codecBuf) String() string { return string(c.buf[:c.n]) }
+
+// readVisualEntry reads the visual sample entry header and the extension
+// boxes among its children.
+func readVisualEntry(typ mp4.BoxType, data []byte) (*VideoEntry, error) {
+	if len(data) < 78 {
+		return nil, mp4.ErrTruncated
+	}
+	e := &VideoEntry{
+		VisualSampleEntry: mp4.ReadVisualSampleEntry(data),
+		EntryType:         typ,
+	}
+	e.ReadExtensions(data)
+	return e, nil
+}
+
+// readAudioEntry reads the audio sample entry header, the extension boxes
+// among its children and an srat child box, which overrides the header
+// rate.
+func readAudioEntry(typ mp4.BoxType, data []byte) (*AudioEntry, error) {
+	if len(data) < 28 {
+		return nil, mp4.ErrTruncated
+	}
+	a := mp4.ReadAudioSampleEntry(data)
+	a.ReadExtensions(data)
+	e := &AudioEntry{
+		AudioSampleEntry: a,
+		EntryType:        typ,
+		Channels:         a.ChannelCount,
+		SampleRateHz:     a.Rate(),
+	}
+	r := mp4.NewReader(data[a.ChildOffset:])
+	for r.Next() {
+		if r.Type() == mp4.TypeSrat {
+			if rate, err := mp4.ReadSrat(r.Data()); err == nil && rate != 0 {
+				e.SampleRateHz = rate
+			}
+			break
+		}
+	}
+	return e, nil
+}
+
+// genericEntryDecoder returns the decoder of sample entries that have no
+// registered decoder: it reads the header fields of kind's base sample
+// entry and uses the fourcc as the codec string.
+func genericEntryDecoder(kind TrackKind) EntryDecoder {
+	switch kind {
+	case TrackVideo:
+		return func(typ mp4.BoxType, data []byte) (SampleEntry, error) {
+			e, err := readVisualEntry(typ, data)
+			if err != nil {
+				return nil, err
+			}
+			e.CodecString = typ.String()
+			return e, nil
+		}
+	case TrackAudio:
+		return func(typ mp4.BoxType, data []byte) (SampleEntry, error) {
+			e, err := readAudioEntry(typ, data)
+			if err != nil {
+				return nil, err
+			}
+			e.CodecString = typ.String()
+			return e, nil
+		}
+	}
+	return func(typ mp4.BoxType, data []byte) (SampleEntry, error) {
+		return &SubtitleEntry{EntryType: typ, CodecString: typ.String()}, nil
+	}
+}
+
+// readDolbyVision decodes a dvcC, dvvC or dvwC child box, or returns nil.
+func readDolbyVision(r *mp4.Reader) *mp4.DolbyVisionConfig {
+	switch r.Type() {
+	case mp4.TypeDvcC, mp4.TypeDvvC, mp4.TypeDvwC:
+		if c, err := mp4.ReadDolbyVisionConfig(r.Data()); err == nil {
+			return &c
+		}
+	}
+	return nil
+}
+
+func decodeAVCEntry(typ mp4.BoxType, data []byte) (SampleEntry, error) {
+	e, err := readVisualEntry(typ, data)
+	if err != nil {
+		return nil, err
+	}
+	var codec codecBuf
+	codec.set(typ.String())
+	r := mp4.NewReader(data[e.ChildOffset:])
+	for r.Next() {
+		if r.Type() == mp4.TypeAvcC {
+			if c, err := mp4.ReadAVCConfig(r.Data()); err == nil {
+				e.Config = &c
+				codec.append(".")
+				codec.append(c.Codec())
+			}
+		} else if dv := readDolbyVision(&r); dv != nil {
+			e.DolbyVision = dv
+		}
+	}
+	e.CodecString = codec.String()
+	return e, nil
+}
+
+// decodeHEVCEntry decodes hvc1/hev1 and the dvh1/dvhe Dolby Vision entries.
+// Dolby Vision entries take their codec string from the Dolby Vision
+// configuration; hvc1/hev1 ones from hvcC.
+func decodeHEVCEntry(typ mp4.BoxType, data []byte) (SampleEntry, error) {
+	e, err := readVisualEntry(typ, data)
+	if err != nil {
+		return nil, err
+	}
+	dolby := typ != mp4.TypeHvc1 && typ != mp4.TypeHev1
+	var codec codecBuf
+	codec.set(typ.String())
+	r := mp4.NewReader(data[e.ChildOffset:])
+	for r.Next() {
+		if r.Type() == mp4.TypeHvcC {
+			if c, err := mp4.ReadHEVCConfig(r.Data()); err == nil {
+				e.Config = &c
+				if !dolby {
+					codec.append(".")
+					codec.append(c.Codec())
+				}
+			}
+		} else if dv := readDolbyVision(&r); dv != nil {
+			e.DolbyVision = dv
+			if dolby {
+				codec.append(".")
+				codec.append(dv.Codec())
+			}
+		}
+	}
+	e.CodecString = codec.String()
+	return e, nil
+}
+
+// decodeAV1Entry decodes av01 and dav1 entries. dav1 entries take their
+// codec string from the Dolby Vision configuration; av01 ones from av1C.
+func decodeAV1Entry(typ mp4.BoxType, data []byte) (SampleEntry, error) {
+	e, err := readVisualEntry(typ, data)
+	if err != nil {
+		return nil, err
+	}
+	dolby := typ == mp4.TypeDav1
+	var codec codecBuf
+	codec.set(typ.String())
+	r := mp4.NewReader(data[e.ChildOffset:])
+	for r.Next() {
+		if r.Type() == mp4.TypeAv1C {
+			if c, err := mp4.ReadAV1Config(r.Data()); err == nil {
+				e.Config = &c
+				if !dolby {
+					codec.append(".")
+					codec.append(c.Codec())
+				}
+			}
+		} else if dv := readDolbyVision(&r); dv != nil {
+			e.DolbyVision = dv
+			if dolby {
+				codec.append(".")
+				codec.append(dv.Codec())
+			}
+		}
+	}
+	e.CodecString = codec.String()
+	return e, nil
+}
+
+func decodeVVCEntry(typ mp4.BoxType, data []byte) (SampleEntry, error) {
+	e, err := readVisualEntry(typ, data)
+	if err != nil {
+		return nil, err
+	}
+	var codec codecBuf
+	codec.set(typ.String())
+	r := mp4.NewReader(data[e.ChildOffset:])
+	for r.Next() {
+		if r.Type() == mp4.TypeVvcC {
+			if c, err := mp4.ReadVVCConfig(r.Data()); err == nil {
+				e.Config = &c
+				if s := c.Codec(); s != "" {
+					codec.append(".")
+					codec.append(s)
+				}
+			}
+			break
+		}
+	}
+	e.CodecString = codec.String()
+	return e, nil
+}
+
+// decodeMp4aEntry appends ".OTI[.AOT]" from esds to the codec string and
+// fills in audio parameters the sample entry leaves unset from the
+// AudioSpecificConfig.
+func decodeMp4aEntry(typ mp4.BoxType, data []byte) (SampleEntry, error) {
+	e, err := readAudioEntry(typ, data)
+	if err != nil {
+		return nil, err
+	}
+	var codec codecBuf
+	codec.set(typ.String())
+	r := mp4.NewReader(data[e.ChildOffset:])
+	for r.Next() {
+		if r.Type() == mp4.TypeEsds {
+			if es, err := mp4.ReadEsds(r.Data()); err == nil {
+				e.Config = &es
+				if s := es.Codec(); s != "" {
+					codec.append(".")
+					codec.append(s)
+				}
+				if es.DecoderConfig.ObjectTypeIndication == mp4.OTIMPEG4Audio {
+					if asc, err := es.AudioSpecificConfig(); err == nil {
+						if e.SampleRateHz == 0 {
+							e.SampleRateHz = asc.OutputSampleRate()
+						}
+						if e.Channels == 0 {
+							e.Channels = asc.Channels()
+						}
+					}
+				}
+			}
+			break
+		}
+	}
+	e.CodecString = codec.String()
+	return e, nil
+}
+
+// decodeMp3Entry decodes QuickTime .mp3 entries, which carry no esds. The
+// codec string is that of MP3 in mp4a entries, with the object type chosen
+// from the sample rate.
+func decodeMp3Entry(typ mp4.BoxType, data []byte) (SampleEntry, error) {
+	e, err := readAudioEntry(typ, data)
+	if err != nil {
+		return nil, err
+	}
+	e.CodecString = "mp4a.6b"
+	if e.SampleRateHz != 0 && e.SampleRateHz < 32000 {
+		e.CodecString = "mp4a.69"
+	}
+	return e, nil
+}
+
+// decodeMPEGHEntry decodes MPEG-H 3D Audio entries. mhm1 and mhm2 entries
+// may omit mhaC and carry the configuration in band.
+func decodeMPEGHEntry(typ mp4.BoxType, data []byte) (SampleEntry, error) {
+	e, err := readAudioEntry(typ, data)
+	if err != nil {
+		return nil, err
+	}
+	var codec codecBuf
+	codec.set(typ.String())
+	r := mp4.NewReader(data[e.ChildOffset:])
+	for r.Next() {
+		if r.Type() == mp4.TypeMhaC {
+			if c, err := mp4.ReadMhaC(r.Data()); err == nil {
+				e.Config = &c
+				codec.append(".")
+				codec.append(c.Codec())
+				if n := c.Channels(); n > 0 {
+					e.Channels = uint16(n)
+				}
+			}
+			break
+		}
+	}
+	e.CodecString = codec.String()
+	return e, nil
+}
+
+func decodeAC4Entry(typ mp4.BoxType, data []byte) (SampleEntry, error) {
+	e, err := readAudioEntry(typ, data)
+	if err != nil {
+		return nil, err
+	}
+	var codec codecBuf
+	codec.set(typ.String())
+	r := mp4.NewReader(data[e.ChildOffset:])
+	for r.Next() {
+		if r.Type() == mp4.TypeDac4 {
+			if c, err := mp4.ReadAC4Config(r.Data()); err == nil {
+				e.Config = &c
+				if s := c.Codec(); s != "" {
+					codec.append(".")
+					codec.append(s)
+				}
+				if n := c.Channels(); n > 0 {
+					e.Channels = uint16(n)
+				}
+				e.SampleRateHz = c.SampleRate()
+			}
+			break
+		}
+	}
+	e.CodecString = codec.String()
+	return e, nil
+}
+
+func decodeFlacEntry(typ mp4.BoxType, data []byte) (SampleEntry, error) {
+	e, err := readAudioEntry(typ, data)
+	if err != nil {
+		return nil, err
+	}
+	e.CodecString = "flac"
+	e.BitDepth = e.SampleSize
+	r := mp4.NewReader(data[e.ChildOffset:])
+	for r.Next() {
+		if r.Type() == mp4.TypeDfla {
+			// STREAMINFO carries rates above 65535 Hz that the 16.16
+			// sample entry field cannot represent.
+			c, err := mp4.ReadDfla(r.Data())
+			if err == nil {
+				e.Config = &c
+			}
+			if si, ok := c.StreamInfo(); err == nil && ok {
+				e.Channels = uint16(si.Channels)
+				e.SampleRateHz = si.SampleRate
+				e.BitDepth = uint16(si.BitsPerSample)
+			}
+			break
+		}
+	}
+	return e, nil
+}
+
+func decodeAlacEntry(typ mp4.BoxType, data []byte) (SampleEntry, error) {
+	e, err := readAudioEntry(typ, data)
+	if err != nil {
+		return nil, err
+	}
+	e.CodecString = "alac"
+	e.BitDepth = e.SampleSize
+	r := mp4.NewReader(data[e.ChildOffset:])
+	for r.Next() {
+		if r.Type() == mp4.TypeAlac {
+			if c, err := mp4.ReadAlacConfig(r.Data()); err == nil {
+				e.Config = &c
+				e.Channels = uint16(c.NumChannels)
+				e.SampleRateHz = c.SampleRate
+				e.BitDepth = uint16(c.BitDepth)
+			}
+			break
+		}
+	}
+	return e, nil
+}
+
+// decodeISOPCMEntry decodes ipcm and fpcm entries, whose sample size and
+// byte order come from pcmC.
+func decodeISOPCMEntry(typ mp4.BoxType, data []byte) (SampleEntry, error) {
+	e, err := readAudioEntry(typ, data)
+	if err != nil {
+		return nil, err
+	}
+	e.CodecString = typ.String()
+	e.BitDepth = e.SampleSize
+	r := mp4.NewReader(data[e.ChildOffset:])
+	for r.Next() {
+		if r.Type() == mp4.TypePcmC {
+			if c, err := mp4.ReadPcmC(r.Data()); err == nil {
+				e.Config = &c
+				e.BitDepth = uint16(c.SampleSize)
+			}
+			break
+		}
+	}
+	e.BytesPerFrame = uint32(e.BitDepth+7) / 8 * uint32(e.Channels)
+	return e, nil
+}
+
+// decodeLpcmEntry decodes QuickTime lpcm entries, which use the version 2
+// sound sample description.
+func decodeLpcmEntry(typ mp4.BoxType, data []byte) (SampleEntry, error) {
+	e, err := readAudioEntry(typ, data)
+	if err != nil {
+		return nil, err
+	}
+	e.CodecString = "lpcm"
+	e.BitDepth = e.SampleSize
+	if e.ConstLPCMFramesPerAudioPacket != 0 {
+		e.BytesPerFrame = e.ConstBytesPerAudioPacket / e.ConstLPCMFramesPerAudioPacket
+	} else {
+		e.BytesPerFrame = uint32(e.BitDepth+7) / 8 * uint32(e.Channels)
+	}
+	return e, nil
+}
+
+// decodeQuickTimePCMEntry decodes the QuickTime uncompressed entries, whose
+// fourcc implies the sample format. twos and sowt take the sample size from
+// the header; the others have a fixed one. Version 1 descriptions give the
+// frame size directly.
+func decodeQuickTimePCMEntry(typ mp4.BoxType, data []byte) (SampleEntry, error) {
+	e, err := readAudioEntry(typ, data)
+	if err != nil {
+		return nil, err
+	}
+	e.CodecString = typ.String()
+	switch typ {
+	case mp4.TypeIn24:
+		e.BitDepth = 24
+	case mp4.TypeIn32, mp4.TypeFl32:
+		e.BitDepth = 32
+	case mp4.TypeFl64:
+		e.BitDepth = 64
+	default:
+		e.BitDepth = e.SampleSize
+	}
+	e.BytesPerFrame = e.AudioSampleEntry.BytesPerFrame
+	if e.BytesPerFrame == 0 {
+		e.BytesPerFrame = uint32(e.BitDepth+7) / 8 * uint32(e.Channels)
+	}
+	return e, nil
+}
+
+func decodeWvttEntry(typ mp4.BoxType, data []byte) (SampleEntry, error) {
+	w, err := mp4.ReadWVTTSampleEntry(data)
+	if err != nil {
+		return nil, err
+	}
+	return &SubtitleEntry{EntryType: typ, CodecString: "wvtt", Config: &w}, nil
+}
+
+func decodeStppEntry(typ mp4.BoxType, data []byte) (SampleEntry, error) {
+	x, err := mp4.ReadXMLSubtitleSampleEntry(data)
+	if err != nil {
+		return nil, err
+	}
+	return &SubtitleEntry{EntryType: typ, CodecString: "stpp", Config: &x}, nil
+}
+
+func decodeTx3gEntry(typ mp4.BoxType, data []byte) (SampleEntry, error) {
+	t, err := mp4.ReadTextSampleEntry(data)
+	if err != nil {
+		return nil, err
+	}
+	return &SubtitleEntry{EntryType: typ, CodecString: "tx3g", Config: &t}, nil
+}
+
+// decodeProtectedEntry decodes encv and enca entries with the decoder of
+// the original format named in their sinf box, whose layout they keep.
+// The entry reports the encv or enca type and the codec string of the
+// original format. Entries whose original format has no registered
+// decoder, or that lack a sinf box, are read as generic entries.
+func decodeProtectedEntry(typ mp4.BoxType, data []byte) (SampleEntry, error) {
+	var sinf *mp4.ProtectionInfo
+	kind := TrackAudio
+	if typ == mp4.TypeEncv {
+		e, err := readVisualEntry(typ, data)
+		if err != nil {
+			return nil, err
+		}
+		sinf, kind = e.Sinf, TrackVideo
+	} else {
+		e, err := readAudioEntry(typ, data)
+		if err != nil {
+			return nil, err
+		}
+		sinf = e.Sinf
+	}
+	format := typ
+	if sinf != nil {
+		format = sinf.OriginalFormat
+	}
+	dec := entryDecoders[format]
+	if dec == nil || format == mp4.TypeEncv || format == mp4.TypeEnca {
+		dec = genericEntryDecoder(kind)
+	}
+	entry, err := dec(format, data)
+	if err != nil {
+		return nil, err
+	}
+	switch e := entry.(type) {
+	case *VideoEntry:
+		e.EntryType = typ
+	case *AudioEntry:
+		e.EntryType = typ
+	}
+	return entry, nil
+}
@@ -0,0 +1,415 @@
+package track_test
+
+import (
+	"testing"
+
+	"github.com/tetsuo/mp4"
+	"github.com/tetsuo/mp4/internal/mp4test"
+	"github.com/tetsuo/mp4/track"
+)
+
+// parseEntry parses a one-track movie whose track has a single sample and
+// the sample entry written by entry.
+func parseEntry(t *testing.T, handler [4]byte, entry func(w *mp4.Writer)) *track.Track {
+	t.Helper()
+	m := mp4test.Movie{TimeScale: 1000, Tracks: []mp4test.Track{{
+		ID: 1, Handler: handler, TimeScale: 48000, Width: 640, Height: 360,
+		Entry: entry, Samples: [][]byte{{0, 1, 2, 3}}, Duration: 1024,
+	}}}
+	tracks, _, err := track.ParseTracks(mp4test.Moov(m.Build()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) != 1 {
+		t.Fatalf("got %d tracks, want 1", len(tracks))
+	}
+	return tracks[0]
+}
+
+// audioParams is the codec and effective audio parameters of a track.
+type audioParams struct {
+	codec    string
+	rate     uint32
+	channels uint16
+	bitDepth uint16
+}
+
+func checkAudio(t *testing.T, tr *track.Track, want audioParams) {
+	t.Helper()
+	got := audioParams{tr.Codec(), tr.SampleRate, tr.ChannelCount, tr.BitDepth}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if tr.Kind != track.TrackAudio {
+		t.Errorf("kind = %v, want audio", tr.Kind)
+	}
+}
+
+func TestFlacEntry(t *testing.T) {
+	si := mp4.FlacStreamInfo{
+		MinBlockSize: 4096, MaxBlockSize: 4096,
+		SampleRate: 96000, Channels: 6, BitsPerSample: 24,
+	}
+	// Rates above 65535 Hz are written as 0 in the sample entry.
+	tr := parseEntry(t, mp4test.Audio, mp4test.AudioEntry(mp4.TypeFlac, 2, 0, func(w *mp4.Writer) {
+		w.WriteDfla(mp4.FlacConfig{Blocks: []mp4.FlacMetadataBlock{si.Block()}})
+	}))
+	checkAudio(t, tr, audioParams{"flac", 96000, 6, 24})
+}
+
+func TestAlacEntry(t *testing.T) {
+	tr := parseEntry(t, mp4test.Audio, mp4test.AudioEntry(mp4.TypeAlac, 2, 44100, func(w *mp4.Writer) {
+		w.WriteAlacConfig(mp4.AlacConfig{
+			FrameLength: 4096, BitDepth: 24, PB: 40, MB: 10, KB: 14,
+			NumChannels: 1, MaxRun: 255, SampleRate: 88200,
+		})
+	}))
+	checkAudio(t, tr, audioParams{"alac", 88200, 1, 24})
+}
+
+func TestDolbyVisionEntries(t *testing.T) {
+	hvcC := func(w *mp4.Writer) {
+		w.WriteHvcC(mp4.HEVCConfig{
+			ConfigurationVersion: 1,
+			PTL:                  mp4.HEVCProfileTierLevel{ProfileIdc: 2, CompatibilityFlags: 0x20000000, LevelIdc: 153},
+			NALLengthSize:        4,
+		})
+	}
+	tests := []struct {
+		name     string
+		entry    func(w *mp4.Writer)
+		codec    string
+		dvCodec  string
+		wantHEVC bool
+	}{
+		{
+			name: "dvh1 profile 5",
+			entry: mp4test.VisualEntry(mp4.TypeDvh1, 640, 360, func(w *mp4.Writer) {
+				hvcC(w)
+				w.WriteDolbyVisionConfig(mp4.DolbyVisionConfig{Profile: 5, Level: 6, RPUPresent: true, BLPresent: true})
+			}),
+			codec: "dvh1.05.06", dvCodec: "dvh1.05.06", wantHEVC: true,
+		},
+		{
+			name: "hvc1 with profile 8.4",
+			entry: mp4test.VisualEntry(mp4.TypeHvc1, 640, 360, func(w *mp4.Writer) {
+				hvcC(w)
+				w.WriteDolbyVisionConfig(mp4.DolbyVisionConfig{Profile: 8, Level: 6, RPUPresent: true, BLPresent: true, BLSignalCompatibilityID: 4})
+			}),
+			codec: "hvc1.2.4.L153", dvCodec: "dvh1.08.06", wantHEVC: true,
+		},
+		{
+			name: "dav1 profile 10",
+			entry: mp4test.VisualEntry(mp4.TypeDav1, 640, 360, func(w *mp4.Writer) {
+				w.StartBox(mp4.BoxType{'a', 'v', '1', 'C'})
+				w.Write([]byte{0x81, 0x08, 0x4c, 0x00})
+				w.EndBox()
+				w.WriteDolbyVisionConfig(mp4.DolbyVisionConfig{Profile: 10, Level: 9, RPUPresent: true, BLPresent: true, BLSignalCompatibilityID: 1})
+			}),
+			codec: "dav1.10.09", dvCodec: "dav1.10.09",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := parseEntry(t, mp4test.Video, tt.entry)
+			if c := tr.Codec(); c != tt.codec {
+				t.Errorf("codec = %q, want %q", c, tt.codec)
+			}
+			if c := tr.DolbyVisionCodec(); c != tt.dvCodec {
+				t.Errorf("Dolby Vision codec = %q, want %q", c, tt.dvCodec)
+			}
+			if (tr.HEVC != nil) != tt.wantHEVC {
+				t.Errorf("HEVC = %v", tr.HEVC)
+			}
+		})
+	}
+}
+
+func TestVVCEntry(t *testing.T) {
+	tr := parseEntry(t, mp4test.Video, mp4test.VisualEntry(mp4.TypeVvc1, 1920, 1080, func(w *mp4.Writer) {
+		w.WriteVvcC(mp4.VVCConfig{
+			NALLengthSize: 4,
+			PTLPresent:    true,
+			NumSublayers:  1,
+			ChromaFormat:  1,
+			BitDepth:      10,
+			PTL:           mp4.VVCPTLRecord{ProfileIdc: 1, LevelIdc: 83, ConstraintInfo: []byte{0x80}},
+		})
+	}))
+	if c := tr.Codec(); c != "vvc1.1.L83.CQA" {
+		t.Errorf("codec = %q, want vvc1.1.L83.CQA", c)
+	}
+	if tr.VVC == nil || tr.Width != 1920 || tr.Height != 1080 {
+		t.Errorf("VVC = %v, size %dx%d", tr.VVC, tr.Width, tr.Height)
+	}
+}
+
+// testEntry is a SampleEntry returned by a registered decoder.
+type testEntry struct {
+	typ  mp4.BoxType
+	kind track.TrackKind
+	size int
+}
+
+func (e *testEntry) Type() mp4.BoxType     { return e.typ }
+func (e *testEntry) Kind() track.TrackKind { return e.kind }
+func (e *testEntry) Codec() string         { return "test" }
+
+func TestRegisterSampleEntry(t *testing.T) {
+	video := mp4.BoxType{'t', 's', 't', 'v'}
+	audio := mp4.BoxType{'t', 's', 't', 'a'}
+	for _, typ := range []mp4.BoxType{video, audio} {
+		kind := track.TrackVideo
+		if typ == audio {
+			kind = track.TrackAudio
+		}
+		prev, ok := track.EntryDecoders[typ]
+		t.Cleanup(func() {
+			if ok {
+				track.EntryDecoders[typ] = prev
+			} else {
+				delete(track.EntryDecoders, typ)
+			}
+		})
+		track.RegisterSampleEntry(typ, func(typ mp4.BoxType, data []byte) (track.SampleEntry, error) {
+			return &testEntry{typ: typ, kind: kind, size: len(data)}, nil
+		})
+	}
+
+	tr := parseEntry(t, mp4test.Video, mp4test.VisualEntry(video, 640, 360, nil))
+	e, ok := tr.Entry.(*testEntry)
+	if !ok {
+		t.Fatalf("entry = %T, want *testEntry", tr.Entry)
+	}
+	if e.size != 78 || tr.Codec() != "test" || tr.Kind != track.TrackVideo {
+		t.Errorf("entry %+v, codec %q, kind %v", e, tr.Codec(), tr.Kind)
+	}
+
+	// An entry whose kind does not match the handler drops the track.
+	m := mp4test.Movie{TimeScale: 1000, Tracks: []mp4test.Track{{
+		ID: 1, Handler: mp4test.Video, TimeScale: 1000,
+		Entry: mp4test.VisualEntry(audio, 640, 360, nil), Samples: [][]byte{{0}}, Duration: 1,
+	}}}
+	tracks, _, err := track.ParseTracks(mp4test.Moov(m.Build()))
+	if err != nil || len(tracks) != 0 {
+		t.Errorf("mismatched kind: got %d tracks, %v, want none", len(tracks), err)
+	}
+}
+
+func TestGenericSampleEntry(t *testing.T) {
+	tests := []struct {
+		handler [4]byte
+		entry   func(w *mp4.Writer)
+		kind    track.TrackKind
+	}{
+		{mp4test.Video, mp4test.VisualEntry(mp4.BoxType{'x', 'v', 'i', 'd'}, 1280, 720, nil), track.TrackVideo},
+		{mp4test.Audio, mp4test.AudioEntry(mp4.BoxType{'x', 'a', 'u', 'd'}, 2, 48000, nil), track.TrackAudio},
+		{mp4test.Subtitle, func(w *mp4.Writer) {
+			w.StartBox(mp4.BoxType{'x', 's', 'u', 'b'})
+			w.Write(make([]byte, 8))
+			w.EndBox()
+		}, track.TrackSubtitle},
+	}
+	for _, tt := range tests {
+		tr := parseEntry(t, tt.handler, tt.entry)
+		typ := tr.Entry.Type()
+		if tr.Kind != tt.kind || tr.Codec() != typ.String() {
+			t.Errorf("%v: kind %v, codec %q", typ, tr.Kind, tr.Codec())
+		}
+		switch e := tr.Entry.(type) {
+		case *track.VideoEntry:
+			if tr.Width != 1280 || tr.Height != 720 || e.Width != 1280 {
+				t.Errorf("%v: size %dx%d", typ, tr.Width, tr.Height)
+			}
+		case *track.AudioEntry:
+			if tr.SampleRate != 48000 || tr.ChannelCount != 2 {
+				t.Errorf("%v: %d Hz, %d channels", typ, tr.SampleRate, tr.ChannelCount)
+			}
+		}
+	}
+}
+
+func TestPCMEntries(t *testing.T) {
+	tests := []struct {
+		name          string
+		entry         func(w *mp4.Writer)
+		want          audioParams
+		bytesPerFrame uint32
+	}{
+		{
+			name: "ipcm",
+			entry: mp4test.AudioEntry(mp4.TypeIpcm, 2, 0, func(w *mp4.Writer) {
+				w.WriteSrat(96000)
+				w.WritePcmC(mp4.PCMConfig{LittleEndian: true, SampleSize: 24})
+			}),
+			want:          audioParams{"ipcm", 96000, 2, 24},
+			bytesPerFrame: 6,
+		},
+		{
+			name: "lpcm",
+			entry: func(w *mp4.Writer) {
+				w.StartBox(mp4.TypeLpcm)
+				w.WriteAudioSampleEntryV2(1, 6, 88200, 32, mp4.LPCMFlagFloat|mp4.LPCMFlagPacked, 24, 1)
+				w.EndBox()
+			},
+			want:          audioParams{"lpcm", 88200, 6, 32},
+			bytesPerFrame: 24,
+		},
+		{
+			name:          "twos",
+			entry:         mp4test.AudioEntry(mp4.TypeTwos, 2, 44100, nil),
+			want:          audioParams{"twos", 44100, 2, 16},
+			bytesPerFrame: 4,
+		},
+		{
+			name:          "in24",
+			entry:         mp4test.AudioEntry(mp4.TypeIn24, 1, 48000, nil),
+			want:          audioParams{"in24", 48000, 1, 24},
+			bytesPerFrame: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := parseEntry(t, mp4test.Audio, tt.entry)
+			checkAudio(t, tr, tt.want)
+			if n := tr.Entry.(*track.AudioEntry).BytesPerFrame; n != tt.bytesPerFrame {
+				t.Errorf("bytes per frame = %d, want %d", n, tt.bytesPerFrame)
+			}
+		})
+	}
+}
+
+func TestChannelLayout(t *testing.T) {
+	chnl := mp4.ChannelLayout{StreamStructure: mp4.ChannelStructured | mp4.ObjectStructured, DefinedLayout: 6, ObjectCount: 2}
+	chan51 := mp4.AudioChannelLayout{Tag: 121<<16 | 6}
+
+	tr := parseEntry(t, mp4test.Audio, mp4test.AudioEntry(mp4.TypeIpcm, 6, 48000, func(w *mp4.Writer) {
+		w.WritePcmC(mp4.PCMConfig{SampleSize: 16})
+		w.WriteChnl(chnl)
+		w.WriteChan(chan51)
+	}))
+	l := tr.ChannelLayout
+	if l == nil || l.ISO == nil || l.QuickTime == nil {
+		t.Fatalf("layout = %+v, want chnl and chan", l)
+	}
+	if l.Channels != 6 || l.Objects != 2 {
+		t.Errorf("chnl: channels %d, objects %d, want 6 and 2", l.Channels, l.Objects)
+	}
+
+	tr = parseEntry(t, mp4test.Audio, mp4test.AudioEntry(mp4.TypeSowt, 6, 48000, func(w *mp4.Writer) {
+		w.WriteChan(mp4.AudioChannelLayout{Tag: mp4.ChannelLayoutTagUseBitmap, Bitmap: 0x0f})
+	}))
+	if l := tr.ChannelLayout; l == nil || l.ISO != nil || l.Channels != 4 {
+		t.Errorf("chan: layout = %+v, want 4 channels", l)
+	}
+
+	tr = parseEntry(t, mp4test.Audio, mp4test.AudioEntry(mp4.TypeSowt, 2, 48000, nil))
+	if tr.ChannelLayout != nil {
+		t.Errorf("no layout boxes: layout = %+v, want nil", tr.ChannelLayout)
+	}
+}
+
+func TestAC4Entry(t *testing.T) {
+	// A dac4 box with a 5.1 presentation, bitstream version 2,
+	// presentation version 1 and compatibility level 3.
+	dac4 := []byte{
+		0x20, 0xa2, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x01, 0x08, 0x03, 0x00, 0x00, 0x09, 0x00, 0x00, 0x11, 0xc0, 0x01, 0x01, 0x30,
+	}
+	tr := parseEntry(t, mp4test.Audio, mp4test.AudioEntry(mp4.TypeAc4, 2, 44100, func(w *mp4.Writer) {
+		w.StartBox(mp4.TypeDac4)
+		w.Write(dac4)
+		w.EndBox()
+	}))
+	checkAudio(t, tr, audioParams{"ac-4.02.01.03", 48000, 6, 0})
+	if _, ok := tr.Entry.(*track.AudioEntry).Config.(*mp4.AC4Config); !ok {
+		t.Errorf("config = %T, want *mp4.AC4Config", tr.Entry.(*track.AudioEntry).Config)
+	}
+}
+
+func TestMPEGHEntry(t *testing.T) {
+	tr := parseEntry(t, mp4test.Audio, mp4test.AudioEntry(mp4.TypeMha1, 2, 48000, func(w *mp4.Writer) {
+		w.WriteMhaC(mp4.MHAConfig{ProfileLevelIndication: 0x0d, ReferenceChannelLayout: 6, Config: []byte{0}})
+	}))
+	checkAudio(t, tr, audioParams{"mha1.0x0D", 48000, 6, 0})
+
+	// mhm1 entries may carry the configuration in band only.
+	tr = parseEntry(t, mp4test.Audio, mp4test.AudioEntry(mp4.TypeMhm1, 2, 48000, nil))
+	checkAudio(t, tr, audioParams{"mhm1", 48000, 2, 0})
+}
+
+func TestAV1Entry(t *testing.T) {
+	c := mp4.AV1Config{SeqLevelIdx0: 8, HighBitdepth: true, ChromaSubsamplingX: true, ChromaSubsamplingY: true}
+	tr := parseEntry(t, mp4test.Video, mp4test.VisualEntry(mp4.TypeAv01, 640, 360, func(w *mp4.Writer) {
+		w.WriteAv1C(c)
+	}))
+	if s := tr.Codec(); s != "av01.0.08M.10" {
+		t.Errorf("codec = %q, want av01.0.08M.10", s)
+	}
+	if tr.AV1 == nil || tr.AV1.BitDepth() != 10 {
+		t.Errorf("AV1 config = %+v", tr.AV1)
+	}
+
+	// dav1 entries take their codec string from the Dolby Vision
+	// configuration but still carry av1C.
+	tr = parseEntry(t, mp4test.Video, mp4test.VisualEntry(mp4.TypeDav1, 640, 360, func(w *mp4.Writer) {
+		w.WriteAv1C(c)
+		w.WriteDolbyVisionConfig(mp4.DolbyVisionConfig{Profile: 10, Level: 9, RPUPresent: true, BLPresent: true, BLSignalCompatibilityID: 1})
+	}))
+	if s := tr.Codec(); s != "dav1.10.09" || tr.AV1 == nil || tr.HEVC != nil {
+		t.Errorf("dav1: codec %q, AV1 %+v, HEVC %+v", s, tr.AV1, tr.HEVC)
+	}
+}
+
+func TestProtectedEntries(t *testing.T) {
+	kid := [16]byte{0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f}
+	sinf := func(format mp4.BoxType) mp4.ProtectionInfo {
+		return mp4.ProtectionInfo{
+			OriginalFormat: format,
+			Scheme:         mp4.ProtectionScheme{Type: mp4.SchemeCENC, Version: 0x00010000},
+			Encryption:     &mp4.TrackEncryption{DefaultIsProtected: true, DefaultPerSampleIVSize: 8, DefaultKID: kid},
+		}
+	}
+
+	tr := parseEntry(t, mp4test.Video, mp4test.VisualEntry(mp4.TypeEncv, 640, 360, func(w *mp4.Writer) {
+		w.WriteAv1C(mp4.AV1Config{SeqLevelIdx0: 8})
+		w.WriteSinf(sinf(mp4.TypeAv01))
+	}))
+	if tr.Codec() != "av01.0.08M.08" || tr.Entry.Type() != mp4.TypeEncv || tr.AV1 == nil {
+		t.Errorf("encv: codec %q, entry %v", tr.Codec(), tr.Entry.Type())
+	}
+	if tr.Protection == nil || tr.Protection.OriginalFormat != mp4.TypeAv01 {
+		t.Errorf("encv: protection = %+v", tr.Protection)
+	}
+	if id, ok := tr.DefaultKID(); !ok || id != kid {
+		t.Errorf("encv: default KID = %x, %v", id, ok)
+	}
+
+	si := mp4.FlacStreamInfo{MinBlockSize: 4096, MaxBlockSize: 4096, SampleRate: 48000, Channels: 2, BitsPerSample: 16}
+	tr = parseEntry(t, mp4test.Audio, mp4test.AudioEntry(mp4.TypeEnca, 2, 48000, func(w *mp4.Writer) {
+		w.WriteDfla(mp4.FlacConfig{Blocks: []mp4.FlacMetadataBlock{si.Block()}})
+		w.WriteSinf(sinf(mp4.TypeFlac))
+	}))
+	checkAudio(t, tr, audioParams{"flac", 48000, 2, 16})
+	if tr.Entry.Type() != mp4.TypeEnca || tr.Protection == nil || tr.Protection.Scheme.Type != mp4.SchemeCENC {
+		t.Errorf("enca: entry %v, protection %+v", tr.Entry.Type(), tr.Protection)
+	}
+
+	xvid := mp4.BoxType{'x', 'v', 'i', 'd'}
+	tr = parseEntry(t, mp4test.Video, mp4test.VisualEntry(mp4.TypeEncv, 1280, 720, func(w *mp4.Writer) {
+		w.WriteSinf(sinf(xvid))
+	}))
+	if tr.Kind != track.TrackVideo || tr.Codec() != "xvid" || tr.Entry.Type() != mp4.TypeEncv {
+		t.Errorf("encv with unknown frma: kind %v, codec %q, entry %v", tr.Kind, tr.Codec(), tr.Entry)
+	}
+	if tr.Width != 1280 || tr.Height != 720 || tr.Protection == nil || tr.Protection.OriginalFormat != xvid {
+		t.Errorf("encv with unknown frma: size %dx%d, protection %+v", tr.Width, tr.Height, tr.Protection)
+	}
+
+	tr = parseEntry(t, mp4test.Audio, mp4test.AudioEntry(mp4.TypeFlac, 2, 48000, func(w *mp4.Writer) {
+		w.WriteDfla(mp4.FlacConfig{Blocks: []mp4.FlacMetadataBlock{si.Block()}})
+	}))
+	if _, ok := tr.DefaultKID(); ok || tr.Protection != nil {
+		t.Error("clear track reports protection")
+	}
+}
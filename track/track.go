@@ -3,6 +3,7 @@ package track
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/tetsuo/mp4"
 )
@@ -13,6 +14,7 @@ type TrackKind int
 const (
 	TrackVideo TrackKind = iota
 	TrackAudio
+	TrackSubtitle
 )
 
 // trackRaw holds internal parsing state and raw box data.
@@ -23,6 +25,9 @@ type trackRaw struct {
 	mdhd []byte // mdhd data (after version+flags header)
 	hdlr []byte // entire hdlr raw box
 	dinf []byte // entire dinf raw box
+	edts []byte // entire edts raw box, nil if absent
+
+	movieTimeScale uint32 // mvhd timescale, which edts durations are in
 
 	tkhdVersion uint8
 	tkhdFlags   uint32
@@ -42,9 +47,8 @@ type trackRaw struct {
 	hasCo64     bool
 	sampleCount uint32
 
-	// Codec string builder buffer.
-	codecBuf [24]byte
-	codecLen uint8
+	// Sample defaults of track fragments from trex.
+	trex mp4.SampleDefaults
 }
 
 // Track holds metadata for one track parsed from a moov box.
@@ -57,7 +61,65 @@ type Track struct {
 	Width        uint16
 	Height       uint16
 	ChannelCount uint16
-	SampleRate   uint32
+	SampleRate   uint32 // in Hz
+	BitDepth     uint16 // bits per audio sample, 0 if not signalled
+
+	// BytesPerFrame is the size of one uncompressed audio sample across all
+	// channels, 0 for compressed audio.
+	BytesPerFrame uint32
+
+	// Picture size from the video bitstream parameter sets. Coded size is the
+	// decoded frame before cropping; display size applies the crop window and
+	// sample aspect ratio. Zero when no parameter set could be parsed.
+	CodedWidth    uint32
+	CodedHeight   uint32
+	DisplayWidth  uint32
+	DisplayHeight uint32
+
+	AVC     *mp4.AVCConfig  // decoded avcC record, nil for non-AVC tracks
+	AVCSPS  *mp4.AVCSPS     // first SPS from avcC, nil if absent or unparsable
+	HEVC    *mp4.HEVCConfig // decoded hvcC record, nil for non-HEVC tracks
+	HEVCSPS *mp4.HEVCSPS    // first SPS from hvcC, nil if absent or unparsable
+	VVC     *mp4.VVCConfig  // decoded vvcC record, nil for non-VVC tracks
+	AV1     *mp4.AV1Config  // decoded av1C record, nil for non-AV1 tracks
+
+	// Dolby Vision configuration from dvcC, dvvC or dvwC. Set for Dolby
+	// Vision sample entries and for backward-compatible hvc1/avc1 entries
+	// that carry one.
+	DolbyVision *mp4.DolbyVisionConfig
+
+	// Entry is the decoded first stsd sample entry.
+	Entry SampleEntry
+
+	// Visual sample entry, including pasp, btrt, colr, clap, mdcv and clli
+	// extensions; nil for non-video tracks.
+	Visual *mp4.VisualSampleEntry
+
+	ESDS *mp4.ESDescriptor        // decoded esds descriptor, nil for non-mp4a tracks
+	AAC  *mp4.AudioSpecificConfig // MPEG-4 audio config from esds, nil if absent
+
+	// References lists the tracks this track references by tref type, e.g.
+	// the chapter track under mp4.TypeChap, or for a subtitle track the
+	// track it subtitles under mp4.TypeSubt. Nil if the track has no tref.
+	References mp4.TrackReferences
+
+	// Grouping and selection metadata. AlternateGroup is from tkhd, 0 if
+	// the track has no alternatives; TrackGroups from trgr; Selection,
+	// Kinds and Labels from the tsel, kind and labl boxes in trak/udta.
+	AlternateGroup int16
+	TrackGroups    []mp4.TrackGroup
+	Selection      *mp4.TrackSelection
+	Kinds          []mp4.Kind
+	Labels         []mp4.Label
+
+	// Channel layout from the chnl or chan box of the audio sample entry,
+	// nil if the entry has neither.
+	ChannelLayout *ChannelLayout
+
+	// Protection is the sinf box of encv and enca sample entries: the
+	// original format, the protection scheme and the tenc defaults. Nil
+	// for unencrypted tracks.
+	Protection *mp4.ProtectionInfo
 
 	Samples       []Sample
 	SampleDescIdx uint32
@@ -66,6 +128,31 @@ type Track struct {
 	raw   trackRaw
 }
 
+// ChannelLayout is the loudspeaker layout of an audio track. A chnl box is
+// preferred over a QuickTime chan box when an entry carries both.
+type ChannelLayout struct {
+	Channels int // loudspeaker channels present, e.g. for the HLS CHANNELS attribute
+	Objects  int // audio objects, chnl only
+
+	ISO       *mp4.ChannelLayout      // decoded chnl box, nil if absent
+	QuickTime *mp4.AudioChannelLayout // decoded chan box, nil if absent
+}
+
+// setChannelLayout records the channel layout boxes of an audio entry.
+func (t *Track) setChannelLayout(a *mp4.AudioSampleEntry) {
+	if a.Chnl == nil && a.Chan == nil {
+		return
+	}
+	l := &ChannelLayout{ISO: a.Chnl, QuickTime: a.Chan}
+	if a.Chnl != nil {
+		l.Channels = a.Chnl.Channels()
+		l.Objects = int(a.Chnl.ObjectCount)
+	} else {
+		l.Channels = a.Chan.Channels()
+	}
+	t.ChannelLayout = l
+}
+
 // Codec returns the MIME codec string (e.g. "avc1.64001e", "mp4a.40.2").
 func (t *Track) Codec() string { return t.codec }
 
@@ -84,6 +171,13 @@ func (t *Track) HdlrRaw() []byte { return t.raw.hdlr }
 // DinfRaw returns the entire dinf raw box.
 func (t *Track) DinfRaw() []byte { return t.raw.dinf }
 
+// EdtsRaw returns the entire edts raw box, nil if the track has no edit
+// list. Its segment durations are in MovieTimeScale units.
+func (t *Track) EdtsRaw() []byte { return t.raw.edts }
+
+// MovieTimeScale returns the timescale of the movie header.
+func (t *Track) MovieTimeScale() uint32 { return t.raw.movieTimeScale }
+
 // TkhdVersion returns the version field of the tkhd box.
 func (t *Track) TkhdVersion() uint8 { return t.raw.tkhdVersion }
 
@@ -109,114 +203,188 @@ func FindTrack(tracks []*Track, id uint32) *Track {
 	return nil
 }
 
-func (t *Track) setCodec(s string) {
-	n := copy(t.raw.codecBuf[:], s)
-	t.raw.codecLen = uint8(n)
+// ReferencedTracks returns the tracks among tracks that t references with
+// the given tref type, in reference order. IDs with no matching track are
+// skipped.
+func (t *Track) ReferencedTracks(tracks []*Track, refType mp4.BoxType) []*Track {
+	var refs []*Track
+	for _, id := range t.References[refType] {
+		if rt := FindTrack(tracks, id); rt != nil {
+			refs = append(refs, rt)
+		}
+	}
+	return refs
+}
+
+// Roles returns the values of the track's kind boxes in the DASH role
+// scheme, e.g. "main", "caption" or "description".
+func (t *Track) Roles() []string {
+	var roles []string
+	for _, k := range t.Kinds {
+		if k.SchemeURI == mp4.SchemeDASHRole && k.Value != "" {
+			roles = append(roles, k.Value)
+		}
+	}
+	return roles
+}
+
+// DefaultKID returns the default key ID from the tenc box of an encrypted
+// track, and false if the track is unencrypted or has no tenc.
+func (t *Track) DefaultKID() ([16]byte, bool) {
+	if t.Protection == nil || t.Protection.Encryption == nil {
+		return [16]byte{}, false
+	}
+	return t.Protection.Encryption.DefaultKID, true
 }
 
-func (t *Track) appendCodec(s string) {
-	n := copy(t.raw.codecBuf[t.raw.codecLen:], s)
-	t.raw.codecLen += uint8(n)
+// setAVCSPS records the SPS and the picture sizes derived from it.
+func (t *Track) setAVCSPS(sps *mp4.AVCSPS) {
+	t.AVCSPS = sps
+	t.CodedWidth = sps.CodedWidth
+	t.CodedHeight = sps.CodedHeight
+	t.DisplayWidth, t.DisplayHeight = sps.VUI.DisplaySize(sps.Width(), sps.Height())
 }
 
-// appendAvcCProfile appends "XXYYZZ" hex profile to the codec buffer.
-func (t *Track) appendAvcCProfile(profile, compat, level byte) {
-	i := t.raw.codecLen
-	t.raw.codecBuf[i+0] = hexChars[profile>>4]
-	t.raw.codecBuf[i+1] = hexChars[profile&0x0f]
-	t.raw.codecBuf[i+2] = hexChars[compat>>4]
-	t.raw.codecBuf[i+3] = hexChars[compat&0x0f]
-	t.raw.codecBuf[i+4] = hexChars[level>>4]
-	t.raw.codecBuf[i+5] = hexChars[level&0x0f]
-	t.raw.codecLen += 6
+// setHEVCSPS records the SPS and the picture sizes derived from it.
+func (t *Track) setHEVCSPS(sps *mp4.HEVCSPS) {
+	t.HEVCSPS = sps
+	t.CodedWidth = sps.CodedWidth
+	t.CodedHeight = sps.CodedHeight
+	t.DisplayWidth, t.DisplayHeight = sps.VUI.DisplaySize(sps.Width(), sps.Height())
 }
 
-// appendEsdsCodec appends ".OTI.audioConfig" to the codec buffer from esds data.
-func (t *Track) appendEsdsCodec(data []byte) {
-	oti, audioConfig := parseEsds(data)
-	if oti == 0 {
+// setVisual records the sample entry and applies its clean aperture and
+// pixel aspect ratio to the display size. These container-level boxes take
+// precedence over the bitstream crop window and VUI aspect ratio.
+func (t *Track) setVisual(v *mp4.VisualSampleEntry) {
+	t.Visual = v
+	if v.Clap == nil && v.Pasp == nil {
 		return
 	}
-	t.appendCodec(".")
-	if oti >= 16 {
-		t.raw.codecBuf[t.raw.codecLen] = hexChars[oti>>4]
-		t.raw.codecLen++
+	w, h := uint32(v.Width), uint32(v.Height)
+	if t.CodedWidth != 0 {
+		w, h = t.CodedWidth, t.CodedHeight
 	}
-	t.raw.codecBuf[t.raw.codecLen] = hexChars[oti&0x0f]
-	t.raw.codecLen++
-	if audioConfig > 0 {
-		t.appendCodec(".")
-		if audioConfig >= 10 {
-			t.raw.codecBuf[t.raw.codecLen] = '0' + audioConfig/10
-			t.raw.codecLen++
+	if v.Clap != nil {
+		if cw, ch := v.Clap.Size(); cw != 0 && ch != 0 {
+			w, h = cw, ch
 		}
-		t.raw.codecBuf[t.raw.codecLen] = '0' + audioConfig%10
-		t.raw.codecLen++
-	}
+	} else if s := t.AVCSPS; s != nil {
+		w, h = s.Width(), s.Height()
+	} else if s := t.HEVCSPS; s != nil {
+		w, h = s.Width(), s.Height()
+	}
+	if p := v.Pasp; p != nil && p.HSpacing != 0 && p.VSpacing != 0 {
+		w = uint32(uint64(w) * uint64(p.HSpacing) / uint64(p.VSpacing))
+	} else if s := t.AVCSPS; s != nil {
+		w, h = s.VUI.DisplaySize(w, h)
+	} else if s := t.HEVCSPS; s != nil {
+		w, h = s.VUI.DisplaySize(w, h)
+	}
+	t.DisplayWidth, t.DisplayHeight = w, h
 }
 
-// parseEsds extracts OTI and audio object type from esds box data.
-func parseEsds(data []byte) (oti, audioConfig byte) {
-	if len(data) < 2 {
-		return 0, 0
-	}
-	ptr, end := 0, len(data)
-	if data[ptr] != 0x03 {
-		return 0, 0
-	}
-	ptr++
-	ptr = skipDescLen(data, ptr, end)
-	if ptr < 0 || ptr+3 > end {
-		return 0, 0
-	}
-	flags := data[ptr+2]
-	ptr += 3
-	if flags&0x80 != 0 {
-		ptr += 2
-	}
-	if flags&0x40 != 0 {
-		if ptr >= end {
-			return 0, 0
+// applyEntry records the decoded sample entry and copies its kind, codec
+// string, dimensions or audio parameters and configuration onto the track.
+func (t *Track) applyEntry(entry SampleEntry) {
+	t.Entry = entry
+	t.Kind = entry.Kind()
+	t.codec = entry.Codec()
+
+	switch e := entry.(type) {
+	case *VideoEntry:
+		t.Width = e.Width
+		t.Height = e.Height
+		switch c := e.Config.(type) {
+		case *mp4.AVCConfig:
+			t.AVC = c
+			if len(c.SPS) > 0 {
+				if sps, err := mp4.ReadAVCSPS(c.SPS[0]); err == nil {
+					t.setAVCSPS(&sps)
+				}
+			}
+		case *mp4.HEVCConfig:
+			t.HEVC = c
+			if sps := c.NALUnits(mp4.HEVCNALSPS); len(sps) > 0 {
+				if s, err := mp4.ReadHEVCSPS(sps[0]); err == nil {
+					t.setHEVCSPS(&s)
+				}
+			}
+		case *mp4.VVCConfig:
+			t.VVC = c
+		case *mp4.AV1Config:
+			t.AV1 = c
+		}
+		t.DolbyVision = e.DolbyVision
+		t.Protection = e.Sinf
+		t.setVisual(&e.VisualSampleEntry)
+	case *AudioEntry:
+		t.ChannelCount = e.Channels
+		t.SampleRate = e.SampleRateHz
+		t.BitDepth = e.BitDepth
+		t.BytesPerFrame = e.BytesPerFrame
+		t.Protection = e.Sinf
+		t.setChannelLayout(&e.AudioSampleEntry)
+		if es, ok := e.Config.(*mp4.ESDescriptor); ok {
+			t.ESDS = es
+			if es.DecoderConfig.ObjectTypeIndication == mp4.OTIMPEG4Audio {
+				if asc, err := es.AudioSpecificConfig(); err == nil {
+					t.AAC = &asc
+				}
+			}
 		}
-		ptr += 1 + int(data[ptr])
-	}
-	if flags&0x20 != 0 {
-		ptr += 2
-	}
-	if ptr >= end || data[ptr] != 0x04 {
-		return 0, 0
-	}
-	ptr++
-	ptr = skipDescLen(data, ptr, end)
-	if ptr < 0 || ptr+13 > end {
-		return 0, 0
-	}
-	oti = data[ptr]
-	if oti == 0 {
-		return 0, 0
-	}
-	ptr += 13
-	if ptr >= end || data[ptr] != 0x05 {
-		return oti, 0
 	}
-	ptr++
-	ptr = skipDescLen(data, ptr, end)
-	if ptr < 0 || ptr >= end {
-		return oti, 0
+}
+
+// DolbyVisionCodec returns the Dolby Vision codec string, e.g.
+// "dvh1.08.06", or "" if the track has no Dolby Vision configuration. For
+// backward-compatible entries such as hvc1 with dvvC, this is the codec
+// to signal alongside Codec (as HLS SUPPLEMENTAL-CODECS).
+func (t *Track) DolbyVisionCodec() string {
+	if t.DolbyVision == nil {
+		return ""
+	}
+	var fourcc string
+	switch {
+	case t.HEVC != nil:
+		fourcc = "dvhe"
+		if len(t.codec) >= 4 && (t.codec[:4] == "hvc1" || t.codec[:4] == "dvh1") {
+			fourcc = "dvh1"
+		}
+	case t.AVC != nil:
+		fourcc = "dva1"
+	default:
+		fourcc = "dav1"
 	}
-	audioConfig = (data[ptr] & 0xf8) >> 3
-	return oti, audioConfig
+	return fourcc + "." + t.DolbyVision.Codec()
 }
 
-func skipDescLen(data []byte, ptr, end int) int {
-	for ptr < end {
-		b := data[ptr]
-		ptr++
-		if b&0x80 == 0 {
-			return ptr
+// VideoRange returns the HLS VIDEO-RANGE of a video track ("SDR", "PQ" or
+// "HLG") from the transfer characteristics signalled in the colr box, the
+// Dolby Vision base layer compatibility, or the SPS VUI, in that order.
+func (t *Track) VideoRange() string {
+	if t.Visual != nil {
+		if r, ok := t.Visual.VideoRange(); ok {
+			return r
+		}
+	}
+	if dv := t.DolbyVision; dv != nil {
+		switch dv.BLSignalCompatibilityID {
+		case 0, 1, 6: // none (profile 5 is PQ), HDR10
+			return "PQ"
+		case 2:
+			return "SDR"
+		case 4:
+			return "HLG"
 		}
 	}
-	return -1
+	switch {
+	case t.HEVCSPS != nil && t.HEVCSPS.VUI.ColourDescription:
+		return mp4.VideoRange(t.HEVCSPS.VUI.TransferCharacteristics)
+	case t.AVCSPS != nil && t.AVCSPS.VUI.ColourDescription:
+		return mp4.VideoRange(t.AVCSPS.VUI.TransferCharacteristics)
+	}
+	return "SDR"
 }
 
 // Sample represents a single media sample.
@@ -235,6 +403,14 @@ func (s Sample) PTS() int64 {
 	return s.DTS + int64(s.PresentationOffset)
 }
 
+// TicksToDuration converts ticks of a timescale, which must not be zero, to
+// a duration. Whole seconds are split off first so that the conversion does
+// not overflow for long tracks.
+func TicksToDuration(ticks int64, timescale uint32) time.Duration {
+	ts := int64(timescale)
+	return time.Duration(ticks/ts)*time.Second + time.Duration(ticks%ts)*time.Second/time.Duration(ts)
+}
+
 // TrackSampleStats holds aggregated stats for samples belonging to one track.
 type TrackSampleStats struct {
 	TrackID     uint32
@@ -290,17 +466,24 @@ func CollectTrackSampleStats(dst []TrackSampleStats, tracks []*Track, samples []
 var (
 	htVide = [4]byte{'v', 'i', 'd', 'e'}
 	htSoun = [4]byte{'s', 'o', 'u', 'n'}
+	htText = [4]byte{'t', 'e', 'x', 't'}
+	htSubt = [4]byte{'s', 'u', 'b', 't'}
+	htSbtl = [4]byte{'s', 'b', 't', 'l'} // QuickTime subtitles
 )
 
 var (
 	ErrMoovNotFound = errors.New("moov box not found in buffer")
 	ErrInvalidTrack = errors.New("invalid track data")
 	ErrCorruptData  = errors.New("corrupt data")
+	ErrMoofNotFound = errors.New("moof box not found in buffer")
 )
 
 // ParseTracks parses a moov box buffer and returns the tracks found with
 // their samples fully populated. The moov buffer must include the box header
 // (the full top-level moov box). The movie duration (from mvhd) is also returned.
+// Samples of fragmented files are added by ParseFragment or ParseFragments,
+// and parameters only the sample data carries, such as those of MP3
+// tracks, by ProbeTracks.
 //
 // Returns an error if the moov box is not found, if no playable tracks are
 // found, or if sample tables cannot be parsed for any track.
@@ -311,14 +494,24 @@ func ParseTracks(moovBuf []byte) ([]*Track, uint64, error) {
 	}
 
 	var tracks []*Track
+	var timescale uint32
 	var duration uint64
+	trex := make(map[uint32]mp4.SampleDefaults)
 
 	mr.Enter()
 	for mr.Next() {
 		switch mr.Type() {
 		case mp4.TypeMvhd:
-			_, dur, _ := mr.ReadMvhd()
-			duration = dur
+			timescale, duration, _ = mr.ReadMvhd()
+		case mp4.TypeMvex:
+			mr.Enter()
+			for mr.Next() {
+				if mr.Type() == mp4.TypeTrex && len(mr.Data()) >= 20 {
+					id, _, dur, size, flags := mr.ReadTrex()
+					trex[id] = mp4.SampleDefaults{Duration: dur, Size: size, Flags: flags}
+				}
+			}
+			mr.Exit()
 		case mp4.TypeTrak:
 			track := parseTrak(&mr)
 			if track != nil {
@@ -331,6 +524,8 @@ func ParseTracks(moovBuf []byte) ([]*Track, uint64, error) {
 	// Parse samples for all tracks; filter out those that fail
 	var valid []*Track
 	for _, t := range tracks {
+		t.raw.trex = trex[t.ID]
+		t.raw.movieTimeScale = timescale
 		if err := t.parseSamples(); err != nil {
 			continue
 		}
@@ -356,21 +551,54 @@ func parseTrak(mr *mp4.Reader) *Track {
 			track.ID = trackId
 			track.Width = uint16(w >> 16)
 			track.Height = uint16(h >> 16)
+			track.AlternateGroup = mr.ReadTkhdAlternateGroup()
+		case mp4.TypeEdts:
+			track.raw.edts = mr.RawBox()
+		case mp4.TypeTref:
+			if refs, err := mp4.ReadTref(mr.Data()); err == nil {
+				track.References = refs
+			}
+		case mp4.TypeTrgr:
+			if groups, err := mp4.ReadTrgr(mr.Data()); err == nil {
+				track.TrackGroups = groups
+			}
+		case mp4.TypeUdta:
+			parseTrakUdta(mr, track)
 		case mp4.TypeMdia:
 			parseMdia(mr, track)
 		}
 	}
 
-	if track.ID == 0 || track.raw.codecLen == 0 {
+	if track.ID == 0 || track.codec == "" {
 		return nil
 	}
 
-	// Finalize codec string
-	track.codec = string(track.raw.codecBuf[:track.raw.codecLen])
-
 	return track
 }
 
+// parseTrakUdta reads the track selection, kind and label boxes.
+func parseTrakUdta(mr *mp4.Reader, track *Track) {
+	mr.Enter()
+	defer mr.Exit()
+
+	for mr.Next() {
+		switch mr.Type() {
+		case mp4.TypeTsel:
+			if s, err := mp4.ReadTsel(mr.Data()); err == nil {
+				track.Selection = &s
+			}
+		case mp4.TypeKind:
+			if k, err := mp4.ReadKind(mr.Data()); err == nil {
+				track.Kinds = append(track.Kinds, k)
+			}
+		case mp4.TypeLabl:
+			if l, err := mp4.ReadLabl(mr.Data()); err == nil {
+				track.Labels = append(track.Labels, l)
+			}
+		}
+	}
+}
+
 func parseMdia(mr *mp4.Reader, track *Track) {
 	mr.Enter()
 	defer mr.Exit()
@@ -469,48 +697,18 @@ func parseStsd(mr *mp4.Reader, track *Track, handlerType [4]byte) {
 		return
 	}
 
-	entryType := mr.Type()
-	entryData := mr.Data()
-
-	if handlerType == htVide && entryType == mp4.TypeAvc1 {
-		track.Kind = TrackVideo
-		track.setCodec("avc1")
-		if len(entryData) >= 78 {
-			v := mp4.ReadVisualSampleEntry(entryData)
-			track.Width = v.Width
-			track.Height = v.Height
-
-			mr.Enter()
-			mr.Skip(v.ChildOffset)
-			for mr.Next() {
-				if mr.Type() == mp4.TypeAvcC {
-					d := mr.Data()
-					if len(d) >= 4 {
-						track.appendCodec(".")
-						track.appendAvcCProfile(d[1], d[2], d[3])
-					}
-					break
-				}
-			}
-			mr.Exit()
+	// Entries without a registered decoder are read as generic entries of
+	// the handler's kind. Entries that fail to decode, or whose kind does
+	// not match the handler, leave the codec unset and the track is
+	// dropped by parseTrak.
+	kind, ok := handlerKind(handlerType)
+	if ok {
+		dec := entryDecoders[mr.Type()]
+		if dec == nil {
+			dec = genericEntryDecoder(kind)
 		}
-	} else if handlerType == htSoun && entryType == mp4.TypeMp4a {
-		track.Kind = TrackAudio
-		track.setCodec("mp4a")
-		if len(entryData) >= 28 {
-			a := mp4.ReadAudioSampleEntry(entryData)
-			track.ChannelCount = a.ChannelCount
-			track.SampleRate = a.SampleRate >> 16
-
-			mr.Enter()
-			mr.Skip(a.ChildOffset)
-			for mr.Next() {
-				if mr.Type() == mp4.TypeEsds {
-					track.appendEsdsCodec(mr.Data())
-					break
-				}
-			}
-			mr.Exit()
+		if entry, err := dec(mr.Type(), mr.Data()); err == nil && entry.Kind() == kind {
+			track.applyEntry(entry)
 		}
 	}
 
@@ -698,5 +896,3 @@ func (t *Track) parseSamples() error {
 	t.SampleDescIdx = curStsc.SampleDescriptionId
 	return nil
 }
-
-const hexChars = "0123456789abcdef"
@@ -0,0 +1,100 @@
+package track_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tetsuo/mp4"
+	"github.com/tetsuo/mp4/internal/mp4test"
+	"github.com/tetsuo/mp4/track"
+)
+
+// textTrack is a one-second wvtt track.
+func textTrack(id uint32, extra func(w *mp4.Writer)) mp4test.Track {
+	return mp4test.Track{
+		ID: id, Handler: mp4test.Text, TimeScale: 1000,
+		Entry:    func(w *mp4.Writer) { w.WriteWVTTSampleEntry(1, "WEBVTT", "") },
+		Samples:  [][]byte{vttSample()},
+		Duration: 1000,
+		Extra:    extra,
+	}
+}
+
+func parseMovie(t *testing.T, m mp4test.Movie) []*track.Track {
+	t.Helper()
+	tracks, _, err := track.ParseTracks(mp4test.Moov(m.Build()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tracks
+}
+
+func TestTrackReferences(t *testing.T) {
+	subt := mp4.BoxType{'s', 'u', 'b', 't'}
+	tracks := parseMovie(t, mp4test.Movie{TimeScale: 1000, Tracks: []mp4test.Track{
+		videoTrack(nil),
+		textTrack(2, func(w *mp4.Writer) { w.WriteTref(mp4.TrackReferences{subt: {1}}) }),
+		textTrack(3, func(w *mp4.Writer) { w.WriteTref(mp4.TrackReferences{subt: {9, 1}, mp4.TypeChap: {2}}) }),
+	}})
+	if len(tracks) != 3 {
+		t.Fatalf("got %d tracks, want 3", len(tracks))
+	}
+	if tracks[0].References != nil {
+		t.Errorf("track 1: references = %v, want nil", tracks[0].References)
+	}
+	want := mp4.TrackReferences{subt: {9, 1}, mp4.TypeChap: {2}}
+	if !reflect.DeepEqual(tracks[2].References, want) {
+		t.Errorf("track 3: references = %v, want %v", tracks[2].References, want)
+	}
+
+	// The missing track 9 is skipped.
+	refs := tracks[2].ReferencedTracks(tracks, subt)
+	if len(refs) != 1 || refs[0] != tracks[0] {
+		t.Errorf("subt tracks = %v, want track 1", refs)
+	}
+	if refs := tracks[1].ReferencedTracks(tracks, mp4.TypeChap); refs != nil {
+		t.Errorf("chap tracks of track 2 = %v, want none", refs)
+	}
+	if track.FindTrack(tracks, 3) != tracks[2] || track.FindTrack(tracks, 4) != nil {
+		t.Error("FindTrack returned the wrong track")
+	}
+}
+
+func TestTrackGrouping(t *testing.T) {
+	en := mp4.Label{Language: "en", Text: "English"}
+	group := mp4.Label{IsGroupLabel: true, ID: 1, Language: "en", Text: "Subtitles"}
+	sel := mp4.TrackSelection{SwitchGroup: 1, Attributes: []mp4.BoxType{{'l', 'a', 'n', 'g'}}}
+	a := textTrack(2, func(w *mp4.Writer) {
+		w.WriteTrgr([]mp4.TrackGroup{{Type: mp4.TypeMsrc, ID: 5}})
+		w.StartBox(mp4.TypeUdta)
+		w.WriteTsel(sel)
+		w.WriteKind(mp4.Kind{SchemeURI: mp4.SchemeDASHRole, Value: "subtitle"})
+		w.WriteKind(mp4.Kind{SchemeURI: "urn:example", Value: "other"})
+		w.WriteKind(mp4.Kind{SchemeURI: mp4.SchemeDASHRole, Value: "main"})
+		w.WriteLabl(en)
+		w.WriteLabl(group)
+		w.EndBox()
+	})
+	a.AlternateGroup = 1
+	tracks := parseMovie(t, mp4test.Movie{TimeScale: 1000, Tracks: []mp4test.Track{videoTrack(nil), a}})
+
+	v, tr := tracks[0], tracks[1]
+	if v.AlternateGroup != 0 || v.TrackGroups != nil || v.Selection != nil || v.Kinds != nil || v.Labels != nil {
+		t.Errorf("video track has grouping metadata: %+v", v)
+	}
+	if tr.AlternateGroup != 1 {
+		t.Errorf("alternate group = %d, want 1", tr.AlternateGroup)
+	}
+	if want := []mp4.TrackGroup{{Type: mp4.TypeMsrc, ID: 5}}; !reflect.DeepEqual(tr.TrackGroups, want) {
+		t.Errorf("track groups = %+v, want %+v", tr.TrackGroups, want)
+	}
+	if tr.Selection == nil || !reflect.DeepEqual(*tr.Selection, sel) {
+		t.Errorf("selection = %+v, want %+v", tr.Selection, sel)
+	}
+	if roles := tr.Roles(); !reflect.DeepEqual(roles, []string{"subtitle", "main"}) {
+		t.Errorf("roles = %q, want [subtitle main]", roles)
+	}
+	if want := []mp4.Label{en, group}; !reflect.DeepEqual(tr.Labels, want) {
+		t.Errorf("labels = %+v, want %+v", tr.Labels, want)
+	}
+}
@@ -0,0 +1,116 @@
+package track
+
+import (
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/tetsuo/mp4"
+)
+
+// WebVTTCue is a WebVTT cue with its timing on the track timeline.
+type WebVTTCue struct {
+	mp4.VTTCue
+	Start time.Duration
+	End   time.Duration
+}
+
+// String formats the cue as a WebVTT cue block, without the trailing blank
+// line that separates cues.
+func (c *WebVTTCue) String() string {
+	buf := make([]byte, 0, 64+len(c.Payload))
+	if c.ID != "" {
+		buf = append(buf, c.ID...)
+		buf = append(buf, '\n')
+	}
+	buf = appendVTTTimestamp(buf, c.Start)
+	buf = append(buf, " --> "...)
+	buf = appendVTTTimestamp(buf, c.End)
+	if c.Settings != "" {
+		buf = append(buf, ' ')
+		buf = append(buf, c.Settings...)
+	}
+	buf = append(buf, '\n')
+	buf = append(buf, c.Payload...)
+	return string(buf)
+}
+
+// appendVTTTimestamp appends d as "hh:mm:ss.ttt".
+func appendVTTTimestamp(buf []byte, d time.Duration) []byte {
+	ms := d.Milliseconds()
+	h := ms / 3600000
+	if h < 10 {
+		buf = append(buf, '0')
+	}
+	buf = strconv.AppendInt(buf, h, 10)
+	buf = append(buf, ':')
+	buf = appendPadded(buf, ms/60000%60, 2)
+	buf = append(buf, ':')
+	buf = appendPadded(buf, ms/1000%60, 2)
+	buf = append(buf, '.')
+	return appendPadded(buf, ms%1000, 3)
+}
+
+// appendPadded appends v zero-padded to width digits.
+func appendPadded(buf []byte, v int64, width int) []byte {
+	for p := int64(10); width > 1; width-- {
+		if v < p {
+			buf = append(buf, '0')
+		}
+		p *= 10
+	}
+	return strconv.AppendInt(buf, v, 10)
+}
+
+// DecodeWebVTT reads the samples of a wvtt track from r, which holds the
+// file the track's sample offsets refer to, and returns its cues in
+// presentation order. A cue that spans several samples, as happens when
+// cues overlap, is returned once with the combined timing.
+func DecodeWebVTT(t *Track, r io.ReaderAt) ([]WebVTTCue, error) {
+	if t.Entry == nil || t.Entry.Type() != mp4.TypeWvtt {
+		return nil, ErrInvalidTrack
+	}
+	if t.TimeScale == 0 {
+		return nil, ErrInvalidTrack
+	}
+	var cues []WebVTTCue
+	var open []int // indices in cues of the cues active in the previous sample
+	var buf []byte
+	for _, s := range t.Samples {
+		if cap(buf) < int(s.Size) {
+			buf = make([]byte, s.Size)
+		}
+		buf = buf[:s.Size]
+		if n, err := r.ReadAt(buf, s.Offset); n < len(buf) {
+			return cues, err
+		}
+		start := TicksToDuration(s.PTS(), t.TimeScale)
+		end := TicksToDuration(s.PTS()+int64(s.Duration), t.TimeScale)
+
+		var next []int
+		for _, c := range mp4.ReadVTTSample(buf) {
+			i := continuedCue(cues, open, c, start)
+			if i >= 0 {
+				cues[i].End = end
+			} else {
+				i = len(cues)
+				cues = append(cues, WebVTTCue{VTTCue: c, Start: start, End: end})
+			}
+			next = append(next, i)
+		}
+		open = next
+	}
+	return cues, nil
+}
+
+// continuedCue returns the index of the cue among open that c continues,
+// or -1. A cue continues when it is identical and the previous sample
+// ended where this one starts.
+func continuedCue(cues []WebVTTCue, open []int, c mp4.VTTCue, start time.Duration) int {
+	for _, i := range open {
+		if cues[i].VTTCue == c && cues[i].End == start {
+			return i
+		}
+	}
+	return -1
+}
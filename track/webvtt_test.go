@@ -0,0 +1,98 @@
+package track_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/tetsuo/mp4"
+	"github.com/tetsuo/mp4/internal/mp4test"
+	"github.com/tetsuo/mp4/track"
+)
+
+// vttSample returns a wvtt sample holding cues, or a vtte box if there
+// are none.
+func vttSample(cues ...mp4.VTTCue) []byte {
+	w := mp4.NewWriter(make([]byte, 256))
+	for _, c := range cues {
+		w.WriteVTTCue(c)
+	}
+	if len(cues) == 0 {
+		w.WriteVTTEmpty()
+	}
+	return bytes.Clone(w.Bytes())
+}
+
+func TestDecodeWebVTT(t *testing.T) {
+	a := mp4.VTTCue{ID: "a", Settings: "align:start", Payload: "Hello"}
+	b := mp4.VTTCue{Payload: "World"}
+	c := mp4.VTTCue{Payload: "Again"}
+	m := mp4test.Movie{TimeScale: 1000, Tracks: []mp4test.Track{{
+		ID: 1, Handler: mp4test.Text, TimeScale: 1000,
+		Entry: func(w *mp4.Writer) { w.WriteWVTTSampleEntry(1, "WEBVTT", "") },
+		// a overlaps b, so it is split across the first two samples.
+		Samples:  [][]byte{vttSample(a), vttSample(a, b), vttSample(), vttSample(c)},
+		Duration: 1000,
+	}}}
+	file := m.Build()
+	tracks, _, err := track.ParseTracks(mp4test.Moov(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) != 1 || tracks[0].Codec() != "wvtt" {
+		t.Fatalf("got %d tracks, want one wvtt track", len(tracks))
+	}
+	cues, err := track.DecodeWebVTT(tracks[0], bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []track.WebVTTCue{
+		{VTTCue: a, Start: 0, End: 2 * time.Second},
+		{VTTCue: b, Start: time.Second, End: 2 * time.Second},
+		{VTTCue: c, Start: 3 * time.Second, End: 4 * time.Second},
+	}
+	if len(cues) != len(want) {
+		t.Fatalf("got %d cues, want %d: %+v", len(cues), len(want), cues)
+	}
+	for i := range want {
+		if cues[i] != want[i] {
+			t.Errorf("cue %d: got %+v, want %+v", i, cues[i], want[i])
+		}
+	}
+	if s := cues[0].String(); s != "a\n00:00:00.000 --> 00:00:02.000 align:start\nHello" {
+		t.Errorf("String = %q", s)
+	}
+
+	if _, err := track.DecodeWebVTT(tracks[0], bytes.NewReader(file[:len(file)-4])); err == nil {
+		t.Error("truncated file: no error")
+	}
+}
+
+func TestDecodeWebVTTLongTrack(t *testing.T) {
+	// Times past about 28 hours at 90 kHz overflow int64 nanoseconds if
+	// the ticks are scaled in one multiplication.
+	c := mp4.VTTCue{Payload: "Late"}
+	m := mp4test.Movie{TimeScale: 1000, Tracks: []mp4test.Track{{
+		ID: 1, Handler: mp4test.Text, TimeScale: 90000,
+		Entry:    func(w *mp4.Writer) { w.WriteWVTTSampleEntry(1, "WEBVTT", "") },
+		Samples:  [][]byte{vttSample(), vttSample(), vttSample(c)},
+		Duration: 4000000000,
+	}}}
+	file := m.Build()
+	tracks, _, err := track.ParseTracks(mp4test.Moov(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cues, err := track.DecodeWebVTT(tracks[0], bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := track.WebVTTCue{
+		VTTCue: c,
+		Start:  88888*time.Second + 888888888, // 8e9 ticks
+		End:    133333*time.Second + 333333333,
+	}
+	if len(cues) != 1 || cues[0] != want {
+		t.Errorf("got %+v, want %+v", cues, want)
+	}
+}
@@ -0,0 +1,56 @@
+package mp4
+
+import (
+	"bytes"
+	"slices"
+)
+
+// TrackReferences maps each reference type of a tref box, such as TypeChap
+// or TypeSubt, to the referenced track IDs in order.
+type TrackReferences map[BoxType][]uint32
+
+// ReadTref parses tref box data, the reference type boxes it contains.
+// Repeated boxes of one type are merged.
+func ReadTref(data []byte) (TrackReferences, error) {
+	refs := TrackReferences{}
+	r := NewReader(data)
+	for r.Next() {
+		d := r.Data()
+		if len(d)%4 != 0 {
+			return refs, ErrTruncated
+		}
+		ids := refs[r.Type()]
+		for i := 0; i < len(d); i += 4 {
+			ids = append(ids, be.Uint32(d[i:]))
+		}
+		refs[r.Type()] = ids
+	}
+	return refs, nil
+}
+
+// WriteTref writes a complete tref box with one reference type box per
+// map entry, in sorted type order. Nothing is written if refs has no
+// entries with track IDs.
+func (w *Writer) WriteTref(refs TrackReferences) {
+	types := make([]BoxType, 0, len(refs))
+	for typ, ids := range refs {
+		if len(ids) > 0 {
+			types = append(types, typ)
+		}
+	}
+	if len(types) == 0 {
+		return
+	}
+	slices.SortFunc(types, func(a, b BoxType) int {
+		return bytes.Compare(a[:], b[:])
+	})
+	w.StartBox(TypeTref)
+	for _, typ := range types {
+		w.StartBox(typ)
+		for _, id := range refs[typ] {
+			w.putUint32(id)
+		}
+		w.EndBox()
+	}
+	w.EndBox()
+}
@@ -0,0 +1,51 @@
+package mp4_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tetsuo/mp4"
+)
+
+func TestTrefRoundTrip(t *testing.T) {
+	want := mp4.TrackReferences{
+		mp4.TypeChap:                    {3},
+		mp4.BoxType{'s', 'u', 'b', 't'}: {2, 4},
+	}
+	r := writeBox(t, func(w *mp4.Writer) {
+		w.WriteTref(want)
+		w.WriteTref(mp4.TrackReferences{mp4.TypeChap: nil})
+	})
+	if r.Type() != mp4.TypeTref {
+		t.Fatalf("type = %v, want tref", r.Type())
+	}
+	refs, err := mp4.ReadTref(r.Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(refs, want) {
+		t.Errorf("got %v, want %v", refs, want)
+	}
+	data := r.Data()
+	if r.Next() {
+		t.Error("tref written for references without track IDs")
+	}
+
+	// Reference type boxes are written in sorted order; repeated ones are
+	// merged when read.
+	if typ := mp4.BoxType(data[4:8]); typ != mp4.TypeChap {
+		t.Errorf("first reference type = %v, want chap", typ)
+	}
+	data = append(data, data[:12]...)
+	refs, err = mp4.ReadTref(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := refs[mp4.TypeChap]; !reflect.DeepEqual(got, []uint32{3, 3}) {
+		t.Errorf("merged chap references = %v, want [3 3]", got)
+	}
+
+	if _, err := mp4.ReadTref([]byte{0, 0, 0, 10, 'c', 'h', 'a', 'p', 0, 1}); err != mp4.ErrTruncated {
+		t.Errorf("odd size: err = %v, want %v", err, mp4.ErrTruncated)
+	}
+}
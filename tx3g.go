@@ -0,0 +1,289 @@
+package mp4
+
+import (
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// TextBox is a 3GPP timed text BoxRecord, in pixels relative to the track.
+type TextBox struct {
+	Top, Left, Bottom, Right int16
+}
+
+// TextStyleRecord is a 3GPP timed text StyleRecord, applying to the
+// characters in [StartChar, EndChar).
+type TextStyleRecord struct {
+	StartChar      uint16
+	EndChar        uint16
+	FontID         uint16
+	FaceStyleFlags uint8 // 1 bold, 2 italic, 4 underline
+	FontSize       uint8
+	TextColor      [4]byte // RGBA
+}
+
+// textStyleRecordSize is the encoded size of a StyleRecord.
+const textStyleRecordSize = 12
+
+// TextFont is one entry of the ftab font table.
+type TextFont struct {
+	ID   uint16
+	Name string
+}
+
+// TextSampleEntry holds a parsed tx3g sample entry (3GPP TS 26.245).
+type TextSampleEntry struct {
+	DataReferenceIndex      uint16
+	DisplayFlags            uint32
+	HorizontalJustification int8
+	VerticalJustification   int8
+	BackgroundColor         [4]byte // RGBA
+	DefaultTextBox          TextBox
+	DefaultStyle            TextStyleRecord
+	Fonts                   []TextFont
+	ChildOffset             int // byte offset within data where child boxes begin
+}
+
+// tx3gHeaderSize is the fixed part of the tx3g sample entry before ftab.
+const tx3gHeaderSize = 38
+
+// ReadTextSampleEntry parses tx3g sample entry box data.
+func ReadTextSampleEntry(data []byte) (TextSampleEntry, error) {
+	var e TextSampleEntry
+	if len(data) < tx3gHeaderSize {
+		return e, ErrTruncated
+	}
+	e.DataReferenceIndex = be.Uint16(data[6:8])
+	e.DisplayFlags = be.Uint32(data[8:12])
+	e.HorizontalJustification = int8(data[12])
+	e.VerticalJustification = int8(data[13])
+	copy(e.BackgroundColor[:], data[14:18])
+	e.DefaultTextBox = TextBox{
+		Top:    int16(be.Uint16(data[18:20])),
+		Left:   int16(be.Uint16(data[20:22])),
+		Bottom: int16(be.Uint16(data[22:24])),
+		Right:  int16(be.Uint16(data[24:26])),
+	}
+	e.DefaultStyle = readTextStyleRecord(data[26:])
+	e.ChildOffset = tx3gHeaderSize
+
+	r := NewReader(data[e.ChildOffset:])
+	for r.Next() {
+		if r.Type() != TypeFtab {
+			continue
+		}
+		d := r.Data()
+		if len(d) < 2 {
+			return e, ErrTruncated
+		}
+		n := int(be.Uint16(d))
+		ptr := 2
+		for range n {
+			if ptr+3 > len(d) || ptr+3+int(d[ptr+2]) > len(d) {
+				return e, ErrTruncated
+			}
+			nameLen := int(d[ptr+2])
+			e.Fonts = append(e.Fonts, TextFont{
+				ID:   be.Uint16(d[ptr:]),
+				Name: string(d[ptr+3 : ptr+3+nameLen]),
+			})
+			ptr += 3 + nameLen
+		}
+	}
+	return e, nil
+}
+
+func readTextStyleRecord(b []byte) TextStyleRecord {
+	s := TextStyleRecord{
+		StartChar:      be.Uint16(b[0:2]),
+		EndChar:        be.Uint16(b[2:4]),
+		FontID:         be.Uint16(b[4:6]),
+		FaceStyleFlags: b[6],
+		FontSize:       b[7],
+	}
+	copy(s.TextColor[:], b[8:12])
+	return s
+}
+
+// WriteTextSampleEntry writes a complete tx3g sample entry box, including
+// its ftab box.
+func (w *Writer) WriteTextSampleEntry(e TextSampleEntry) {
+	w.StartBox(TypeTx3g)
+	w.putZeros(6)
+	w.putUint16(e.DataReferenceIndex)
+	w.putUint32(e.DisplayFlags)
+	w.putUint8(uint8(e.HorizontalJustification))
+	w.putUint8(uint8(e.VerticalJustification))
+	w.putBytes(e.BackgroundColor[:])
+	w.putUint16(uint16(e.DefaultTextBox.Top))
+	w.putUint16(uint16(e.DefaultTextBox.Left))
+	w.putUint16(uint16(e.DefaultTextBox.Bottom))
+	w.putUint16(uint16(e.DefaultTextBox.Right))
+	w.putTextStyleRecord(e.DefaultStyle)
+	w.StartBox(TypeFtab)
+	w.putUint16(uint16(len(e.Fonts)))
+	for _, f := range e.Fonts {
+		name := truncateUTF8(f.Name, 255)
+		w.putUint16(f.ID)
+		w.putUint8(uint8(len(name)))
+		w.putBytes([]byte(name))
+	}
+	w.EndBox()
+	w.EndBox()
+}
+
+func (w *Writer) putTextStyleRecord(s TextStyleRecord) {
+	w.putUint16(s.StartChar)
+	w.putUint16(s.EndChar)
+	w.putUint16(s.FontID)
+	w.putUint8(s.FaceStyleFlags)
+	w.putUint8(s.FontSize)
+	w.putBytes(s.TextColor[:])
+}
+
+// TextSample is a decoded 3GPP timed text sample. Style character offsets
+// count characters of the original encoding, as stored in the file.
+type TextSample struct {
+	Text   string // UTF-8
+	Styles []TextStyleRecord
+}
+
+// ReadTextSample parses a tx3g sample: the text, which is converted to
+// UTF-8 if it carries a UTF-16 byte order mark, and any styl modifier box.
+// Other modifier boxes are ignored.
+func ReadTextSample(data []byte) (TextSample, error) {
+	var s TextSample
+	if len(data) < 2 {
+		return s, ErrTruncated
+	}
+	n := int(be.Uint16(data))
+	if 2+n > len(data) {
+		return s, ErrTruncated
+	}
+	s.Text = decodeText(data[2 : 2+n])
+
+	r := NewReader(data[2+n:])
+	for r.Next() {
+		if r.Type() != TypeStyl {
+			continue
+		}
+		d := r.Data()
+		if len(d) < 2 {
+			return s, ErrTruncated
+		}
+		count := int(be.Uint16(d))
+		if 2+count*textStyleRecordSize > len(d) {
+			return s, ErrTruncated
+		}
+		for i := range count {
+			s.Styles = append(s.Styles, readTextStyleRecord(d[2+i*textStyleRecordSize:]))
+		}
+	}
+	return s, nil
+}
+
+// decodeText returns timed text as UTF-8, converting UTF-16 text marked
+// with a byte order mark.
+func decodeText(b []byte) string {
+	if len(b) < 2 || len(b)%2 != 0 {
+		return string(b)
+	}
+	var big bool
+	switch {
+	case b[0] == 0xfe && b[1] == 0xff:
+		big = true
+	case b[0] == 0xff && b[1] == 0xfe:
+	default:
+		return string(b)
+	}
+	u := make([]uint16, 0, len(b)/2-1)
+	for i := 2; i < len(b); i += 2 {
+		if big {
+			u = append(u, uint16(b[i])<<8|uint16(b[i+1]))
+		} else {
+			u = append(u, uint16(b[i+1])<<8|uint16(b[i]))
+		}
+	}
+	buf := make([]byte, 0, len(u))
+	for _, c := range utf16.Decode(u) {
+		buf = utf8.AppendRune(buf, c)
+	}
+	return string(buf)
+}
+
+// WriteTextSample writes a tx3g sample: the UTF-8 text followed by a styl
+// box if s has styles. The text is truncated to 65535 bytes, on a rune
+// boundary.
+func (w *Writer) WriteTextSample(s TextSample) {
+	text := truncateUTF8(s.Text, 0xffff)
+	w.putUint16(uint16(len(text)))
+	w.putBytes([]byte(text))
+	if len(s.Styles) > 0 {
+		w.StartBox(TypeStyl)
+		w.putUint16(uint16(len(s.Styles)))
+		for _, st := range s.Styles {
+			w.putTextStyleRecord(st)
+		}
+		w.EndBox()
+	}
+}
+
+// NeroChapter is one entry of a Nero chpl box.
+type NeroChapter struct {
+	Start uint64 // in 100-nanosecond units
+	Title string
+}
+
+// ReadChpl parses chpl box data (after version+flags). Version 1 boxes
+// carry four reserved bytes before the chapter count.
+func ReadChpl(data []byte, version uint8) ([]NeroChapter, error) {
+	ptr := 0
+	if version > 0 {
+		ptr = 4
+	}
+	if ptr+1 > len(data) {
+		return nil, ErrTruncated
+	}
+	n := int(data[ptr])
+	ptr++
+	chapters := make([]NeroChapter, 0, n)
+	for range n {
+		if ptr+9 > len(data) || ptr+9+int(data[ptr+8]) > len(data) {
+			return chapters, ErrTruncated
+		}
+		titleLen := int(data[ptr+8])
+		chapters = append(chapters, NeroChapter{
+			Start: be.Uint64(data[ptr:]),
+			Title: string(data[ptr+9 : ptr+9+titleLen]),
+		})
+		ptr += 9 + titleLen
+	}
+	return chapters, nil
+}
+
+// WriteChpl writes a complete version 1 chpl box. At most 255 chapters are
+// written and titles are truncated to 255 bytes, on a rune boundary.
+func (w *Writer) WriteChpl(chapters []NeroChapter) {
+	chapters = chapters[:min(len(chapters), 255)]
+	w.StartFullBox(TypeChpl, 1, 0)
+	w.putUint32(0) // reserved
+	w.putUint8(uint8(len(chapters)))
+	for _, c := range chapters {
+		title := truncateUTF8(c.Title, 255)
+		w.putUint64(c.Start)
+		w.putUint8(uint8(len(title)))
+		w.putBytes([]byte(title))
+	}
+	w.EndBox()
+}
+
+// truncateUTF8 returns s cut to at most n bytes without splitting a
+// multi-byte rune.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,96 @@
+package mp4_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/tetsuo/mp4"
+)
+
+func TestTextSampleEntryRoundTrip(t *testing.T) {
+	want := mp4.TextSampleEntry{
+		DataReferenceIndex:      1,
+		DisplayFlags:            0x20000000,
+		HorizontalJustification: 1,
+		VerticalJustification:   -1,
+		BackgroundColor:         [4]byte{0, 0, 0, 0xff},
+		DefaultTextBox:          mp4.TextBox{Top: 0, Left: 0, Bottom: 60, Right: 400},
+		DefaultStyle:            mp4.TextStyleRecord{FontID: 1, FontSize: 18, TextColor: [4]byte{0xff, 0xff, 0xff, 0xff}},
+		Fonts:                   []mp4.TextFont{{ID: 1, Name: "Serif"}, {ID: 2, Name: "Sans-Serif"}},
+		ChildOffset:             38,
+	}
+	r := writeBox(t, func(w *mp4.Writer) { w.WriteTextSampleEntry(want) })
+	if r.Type() != mp4.TypeTx3g {
+		t.Fatalf("type = %v, want tx3g", r.Type())
+	}
+	e, err := mp4.ReadTextSampleEntry(r.Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(e, want) {
+		t.Errorf("got %+v, want %+v", e, want)
+	}
+}
+
+func TestTextSampleRoundTrip(t *testing.T) {
+	want := mp4.TextSample{
+		Text: "Café au lait",
+		Styles: []mp4.TextStyleRecord{
+			{StartChar: 0, EndChar: 4, FontID: 1, FaceStyleFlags: 2, FontSize: 18, TextColor: [4]byte{0xff, 0, 0, 0xff}},
+		},
+	}
+	w := mp4.NewWriter(make([]byte, 256))
+	w.WriteTextSample(want)
+	s, err := mp4.ReadTextSample(w.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("got %+v, want %+v", s, want)
+	}
+
+	// UTF-16 text with a byte order mark is converted.
+	utf16 := []byte{0, 8, 0xfe, 0xff, 0, 'C', 0, 0xe9, 0, '!'}
+	if s, err := mp4.ReadTextSample(utf16); err != nil || s.Text != "Cé!" {
+		t.Errorf("UTF-16: got %q, %v", s.Text, err)
+	}
+	if _, err := mp4.ReadTextSample([]byte{0, 4, 'a'}); err != mp4.ErrTruncated {
+		t.Errorf("truncated: err = %v, want %v", err, mp4.ErrTruncated)
+	}
+
+	long := "a" + strings.Repeat("€", 0x5555)
+	w = mp4.NewWriter(make([]byte, 0x10010))
+	w.WriteTextSample(mp4.TextSample{Text: long})
+	if s, err := mp4.ReadTextSample(w.Bytes()); err != nil || !utf8.ValidString(s.Text) || len(s.Text) != 0xfffd {
+		t.Errorf("long text: %d bytes, valid %v, %v", len(s.Text), utf8.ValidString(s.Text), err)
+	}
+}
+
+func TestChplRoundTrip(t *testing.T) {
+	want := []mp4.NeroChapter{
+		{Start: 0, Title: "Intro"},
+		{Start: 600_000_000, Title: "Part 1"},
+		{Start: 1_200_000_000, Title: ""},
+	}
+	r := writeBox(t, func(w *mp4.Writer) { w.WriteChpl(want) })
+	if r.Type() != mp4.TypeChpl || r.Version() != 1 {
+		t.Fatalf("got %v version %d, want chpl version 1", r.Type(), r.Version())
+	}
+	got, err := mp4.ReadChpl(r.Data(), r.Version())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// Titles are cut to 255 bytes before the rune that would cross it.
+	long := strings.Repeat("a", 254) + "é"
+	r = writeBox(t, func(w *mp4.Writer) { w.WriteChpl([]mp4.NeroChapter{{Title: long}}) })
+	got, err = mp4.ReadChpl(r.Data(), r.Version())
+	if err != nil || len(got) != 1 || got[0].Title != long[:254] {
+		t.Errorf("long title: got %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,240 @@
+package mp4
+
+// Colour information types carried in colr.
+var (
+	ColourTypeNclx = [4]byte{'n', 'c', 'l', 'x'} // on-screen colours (ISO/IEC 23091-2 code points)
+	ColourTypeNclc = [4]byte{'n', 'c', 'l', 'c'} // QuickTime on-screen colours, no range flag
+	ColourTypeRICC = [4]byte{'r', 'I', 'C', 'C'} // restricted ICC profile
+	ColourTypeProf = [4]byte{'p', 'r', 'o', 'f'} // unrestricted ICC profile
+)
+
+// PixelAspectRatio holds a parsed pasp box.
+type PixelAspectRatio struct {
+	HSpacing uint32
+	VSpacing uint32
+}
+
+// BitRate holds a parsed btrt box.
+type BitRate struct {
+	BufferSizeDB uint32
+	MaxBitrate   uint32
+	AvgBitrate   uint32
+}
+
+// ColourInformation holds a parsed colr box. The code point fields are set
+// for nclx and nclc; ICCProfile is set for rICC and prof.
+type ColourInformation struct {
+	ColourType              [4]byte
+	ColourPrimaries         uint16
+	TransferCharacteristics uint16
+	MatrixCoefficients      uint16
+	FullRange               bool   // nclx only
+	ICCProfile              []byte // points into the original buffer when read
+}
+
+// CleanAperture holds a parsed clap box. Each value is a fraction N/D;
+// offsets are relative to the picture centre.
+type CleanAperture struct {
+	WidthN, WidthD       uint32
+	HeightN, HeightD     uint32
+	HorizOffN, HorizOffD int32
+	VertOffN, VertOffD   int32
+}
+
+// MasteringDisplayColourVolume holds a parsed mdcv box (SMPTE ST 2086).
+// Chromaticity coordinates are in units of 0.00002; luminance in units of
+// 0.0001 cd/m2.
+type MasteringDisplayColourVolume struct {
+	DisplayPrimariesX [3]uint16 // in G, B, R order
+	DisplayPrimariesY [3]uint16
+	WhitePointX       uint16
+	WhitePointY       uint16
+	MaxLuminance      uint32
+	MinLuminance      uint32
+}
+
+// ContentLightLevel holds a parsed clli box, in cd/m2.
+type ContentLightLevel struct {
+	MaxContentLightLevel    uint16 // MaxCLL
+	MaxPicAverageLightLevel uint16 // MaxFALL
+}
+
+// ReadPasp parses pasp box data.
+func ReadPasp(data []byte) (PixelAspectRatio, error) {
+	if len(data) < 8 {
+		return PixelAspectRatio{}, ErrTruncated
+	}
+	return PixelAspectRatio{
+		HSpacing: be.Uint32(data[0:4]),
+		VSpacing: be.Uint32(data[4:8]),
+	}, nil
+}
+
+// ReadBtrt parses btrt box data.
+func ReadBtrt(data []byte) (BitRate, error) {
+	if len(data) < 12 {
+		return BitRate{}, ErrTruncated
+	}
+	return BitRate{
+		BufferSizeDB: be.Uint32(data[0:4]),
+		MaxBitrate:   be.Uint32(data[4:8]),
+		AvgBitrate:   be.Uint32(data[8:12]),
+	}, nil
+}
+
+// ReadColr parses colr box data.
+func ReadColr(data []byte) (ColourInformation, error) {
+	var c ColourInformation
+	if len(data) < 4 {
+		return c, ErrTruncated
+	}
+	copy(c.ColourType[:], data[0:4])
+	switch c.ColourType {
+	case ColourTypeNclx, ColourTypeNclc:
+		if len(data) < 10 {
+			return c, ErrTruncated
+		}
+		c.ColourPrimaries = be.Uint16(data[4:6])
+		c.TransferCharacteristics = be.Uint16(data[6:8])
+		c.MatrixCoefficients = be.Uint16(data[8:10])
+		if c.ColourType == ColourTypeNclx {
+			if len(data) < 11 {
+				return c, ErrTruncated
+			}
+			c.FullRange = data[10]&0x80 != 0
+		}
+	default:
+		c.ICCProfile = data[4:]
+	}
+	return c, nil
+}
+
+// ReadClap parses clap box data.
+func ReadClap(data []byte) (CleanAperture, error) {
+	if len(data) < 32 {
+		return CleanAperture{}, ErrTruncated
+	}
+	return CleanAperture{
+		WidthN:    be.Uint32(data[0:4]),
+		WidthD:    be.Uint32(data[4:8]),
+		HeightN:   be.Uint32(data[8:12]),
+		HeightD:   be.Uint32(data[12:16]),
+		HorizOffN: int32(be.Uint32(data[16:20])),
+		HorizOffD: int32(be.Uint32(data[20:24])),
+		VertOffN:  int32(be.Uint32(data[24:28])),
+		VertOffD:  int32(be.Uint32(data[28:32])),
+	}, nil
+}
+
+// Size returns the clean aperture width and height rounded down to whole
+// pixels, or zeros if a denominator is 0.
+func (c *CleanAperture) Size() (uint32, uint32) {
+	if c.WidthD == 0 || c.HeightD == 0 {
+		return 0, 0
+	}
+	return c.WidthN / c.WidthD, c.HeightN / c.HeightD
+}
+
+// ReadMdcv parses mdcv box data.
+func ReadMdcv(data []byte) (MasteringDisplayColourVolume, error) {
+	var m MasteringDisplayColourVolume
+	if len(data) < 24 {
+		return m, ErrTruncated
+	}
+	for i := range 3 {
+		m.DisplayPrimariesX[i] = be.Uint16(data[i*4:])
+		m.DisplayPrimariesY[i] = be.Uint16(data[i*4+2:])
+	}
+	m.WhitePointX = be.Uint16(data[12:14])
+	m.WhitePointY = be.Uint16(data[14:16])
+	m.MaxLuminance = be.Uint32(data[16:20])
+	m.MinLuminance = be.Uint32(data[20:24])
+	return m, nil
+}
+
+// ReadClli parses clli box data.
+func ReadClli(data []byte) (ContentLightLevel, error) {
+	if len(data) < 4 {
+		return ContentLightLevel{}, ErrTruncated
+	}
+	return ContentLightLevel{
+		MaxContentLightLevel:    be.Uint16(data[0:2]),
+		MaxPicAverageLightLevel: be.Uint16(data[2:4]),
+	}, nil
+}
+
+// WritePasp writes a complete pasp box.
+func (w *Writer) WritePasp(p PixelAspectRatio) {
+	w.StartBox(TypePasp)
+	w.putUint32(p.HSpacing)
+	w.putUint32(p.VSpacing)
+	w.EndBox()
+}
+
+// WriteBtrt writes a complete btrt box.
+func (w *Writer) WriteBtrt(b BitRate) {
+	w.StartBox(TypeBtrt)
+	w.putUint32(b.BufferSizeDB)
+	w.putUint32(b.MaxBitrate)
+	w.putUint32(b.AvgBitrate)
+	w.EndBox()
+}
+
+// WriteColr writes a complete colr box. Code points are written for nclx
+// and nclc; any other colour type carries ICCProfile.
+func (w *Writer) WriteColr(c ColourInformation) {
+	w.StartBox(TypeColr)
+	w.putBytes(c.ColourType[:])
+	switch c.ColourType {
+	case ColourTypeNclx, ColourTypeNclc:
+		w.putUint16(c.ColourPrimaries)
+		w.putUint16(c.TransferCharacteristics)
+		w.putUint16(c.MatrixCoefficients)
+		if c.ColourType == ColourTypeNclx {
+			if c.FullRange {
+				w.putUint8(0x80)
+			} else {
+				w.putUint8(0)
+			}
+		}
+	default:
+		w.putBytes(c.ICCProfile)
+	}
+	w.EndBox()
+}
+
+// WriteClap writes a complete clap box.
+func (w *Writer) WriteClap(c CleanAperture) {
+	w.StartBox(TypeClap)
+	w.putUint32(c.WidthN)
+	w.putUint32(c.WidthD)
+	w.putUint32(c.HeightN)
+	w.putUint32(c.HeightD)
+	w.putInt32(c.HorizOffN)
+	w.putInt32(c.HorizOffD)
+	w.putInt32(c.VertOffN)
+	w.putInt32(c.VertOffD)
+	w.EndBox()
+}
+
+// WriteMdcv writes a complete mdcv box.
+func (w *Writer) WriteMdcv(m MasteringDisplayColourVolume) {
+	w.StartBox(TypeMdcv)
+	for i := range 3 {
+		w.putUint16(m.DisplayPrimariesX[i])
+		w.putUint16(m.DisplayPrimariesY[i])
+	}
+	w.putUint16(m.WhitePointX)
+	w.putUint16(m.WhitePointY)
+	w.putUint32(m.MaxLuminance)
+	w.putUint32(m.MinLuminance)
+	w.EndBox()
+}
+
+// WriteClli writes a complete clli box.
+func (w *Writer) WriteClli(c ContentLightLevel) {
+	w.StartBox(TypeClli)
+	w.putUint16(c.MaxContentLightLevel)
+	w.putUint16(c.MaxPicAverageLightLevel)
+	w.EndBox()
+}
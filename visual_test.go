@@ -0,0 +1,79 @@
+package mp4_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tetsuo/mp4"
+)
+
+func TestVisualSampleEntryExtensions(t *testing.T) {
+	pasp := mp4.PixelAspectRatio{HSpacing: 4, VSpacing: 3}
+	btrt := mp4.BitRate{BufferSizeDB: 1 << 20, MaxBitrate: 8000000, AvgBitrate: 5000000}
+	colr := mp4.ColourInformation{
+		ColourType:              mp4.ColourTypeNclx,
+		ColourPrimaries:         9,
+		TransferCharacteristics: 16,
+		MatrixCoefficients:      9,
+		FullRange:               true,
+	}
+	clap := mp4.CleanAperture{
+		WidthN: 1920, WidthD: 1, HeightN: 1080, HeightD: 1,
+		HorizOffN: -8, HorizOffD: 2, VertOffN: 0, VertOffD: 1,
+	}
+	mdcv := mp4.MasteringDisplayColourVolume{
+		DisplayPrimariesX: [3]uint16{13250, 7500, 34000},
+		DisplayPrimariesY: [3]uint16{34500, 3000, 16000},
+		WhitePointX:       15635,
+		WhitePointY:       16450,
+		MaxLuminance:      10000000,
+		MinLuminance:      50,
+	}
+	clli := mp4.ContentLightLevel{MaxContentLightLevel: 1000, MaxPicAverageLightLevel: 400}
+
+	w := mp4.NewWriter(make([]byte, 1024))
+	w.StartBox(mp4.TypeHvc1)
+	w.WriteVisualSampleEntry(1, 1920, 1080, 1, 24, "")
+	w.WritePasp(pasp)
+	w.WriteBtrt(btrt)
+	w.WriteColr(colr)
+	w.WriteClap(clap)
+	w.WriteMdcv(mdcv)
+	w.WriteClli(clli)
+	w.EndBox()
+
+	r := mp4.NewReader(w.Bytes())
+	if !r.Next() {
+		t.Fatal("sample entry not found")
+	}
+	v := mp4.ReadVisualSampleEntry(r.Data())
+	if v.Width != 1920 || v.Height != 1080 {
+		t.Errorf("size = %dx%d, want 1920x1080", v.Width, v.Height)
+	}
+	if v.Pasp != nil || v.Colr != nil {
+		t.Error("extensions decoded without ReadExtensions")
+	}
+
+	v.ReadExtensions(r.Data())
+	for _, c := range []struct {
+		name      string
+		got, want any
+	}{
+		{"pasp", v.Pasp, &pasp},
+		{"btrt", v.Btrt, &btrt},
+		{"colr", v.Colr, &colr},
+		{"clap", v.Clap, &clap},
+		{"mdcv", v.Mdcv, &mdcv},
+		{"clli", v.Clli, &clli},
+	} {
+		if !reflect.DeepEqual(c.got, c.want) {
+			t.Errorf("%s: got %+v, want %+v", c.name, c.got, c.want)
+		}
+	}
+	if r, ok := v.VideoRange(); !ok || r != "PQ" {
+		t.Errorf("video range = %q, %v, want PQ", r, ok)
+	}
+	if cw, ch := v.Clap.Size(); cw != 1920 || ch != 1080 {
+		t.Errorf("clean aperture = %dx%d, want 1920x1080", cw, ch)
+	}
+}
@@ -0,0 +1,301 @@
+package mp4
+
+import (
+	"encoding/base32"
+	"strconv"
+)
+
+// VVC NAL unit types carried in vvcC arrays.
+const (
+	VVCNALOPI       = 12
+	VVCNALDCI       = 13
+	VVCNALVPS       = 14
+	VVCNALSPS       = 15
+	VVCNALPPS       = 16
+	VVCNALPrefixAPS = 17
+	VVCNALSuffixAPS = 18
+	VVCNALPrefixSEI = 23
+	VVCNALSuffixSEI = 24
+)
+
+// VVCPTLRecord holds a parsed VvcPTLRecord from vvcC.
+type VVCPTLRecord struct {
+	ProfileIdc uint8 // 7 bits
+	Tier       bool  // true for High tier
+	LevelIdc   uint8
+
+	// ConstraintInfo is general_constraint_info as num_bytes_constraint_info
+	// bytes. Its first two bits are ptl_frame_only_constraint_flag and
+	// ptl_multi_layer_enabled_flag.
+	ConstraintInfo []byte
+
+	// SublayerLevelIdc holds sublayer_level_idc for sublayers 0 to
+	// NumSublayers-2; zero entries are not present.
+	SublayerLevelIdc []uint8
+	SubProfileIdc    []uint32
+}
+
+// FrameOnlyConstraint reports ptl_frame_only_constraint_flag.
+func (p *VVCPTLRecord) FrameOnlyConstraint() bool {
+	return len(p.ConstraintInfo) > 0 && p.ConstraintInfo[0]&0x80 != 0
+}
+
+// MultiLayerEnabled reports ptl_multi_layer_enabled_flag.
+func (p *VVCPTLRecord) MultiLayerEnabled() bool {
+	return len(p.ConstraintInfo) > 0 && p.ConstraintInfo[0]&0x40 != 0
+}
+
+// vvcBase32 encodes constraint info for codec strings (RFC 4648, unpadded).
+var vvcBase32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Codec returns the RFC 6381 suffix for vvc1/vvi1 codec strings as defined
+// in ISO/IEC 14496-15 Annex E, e.g. "1.L51.CQA". The constraint element is
+// omitted when all constraint bytes are zero, and the optional output layer
+// set element is never written.
+func (p *VVCPTLRecord) Codec() string {
+	buf := make([]byte, 0, 32)
+	buf = strconv.AppendUint(buf, uint64(p.ProfileIdc), 10)
+	buf = append(buf, '.')
+	if p.Tier {
+		buf = append(buf, 'H')
+	} else {
+		buf = append(buf, 'L')
+	}
+	buf = strconv.AppendUint(buf, uint64(p.LevelIdc), 10)
+
+	// Constraint bytes, with trailing zero bytes omitted.
+	n := len(p.ConstraintInfo)
+	for n > 0 && p.ConstraintInfo[n-1] == 0 {
+		n--
+	}
+	if n > 0 {
+		buf = append(buf, ".C"...)
+		buf = vvcBase32.AppendEncode(buf, p.ConstraintInfo[:n])
+	}
+
+	for i, sp := range p.SubProfileIdc {
+		if i == 0 {
+			buf = append(buf, ".S"...)
+		} else {
+			buf = append(buf, '+')
+		}
+		buf = strconv.AppendUint(buf, uint64(sp), 16)
+	}
+	return string(buf)
+}
+
+// VVCConfig holds a parsed VvcDecoderConfigurationRecord (vvcC box data,
+// after version+flags).
+type VVCConfig struct {
+	NALLengthSize uint8 // bytes per NAL unit length prefix: 1, 2 or 4
+
+	// The following fields are only meaningful when PTLPresent is set.
+	PTLPresent        bool
+	OlsIdx            uint16 // 9 bits
+	NumSublayers      uint8
+	ConstantFrameRate uint8
+	ChromaFormat      uint8 // chroma_format_idc
+	BitDepth          uint8
+	PTL               VVCPTLRecord
+	MaxPictureWidth   uint16
+	MaxPictureHeight  uint16
+	AvgFrameRate      uint16 // frames per 256 seconds, 0 if unspecified
+
+	// Arrays hold the parameter set and SEI NAL units; DCI and OPI arrays
+	// carry exactly one NAL unit.
+	Arrays []HEVCNALArray
+}
+
+// ReadVVCConfig parses vvcC box data. NAL unit slices point into data.
+func ReadVVCConfig(data []byte) (VVCConfig, error) {
+	var c VVCConfig
+	br := NewBitReader(data)
+	br.Skip(5) // reserved
+	c.NALLengthSize = uint8(br.ReadBits(2)) + 1
+	c.PTLPresent = br.ReadFlag()
+	if c.PTLPresent {
+		c.OlsIdx = uint16(br.ReadBits(9))
+		c.NumSublayers = uint8(br.ReadBits(3))
+		c.ConstantFrameRate = uint8(br.ReadBits(2))
+		c.ChromaFormat = uint8(br.ReadBits(2))
+		c.BitDepth = uint8(br.ReadBits(3)) + 8
+		br.Skip(5) // reserved
+		c.PTL = readVVCPTLRecord(&br, data, c.NumSublayers)
+		c.MaxPictureWidth = uint16(br.ReadBits(16))
+		c.MaxPictureHeight = uint16(br.ReadBits(16))
+		c.AvgFrameRate = uint16(br.ReadBits(16))
+	}
+	numArrays := int(br.ReadBits(8))
+	if err := br.Err(); err != nil {
+		return c, err
+	}
+
+	ptr := br.Pos() / 8
+	for range numArrays {
+		if ptr+1 > len(data) {
+			return c, ErrTruncated
+		}
+		a := HEVCNALArray{
+			Completeness: data[ptr]&0x80 != 0,
+			NALUnitType:  data[ptr] & 0x1f,
+		}
+		ptr++
+		numNalus := 1
+		if a.NALUnitType != VVCNALDCI && a.NALUnitType != VVCNALOPI {
+			if ptr+2 > len(data) {
+				return c, ErrTruncated
+			}
+			numNalus = int(be.Uint16(data[ptr:]))
+			ptr += 2
+		}
+		for range numNalus {
+			if ptr+2 > len(data) {
+				return c, ErrTruncated
+			}
+			n := int(be.Uint16(data[ptr:]))
+			ptr += 2
+			if ptr+n > len(data) {
+				return c, ErrTruncated
+			}
+			a.NALUnits = append(a.NALUnits, data[ptr:ptr+n])
+			ptr += n
+		}
+		c.Arrays = append(c.Arrays, a)
+	}
+	return c, nil
+}
+
+// readVVCPTLRecord reads a VvcPTLRecord. The record is byte-aligned, so
+// ConstraintInfo can point into data.
+func readVVCPTLRecord(br *BitReader, data []byte, numSublayers uint8) VVCPTLRecord {
+	var p VVCPTLRecord
+	br.Skip(2) // reserved
+	numBytes := int(br.ReadBits(6))
+	p.ProfileIdc = uint8(br.ReadBits(7))
+	p.Tier = br.ReadFlag()
+	p.LevelIdc = uint8(br.ReadBits(8))
+	start := br.Pos() / 8
+	br.Skip(8 * numBytes)
+	if br.Err() != nil {
+		return p
+	}
+	p.ConstraintInfo = data[start : start+numBytes]
+
+	if numSublayers > 1 {
+		present := br.ReadBits(8) // flags for sublayers n-2..0, then zero bits
+		p.SublayerLevelIdc = make([]uint8, numSublayers-1)
+		for i := int(numSublayers) - 2; i >= 0; i-- {
+			if present&(0x80>>(int(numSublayers)-2-i)) != 0 {
+				p.SublayerLevelIdc[i] = uint8(br.ReadBits(8))
+			}
+		}
+	}
+	numSubProfiles := int(br.ReadBits(8))
+	for range numSubProfiles {
+		if br.Err() != nil {
+			break
+		}
+		p.SubProfileIdc = append(p.SubProfileIdc, br.ReadBits(32))
+	}
+	return p
+}
+
+// NALUnits returns the NAL units of the given type from all arrays.
+func (c *VVCConfig) NALUnits(nalType uint8) [][]byte {
+	var out [][]byte
+	for _, a := range c.Arrays {
+		if a.NALUnitType == nalType {
+			out = append(out, a.NALUnits...)
+		}
+	}
+	return out
+}
+
+// Codec returns the codec string suffix, e.g. "1.L51.CQA", or "" if the
+// record has no PTL.
+func (c *VVCConfig) Codec() string {
+	if !c.PTLPresent {
+		return ""
+	}
+	return c.PTL.Codec()
+}
+
+// WriteVvcC writes a complete vvcC box.
+func (w *Writer) WriteVvcC(c VVCConfig) {
+	lengthSize := c.NALLengthSize
+	if lengthSize == 0 {
+		lengthSize = 4
+	}
+	var bw bitWriter
+	bw.put(0x1f, 5)
+	bw.put(uint64(lengthSize-1), 2)
+	if c.PTLPresent {
+		numSublayers := max(c.NumSublayers, 1)
+		bitDepth := max(c.BitDepth, 8)
+		p := &c.PTL
+		bw.put(1, 1)
+		bw.put(uint64(c.OlsIdx), 9)
+		bw.put(uint64(numSublayers), 3)
+		bw.put(uint64(c.ConstantFrameRate), 2)
+		bw.put(uint64(c.ChromaFormat), 2)
+		bw.put(uint64(bitDepth-8), 3)
+		bw.put(0x1f, 5)
+
+		bw.put(0, 2)
+		bw.put(uint64(len(p.ConstraintInfo)), 6)
+		bw.put(uint64(p.ProfileIdc), 7)
+		if p.Tier {
+			bw.put(1, 1)
+		} else {
+			bw.put(0, 1)
+		}
+		bw.put(uint64(p.LevelIdc), 8)
+		for _, b := range p.ConstraintInfo {
+			bw.put(uint64(b), 8)
+		}
+		if numSublayers > 1 {
+			for i := int(numSublayers) - 2; i >= 0; i-- {
+				if i < len(p.SublayerLevelIdc) && p.SublayerLevelIdc[i] != 0 {
+					bw.put(1, 1)
+				} else {
+					bw.put(0, 1)
+				}
+			}
+			bw.put(0, 9-int(numSublayers))
+			for i := int(numSublayers) - 2; i >= 0; i-- {
+				if i < len(p.SublayerLevelIdc) && p.SublayerLevelIdc[i] != 0 {
+					bw.put(uint64(p.SublayerLevelIdc[i]), 8)
+				}
+			}
+		}
+		bw.put(uint64(len(p.SubProfileIdc)), 8)
+		for _, sp := range p.SubProfileIdc {
+			bw.put(uint64(sp), 32)
+		}
+
+		bw.put(uint64(c.MaxPictureWidth), 16)
+		bw.put(uint64(c.MaxPictureHeight), 16)
+		bw.put(uint64(c.AvgFrameRate), 16)
+	} else {
+		bw.put(0, 1)
+	}
+
+	w.StartFullBox(TypeVvcC, 0, 0)
+	w.putBytes(bw.bytes())
+	w.putUint8(uint8(len(c.Arrays)))
+	for _, a := range c.Arrays {
+		b := a.NALUnitType & 0x1f
+		if a.Completeness {
+			b |= 0x80
+		}
+		w.putUint8(b)
+		if a.NALUnitType != VVCNALDCI && a.NALUnitType != VVCNALOPI {
+			w.putUint16(uint16(len(a.NALUnits)))
+		}
+		for _, n := range a.NALUnits {
+			w.putUint16(uint16(len(n)))
+			w.putBytes(n)
+		}
+	}
+	w.EndBox()
+}
@@ -0,0 +1,53 @@
+package mp4_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tetsuo/mp4"
+)
+
+func TestVvcCRoundTrip(t *testing.T) {
+	c := mp4.VVCConfig{
+		NALLengthSize:     4,
+		PTLPresent:        true,
+		NumSublayers:      2,
+		ConstantFrameRate: 1,
+		ChromaFormat:      1,
+		BitDepth:          10,
+		PTL: mp4.VVCPTLRecord{
+			ProfileIdc:       1,
+			LevelIdc:         51,
+			ConstraintInfo:   []byte{0x84, 0x00},
+			SublayerLevelIdc: []uint8{48},
+			SubProfileIdc:    []uint32{0x12345678},
+		},
+		MaxPictureWidth:  3840,
+		MaxPictureHeight: 2160,
+		AvgFrameRate:     50 * 256,
+		Arrays: []mp4.HEVCNALArray{
+			{Completeness: true, NALUnitType: mp4.VVCNALSPS, NALUnits: [][]byte{{0x00, 0x79, 0x01, 0x02}}},
+			{Completeness: true, NALUnitType: mp4.VVCNALPPS, NALUnits: [][]byte{{0x00, 0x81, 0x03}}},
+		},
+	}
+	r := writeBox(t, func(w *mp4.Writer) { w.WriteVvcC(c) })
+	if r.Type() != mp4.TypeVvcC {
+		t.Fatalf("type = %v, want vvcC", r.Type())
+	}
+	got, err := mp4.ReadVVCConfig(r.Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, c) {
+		t.Errorf("got %+v, want %+v", got, c)
+	}
+	if s := got.Codec(); s != "1.L51.CQQ.S12345678" {
+		t.Errorf("codec = %q, want 1.L51.CQQ.S12345678", s)
+	}
+	if !got.PTL.FrameOnlyConstraint() || got.PTL.MultiLayerEnabled() {
+		t.Error("constraint flags not decoded")
+	}
+	if n := got.NALUnits(mp4.VVCNALPPS); len(n) != 1 {
+		t.Errorf("got %d PPS NAL units, want 1", len(n))
+	}
+}
@@ -1,6 +1,9 @@
 package mp4
 
-import "errors"
+import (
+	"errors"
+	"math"
+)
 
 // writerFrame tracks the start offset of a box for size backpatching.
 type writerFrame struct {
@@ -185,6 +188,13 @@ func (w *Writer) WriteMvhd(timescale uint32, duration uint64, nextTrackId uint32
 
 // WriteTkhd writes a complete tkhd box.
 func (w *Writer) WriteTkhd(flags uint32, trackId uint32, duration uint64, width, height uint32) {
+	w.WriteTkhdAlternateGroup(flags, trackId, duration, width, height, 0)
+}
+
+// WriteTkhdAlternateGroup writes a complete tkhd box placing the track in
+// an alternate group. Tracks sharing a non-zero alternate group are
+// alternatives to each other, such as audio in different languages.
+func (w *Writer) WriteTkhdAlternateGroup(flags uint32, trackId uint32, duration uint64, width, height uint32, alternateGroup int16) {
 	if duration > uint32Max {
 		w.StartFullBox(TypeTkhd, 1, flags)
 		w.putUint64(0) // creation time
@@ -200,11 +210,11 @@ func (w *Writer) WriteTkhd(flags uint32, trackId uint32, duration uint64, width,
 		w.putUint32(0) // reserved
 		w.putUint32(uint32(duration))
 	}
-	w.putZeros(8)  // reserved
-	w.putUint16(0) // layer
-	w.putUint16(0) // alternate group
-	w.putUint16(0) // volume
-	w.putUint16(0) // reserved
+	w.putZeros(8)                       // reserved
+	w.putUint16(0)                      // layer
+	w.putUint16(uint16(alternateGroup)) // alternate group
+	w.putUint16(0)                      // volume
+	w.putUint16(0)                      // reserved
 	// Identity matrix
 	w.putUint32(0x00010000)
 	w.putZeros(4)
@@ -488,6 +498,31 @@ func (w *Writer) WriteAudioSampleEntry(dataRefIdx, channelCount, sampleSize uint
 	w.putUint32(sampleRate)   // sample rate (16.16 fixed point)
 }
 
+// WriteAudioSampleEntryV2 writes the 64-byte QuickTime version 2 sound
+// sample description header, as used by lpcm entries. The caller must start
+// the box and end it after writing children.
+func (w *Writer) WriteAudioSampleEntryV2(dataRefIdx uint16, channelCount uint32, sampleRate float64,
+	bitsPerChannel, formatFlags, bytesPerPacket, framesPerPacket uint32) {
+	w.putZeros(6)           // reserved
+	w.putUint16(dataRefIdx) // data reference index
+	w.putUint16(2)          // version
+	w.putUint16(0)          // revision level
+	w.putUint32(0)          // vendor
+	w.putUint16(3)          // always 3
+	w.putUint16(16)         // always 16
+	w.putUint16(0xfffe)     // always -2
+	w.putUint16(0)          // always 0
+	w.putUint32(0x00010000) // always 65536
+	w.putUint32(72)         // size of struct only
+	w.putUint64(math.Float64bits(sampleRate))
+	w.putUint32(channelCount) // channel count
+	w.putUint32(0x7f000000)   // always 0x7F000000
+	w.putUint32(bitsPerChannel)
+	w.putUint32(formatFlags)
+	w.putUint32(bytesPerPacket)
+	w.putUint32(framesPerPacket)
+}
+
 // WriteStyp writes a segment type box (same format as ftyp).
 func (w *Writer) WriteStyp(brand [4]byte, brandVersion uint32, compat [][4]byte) {
 	w.StartBox(TypeStyp)